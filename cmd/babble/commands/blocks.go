@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+	"github.com/spf13/cobra"
+)
+
+//blocksConfig contains the options of the blocks commands
+type blocksConfig struct {
+	Format string
+	From   int
+	To     int
+	Output string
+	Input  string
+}
+
+var blocksConf = blocksConfig{
+	Format: hg.BlockLogJSON,
+	From:   0,
+	To:     -1,
+}
+
+//NewBlocksCmd returns the command that exports and imports the Blocks of the
+//database of a node
+func NewBlocksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "blocks",
+		Short: "Export or import the Blocks of a node",
+	}
+
+	cmd.AddCommand(
+		newBlocksExportCmd(),
+		newBlocksImportCmd())
+
+	return cmd
+}
+
+//newBlocksExportCmd returns the command that writes the signed Blocks of the
+//database of a data directory, with their PeerSets, to a block log. The node
+//must not be running.
+func newBlocksExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "export",
+		Short:   "Export signed Blocks to a file",
+		PreRunE: loadConfig,
+		RunE:    exportBlocks,
+	}
+	addStoreFlags(cmd)
+
+	cmd.Flags().StringVar(&blocksConf.Format, "format", blocksConf.Format, "Output format: json (newline-delimited) or binary (length-prefixed)")
+	cmd.Flags().IntVar(&blocksConf.From, "from", blocksConf.From, "Index of the first Block to export")
+	cmd.Flags().IntVar(&blocksConf.To, "to", blocksConf.To, "Index of the last Block to export (-1 means the last Block)")
+	cmd.Flags().StringVarP(&blocksConf.Output, "out", "o", blocksConf.Output, "Output file (default stdout)")
+
+	return cmd
+}
+
+//newBlocksImportCmd returns the command that verifies the Blocks of a block log
+//and saves them in the database of a data directory. The Blocks are verified
+//against the PeerSets of the database or, if it has none, the peers.json file
+//of the data directory. The node must not be running.
+func newBlocksImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "import",
+		Short:   "Verify and import signed Blocks from a file",
+		PreRunE: loadConfig,
+		RunE:    importBlocks,
+	}
+	addStoreFlags(cmd)
+
+	cmd.Flags().StringVarP(&blocksConf.Input, "in", "i", blocksConf.Input, "Input file, in either format (default stdin)")
+
+	return cmd
+}
+
+//addStoreFlags adds the flags that locate the database, select its type, and
+//decrypt it
+func addStoreFlags(cmd *cobra.Command) {
+	addDbFlags(cmd)
+	addEncryptionFlags(cmd)
+	cmd.Flags().String("store-type", config.Babble.StoreType, "Type of the database: badger or file")
+}
+
+//openStore opens the database of the data directory without bootstrapping it.
+//With create false, it returns an error if the database does not exist.
+func openStore(create bool) (hg.Store, error) {
+	var path string
+	switch config.Babble.StoreType {
+	case "badger":
+		path = config.Babble.BadgerDir()
+	case "file":
+		path = config.Babble.FileStoreDir()
+	default:
+		return nil, fmt.Errorf("Unknown store type %s", config.Babble.StoreType)
+	}
+
+	if !create {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	keys, err := config.Babble.LoadEncryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Babble.StoreType == "file" {
+		if keys != nil {
+			return nil, fmt.Errorf("Encryption at rest requires the badger store")
+		}
+		return hg.NewFileStore(config.Babble.NodeConfig.CacheSize, path)
+	}
+	return hg.NewEncryptedBadgerStore(config.Babble.NodeConfig.CacheSize, path, keys)
+}
+
+/*******************************************************************************
+* EXPORT
+*******************************************************************************/
+
+func exportBlocks(cmd *cobra.Command, args []string) error {
+	store, err := openStore(false)
+	if err != nil {
+		config.Babble.Logger.Error("Cannot open database:", err)
+		return err
+	}
+	defer store.Close()
+
+	var out io.Writer = os.Stdout
+	if blocksConf.Output != "" {
+		f, err := os.Create(blocksConf.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	count, err := hg.ExportBlocks(store, out, blocksConf.Format, blocksConf.From, blocksConf.To)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d Blocks\n", count)
+
+	return nil
+}
+
+/*******************************************************************************
+* IMPORT
+*******************************************************************************/
+
+func importBlocks(cmd *cobra.Command, args []string) error {
+	var in io.Reader = os.Stdin
+	if blocksConf.Input != "" {
+		f, err := os.Open(blocksConf.Input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	store, err := openStore(true)
+	if err != nil {
+		config.Babble.Logger.Error("Cannot open database:", err)
+		return err
+	}
+	defer store.Close()
+
+	//The genesis PeerSet is only needed when the database has no PeerSet
+	genesisPeerSet, err := peers.NewJSONPeerSet(config.Babble.DataDir).PeerSet()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	h := hg.NewHashgraph(store, nil, config.Babble.Logger.WithField("component", "blocks"))
+
+	count, err := h.ImportBlocks(in, genesisPeerSet)
+	if err != nil {
+		return fmt.Errorf("Imported %d Blocks before error: %v", count, err)
+	}
+
+	fmt.Printf("Imported %d Blocks\n", count)
+
+	return nil
+}
@@ -12,10 +12,15 @@ type CLIConfig struct {
 
 //NewDefaultCLIConfig creates a CLIConfig with default values
 func NewDefaultCLIConfig() *CLIConfig {
-	return &CLIConfig{
+	config := &CLIConfig{
 		Babble:     *babble.NewDefaultConfig(),
 		ProxyAddr:  "127.0.0.1:1338",
 		ClientAddr: "127.0.0.1:1339",
 		Standalone: false,
 	}
+
+	//The leave command relies on the admin socket
+	config.Babble.Admin = true
+
+	return config
 }
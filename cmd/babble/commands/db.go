@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/mosaicnetworks/babble/src/babble"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/spf13/cobra"
+)
+
+//NewDbCmd returns the command that maintains the database of a Babble node
+func NewDbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Maintain the database of a node",
+	}
+
+	cmd.AddCommand(
+		newDbVerifyCmd(),
+		newDbRekeyCmd())
+
+	return cmd
+}
+
+//newDbVerifyCmd returns the command that checks the integrity of the BadgerDB
+//of a data directory, which it opens read-only. The node must not be running.
+func newDbVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "verify",
+		Short:   "Check the database for corruption",
+		PreRunE: loadConfig,
+		RunE:    verifyDb,
+	}
+	addDbFlags(cmd)
+	addEncryptionFlags(cmd)
+	return cmd
+}
+
+//newDbRekeyCmd returns the command that encrypts the BadgerDB of a data
+//directory with the first of its encryption keys, to encrypt a database for the
+//first time, or to finish a key rotation. The node must not be running.
+func newDbRekeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rekey",
+		Short:   "Encrypt the database with the first encryption key",
+		PreRunE: loadConfig,
+		RunE:    rekeyDb,
+	}
+	addDbFlags(cmd)
+	addEncryptionFlags(cmd)
+	return cmd
+}
+
+//addDbFlags adds the flags that locate the database
+func addDbFlags(cmd *cobra.Command) {
+	cmd.Flags().String("datadir", config.Babble.DataDir, "Top-level directory for configuration and data")
+	cmd.Flags().String("log", config.Babble.LogLevel, "debug, info, warn, error, fatal, panic")
+}
+
+//addEncryptionFlags adds the flag that locates the encryption keys of the
+//database
+func addEncryptionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("encryption-key-file", config.Babble.EncryptionKeyFile, "File of hex-encoded encryption keys, current key first (default $"+babble.EncryptionKeyEnv+")")
+}
+
+/*******************************************************************************
+* VERIFY
+*******************************************************************************/
+
+func verifyDb(cmd *cobra.Command, args []string) error {
+	path := config.Babble.BadgerDir()
+
+	keys, err := config.Babble.LoadEncryptionKeys()
+	if err != nil {
+		return err
+	}
+
+	report, err := hg.VerifyBadgerStore(path, keys)
+	if err != nil {
+		config.Babble.Logger.Error("Cannot verify database:", err)
+		return err
+	}
+
+	fmt.Printf("Database:       %s\n", path)
+	fmt.Printf("Schema version: %d\n", report.SchemaVersion)
+	fmt.Printf("Events:         %d\n", report.Events)
+	fmt.Printf("Blocks:         %d (%d without enough signatures)\n", report.Blocks, report.Unsigned)
+	fmt.Printf("Frames:         %d (%d pruned)\n", report.Frames, report.PrunedFrames)
+
+	if report.OK() {
+		fmt.Println("No corruption found")
+		return nil
+	}
+
+	fmt.Printf("%d problems:\n", len(report.Problems))
+	for _, p := range report.Problems {
+		fmt.Printf("  %s\n", p)
+	}
+
+	return fmt.Errorf("Database %s is corrupted", path)
+}
+
+/*******************************************************************************
+* REKEY
+*******************************************************************************/
+
+func rekeyDb(cmd *cobra.Command, args []string) error {
+	path := config.Babble.BadgerDir()
+
+	keys, err := config.Babble.LoadEncryptionKeys()
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return fmt.Errorf("No encryption key. Use --encryption-key-file or %s", babble.EncryptionKeyEnv)
+	}
+
+	count, err := hg.RekeyBadgerStore(path, keys)
+	if err != nil {
+		config.Babble.Logger.Error("Cannot rekey database:", err)
+		return fmt.Errorf("Encrypted %d values before error: %v", count, err)
+	}
+
+	fmt.Printf("Encrypted %d values of database %s with the first encryption key\n", count, path)
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/node"
+	"github.com/spf13/cobra"
+)
+
+//graphConfig contains the options of the graph commands
+type graphConfig struct {
+	ServiceAddr string
+	Format      string
+	From        int
+	To          int
+	Output      string
+}
+
+var graphConf = graphConfig{
+	ServiceAddr: "127.0.0.1:80",
+	Format:      "dot",
+	From:        0,
+	To:          -1,
+}
+
+//NewGraphCmd returns the command that inspects the hashgraph of a running node
+func NewGraphCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Inspect the hashgraph of a running node",
+	}
+
+	cmd.AddCommand(newGraphExportCmd())
+
+	return cmd
+}
+
+//newGraphExportCmd returns the command that downloads the hashgraph from the
+//HTTP service of a node, and writes it in Graphviz DOT format, or as a
+//standalone JSON dump
+func newGraphExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the hashgraph to Graphviz DOT or JSON",
+		RunE:  exportGraph,
+	}
+
+	cmd.Flags().StringVar(&graphConf.ServiceAddr, "service-addr", graphConf.ServiceAddr, "IP:Port of the node's HTTP service")
+	cmd.Flags().StringVar(&graphConf.Format, "format", graphConf.Format, "Output format: dot or json")
+	cmd.Flags().IntVar(&graphConf.From, "from", graphConf.From, "First round to export")
+	cmd.Flags().IntVar(&graphConf.To, "to", graphConf.To, "Last round to export (-1 means the last known round)")
+	cmd.Flags().StringVarP(&graphConf.Output, "output", "o", graphConf.Output, "Output file (default stdout)")
+
+	return cmd
+}
+
+/*******************************************************************************
+* EXPORT
+*******************************************************************************/
+
+func exportGraph(cmd *cobra.Command, args []string) error {
+	if graphConf.Format != "dot" && graphConf.Format != "json" {
+		return fmt.Errorf("Unknown format %s", graphConf.Format)
+	}
+
+	infos, err := fetchGraph(graphConf.ServiceAddr)
+	if err != nil {
+		return err
+	}
+
+	infos = infos.FilterRounds(graphConf.From, graphConf.To)
+
+	var out io.Writer = os.Stdout
+	if graphConf.Output != "" {
+		f, err := os.Create(graphConf.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if graphConf.Format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+
+	return infos.WriteDot(out)
+}
+
+//fetchGraph reads the hashgraph from the /graph endpoint of a node
+func fetchGraph(serviceAddr string) (node.Infos, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Get(fmt.Sprintf("http://%s/graph", serviceAddr))
+	if err != nil {
+		return node.Infos{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return node.Infos{}, fmt.Errorf("Error fetching graph: %s", resp.Status)
+	}
+
+	var infos node.Infos
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return node.Infos{}, err
+	}
+
+	return infos, nil
+}
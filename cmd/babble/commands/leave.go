@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+//NewLeaveCmd returns the command that makes a running Babble node leave the
+//network gracefully. It calls /leave on the admin socket of the node, in the
+//same datadir, which submits a leave request and shuts the node down once the
+//request has gone through consensus and the new PeerSet, without this node,
+//has taken effect.
+func NewLeaveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "leave",
+		Short:   "Make a running node leave the network",
+		PreRunE: loadConfig,
+		RunE:    leaveBabble,
+	}
+
+	cmd.Flags().String("datadir", config.Babble.DataDir, "Top-level directory for configuration and data of the running node")
+	cmd.Flags().String("log", config.Babble.LogLevel, "debug, info, warn, error, fatal, panic")
+
+	return cmd
+}
+
+/*******************************************************************************
+* LEAVE
+*******************************************************************************/
+
+func leaveBabble(cmd *cobra.Command, args []string) error {
+	socket := config.Babble.AdminSocket()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+		//No timeout, the node gives up on its own after its join-timeout
+	}
+
+	//The host is ignored, the request goes to the socket
+	resp, err := client.Post("http://babble/leave", "", nil)
+	if err != nil {
+		return fmt.Errorf("Error leaving: cannot reach the admin socket of the node: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Error leaving: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
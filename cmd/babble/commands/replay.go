@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/mosaicnetworks/babble/src/node"
+	aproxy "github.com/mosaicnetworks/babble/src/proxy/socket/app"
+	"github.com/spf13/cobra"
+)
+
+var replayFrom = 0
+
+//NewReplayCmd returns the command that rebuilds the state of an application
+//from the committed Blocks of the database of a node, without gossiping. The
+//node must not be running.
+func NewReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "replay",
+		Short:   "Replay committed Blocks into the application",
+		PreRunE: loadConfig,
+		RunE:    replayBlocks,
+	}
+	addStoreFlags(cmd)
+
+	cmd.Flags().StringP("proxy-listen", "p", config.ProxyAddr, "Listen IP:Port for babble proxy")
+	cmd.Flags().StringP("client-connect", "c", config.ClientAddr, "IP:Port to connect to client")
+	cmd.Flags().Duration("heartbeat", config.Babble.NodeConfig.HeartbeatTimeout, "Timeout of the calls to the client")
+	cmd.Flags().IntVar(&replayFrom, "from", replayFrom, "Index of the first Block to replay")
+
+	return cmd
+}
+
+/*******************************************************************************
+* REPLAY
+*******************************************************************************/
+
+func replayBlocks(cmd *cobra.Command, args []string) error {
+	store, err := openStore(false)
+	if err != nil {
+		config.Babble.Logger.Error("Cannot open database:", err)
+		return err
+	}
+	defer store.Close()
+
+	p, err := aproxy.NewSocketAppProxy(
+		config.ClientAddr,
+		config.ProxyAddr,
+		config.Babble.NodeConfig.HeartbeatTimeout,
+		config.Babble.Logger,
+	)
+	if err != nil {
+		config.Babble.Logger.Error("Cannot initialize socket AppProxy:", err)
+		return err
+	}
+
+	count, err := node.ReplayBlocks(store, p, replayFrom, config.Babble.Logger.WithField("component", "replay"))
+	if err != nil {
+		return fmt.Errorf("Replayed %d Blocks before error: %v", count, err)
+	}
+
+	fmt.Printf("Replayed %d Blocks from Block %d\n", count, replayFrom)
+
+	return nil
+}
@@ -26,6 +26,19 @@ func NewRunCmd() *cobra.Command {
 *******************************************************************************/
 
 func runBabble(cmd *cobra.Command, args []string) error {
+	engine, err := initEngine()
+	if err != nil {
+		return err
+	}
+
+	engine.Run()
+
+	return nil
+}
+
+//initEngine creates the AppProxy and initializes a Babble engine from the
+//configuration
+func initEngine() (*babble.Babble, error) {
 	if !config.Standalone {
 		p, err := aproxy.NewSocketAppProxy(
 			config.ClientAddr,
@@ -36,7 +49,7 @@ func runBabble(cmd *cobra.Command, args []string) error {
 
 		if err != nil {
 			config.Babble.Logger.Error("Cannot initialize socket AppProxy:", err)
-			return err
+			return nil, err
 		}
 
 		config.Babble.Proxy = p
@@ -50,12 +63,10 @@ func runBabble(cmd *cobra.Command, args []string) error {
 
 	if err := engine.Init(); err != nil {
 		config.Babble.Logger.Error("Cannot initialize engine:", err)
-		return err
+		return nil, err
 	}
 
-	engine.Run()
-
-	return nil
+	return engine, nil
 }
 
 /*******************************************************************************
@@ -72,6 +83,8 @@ func AddRunFlags(cmd *cobra.Command) {
 	cmd.Flags().StringP("listen", "l", config.Babble.BindAddr, "Listen IP:Port for babble node")
 	cmd.Flags().DurationP("timeout", "t", config.Babble.NodeConfig.TCPTimeout, "TCP Timeout")
 	cmd.Flags().Int("max-pool", config.Babble.MaxPool, "Connection pool size max")
+	cmd.Flags().Bool("tls", config.Babble.TLS, "Authenticate peers with TLS certificates derived from their keys")
+	cmd.Flags().String("wire-codec", config.Babble.WireCodec, "Encoding of gossip: json or msgpack")
 
 	// Proxy
 	cmd.Flags().Bool("standalone", config.Standalone, "Do not create a proxy")
@@ -80,14 +93,24 @@ func AddRunFlags(cmd *cobra.Command) {
 
 	// Service
 	cmd.Flags().StringP("service-listen", "s", config.Babble.ServiceAddr, "Listen IP:Port for HTTP service")
+	cmd.Flags().Bool("admin", config.Babble.Admin, "Serve admin requests, like leave, on a Unix socket in the datadir")
 
 	// Store
-	cmd.Flags().Bool("store", config.Babble.Store, "Use badgerDB instead of in-mem DB")
+	cmd.Flags().Bool("store", config.Babble.Store, "Use a persistent store instead of in-mem DB")
+	cmd.Flags().String("store-type", config.Babble.StoreType, "Type of persistent store: badger or file")
+	cmd.Flags().String("encryption-key-file", config.Babble.EncryptionKeyFile, "File of hex-encoded keys that encrypt the badger store (default $"+babble.EncryptionKeyEnv+")")
 	cmd.Flags().Int("cache-size", config.Babble.NodeConfig.CacheSize, "Number of items in LRU caches")
+	cmd.Flags().Int("retain-rounds", config.Babble.NodeConfig.RetainRounds, "Number of rounds to keep below the AnchorBlock (0 disables pruning)")
 
 	// Node configuration
 	cmd.Flags().Duration("heartbeat", config.Babble.NodeConfig.HeartbeatTimeout, "Time between gossips")
 	cmd.Flags().Int("sync-limit", config.Babble.NodeConfig.SyncLimit, "Max number of events for sync")
+	cmd.Flags().Duration("join-timeout", config.Babble.NodeConfig.JoinTimeout, "Max time to wait for a join or leave request to be accepted")
+	cmd.Flags().Int("max-block-txs", config.Babble.NodeConfig.MaxBlockTransactions, "Max number of transactions per block (0 means no limit)")
+	cmd.Flags().Int("max-block-bytes", config.Babble.NodeConfig.MaxBlockBytes, "Max size of the transactions of a block, in bytes (0 means no limit)")
+	cmd.Flags().Int("max-tx-bytes", config.Babble.NodeConfig.MaxTxBytes, "Max size of a transaction, in bytes (0 means no limit)")
+	cmd.Flags().Int("tx-pool-size", config.Babble.NodeConfig.TxPoolSize, "Max number of transactions waiting to be gossiped (0 means no limit)")
+	cmd.Flags().Int("tx-pool-bytes", config.Babble.NodeConfig.TxPoolBytes, "Max size of the transactions waiting to be gossiped, in bytes (0 means no limit)")
 }
 
 func loadConfig(cmd *cobra.Command, args []string) error {
@@ -106,20 +129,32 @@ func loadConfig(cmd *cobra.Command, args []string) error {
 	config.Babble.NodeConfig.Logger = config.Babble.Logger
 
 	config.Babble.Logger.WithFields(logrus.Fields{
-		"babble.DataDir":               config.Babble.DataDir,
-		"babble.BindAddr":              config.Babble.BindAddr,
-		"babble.ServiceAddr":           config.Babble.ServiceAddr,
-		"babble.MaxPool":               config.Babble.MaxPool,
-		"babble.Store":                 config.Babble.Store,
-		"babble.LoadPeers":             config.Babble.LoadPeers,
-		"babble.LogLevel":              config.Babble.LogLevel,
-		"babble.Node.HeartbeatTimeout": config.Babble.NodeConfig.HeartbeatTimeout,
-		"babble.Node.TCPTimeout":       config.Babble.NodeConfig.TCPTimeout,
-		"babble.Node.CacheSize":        config.Babble.NodeConfig.CacheSize,
-		"babble.Node.SyncLimit":        config.Babble.NodeConfig.SyncLimit,
-		"ProxyAddr":                    config.ProxyAddr,
-		"ClientAddr":                   config.ClientAddr,
-		"Standalone":                   config.Standalone,
+		"babble.DataDir":                   config.Babble.DataDir,
+		"babble.BindAddr":                  config.Babble.BindAddr,
+		"babble.ServiceAddr":               config.Babble.ServiceAddr,
+		"babble.Admin":                     config.Babble.Admin,
+		"babble.MaxPool":                   config.Babble.MaxPool,
+		"babble.TLS":                       config.Babble.TLS,
+		"babble.WireCodec":                 config.Babble.WireCodec,
+		"babble.Store":                     config.Babble.Store,
+		"babble.StoreType":                 config.Babble.StoreType,
+		"babble.EncryptionKeyFile":         config.Babble.EncryptionKeyFile,
+		"babble.LoadPeers":                 config.Babble.LoadPeers,
+		"babble.LogLevel":                  config.Babble.LogLevel,
+		"babble.Node.HeartbeatTimeout":     config.Babble.NodeConfig.HeartbeatTimeout,
+		"babble.Node.TCPTimeout":           config.Babble.NodeConfig.TCPTimeout,
+		"babble.Node.CacheSize":            config.Babble.NodeConfig.CacheSize,
+		"babble.Node.SyncLimit":            config.Babble.NodeConfig.SyncLimit,
+		"babble.Node.JoinTimeout":          config.Babble.NodeConfig.JoinTimeout,
+		"babble.Node.RetainRounds":         config.Babble.NodeConfig.RetainRounds,
+		"babble.Node.MaxBlockTransactions": config.Babble.NodeConfig.MaxBlockTransactions,
+		"babble.Node.MaxBlockBytes":        config.Babble.NodeConfig.MaxBlockBytes,
+		"babble.Node.MaxTxBytes":           config.Babble.NodeConfig.MaxTxBytes,
+		"babble.Node.TxPoolSize":           config.Babble.NodeConfig.TxPoolSize,
+		"babble.Node.TxPoolBytes":          config.Babble.NodeConfig.TxPoolBytes,
+		"ProxyAddr":                        config.ProxyAddr,
+		"ClientAddr":                       config.ClientAddr,
+		"Standalone":                       config.Standalone,
 	}).Debug("RUN")
 
 	return nil
@@ -13,7 +13,12 @@ func main() {
 	rootCmd.AddCommand(
 		cmd.VersionCmd,
 		cmd.NewKeygenCmd(),
-		cmd.NewRunCmd())
+		cmd.NewRunCmd(),
+		cmd.NewLeaveCmd(),
+		cmd.NewGraphCmd(),
+		cmd.NewDbCmd(),
+		cmd.NewBlocksCmd(),
+		cmd.NewReplayCmd())
 
 	//Do not print usage when error occurs
 	rootCmd.SilenceUsage = true
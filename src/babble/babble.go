@@ -3,6 +3,7 @@ package babble
 import (
 	"crypto/ecdsa"
 	"fmt"
+	"sync"
 
 	"github.com/mosaicnetworks/babble/src/common"
 	"github.com/mosaicnetworks/babble/src/crypto"
@@ -21,6 +22,11 @@ type Babble struct {
 	Store     h.Store
 	Peers     *peers.PeerSet
 	Service   *service.Service
+	Admin     *service.AdminService
+
+	//nodeLock guards Node against the TLS handshakes, which call isPeer from
+	//other goroutines as soon as the Transport is listening
+	nodeLock sync.RWMutex
 }
 
 func NewBabble(config *BabbleConfig) *Babble {
@@ -32,23 +38,59 @@ func NewBabble(config *BabbleConfig) *Babble {
 }
 
 func (b *Babble) initTransport() error {
-	transport, err := net.NewTCPTransport(
-		b.Config.BindAddr,
-		nil,
-		b.Config.MaxPool,
-		b.Config.NodeConfig.TCPTimeout,
-		b.Config.Logger,
-	)
+	codec, err := net.CodecByName(b.Config.WireCodec)
+	if err != nil {
+		return err
+	}
+
+	var transport *net.NetworkTransport
+
+	if b.Config.TLS {
+		transport, err = net.NewTLSTransport(
+			b.Config.BindAddr,
+			nil,
+			b.Config.MaxPool,
+			b.Config.NodeConfig.TCPTimeout,
+			b.Config.Key,
+			b.isPeer,
+			b.Config.Logger,
+		)
+	} else {
+		transport, err = net.NewTCPTransport(
+			b.Config.BindAddr,
+			nil,
+			b.Config.MaxPool,
+			b.Config.NodeConfig.TCPTimeout,
+			b.Config.Logger,
+		)
+	}
 
 	if err != nil {
 		return err
 	}
 
+	transport.SetCodec(codec)
+
 	b.Transport = transport
 
 	return nil
 }
 
+//isPeer is the PeerVerifier of the TLS transport. It checks the peers of the
+//node, or the initial peers until the node is initialized.
+func (b *Babble) isPeer(pubKeyHex string, netAddr string) bool {
+	b.nodeLock.RLock()
+	n := b.Node
+	b.nodeLock.RUnlock()
+
+	if n != nil {
+		return n.HasPeer(pubKeyHex, netAddr)
+	}
+
+	peer, ok := b.Peers.ByPubKey[pubKeyHex]
+	return ok && (netAddr == "" || peer.NetAddr == netAddr)
+}
+
 func (b *Babble) initPeers() error {
 	if !b.Config.LoadPeers {
 		if b.Peers == nil {
@@ -77,20 +119,39 @@ func (b *Babble) initStore() error {
 
 		b.Config.Logger.Debug("created new in-mem store")
 	} else {
-		var err error
+		keys, err := b.Config.LoadEncryptionKeys()
+		if err != nil {
+			return err
+		}
 
-		b.Config.Logger.WithField("path", b.Config.BadgerDir()).Debug("Attempting to load or create database")
+		switch b.Config.StoreType {
+		case "badger":
+			b.Config.Logger.WithFields(logrus.Fields{
+				"path":      b.Config.BadgerDir(),
+				"encrypted": keys != nil,
+			}).Debug("Attempting to load or create database")
+
+			b.Store, err = h.NewEncryptedBadgerStore(b.Config.NodeConfig.CacheSize, b.Config.BadgerDir(), keys)
+		case "file":
+			if keys != nil {
+				return fmt.Errorf("Encryption at rest requires the badger store")
+			}
 
-		b.Store, err = h.NewBadgerStore(b.Config.NodeConfig.CacheSize, b.Config.BadgerDir())
+			b.Config.Logger.WithField("path", b.Config.FileStoreDir()).Debug("Attempting to load or create file store")
+
+			b.Store, err = h.NewFileStore(b.Config.NodeConfig.CacheSize, b.Config.FileStoreDir())
+		default:
+			err = fmt.Errorf("Unknown store type %s", b.Config.StoreType)
+		}
 
 		if err != nil {
 			return err
 		}
 
 		if b.Store.NeedBoostrap() {
-			b.Config.Logger.Debug("loaded badger store from existing database")
+			b.Config.Logger.Debugf("loaded %s store from existing database", b.Config.StoreType)
 		} else {
-			b.Config.Logger.Debug("created new badger store from fresh database")
+			b.Config.Logger.Debugf("created new %s store from fresh database", b.Config.StoreType)
 		}
 	}
 
@@ -134,7 +195,7 @@ func (b *Babble) initNode() error {
 		"id":           id,
 	}).Debug("PARTICIPANTS")
 
-	b.Node = node.NewNode(
+	n := node.NewNode(
 		&b.Config.NodeConfig,
 		id,
 		key,
@@ -144,10 +205,14 @@ func (b *Babble) initNode() error {
 		b.Config.Proxy,
 	)
 
-	if err := b.Node.Init(); err != nil {
+	if err := n.Init(); err != nil {
 		return fmt.Errorf("failed to initialize node: %s", err)
 	}
 
+	b.nodeLock.Lock()
+	b.Node = n
+	b.nodeLock.Unlock()
+
 	return nil
 }
 
@@ -155,6 +220,15 @@ func (b *Babble) initService() error {
 	if b.Config.ServiceAddr != "" {
 		b.Service = service.NewService(b.Config.ServiceAddr, b.Node, b.Config.Logger)
 	}
+
+	if b.Config.Admin {
+		b.Admin = service.NewAdminService(b.Config.AdminSocket(), b.Node, b.Config.Logger)
+
+		if err := b.Admin.Listen(); err != nil {
+			return fmt.Errorf("failed to create admin socket: %s", err)
+		}
+	}
+
 	return nil
 }
 
@@ -171,11 +245,11 @@ func (b *Babble) Init() error {
 		return err
 	}
 
-	if err := b.initTransport(); err != nil {
+	if err := b.initKey(); err != nil {
 		return err
 	}
 
-	if err := b.initKey(); err != nil {
+	if err := b.initTransport(); err != nil {
 		return err
 	}
 
@@ -195,7 +269,19 @@ func (b *Babble) Run() {
 		go b.Service.Serve()
 	}
 
+	if b.Admin != nil {
+		go b.Admin.Serve()
+	}
+
 	b.Node.Run(true)
+
+	if b.Service != nil {
+		b.Service.Shutdown()
+	}
+
+	if b.Admin != nil {
+		b.Admin.Shutdown()
+	}
 }
 
 func Keygen(datadir string) (*ecdsa.PrivateKey, error) {
@@ -2,16 +2,22 @@ package babble
 
 import (
 	"crypto/ecdsa"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 
+	h "github.com/mosaicnetworks/babble/src/hashgraph"
 	"github.com/mosaicnetworks/babble/src/node"
 	"github.com/mosaicnetworks/babble/src/proxy"
 	"github.com/sirupsen/logrus"
 )
 
+//EncryptionKeyEnv is the environment variable that holds the encryption keys of
+//the BadgerStore when no key file is configured
+const EncryptionKeyEnv = "BABBLE_ENCRYPTION_KEY"
+
 type BabbleConfig struct {
 	NodeConfig node.Config `mapstructure:",squash"`
 
@@ -20,12 +26,26 @@ type BabbleConfig struct {
 	ServiceAddr string `mapstructure:"service-listen"`
 	MaxPool     int    `mapstructure:"max-pool"`
 	Store       bool   `mapstructure:"store"`
+	StoreType   string `mapstructure:"store-type"`
 	LogLevel    string `mapstructure:"log"`
+	TLS         bool   `mapstructure:"tls"`
+	WireCodec   string `mapstructure:"wire-codec"`
+
+	//Admin enables the AdminService, on the AdminSocket, through which the
+	//babble leave command makes the node leave
+	Admin bool `mapstructure:"admin"`
+
+	EncryptionKeyFile string `mapstructure:"encryption-key-file"`
 
 	LoadPeers bool
 	Proxy     proxy.AppProxy
 	Key       *ecdsa.PrivateKey
 	Logger    *logrus.Logger
+
+	//EncryptionKeys encrypt the values of the BadgerStore. The first one seals
+	//new values, the others are previous keys. If nil, they are read from
+	//EncryptionKeyFile, or from the EncryptionKeyEnv environment variable.
+	EncryptionKeys [][]byte
 }
 
 func NewDefaultConfig() *BabbleConfig {
@@ -37,6 +57,8 @@ func NewDefaultConfig() *BabbleConfig {
 		MaxPool:    2,
 		NodeConfig: *node.DefaultConfig(),
 		Store:      false,
+		StoreType:  "badger",
+		WireCodec:  "json",
 		LoadPeers:  true,
 		Key:        nil,
 	}
@@ -50,6 +72,39 @@ func (c *BabbleConfig) BadgerDir() string {
 	return filepath.Join(c.DataDir, "badger_db")
 }
 
+func (c *BabbleConfig) FileStoreDir() string {
+	return filepath.Join(c.DataDir, "file_db")
+}
+
+//AdminSocket is the Unix socket of the AdminService. It is in a directory of
+//its own, which only the user running the node can access.
+func (c *BabbleConfig) AdminSocket() string {
+	return filepath.Join(c.DataDir, "admin", "babble.sock")
+}
+
+//LoadEncryptionKeys returns the EncryptionKeys, or reads them, hex-encoded,
+//from the key file or from the environment. It returns nil if the database is
+//not encrypted.
+func (c *BabbleConfig) LoadEncryptionKeys() ([][]byte, error) {
+	if c.EncryptionKeys != nil {
+		return c.EncryptionKeys, nil
+	}
+
+	if c.EncryptionKeyFile != "" {
+		data, err := ioutil.ReadFile(c.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return h.ParseEncryptionKeys(string(data))
+	}
+
+	if env := os.Getenv(EncryptionKeyEnv); env != "" {
+		return h.ParseEncryptionKeys(env)
+	}
+
+	return nil, nil
+}
+
 func DefaultDataDir() string {
 	// Try to place the data folder in the user's home dir
 	home := HomeDir()
@@ -89,6 +89,24 @@ func (r *RollingIndex) Set(item interface{}, index int) error {
 	return nil
 }
 
+//Prune removes all the items with an index lower or equal to the given index.
+//Subsequent requests for these items return a TooLate error.
+func (r *RollingIndex) Prune(index int) {
+	oldestCachedIndex := r.lastIndex - len(r.items) + 1
+	if index < oldestCachedIndex {
+		return
+	}
+
+	if index >= r.lastIndex {
+		r.items = make([]interface{}, 0, 2*r.size)
+		return
+	}
+
+	newList := make([]interface{}, 0, 2*r.size)
+	newList = append(newList, r.items[index-oldestCachedIndex+1:]...)
+	r.items = newList
+}
+
 func (r *RollingIndex) Roll() {
 	newList := make([]interface{}, 0, 2*r.size)
 	newList = append(newList, r.items[r.size:]...)
@@ -69,6 +69,16 @@ func (rim *RollingIndexMap) Set(key uint32, item interface{}, index int) error {
 	return items.Set(item, index)
 }
 
+//Prune removes the key items with index <= index
+func (rim *RollingIndexMap) Prune(key uint32, index int) error {
+	items, ok := rim.mapping[key]
+	if !ok {
+		return NewStoreErr(rim.name, KeyNotFound, fmt.Sprint(key))
+	}
+	items.Prune(index)
+	return nil
+}
+
 //returns [key] => lastKnownIndex
 func (rim *RollingIndexMap) Known() map[uint32]int {
 	known := make(map[uint32]int)
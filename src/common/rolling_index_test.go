@@ -142,3 +142,54 @@ func TestRollingIndexSkip(t *testing.T) {
 	}
 
 }
+
+func TestRollingIndexPrune(t *testing.T) {
+	size := 10
+	testSize := 15
+	RollingIndex := NewRollingIndex("test", size)
+
+	items := []string{}
+	for i := 0; i < testSize; i++ {
+		item := fmt.Sprintf("item%d", i)
+		RollingIndex.Set(item, i)
+		items = append(items, item)
+	}
+
+	pruneIndex := 7
+	RollingIndex.Prune(pruneIndex)
+
+	if _, err := RollingIndex.GetItem(pruneIndex); err == nil || !Is(err, TooLate) {
+		t.Fatalf("GetItem(%d) should return ErrTooLate", pruneIndex)
+	}
+
+	if _, err := RollingIndex.Get(pruneIndex - 1); err == nil || !Is(err, TooLate) {
+		t.Fatalf("Get(%d) should return ErrTooLate", pruneIndex-1)
+	}
+
+	cached, err := RollingIndex.Get(pruneIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != testSize-pruneIndex-1 {
+		t.Fatalf("Get(%d) should return %d items, not %d", pruneIndex, testSize-pruneIndex-1, len(cached))
+	}
+
+	//Pruning everything keeps the lastIndex, so that new items can be appended
+	RollingIndex.Prune(testSize)
+
+	if _, lastIndex := RollingIndex.GetLastWindow(); lastIndex != testSize-1 {
+		t.Fatalf("lastIndex should be %d, not %d", testSize-1, lastIndex)
+	}
+
+	if err := RollingIndex.Set("new", testSize); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := RollingIndex.GetItem(testSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.(string) != "new" {
+		t.Fatalf("GetItem(%d) should be new, not %s", testSize, item)
+	}
+}
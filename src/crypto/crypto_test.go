@@ -1,6 +1,8 @@
 package crypto
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
@@ -127,3 +129,29 @@ func TestSignatureEncoding(t *testing.T) {
 	}
 
 }
+
+//Test vector of RFC 6979, A.2.5: ECDSA, 256 bits (prime field), SHA-256,
+//message "sample"
+func TestSignDeterministic(t *testing.T) {
+	d, _ := new(big.Int).SetString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721", 16)
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = elliptic.P256()
+	key.PublicKey.X, key.PublicKey.Y = key.PublicKey.Curve.ScalarBaseMult(d.Bytes())
+
+	hash := SHA256([]byte("sample"))
+
+	r, s, err := Sign(key, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedR, _ := new(big.Int).SetString("EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716", 16)
+	expectedS, _ := new(big.Int).SetString("F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8", 16)
+	if r.Cmp(expectedR) != 0 || s.Cmp(expectedS) != 0 {
+		t.Fatalf("Signature should be (%X, %X), not (%X, %X)", expectedR, expectedS, r, s)
+	}
+
+	if !Verify(&key.PublicKey, hash, r, s) {
+		t.Fatal("Signature should verify")
+	}
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+//Domain separation prefixes of RFC 6962. Leaves and inner nodes are hashed
+//differently, so that an inner node cannot be passed off as a leaf, nor a leaf
+//as an inner node.
+const (
+	merkleLeafPrefix  byte = 0x00
+	merkleInnerPrefix byte = 0x01
+)
+
+//MerkleLeafHash returns the hash of a leaf: SHA256(0x00 || data)
+func MerkleLeafHash(data []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte{merkleLeafPrefix})
+	hasher.Write(data)
+	return hasher.Sum(nil)
+}
+
+//merkleInnerHash returns the hash of an inner node: SHA256(0x01 || left || right)
+func merkleInnerHash(left, right []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write([]byte{merkleInnerPrefix})
+	hasher.Write(left)
+	hasher.Write(right)
+	return hasher.Sum(nil)
+}
+
+//MerkleRoot returns the root of the tree whose leaves are the given leaf
+//hashes. The tree is split like in SimpleHashFromHashes, but inner nodes are
+//domain separated from leaves. The root of an empty tree is nil.
+func MerkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return nil
+	case 1:
+		return leaves[0]
+	default:
+		numLeft := (len(leaves) + 1) / 2
+		return merkleInnerHash(MerkleRoot(leaves[:numLeft]), MerkleRoot(leaves[numLeft:]))
+	}
+}
+
+/*
+SimpleProof is a Merkle inclusion proof for the trees built by MerkleRoot.
+Aunts are the hashes of the sibling subtrees on the path from the leaf to the
+root, starting with the leaf's sibling.
+*/
+type SimpleProof struct {
+	Aunts [][]byte
+}
+
+//SimpleProofFromHashes returns the Merkle root of the leaf hashes, and the
+//proof that the leaf at position index is included in it
+func SimpleProofFromHashes(hashes [][]byte, index int) ([]byte, *SimpleProof) {
+	return MerkleRoot(hashes), &SimpleProof{
+		Aunts: simpleProofAunts(hashes, index),
+	}
+}
+
+func simpleProofAunts(hashes [][]byte, index int) [][]byte {
+	if len(hashes) <= 1 {
+		return [][]byte{}
+	}
+
+	numLeft := (len(hashes) + 1) / 2
+	if index < numLeft {
+		aunts := simpleProofAunts(hashes[:numLeft], index)
+		return append(aunts, MerkleRoot(hashes[numLeft:]))
+	}
+	aunts := simpleProofAunts(hashes[numLeft:], index-numLeft)
+	return append(aunts, MerkleRoot(hashes[:numLeft]))
+}
+
+//Verify returns true if leafHash, computed with MerkleLeafHash, is the leaf at
+//position index, among total leaves, of the tree whose root is rootHash
+func (sp *SimpleProof) Verify(index, total int, leafHash, rootHash []byte) bool {
+	if index < 0 || index >= total {
+		return false
+	}
+	computed := computeHashFromAunts(index, total, leafHash, sp.Aunts)
+	if computed == nil {
+		return false
+	}
+	return bytes.Equal(computed, rootHash)
+}
+
+func computeHashFromAunts(index, total int, leafHash []byte, aunts [][]byte) []byte {
+	switch total {
+	case 0:
+		return nil
+	case 1:
+		if len(aunts) != 0 {
+			return nil
+		}
+		return leafHash
+	default:
+		if len(aunts) == 0 {
+			return nil
+		}
+		numLeft := (total + 1) / 2
+		sibling := aunts[len(aunts)-1]
+		if index < numLeft {
+			left := computeHashFromAunts(index, numLeft, leafHash, aunts[:len(aunts)-1])
+			if left == nil {
+				return nil
+			}
+			return merkleInnerHash(left, sibling)
+		}
+		right := computeHashFromAunts(index-numLeft, total-numLeft, leafHash, aunts[:len(aunts)-1])
+		if right == nil {
+			return nil
+		}
+		return merkleInnerHash(sibling, right)
+	}
+}
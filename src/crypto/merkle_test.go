@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSimpleProof(t *testing.T) {
+	for total := 1; total <= 9; total++ {
+		hashes := [][]byte{}
+		for i := 0; i < total; i++ {
+			hashes = append(hashes, MerkleLeafHash([]byte(fmt.Sprintf("tx%d", i))))
+		}
+
+		for i := 0; i < total; i++ {
+			root, proof := SimpleProofFromHashes(hashes, i)
+
+			if !reflect.DeepEqual(root, MerkleRoot(hashes)) {
+				t.Fatalf("total %d, index %d: root should match MerkleRoot", total, i)
+			}
+
+			if !proof.Verify(i, total, hashes[i], root) {
+				t.Fatalf("total %d, index %d: proof should verify", total, i)
+			}
+
+			//the proof does not hold for another leaf
+			if total > 1 && proof.Verify(i, total, hashes[(i+1)%total], root) {
+				t.Fatalf("total %d, index %d: proof should not verify another leaf", total, i)
+			}
+
+			//nor for another position
+			if total > 1 && proof.Verify((i+1)%total, total, hashes[i], root) {
+				t.Fatalf("total %d, index %d: proof should not verify another index", total, i)
+			}
+		}
+	}
+}
+
+//The concatenation of two children cannot be passed off as a leaf whose hash is
+//their parent
+func TestSimpleProofDomainSeparation(t *testing.T) {
+	leaves := [][]byte{}
+	for i := 0; i < 4; i++ {
+		leaves = append(leaves, MerkleLeafHash([]byte(fmt.Sprintf("tx%d", i))))
+	}
+	root := MerkleRoot(leaves)
+
+	forged := append(append([]byte{merkleInnerPrefix}, leaves[0]...), leaves[1]...)
+	proof := SimpleProof{Aunts: [][]byte{MerkleRoot(leaves[2:])}}
+
+	if proof.Verify(0, 2, MerkleLeafHash(forged), root) {
+		t.Fatal("an inner node should not verify as a leaf")
+	}
+}
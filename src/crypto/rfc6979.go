@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+/*
+signDeterministic computes an ECDSA signature whose nonce k is derived from the
+private key and the hash, as specified by RFC 6979 with HMAC-SHA256. Signing the
+same hash with the same key always produces the same signature, which makes runs
+that only differ by their signatures reproducible, and does not depend on the
+quality of a random source.
+*/
+func signDeterministic(priv *ecdsa.PrivateKey, hash []byte) (r, s *big.Int, err error) {
+	curve := priv.Curve
+	n := curve.Params().N
+	size := (n.BitLen() + 7) / 8
+
+	e := hashToInt(hash, n)
+
+	nonces := newRFC6979Nonces(priv.D, e, n)
+	for i := 0; i < 100; i++ {
+		k := nonces.next()
+
+		x, _ := curve.ScalarBaseMult(leftPad(k.Bytes(), size))
+		r = new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		//s = k^-1 (e + r*d) mod n. n is prime, so k^-1 = k^(n-2) mod n.
+		kInv := new(big.Int).Exp(k, new(big.Int).Sub(n, big.NewInt(2)), n)
+		s = new(big.Int).Mul(r, priv.D)
+		s.Add(s, e)
+		s.Mul(s, kInv)
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		return r, s, nil
+	}
+
+	return nil, nil, fmt.Errorf("Could not find a valid nonce")
+}
+
+//hashToInt converts a hash to an integer modulo n, keeping its leftmost bits
+//like ECDSA does
+func hashToInt(hash []byte, n *big.Int) *big.Int {
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+
+	ret := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - orderBits; excess > 0 {
+		ret.Rsh(ret, uint(excess))
+	}
+	return ret
+}
+
+//rfc6979Nonces is the HMAC_DRBG of RFC 6979, section 3.2
+type rfc6979Nonces struct {
+	n    *big.Int
+	size int
+	k    []byte
+	v    []byte
+	used bool
+}
+
+func newRFC6979Nonces(d, e, n *big.Int) *rfc6979Nonces {
+	size := (n.BitLen() + 7) / 8
+
+	g := &rfc6979Nonces{
+		n:    n,
+		size: size,
+		k:    make([]byte, sha256.Size),
+		v:    make([]byte, sha256.Size),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	x := leftPad(d.Bytes(), size)
+	h := leftPad(new(big.Int).Mod(e, n).Bytes(), size)
+
+	g.k = g.mac(g.v, []byte{0x00}, x, h)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, x, h)
+	g.v = g.mac(g.v)
+
+	return g
+}
+
+func (g *rfc6979Nonces) mac(data ...[]byte) []byte {
+	m := hmac.New(sha256.New, g.k)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+//next returns the next candidate nonce in [1, n-1]
+func (g *rfc6979Nonces) next() *big.Int {
+	for {
+		if g.used {
+			g.k = g.mac(g.v, []byte{0x00})
+			g.v = g.mac(g.v)
+		}
+		g.used = true
+
+		t := []byte{}
+		for len(t) < g.size {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+
+		k := hashToInt(t, g.n)
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
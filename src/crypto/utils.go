@@ -28,8 +28,10 @@ func FromECDSAPub(pub *ecdsa.PublicKey) []byte {
 	return elliptic.Marshal(elliptic.P256(), pub.X, pub.Y)
 }
 
+//Sign signs a hash with a deterministic nonce (RFC 6979), so the signature only
+//depends on the key and the hash
 func Sign(priv *ecdsa.PrivateKey, hash []byte) (r, s *big.Int, err error) {
-	return ecdsa.Sign(rand.Reader, priv, hash)
+	return signDeterministic(priv, hash)
 }
 
 func Verify(pub *ecdsa.PublicKey, hash []byte, r, s *big.Int) bool {
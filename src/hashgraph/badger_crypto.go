@@ -0,0 +1,414 @@
+package hashgraph
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/dgraph-io/badger"
+	"github.com/mosaicnetworks/babble/src/crypto"
+)
+
+const (
+	//EncryptionKeySize is the size of the AES-256 keys that encrypt a BadgerStore
+	EncryptionKeySize = 32
+
+	//sealedVersion starts every sealed value, before the ID of its key
+	sealedVersion byte = 1
+	keyIDSize          = 8
+
+	//encryptionCheckKey records a sealed value in an encrypted DB, so that a
+	//wrong key is detected when the DB is opened, rather than on the first read
+	encryptionCheckKey   = "encryptioncheck"
+	encryptionCheckValue = "babble"
+
+	//rekeySuffix is appended to the path of a DB for its copy during a rekey,
+	//and rekeyOldSuffix for the previous DB while the copy replaces it
+	rekeySuffix    = ".rekey"
+	rekeyOldSuffix = ".old"
+)
+
+//ParseEncryptionKeys reads hex-encoded keys separated by whitespace or commas.
+//The first key encrypts new values, the others are previous keys that only
+//decrypt the values written before a rotation.
+func ParseEncryptionKeys(data string) ([][]byte, error) {
+	fields := strings.FieldsFunc(data, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("No encryption key")
+	}
+
+	keys := [][]byte{}
+	for i, f := range fields {
+		key, err := hex.DecodeString(f)
+		if err != nil {
+			return nil, fmt.Errorf("Encryption key %d is not hex-encoded: %v", i, err)
+		}
+		if len(key) != EncryptionKeySize {
+			return nil, fmt.Errorf("Encryption key %d is %d bytes long, not %d", i, len(key), EncryptionKeySize)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+//sealingKey is an AES-GCM cipher and the ID that designates its key in the
+//values it seals
+type sealingKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+/*
+badgerCipher seals the values of a BadgerStore with AES-256-GCM. A sealed value
+is made of the version byte, the ID of the key, which is a prefix of its hash,
+the nonce, and the ciphertext. The DB key of the value is authenticated with it,
+so that values cannot be swapped between keys.
+
+New values are sealed with the first key. A value is opened with the key whose
+ID it carries, so keys can be rotated by putting the new key first, and keeping
+the old ones until RekeyBadgerStore has sealed every value with the new key.
+*/
+type badgerCipher struct {
+	keys []sealingKey
+}
+
+func newBadgerCipher(keys [][]byte) (*badgerCipher, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No encryption key")
+	}
+
+	c := &badgerCipher{}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("Encryption key %d: %v", i, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		c.keys = append(c.keys, sealingKey{
+			id:   crypto.SHA256(key)[:keyIDSize],
+			aead: aead,
+		})
+	}
+
+	return c, nil
+}
+
+func (c *badgerCipher) seal(key, value []byte) ([]byte, error) {
+	current := c.keys[0]
+
+	nonce := make([]byte, current.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, 1+keyIDSize+len(nonce)+len(value)+current.aead.Overhead())
+	sealed = append(sealed, sealedVersion)
+	sealed = append(sealed, current.id...)
+	sealed = append(sealed, nonce...)
+
+	return current.aead.Seal(sealed, nonce, value, key), nil
+}
+
+//sealedWith returns the key that sealed a value, or nil if none of the keys did
+func (c *badgerCipher) sealedWith(value []byte) *sealingKey {
+	if len(value) < 1+keyIDSize || value[0] != sealedVersion {
+		return nil
+	}
+
+	for i, k := range c.keys {
+		if bytes.Equal(value[1:1+keyIDSize], k.id) {
+			return &c.keys[i]
+		}
+	}
+
+	return nil
+}
+
+func (c *badgerCipher) open(key, value []byte) ([]byte, error) {
+	k := c.sealedWith(value)
+	if k == nil {
+		return nil, fmt.Errorf("Value of %s is not encrypted with any of the encryption keys", key)
+	}
+
+	nonceSize := k.aead.NonceSize()
+	if len(value) < 1+keyIDSize+nonceSize {
+		return nil, fmt.Errorf("Value of %s is truncated", key)
+	}
+
+	nonce := value[1+keyIDSize : 1+keyIDSize+nonceSize]
+	plain, err := k.aead.Open(nil, nonce, value[1+keyIDSize+nonceSize:], key)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decrypt value of %s: %v", key, err)
+	}
+
+	return plain, nil
+}
+
+//dbGetEncryptionCheck returns the check value of an encrypted DB, or nil if the
+//DB is not encrypted
+func dbGetEncryptionCheck(db *badger.DB) ([]byte, error) {
+	var check []byte
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(encryptionCheckKey))
+		if err != nil {
+			return err
+		}
+		check, err = item.ValueCopy(nil)
+		return err
+	})
+
+	if err != nil && isDBKeyNotFound(err) {
+		return nil, nil
+	}
+
+	return check, err
+}
+
+func dbSetEncryptionCheck(db *badger.DB, c *badgerCipher) error {
+	check, err := c.seal([]byte(encryptionCheckKey), []byte(encryptionCheckValue))
+	if err != nil {
+		return err
+	}
+
+	tx := db.NewTransaction(true)
+	defer tx.Discard()
+
+	if err := tx.Set([]byte(encryptionCheckKey), check); err != nil {
+		return err
+	}
+
+	return tx.Commit(nil)
+}
+
+//verifyEncryptionCheck returns an error if none of the keys opens the check
+//value
+func verifyEncryptionCheck(check []byte, c *badgerCipher, path string) error {
+	if c.sealedWith(check) == nil {
+		return fmt.Errorf("Wrong encryption key for database %s", path)
+	}
+
+	if _, err := c.open([]byte(encryptionCheckKey), check); err != nil {
+		return fmt.Errorf("Wrong encryption key for database %s: %v", path, err)
+	}
+
+	return nil
+}
+
+//checkEncryption verifies that the keys, or their absence, match the DB. It
+//records the check value in a new encrypted DB.
+func checkEncryption(db *badger.DB, c *badgerCipher, path string, empty bool) error {
+	check, err := dbGetEncryptionCheck(db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case check != nil && c == nil:
+		return fmt.Errorf("Database %s is encrypted. An encryption key is required", path)
+	case check != nil:
+		return verifyEncryptionCheck(check, c, path)
+	case c != nil && empty:
+		return dbSetEncryptionCheck(db, c)
+	case c != nil:
+		return fmt.Errorf("Database %s is not encrypted. Run babble db rekey to encrypt it", path)
+	}
+
+	return nil
+}
+
+/*
+RekeyBadgerStore seals every value of the database in path with the first of
+the keys. The other keys are the previous keys of the database, which are needed
+to open its values. A database that is not encrypted yet is encrypted. It
+returns the number of values that were sealed; values that are already sealed
+with the first key are copied as they are.
+
+Badger does not overwrite values in place, so the plaintext, or the values of
+the old key, would remain in its files. Instead, the values are copied into a
+new database in path.rekey, which records the check value of the first key
+before any value, and which then replaces the database in path. The previous
+database is moved to path.old and deleted. If the rekey is interrupted, the
+next run discards the incomplete copy, or completes the replacement if the copy
+was complete; the node must not be started in between.
+*/
+func RekeyBadgerStore(path string, keys [][]byte) (int, error) {
+	c, err := newBadgerCipher(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := finishRekey(path); err != nil {
+		return 0, fmt.Errorf("Interrupted rekey: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	db, err := openBadgerDB(path)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := rekeyBadgerDB(db, path+rekeySuffix, c, path)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.RemoveAll(path + rekeySuffix)
+		return count, err
+	}
+
+	if err := os.Rename(path, path+rekeyOldSuffix); err != nil {
+		return count, err
+	}
+	if err := os.Rename(path+rekeySuffix, path); err != nil {
+		return count, err
+	}
+
+	return count, os.RemoveAll(path + rekeyOldSuffix)
+}
+
+//finishRekey cleans up after an interrupted RekeyBadgerStore. The copy is
+//complete once the previous database was moved away, in which case it replaces
+//it; otherwise it is discarded.
+func finishRekey(path string) error {
+	if _, err := os.Stat(path + rekeyOldSuffix); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		return os.RemoveAll(path + rekeySuffix)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.Rename(path+rekeySuffix, path); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(path + rekeyOldSuffix)
+}
+
+//rekeyBadgerDB copies the values of db, sealed with the first key of c, into a
+//new DB in newPath. It returns the number of values that were not sealed with
+//that key yet.
+func rekeyBadgerDB(db *badger.DB, newPath string, c *badgerCipher, path string) (count int, err error) {
+	version, err := dbSchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version < 0 {
+		return 0, fmt.Errorf("Empty database")
+	}
+
+	check, err := dbGetEncryptionCheck(db)
+	if err != nil {
+		return 0, err
+	}
+
+	encrypted := check != nil
+	if encrypted {
+		if err := verifyEncryptionCheck(check, c, path); err != nil {
+			return 0, err
+		}
+	}
+
+	newDB, err := openBadgerDB(newPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := newDB.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if err := dbSetSchemaVersion(newDB, version); err != nil {
+		return 0, err
+	}
+	if err := dbSetEncryptionCheck(newDB, c); err != nil {
+		return 0, err
+	}
+
+	tx := newDB.NewTransaction(true)
+	defer func() { tx.Discard() }()
+
+	set := func(key, val []byte) error {
+		err := tx.Set(key, val)
+		if err == badger.ErrTxnTooBig {
+			if err := tx.Commit(nil); err != nil {
+				return err
+			}
+			tx = newDB.NewTransaction(true)
+			err = tx.Set(key, val)
+		}
+		return err
+	}
+
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+
+			key := item.KeyCopy(nil)
+			if string(key) == schemaVersionKey || string(key) == encryptionCheckKey {
+				continue
+			}
+
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			plain := val
+			k := c.sealedWith(val)
+			switch {
+			case k == &c.keys[0]:
+				if err := set(key, val); err != nil {
+					return err
+				}
+				continue
+			case k != nil:
+				if plain, err = c.open(key, val); err != nil {
+					return err
+				}
+			case encrypted:
+				return fmt.Errorf("Value of %s is not encrypted with any of the encryption keys", key)
+			}
+			//Otherwise the value was written before the DB was encrypted
+
+			sealed, err := c.seal(key, plain)
+			if err != nil {
+				return err
+			}
+
+			if err := set(key, sealed); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, tx.Commit(nil)
+}
@@ -0,0 +1,314 @@
+package hashgraph
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+)
+
+func newEncryptionKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, EncryptionKeySize)
+}
+
+//initEncryptedBadgerStore creates an encrypted BadgerStore with a signed Block
+//whose transactions are secret
+func initEncryptedBadgerStore(keys [][]byte, t *testing.T) string {
+	os.RemoveAll("test_data")
+	os.Mkdir("test_data", os.ModeDir|0777)
+	path, err := ioutil.TempDir("test_data", "badger")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := NewEncryptedBadgerStore(100, path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerSet, _ := initPeers(3)
+	if err := encrypted.SetPeerSet(0, peerSet); err != nil {
+		t.Fatal(err)
+	}
+
+	block := NewBlock(0, 1, []byte("framehash"), peerSet.Peers,
+		[][]byte{[]byte("secret transaction")}, nil)
+	if err := encrypted.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encrypted.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+//plaintextFiles counts the files of the DB directory that contain the secret
+//transaction, including values that were overwritten or deleted
+func plaintextFiles(path string, t *testing.T) int {
+	secret := []byte(base64.StdEncoding.EncodeToString([]byte("secret transaction")))
+
+	count := 0
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, secret) {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+//plaintextValues counts the values of the DB that contain the secret
+//transaction, which is base64-encoded in the JSON of Blocks
+func plaintextValues(path string, t *testing.T) int {
+	secret := []byte(base64.StdEncoding.EncodeToString([]byte("secret transaction")))
+
+	db, err := openBadgerDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	count := 0
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if bytes.Contains(val, secret) {
+				count++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func checkEncryptedBlock(path string, keys [][]byte, t *testing.T) {
+	store, err := NewEncryptedBadgerStore(100, path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	block, err := store.dbGetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(block.Transactions()[0]) != "secret transaction" {
+		t.Fatalf("Transaction should be %q, not %q", "secret transaction", block.Transactions()[0])
+	}
+}
+
+func TestParseEncryptionKeys(t *testing.T) {
+	k1 := hex.EncodeToString(newEncryptionKey(1))
+	k2 := hex.EncodeToString(newEncryptionKey(2))
+
+	keys, err := ParseEncryptionKeys(k1 + "\n" + k2 + ",\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !bytes.Equal(keys[0], newEncryptionKey(1)) || !bytes.Equal(keys[1], newEncryptionKey(2)) {
+		t.Fatalf("Keys should be %s and %s, not %X", k1, k2, keys)
+	}
+
+	for _, invalid := range []string{"", " \n", "xyz", k1[:10]} {
+		if _, err := ParseEncryptionKeys(invalid); err == nil {
+			t.Fatalf("ParseEncryptionKeys should refuse %q", invalid)
+		}
+	}
+}
+
+func TestBadgerEncryption(t *testing.T) {
+	k1 := newEncryptionKey(1)
+	k2 := newEncryptionKey(2)
+
+	path := initEncryptedBadgerStore([][]byte{k1}, t)
+	defer os.RemoveAll(path)
+
+	if n := plaintextValues(path, t); n != 0 {
+		t.Fatalf("%d values are not encrypted", n)
+	}
+	checkEncryptedBlock(path, [][]byte{k1}, t)
+
+	_, err := NewEncryptedBadgerStore(100, path, [][]byte{k2})
+	if err == nil || !strings.Contains(err.Error(), "Wrong encryption key") {
+		t.Fatalf("NewEncryptedBadgerStore should refuse a wrong key, not return %v", err)
+	}
+
+	_, err = NewBadgerStore(100, path)
+	if err == nil || !strings.Contains(err.Error(), "encryption key is required") {
+		t.Fatalf("NewBadgerStore should refuse an encrypted database, not return %v", err)
+	}
+
+	//A rotated key opens the old values and seals new ones
+	store, err := NewEncryptedBadgerStore(100, path, [][]byte{k2, k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := store.dbGetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Body.Index = 1
+	if err := store.dbSetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewEncryptedBadgerStore(100, path, [][]byte{k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.dbGetBlock(1); err == nil {
+		t.Fatalf("The old key should not open values sealed with the new key")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBadgerRekey(t *testing.T) {
+	k1 := newEncryptionKey(1)
+	k2 := newEncryptionKey(2)
+
+	//Encrypt a database that is not encrypted
+	store := initBadgerStore(100, t)
+	path := store.path
+	defer os.RemoveAll(path)
+
+	peerSet, _ := initPeers(3)
+	block := NewBlock(0, 1, []byte("framehash"), peerSet.Peers,
+		[][]byte{[]byte("secret transaction")}, nil)
+	if err := store.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := plaintextValues(path, t); n != 1 {
+		t.Fatalf("The Block should be in plaintext, not %d values", n)
+	}
+	if n := plaintextFiles(path, t); n == 0 {
+		t.Fatalf("The Block should be in plaintext in the files of the database")
+	}
+
+	_, err := NewEncryptedBadgerStore(100, path, [][]byte{k1})
+	if err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Fatalf("NewEncryptedBadgerStore should refuse a database that is not encrypted, not return %v", err)
+	}
+
+	count, err := RekeyBadgerStore(path, [][]byte{k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Fatalf("RekeyBadgerStore should encrypt the values")
+	}
+
+	if n := plaintextValues(path, t); n != 0 {
+		t.Fatalf("%d values are not encrypted", n)
+	}
+	if n := plaintextFiles(path, t); n != 0 {
+		t.Fatalf("%d files of the database still contain the plaintext", n)
+	}
+	for _, suffix := range []string{rekeySuffix, rekeyOldSuffix} {
+		if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+			t.Fatalf("RekeyBadgerStore should remove %s, not return %v", path+suffix, err)
+		}
+	}
+	checkEncryptedBlock(path, [][]byte{k1}, t)
+
+	//Running it again does nothing
+	if count, err = RekeyBadgerStore(path, [][]byte{k1}); err != nil || count != 0 {
+		t.Fatalf("RekeyBadgerStore should not seal values again: %d, %v", count, err)
+	}
+
+	//Rotate the key
+	if _, err := RekeyBadgerStore(path, [][]byte{k2}); err == nil {
+		t.Fatalf("RekeyBadgerStore should need the old key")
+	}
+
+	if _, err := RekeyBadgerStore(path, [][]byte{k2, k1}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkEncryptedBlock(path, [][]byte{k2}, t)
+
+	if _, err := NewEncryptedBadgerStore(100, path, [][]byte{k1}); err == nil {
+		t.Fatalf("NewEncryptedBadgerStore should refuse the old key after a rotation")
+	}
+
+	report, err := VerifyBadgerStore(path, [][]byte{k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Blocks != 1 {
+		t.Fatalf("VerifyBadgerStore should read 1 Block, not %d", report.Blocks)
+	}
+}
+
+//TestBadgerRekeyInterrupted checks that a rekey completes the replacement of
+//the database by a complete copy, and discards an incomplete copy
+func TestBadgerRekeyInterrupted(t *testing.T) {
+	k1 := newEncryptionKey(1)
+	k2 := newEncryptionKey(2)
+
+	path := initEncryptedBadgerStore([][]byte{k1}, t)
+	defer os.RemoveAll(path)
+
+	//Interrupted while copying
+	if err := os.Mkdir(path+rekeySuffix, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RekeyBadgerStore(path, [][]byte{k2, k1}); err != nil {
+		t.Fatal(err)
+	}
+	checkEncryptedBlock(path, [][]byte{k2}, t)
+
+	//Interrupted after the previous database was moved away
+	if err := os.Rename(path, path+rekeySuffix); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path+rekeyOldSuffix, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RekeyBadgerStore(path, [][]byte{k2}); err != nil {
+		t.Fatal(err)
+	}
+	checkEncryptedBlock(path, [][]byte{k2}, t)
+
+	for _, suffix := range []string{rekeySuffix, rekeyOldSuffix} {
+		if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+			t.Fatalf("RekeyBadgerStore should remove %s, not return %v", path+suffix, err)
+		}
+	}
+}
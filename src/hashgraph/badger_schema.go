@@ -0,0 +1,112 @@
+package hashgraph
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	/*
+		SCHEMA_VERSION is the version of the keys and values of the BadgerStore.
+		It must be incremented every time a change to the keys, or to the
+		encoding of the values, would prevent the BadgerStore from reading an
+		existing database. Databases cannot be upgraded in place, because their
+		Blocks are signed in their old encoding; a node with an older database
+		must be resynced from its peers with an empty data directory.
+	*/
+	SCHEMA_VERSION = 1
+
+	schemaVersionKey = "schemaversion"
+)
+
+func badgerOptions(path string) badger.Options {
+	opts := badger.DefaultOptions
+	opts.Dir = path
+	opts.ValueDir = path
+	opts.SyncWrites = false
+
+	return opts
+}
+
+func openBadgerDB(path string) (*badger.DB, error) {
+	return badger.Open(badgerOptions(path))
+}
+
+//openBadgerDBReadOnly opens an existing DB without modifying it. It fails if
+//the DB is in use, or was not closed properly.
+func openBadgerDBReadOnly(path string) (*badger.DB, error) {
+	opts := badgerOptions(path)
+	opts.ReadOnly = true
+
+	return badger.Open(opts)
+}
+
+/*
+dbSchemaVersion returns the schema version recorded in the DB. Databases created
+before versioning have no record; they are version 0. It returns -1 for an
+empty DB, which has no version yet.
+*/
+func dbSchemaVersion(db *badger.DB) (int, error) {
+	version := -1
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(schemaVersionKey))
+		if err == nil {
+			val, err := item.Value()
+			if err != nil {
+				return err
+			}
+			version, err = strconv.Atoi(string(val))
+			return err
+		}
+
+		if !isDBKeyNotFound(err) {
+			return err
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		if it.Rewind(); it.Valid() {
+			version = 0
+		}
+
+		return nil
+	})
+
+	return version, err
+}
+
+func dbSetSchemaVersion(db *badger.DB, version int) error {
+	tx := db.NewTransaction(true)
+	defer tx.Discard()
+
+	if err := tx.Set([]byte(schemaVersionKey), []byte(strconv.Itoa(version))); err != nil {
+		return err
+	}
+
+	return tx.Commit(nil)
+}
+
+//checkSchemaVersion records SCHEMA_VERSION in a new DB, and returns an error if
+//an existing DB has any other version
+func checkSchemaVersion(db *badger.DB) error {
+	version, err := dbSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version < 0:
+		return dbSetSchemaVersion(db, SCHEMA_VERSION)
+	case version > SCHEMA_VERSION:
+		return fmt.Errorf("Unknown database schema version %d. This version of Babble supports up to version %d", version, SCHEMA_VERSION)
+	case version < SCHEMA_VERSION:
+		return fmt.Errorf("Database schema version %d is older than version %d, resync required: remove the database and fast-forward from peers", version, SCHEMA_VERSION)
+	}
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package hashgraph
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -17,36 +19,80 @@ const (
 	topoPrefix       = "topo"
 	blockPrefix      = "block"
 	framePrefix      = "frame"
+	forkProofPrefix  = "forkproof"
+	txPrefix         = "tx"
+	pruneBaseKey     = "prunebase"
+	anchorBaseKey    = "anchorbase"
+	bootRoundsKey    = "bootrounds"
 )
 
+//storeBase records a Block from which the Hashgraph can be bootstrapped, the
+//application snapshot corresponding to that Block, and the topological index
+//from which the Events above the Block's Frame must be replayed.
+type storeBase struct {
+	BlockIndex       int
+	Snapshot         []byte
+	TopologicalIndex int
+}
+
 type BadgerStore struct {
 	inmemStore   *InmemStore
 	db           *badger.DB
+	cipher       *badgerCipher
 	path         string
 	needBoostrap bool
 }
 
 //NewBadgerStore opens an existing database or creates a new one if nothing is
-//found in path.
+//found in path. It refuses to open a database whose schema version is not
+//SCHEMA_VERSION; nodes with older databases must be resynced.
 func NewBadgerStore(cacheSize int, path string) (*BadgerStore, error) {
+	return NewEncryptedBadgerStore(cacheSize, path, nil)
+}
+
+//NewEncryptedBadgerStore is NewBadgerStore for a database whose values are
+//encrypted with the given keys; see ParseEncryptionKeys. With no keys, the
+//database is not encrypted. It refuses to open an encrypted database with no
+//key or the wrong keys, and a database that is not encrypted with keys.
+func NewEncryptedBadgerStore(cacheSize int, path string, keys [][]byte) (*BadgerStore, error) {
 	needBootstrap := false
 	if _, err := os.Stat(path); err == nil {
 		needBootstrap = true
 	}
 
-	opts := badger.DefaultOptions
-	opts.Dir = path
-	opts.ValueDir = path
-	opts.SyncWrites = false
+	var c *badgerCipher
+	if len(keys) > 0 {
+		var err error
+		if c, err = newBadgerCipher(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	handle, err := openBadgerDB(path)
+	if err != nil {
+		return nil, err
+	}
 
-	handle, err := badger.Open(opts)
+	version, err := dbSchemaVersion(handle)
 	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	if err := checkSchemaVersion(handle); err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	if err := checkEncryption(handle, c, path, version < 0); err != nil {
+		handle.Close()
 		return nil, err
 	}
 
 	store := &BadgerStore{
 		inmemStore:   NewInmemStore(cacheSize),
 		db:           handle,
+		cipher:       c,
 		path:         path,
 		needBoostrap: needBootstrap,
 	}
@@ -89,6 +135,14 @@ func frameKey(index int) []byte {
 	return []byte(fmt.Sprintf("%s_%09d", framePrefix, index))
 }
 
+func forkProofKey(creator string, index int) []byte {
+	return []byte(fmt.Sprintf("%s_%s_%09d", forkProofPrefix, creator, index))
+}
+
+func txLocationKey(hash string) []byte {
+	return []byte(fmt.Sprintf("%s_%s", txPrefix, hash))
+}
+
 /*******************************************************************************
 Implement the Store interface
 
@@ -146,7 +200,13 @@ func (s *BadgerStore) RoundEvents(r int) int {
 }
 
 func (s *BadgerStore) GetFrame(rr int) (*Frame, error) {
-	return s.inmemStore.GetFrame(rr)
+	res, err := s.inmemStore.GetFrame(rr)
+	if err != nil {
+		//Frames computed before a restart must be reused as they are; Frames
+		//recomputed from a pruned base might have different Roots.
+		res, err = s.dbGetFrame(rr)
+	}
+	return res, mapError(err, "Frame", string(frameKey(rr)))
 }
 
 func (s *BadgerStore) GetPeerSet(round int) (peerSet *peers.PeerSet, err error) {
@@ -234,6 +294,10 @@ func (s *BadgerStore) SetPeerSet(round int, peerSet *peers.PeerSet) error {
 }
 
 func (s *BadgerStore) AddParticipant(p *peers.Peer) error {
+	if err := s.inmemStore.AddParticipant(p); err != nil {
+		return err
+	}
+
 	if err := s.dbSetRepertoire(p); err != nil {
 		return err
 	}
@@ -295,6 +359,42 @@ func (s *BadgerStore) SetFrame(frame *Frame) error {
 	return s.dbSetFrame(frame)
 }
 
+func (s *BadgerStore) GetForkProof(creator string, index int) (*ForkProof, error) {
+	res, err := s.inmemStore.GetForkProof(creator, index)
+	if err != nil {
+		res, err = s.dbGetForkProof(creator, index)
+	}
+	return res, mapError(err, "ForkProof", string(forkProofKey(creator, index)))
+}
+
+func (s *BadgerStore) SetForkProof(proof *ForkProof) error {
+	if err := s.inmemStore.SetForkProof(proof); err != nil {
+		return err
+	}
+	return s.dbSetForkProof(proof)
+}
+
+//GetForkProofs reads ForkProofs from the DB, because the InmemStore does not
+//contain those that were recorded before the node was restarted.
+func (s *BadgerStore) GetForkProofs() ([]*ForkProof, error) {
+	return s.dbGetForkProofs()
+}
+
+func (s *BadgerStore) GetTxLocation(hash string) (*TxLocation, error) {
+	res, err := s.inmemStore.GetTxLocation(hash)
+	if err != nil {
+		res, err = s.dbGetTxLocation(hash)
+	}
+	return res, mapError(err, "TxLocation", string(txLocationKey(hash)))
+}
+
+func (s *BadgerStore) SetTxLocation(location *TxLocation) error {
+	if err := s.inmemStore.SetTxLocation(location); err != nil {
+		return err
+	}
+	return s.dbSetTxLocation(location)
+}
+
 func (s *BadgerStore) Reset(frame *Frame) error {
 	//Reset InmemStore
 	if err := s.inmemStore.Reset(frame); err != nil {
@@ -317,9 +417,68 @@ func (s *BadgerStore) Reset(frame *Frame) error {
 		return err
 	}
 
+	for round, ps := range frame.FuturePeerSets {
+		if err := s.dbSetPeerSet(round, peers.NewPeerSet(ps)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+/*
+Prune deletes the Events, Rounds, and Frames below the Frame from the InmemStore
+and from the DB. It also records the Block and the application snapshot, so that
+Bootstrap can Reset the Hashgraph from the Block and Frame, and the application
+from the snapshot, instead of replaying everything from genesis.
+*/
+func (s *BadgerStore) Prune(block *Block, frame *Frame, snapshot []byte) error {
+	if err := s.inmemStore.Prune(block, frame, snapshot); err != nil {
+		return err
+	}
+
+	for p, root := range frame.Roots {
+		if err := s.dbSetRoot(p, root); err != nil {
+			return err
+		}
+	}
+
+	if err := s.dbPruneEvents(frame); err != nil {
+		return err
+	}
+
+	if err := s.dbDeleteBelow(roundPrefix, frame.Round); err != nil {
+		return err
+	}
+
+	if err := s.dbDeleteBelow(framePrefix, frame.Round); err != nil {
+		return err
+	}
+
+	return s.dbSetBase(pruneBaseKey, &storeBase{
+		BlockIndex: block.Index(),
+		Snapshot:   snapshot,
+	})
+}
+
+/*
+Checkpoint records the Block, whose Frame is already in the DB, and the
+application snapshot, as the base from which Bootstrap restarts the Hashgraph.
+Only the Events whose topological index is at least topologicalIndex need to be
+replayed above the Block's Frame.
+*/
+func (s *BadgerStore) Checkpoint(block *Block, snapshot []byte, topologicalIndex int) error {
+	if err := s.inmemStore.Checkpoint(block, snapshot, topologicalIndex); err != nil {
+		return err
+	}
+
+	return s.dbSetBase(anchorBaseKey, &storeBase{
+		BlockIndex:       block.Index(),
+		Snapshot:         snapshot,
+		TopologicalIndex: topologicalIndex,
+	})
+}
+
 func (s *BadgerStore) Close() error {
 	if err := s.inmemStore.Close(); err != nil {
 		return err
@@ -335,6 +494,10 @@ func (s *BadgerStore) StorePath() string {
 	return s.path
 }
 
+func (s *BadgerStore) cache() *InmemStore {
+	return s.inmemStore
+}
+
 /*******************************************************************************
 DB Methods
 *******************************************************************************/
@@ -348,7 +511,7 @@ func (s *BadgerStore) dbGetRepertoire() (map[string]*peers.Peer, error) {
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 			item := it.Item()
 
-			peerBytes, err := item.Value()
+			peerBytes, err := s.itemValue(item)
 			if err != nil {
 				return err
 			}
@@ -382,7 +545,7 @@ func (s *BadgerStore) dbSetRepertoire(peer *peers.Peer) error {
 	}
 
 	//insert [pub] => [Peer]
-	if err := tx.Set(key, val); err != nil {
+	if err := s.setValue(tx, key, val); err != nil {
 		return err
 	}
 
@@ -397,7 +560,7 @@ func (s *BadgerStore) dbGetPeerSet(round int) (*peers.PeerSet, error) {
 		if err != nil {
 			return err
 		}
-		peerSliceBytes, err = item.Value()
+		peerSliceBytes, err = s.itemValue(item)
 		return err
 	})
 
@@ -408,6 +571,43 @@ func (s *BadgerStore) dbGetPeerSet(round int) (*peers.PeerSet, error) {
 	return peers.NewPeerSetFromPeerSliceBytes(peerSliceBytes)
 }
 
+//dbGetPeerSets returns all the PeerSets recorded in the DB, by round
+func (s *BadgerStore) dbGetPeerSets() (map[int]*peers.PeerSet, error) {
+	res := make(map[int]*peers.PeerSet)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(peerSetPrefix + "_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			var round int
+			if _, err := fmt.Sscanf(string(item.Key()), peerSetPrefix+"_%d", &round); err != nil {
+				return err
+			}
+
+			peerSliceBytes, err := s.itemValue(item)
+			if err != nil {
+				return err
+			}
+
+			peerSet, err := peers.NewPeerSetFromPeerSliceBytes(peerSliceBytes)
+			if err != nil {
+				return err
+			}
+
+			res[round] = peerSet
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (s *BadgerStore) dbSetPeerSet(round int, peerSet *peers.PeerSet) error {
 	tx := s.db.NewTransaction(true)
 	defer tx.Discard()
@@ -419,7 +619,7 @@ func (s *BadgerStore) dbSetPeerSet(round int, peerSet *peers.PeerSet) error {
 	}
 
 	//insert [round_index] => [PeerSet bytes]
-	if err := tx.Set(key, val); err != nil {
+	if err := s.setValue(tx, key, val); err != nil {
 		return err
 	}
 
@@ -433,7 +633,7 @@ func (s *BadgerStore) dbGetEvent(key string) (*Event, error) {
 		if err != nil {
 			return err
 		}
-		eventBytes, err = item.Value()
+		eventBytes, err = s.itemValue(item)
 		return err
 	})
 
@@ -466,19 +666,19 @@ func (s *BadgerStore) dbSetEvents(events []*Event) error {
 			new = true
 		}
 		//insert [event hash] => [event bytes]
-		if err := tx.Set([]byte(eventHex), val); err != nil {
+		if err := s.setValue(tx, []byte(eventHex), val); err != nil {
 			return err
 		}
 
 		if new {
 			//insert [topo_index] => [event hash]
 			topoKey := topologicalEventKey(event.topologicalIndex)
-			if err := tx.Set(topoKey, []byte(eventHex)); err != nil {
+			if err := s.setValue(tx, topoKey, []byte(eventHex)); err != nil {
 				return err
 			}
 			//insert [participant_index] => [event hash]
 			peKey := participantEventKey(event.Creator(), event.Index())
-			if err := tx.Set(peKey, []byte(eventHex)); err != nil {
+			if err := s.setValue(tx, peKey, []byte(eventHex)); err != nil {
 				return err
 			}
 		}
@@ -493,7 +693,7 @@ func (s *BadgerStore) dbParticipantEvents(participant string, skip int) ([]strin
 		key := participantEventKey(participant, i)
 		item, errr := txn.Get(key)
 		for errr == nil {
-			v, errrr := item.Value()
+			v, errrr := s.itemValue(item)
 			if errrr != nil {
 				break
 			}
@@ -521,7 +721,7 @@ func (s *BadgerStore) dbParticipantEvent(participant string, index int) (string,
 		if err != nil {
 			return err
 		}
-		data, err = item.Value()
+		data, err = s.itemValue(item)
 		return err
 	})
 	if err != nil {
@@ -530,24 +730,38 @@ func (s *BadgerStore) dbParticipantEvent(participant string, index int) (string,
 	return string(data), nil
 }
 
-func (s *BadgerStore) dbTopologicalEvents() ([]*Event, error) {
+//dbTopologicalEvents returns the Events in topological order, starting at the
+//topological index from. The keys may not start at 0 if the DB was pruned, so
+//the Events are read by prefix. An Event may appear more than once if it was
+//inserted again after a restart; keys that refer to pruned Events are skipped.
+func (s *BadgerStore) dbTopologicalEvents(from int) ([]*Event, error) {
 	res := []*Event{}
-	t := 0
 	err := s.db.View(func(txn *badger.Txn) error {
-		key := topologicalEventKey(t)
-		item, errr := txn.Get(key)
-		for errr == nil {
-			v, errrr := item.Value()
-			if errrr != nil {
-				break
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(topoPrefix + "_")
+		for it.Seek(topologicalEventKey(from)); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			var t int
+			if _, err := fmt.Sscanf(string(item.Key()), topoPrefix+"_%d", &t); err != nil {
+				return err
+			}
+
+			v, err := s.itemValue(item)
+			if err != nil {
+				return err
 			}
 
 			evKey := string(v)
 			eventItem, err := txn.Get([]byte(evKey))
 			if err != nil {
+				if isDBKeyNotFound(err) {
+					continue
+				}
 				return err
 			}
-			eventBytes, err := eventItem.Value()
+			eventBytes, err := s.itemValue(eventItem)
 			if err != nil {
 				return err
 			}
@@ -556,21 +770,41 @@ func (s *BadgerStore) dbTopologicalEvents() ([]*Event, error) {
 			if err := event.Unmarshal(eventBytes); err != nil {
 				return err
 			}
-			res = append(res, event)
+			event.topologicalIndex = t
 
-			t++
-			key = topologicalEventKey(t)
-			item, errr = txn.Get(key)
+			res = append(res, event)
 		}
+		return nil
+	})
 
-		if !isDBKeyNotFound(errr) {
-			return errr
+	return res, err
+}
+
+//dbNextTopologicalIndex returns the topological index that follows the last
+//one in the DB
+func (s *BadgerStore) dbNextTopologicalIndex() (int, error) {
+	next := 0
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(topoPrefix + "_")
+		it.Seek(append(prefix, 0xFF))
+		if !it.ValidForPrefix(prefix) {
+			return nil
 		}
 
+		var t int
+		if _, err := fmt.Sscanf(string(it.Item().Key()), topoPrefix+"_%d", &t); err != nil {
+			return err
+		}
+		next = t + 1
 		return nil
 	})
 
-	return res, err
+	return next, err
 }
 
 func (s *BadgerStore) dbSetRoot(participant string, root *Root) error {
@@ -585,7 +819,7 @@ func (s *BadgerStore) dbSetRoot(participant string, root *Root) error {
 	}
 
 	//insert [round_index] => [round bytes]
-	if err := tx.Set(key, val); err != nil {
+	if err := s.setValue(tx, key, val); err != nil {
 		return err
 	}
 
@@ -600,7 +834,7 @@ func (s *BadgerStore) dbGetRoot(participant string) (*Root, error) {
 		if err != nil {
 			return err
 		}
-		rootBytes, err = item.Value()
+		rootBytes, err = s.itemValue(item)
 		return err
 	})
 
@@ -624,7 +858,7 @@ func (s *BadgerStore) dbGetRound(index int) (*RoundInfo, error) {
 		if err != nil {
 			return err
 		}
-		roundBytes, err = item.Value()
+		roundBytes, err = s.itemValue(item)
 		return err
 	})
 
@@ -640,6 +874,42 @@ func (s *BadgerStore) dbGetRound(index int) (*RoundInfo, error) {
 	return roundInfo, nil
 }
 
+//dbGetRoundsFrom returns the Round of every Event listed in the RoundInfos from
+//the given Round upwards
+func (s *BadgerStore) dbGetRoundsFrom(from int) (map[string]int, error) {
+	res := make(map[string]int)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(roundPrefix + "_")
+		for it.Seek(roundKey(from)); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			var r int
+			if _, err := fmt.Sscanf(string(item.Key()), roundPrefix+"_%d", &r); err != nil {
+				return err
+			}
+
+			v, err := s.itemValue(item)
+			if err != nil {
+				return err
+			}
+
+			roundInfo := new(RoundInfo)
+			if err := roundInfo.Unmarshal(v); err != nil {
+				return err
+			}
+
+			for x := range roundInfo.CreatedEvents {
+				res[x] = r
+			}
+		}
+		return nil
+	})
+
+	return res, err
+}
+
 func (s *BadgerStore) dbSetRound(index int, round *RoundInfo) error {
 	tx := s.db.NewTransaction(true)
 	defer tx.Discard()
@@ -651,7 +921,7 @@ func (s *BadgerStore) dbSetRound(index int, round *RoundInfo) error {
 	}
 
 	//insert [round_index] => [round bytes]
-	if err := tx.Set(key, val); err != nil {
+	if err := s.setValue(tx, key, val); err != nil {
 		return err
 	}
 
@@ -666,7 +936,7 @@ func (s *BadgerStore) dbGetBlock(index int) (*Block, error) {
 		if err != nil {
 			return err
 		}
-		blockBytes, err = item.Value()
+		blockBytes, err = s.itemValue(item)
 		return err
 	})
 
@@ -693,7 +963,7 @@ func (s *BadgerStore) dbSetBlock(block *Block) error {
 	}
 
 	//insert [index] => [block bytes]
-	if err := tx.Set(key, val); err != nil {
+	if err := s.setValue(tx, key, val); err != nil {
 		return err
 	}
 
@@ -708,7 +978,7 @@ func (s *BadgerStore) dbGetFrame(index int) (*Frame, error) {
 		if err != nil {
 			return err
 		}
-		frameBytes, err = item.Value()
+		frameBytes, err = s.itemValue(item)
 		return err
 	})
 
@@ -735,7 +1005,7 @@ func (s *BadgerStore) dbSetFrame(frame *Frame) error {
 	}
 
 	//insert [index] => [block bytes]
-	if err := tx.Set(key, val); err != nil {
+	if err := s.setValue(tx, key, val); err != nil {
 		return err
 	}
 
@@ -744,10 +1014,389 @@ func (s *BadgerStore) dbSetFrame(frame *Frame) error {
 
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
+//setValue sets a value in a transaction, sealed if the DB is encrypted
+func (s *BadgerStore) setValue(tx *badger.Txn, key, val []byte) error {
+	if s.cipher != nil {
+		sealed, err := s.cipher.seal(key, val)
+		if err != nil {
+			return err
+		}
+		val = sealed
+	}
+	return tx.Set(key, val)
+}
+
+//itemValue returns a copy of the value of an item, opened if the DB is
+//encrypted
+func (s *BadgerStore) itemValue(item *badger.Item) ([]byte, error) {
+	val, err := item.ValueCopy(nil)
+	if err != nil || s.cipher == nil {
+		return val, err
+	}
+	return s.cipher.open(item.Key(), val)
+}
+
 func isDBKeyNotFound(err error) bool {
 	return err.Error() == badger.ErrKeyNotFound.Error()
 }
 
+//dbPruneEvents deletes the Events of every participant up to, and including,
+//the head of its Root in the Frame, along with the corresponding participant
+//and topological keys.
+func (s *BadgerStore) dbPruneEvents(frame *Frame) error {
+	pruned := make(map[string]bool)
+	keys := [][]byte{}
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		for p, root := range frame.Roots {
+			for i := root.GetHead().Index; i >= 0; i-- {
+				peKey := participantEventKey(p, i)
+				item, err := txn.Get(peKey)
+				if err != nil {
+					if isDBKeyNotFound(err) {
+						break
+					}
+					return err
+				}
+
+				hash, err := s.itemValue(item)
+				if err != nil {
+					return err
+				}
+
+				pruned[string(hash)] = true
+				keys = append(keys, hash, peKey)
+			}
+		}
+
+		if len(pruned) == 0 {
+			return nil
+		}
+
+		//Pruned Events are the oldest, so their topological keys come first.
+		//Stop as soon as all of them are found.
+		found := 0
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(topoPrefix + "_")
+		for it.Seek(prefix); it.ValidForPrefix(prefix) && found < len(pruned); it.Next() {
+			item := it.Item()
+
+			hash, err := s.itemValue(item)
+			if err != nil {
+				return err
+			}
+
+			if pruned[string(hash)] {
+				keys = append(keys, item.KeyCopy(nil))
+				found++
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return s.dbDeleteKeys(keys)
+}
+
+//dbDeleteBelow deletes the keys of the form prefix_index, where index is lower
+//than limit.
+func (s *BadgerStore) dbDeleteBelow(prefix string, limit int) error {
+	keys := [][]byte{}
+	limitKey := []byte(fmt.Sprintf("%s_%09d", prefix, limit))
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		p := []byte(prefix + "_")
+		for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if bytes.Compare(key, limitKey) >= 0 {
+				break
+			}
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.dbDeleteKeys(keys)
+}
+
+func (s *BadgerStore) dbDeleteFrom(prefix string, from int) error {
+	keys := [][]byte{}
+	fromKey := []byte(fmt.Sprintf("%s_%09d", prefix, from))
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		p := []byte(prefix + "_")
+		for it.Seek(fromKey); it.ValidForPrefix(p); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.dbDeleteKeys(keys)
+}
+
+//dbGetBootstrapRounds returns the Rounds recorded by dbSetBootstrapRounds, which
+//are only left in the DB if Bootstrap was interrupted
+func (s *BadgerStore) dbGetBootstrapRounds() (map[string]int, error) {
+	var roundsBytes []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(bootRoundsKey))
+		if err != nil {
+			return err
+		}
+		roundsBytes, err = s.itemValue(item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rounds := make(map[string]int)
+	if err := json.Unmarshal(roundsBytes, &rounds); err != nil {
+		return nil, err
+	}
+
+	return rounds, nil
+}
+
+//dbSetBootstrapRounds records the Rounds of the Events that Bootstrap replays,
+//before it deletes the RoundInfos they were read from
+func (s *BadgerStore) dbSetBootstrapRounds(rounds map[string]int) error {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	val, err := json.Marshal(rounds)
+	if err != nil {
+		return err
+	}
+
+	//insert [key] => [event hash => round]
+	if err := s.setValue(tx, []byte(bootRoundsKey), val); err != nil {
+		return err
+	}
+
+	return tx.Commit(nil)
+}
+
+//dbDeleteBootstrapRounds deletes the Rounds recorded by dbSetBootstrapRounds,
+//once Bootstrap has replayed the Events and recorded their new RoundInfos
+func (s *BadgerStore) dbDeleteBootstrapRounds() error {
+	return s.dbDeleteKeys([][]byte{[]byte(bootRoundsKey)})
+}
+
+func (s *BadgerStore) dbDeleteKeys(keys [][]byte) error {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	for _, k := range keys {
+		if err := tx.Delete(k); err != nil {
+			if err == badger.ErrTxnTooBig {
+				if err := tx.Commit(nil); err != nil {
+					return err
+				}
+				tx = s.db.NewTransaction(true)
+				if err := tx.Delete(k); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+	}
+
+	return tx.Commit(nil)
+}
+
+//dbGetBase returns the newest of the bases recorded by Prune and Checkpoint. Their
+//Blocks are never pruned, but the Frame of an old Checkpoint might be.
+func (s *BadgerStore) dbGetBase() (*storeBase, error) {
+	var res *storeBase
+	for _, key := range []string{pruneBaseKey, anchorBaseKey} {
+		base, err := s.dbGetBaseByKey(key)
+		if err != nil {
+			if isDBKeyNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if res == nil || base.BlockIndex > res.BlockIndex {
+			res = base
+		}
+	}
+
+	if res == nil {
+		return nil, badger.ErrKeyNotFound
+	}
+
+	return res, nil
+}
+
+func (s *BadgerStore) dbGetBaseByKey(key string) (*storeBase, error) {
+	var baseBytes []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		baseBytes, err = s.itemValue(item)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	base := new(storeBase)
+	if err := json.Unmarshal(baseBytes, base); err != nil {
+		return nil, err
+	}
+
+	return base, nil
+}
+
+func (s *BadgerStore) dbSetBase(key string, base *storeBase) error {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	val, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+
+	//insert [key] => [block index, snapshot, topological index]
+	if err := s.setValue(tx, []byte(key), val); err != nil {
+		return err
+	}
+
+	return tx.Commit(nil)
+}
+
+func (s *BadgerStore) dbGetForkProof(creator string, index int) (*ForkProof, error) {
+	var proofBytes []byte
+	key := forkProofKey(creator, index)
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		proofBytes, err = s.itemValue(item)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	proof := new(ForkProof)
+	if err := proof.Unmarshal(proofBytes); err != nil {
+		return nil, err
+	}
+
+	return proof, nil
+}
+
+func (s *BadgerStore) dbSetForkProof(proof *ForkProof) error {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	key := forkProofKey(proof.Creator(), proof.Index())
+	val, err := proof.Marshal()
+	if err != nil {
+		return err
+	}
+
+	//insert [creator_index] => [ForkProof bytes]
+	if err := s.setValue(tx, key, val); err != nil {
+		return err
+	}
+
+	return tx.Commit(nil)
+}
+
+func (s *BadgerStore) dbGetForkProofs() ([]*ForkProof, error) {
+	proofs := []*ForkProof{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(forkProofPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			proofBytes, err := s.itemValue(item)
+			if err != nil {
+				return err
+			}
+
+			proof := new(ForkProof)
+			if err := proof.Unmarshal(proofBytes); err != nil {
+				return err
+			}
+
+			proofs = append(proofs, proof)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return proofs, nil
+}
+
+func (s *BadgerStore) dbGetTxLocation(hash string) (*TxLocation, error) {
+	var locationBytes []byte
+	key := txLocationKey(hash)
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		locationBytes, err = s.itemValue(item)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	location := new(TxLocation)
+	if err := location.Unmarshal(locationBytes); err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+func (s *BadgerStore) dbSetTxLocation(location *TxLocation) error {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	key := txLocationKey(location.TxHash)
+	val, err := location.Marshal()
+	if err != nil {
+		return err
+	}
+
+	//insert [tx hash] => [TxLocation bytes]
+	if err := s.setValue(tx, key, val); err != nil {
+		return err
+	}
+
+	return tx.Commit(nil)
+}
+
 func mapError(err error, name, key string) error {
 	if err != nil {
 		if isDBKeyNotFound(err) {
@@ -5,8 +5,12 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/dgraph-io/badger"
+	cm "github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/crypto"
 	"github.com/mosaicnetworks/babble/src/peers"
 )
 
@@ -51,6 +55,166 @@ func TestNewBadgerStore(t *testing.T) {
 	}
 }
 
+func TestBadgerSchemaVersion(t *testing.T) {
+	store := initBadgerStore(1000, t)
+	path := store.path
+	defer os.RemoveAll(path)
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	setVersion := func(version int) {
+		db, err := openBadgerDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		v, err := dbSchemaVersion(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != SCHEMA_VERSION {
+			t.Fatalf("Schema version should be %d, not %d", SCHEMA_VERSION, v)
+		}
+
+		if err := dbSetSchemaVersion(db, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//A database from a future version of Babble is refused
+	setVersion(SCHEMA_VERSION + 1)
+	if _, err := NewBadgerStore(1000, path); err == nil {
+		t.Fatalf("NewBadgerStore should refuse an unknown schema version")
+	}
+
+	//An outdated database is refused, and must be resynced
+	db, err := openBadgerDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbSetSchemaVersion(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, err = NewBadgerStore(1000, path)
+	if err == nil || !strings.Contains(err.Error(), "resync required") {
+		t.Fatalf("NewBadgerStore should refuse an outdated schema version, not return %v", err)
+	}
+}
+
+func TestBadgerVerify(t *testing.T) {
+	h, index := initConsensusHashgraph(true, t)
+	h.DivideRounds()
+	h.DecideFame()
+	h.DecideRoundReceived()
+	h.ProcessDecidedRounds()
+
+	if err := h.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(badgerDir)
+
+	report, err := VerifyBadgerStore(badgerDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("Database should not be corrupted: %v", report.Problems)
+	}
+	if report.Events != len(index) {
+		t.Fatalf("Report should count %d Events, not %d", len(index), report.Events)
+	}
+	if report.Blocks == 0 || report.Frames == 0 {
+		t.Fatalf("Report should count Blocks and Frames, not %d and %d", report.Blocks, report.Frames)
+	}
+	if report.Unsigned != report.Blocks {
+		t.Fatalf("Blocks should not be signed")
+	}
+
+	//Corrupt an Event, the index of another, a Frame, and a Block signature
+	db, err := openBadgerDB(badgerDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &BadgerStore{db: db, path: badgerDir}
+
+	forged, err := s.dbGetEvent(index["f1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Body.Transactions = [][]byte{[]byte("forged")}
+	forgedBytes, err := forged.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unindexed, err := s.dbGetEvent(index["g2"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := s.dbGetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := crypto.GenerateECDSAKey()
+	sig, err := block.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.SetSignature(sig)
+	if err := s.dbSetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := s.dbGetFrame(block.RoundReceived())
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame.Events = frame.Events[1:]
+	if err := s.dbSetFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set([]byte(index["f1"]), forgedBytes); err != nil {
+			return err
+		}
+		return txn.Delete(participantEventKey(unindexed.Creator(), unindexed.Index()))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = VerifyBadgerStore(badgerDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		fmt.Sprintf("Event %s: invalid signature", index["f1"]),
+		fmt.Sprintf("Event %s: not indexed", index["g2"]),
+		fmt.Sprintf("Events %d to %d are missing", unindexed.Index(), unindexed.Index()),
+		"Block 0: FrameHash does not match",
+		fmt.Sprintf("Block 0: signature of %s, who is not in the PeerSet", sig.ValidatorHex()),
+	}
+
+	problems := strings.Join(report.Problems, "\n")
+	for _, e := range expected {
+		if !strings.Contains(problems, e) {
+			t.Fatalf("Report should contain %q: %v", e, report.Problems)
+		}
+	}
+}
+
 /*******************************************************************************
 Call DB methods directly
 *******************************************************************************/
@@ -126,6 +290,7 @@ func TestDBEventMethods(t *testing.T) {
 		for k := 0; k < testSize; k++ {
 			event := NewEvent(
 				[][]byte{[]byte(fmt.Sprintf("%s_%d", p.hex[:5], k))},
+				nil,
 				[]BlockSignature{BlockSignature{Validator: []byte("validator"), Index: 0, Signature: "r|s"}},
 				[]string{"", ""},
 				p.pubKey,
@@ -164,7 +329,7 @@ func TestDBEventMethods(t *testing.T) {
 	}
 
 	//check topological order of events was correctly created
-	dbTopologicalEvents, err := store.dbTopologicalEvents()
+	dbTopologicalEvents, err := store.dbTopologicalEvents(0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -209,6 +374,7 @@ func TestDBRoundMethods(t *testing.T) {
 	events := make(map[string]*Event)
 	for _, p := range participants {
 		event := NewEvent([][]byte{},
+			nil,
 			[]BlockSignature{},
 			[]string{"", ""},
 			p.pubKey,
@@ -231,6 +397,35 @@ func TestDBRoundMethods(t *testing.T) {
 	}
 }
 
+func TestDBBootstrapRoundsMethods(t *testing.T) {
+	store := initBadgerStore(0, t)
+	defer removeBadgerStore(store, t)
+
+	if _, err := store.dbGetBootstrapRounds(); err == nil || !isDBKeyNotFound(err) {
+		t.Fatalf("dbGetBootstrapRounds should return KeyNotFound, not %v", err)
+	}
+
+	rounds := map[string]int{"0xAA": 3, "0xBB": 4}
+	if err := store.dbSetBootstrapRounds(rounds); err != nil {
+		t.Fatal(err)
+	}
+
+	storedRounds, err := store.dbGetBootstrapRounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rounds, storedRounds) {
+		t.Fatalf("Stored bootstrap Rounds should be %v, not %v", rounds, storedRounds)
+	}
+
+	if err := store.dbDeleteBootstrapRounds(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.dbGetBootstrapRounds(); err == nil || !isDBKeyNotFound(err) {
+		t.Fatalf("dbGetBootstrapRounds should return KeyNotFound after delete, not %v", err)
+	}
+}
+
 func TestDBBlockMethods(t *testing.T) {
 	cacheSize := 0
 
@@ -251,7 +446,7 @@ func TestDBBlockMethods(t *testing.T) {
 
 	frameHash := []byte("this is the frame hash")
 
-	block := NewBlock(index, roundReceived, frameHash, peerSet.Peers, transactions)
+	block := NewBlock(index, roundReceived, frameHash, peerSet.Peers, transactions, nil)
 
 	sig1, err := block.Sign(participants[0].privKey)
 	if err != nil {
@@ -322,6 +517,7 @@ func TestDBFrameMethods(t *testing.T) {
 	for id, p := range participants {
 		event := NewEvent(
 			[][]byte{[]byte(fmt.Sprintf("%s_%d", p.hex[:5], 0))},
+			nil,
 			[]BlockSignature{BlockSignature{Validator: []byte("validator"), Index: 0, Signature: "r|s"}},
 			[]string{"", ""},
 			p.pubKey,
@@ -370,6 +566,93 @@ Test wrapper methods work. These methods use the inmemStore as a cache on top of
 the DB.
 *******************************************************************************/
 
+func TestDBForkProofMethods(t *testing.T) {
+	cacheSize := 0
+
+	store := initBadgerStore(cacheSize, t)
+	defer removeBadgerStore(store, t)
+
+	proof, node := createForkProof(t)
+
+	t.Run("Store ForkProof", func(t *testing.T) {
+		if err := store.dbSetForkProof(proof); err != nil {
+			t.Fatal(err)
+		}
+
+		storedProof, err := store.dbGetForkProof(node.PubHex, proof.Index())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(storedProof, proof) {
+			t.Fatalf("ForkProof and StoredForkProof do not match")
+		}
+	})
+
+	t.Run("Get all ForkProofs", func(t *testing.T) {
+		proofs, err := store.dbGetForkProofs()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(proofs) != 1 || !reflect.DeepEqual(proofs[0], proof) {
+			t.Fatalf("dbGetForkProofs should return the stored ForkProof")
+		}
+	})
+
+	t.Run("Get ForkProof not in InmemStore", func(t *testing.T) {
+		if _, err := store.GetForkProof(node.PubHex, proof.Index()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := store.GetForkProof(node.PubHex, proof.Index()+1)
+		if !cm.Is(err, cm.KeyNotFound) {
+			t.Fatalf("GetForkProof should return KeyNotFound, not %v", err)
+		}
+	})
+}
+
+func TestDBTxLocationMethods(t *testing.T) {
+	cacheSize := 0
+
+	store := initBadgerStore(cacheSize, t)
+	defer removeBadgerStore(store, t)
+
+	location := &TxLocation{
+		TxHash:        TxHash([]byte("tx")),
+		BlockIndex:    3,
+		Position:      1,
+		EventHash:     "0xEVENT",
+		EventPosition: 2,
+	}
+
+	t.Run("Store TxLocation", func(t *testing.T) {
+		if err := store.dbSetTxLocation(location); err != nil {
+			t.Fatal(err)
+		}
+
+		storedLocation, err := store.dbGetTxLocation(location.TxHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(storedLocation, location) {
+			t.Fatalf("TxLocation and StoredTxLocation do not match")
+		}
+	})
+
+	t.Run("Get TxLocation not in InmemStore", func(t *testing.T) {
+		if _, err := store.GetTxLocation(location.TxHash); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := store.GetTxLocation(TxHash([]byte("other tx")))
+		if !cm.Is(err, cm.KeyNotFound) {
+			t.Fatalf("GetTxLocation should return KeyNotFound, not %v", err)
+		}
+	})
+}
+
 func TestBadgerPeerSets(t *testing.T) {
 	cacheSize := 1000
 
@@ -460,6 +743,7 @@ func TestBadgerEvents(t *testing.T) {
 		items := []*Event{}
 		for k := 0; k < testSize; k++ {
 			event := NewEvent([][]byte{[]byte(fmt.Sprintf("%s_%d", p.hex[:5], k))},
+				nil,
 				[]BlockSignature{BlockSignature{Validator: []byte("validator"), Index: 0, Signature: "r|s"}},
 				[]string{"", ""},
 				p.pubKey,
@@ -566,6 +850,7 @@ func TestBadgerRounds(t *testing.T) {
 	events := make(map[string]*Event)
 	for _, p := range participants {
 		event := NewEvent([][]byte{},
+			nil,
 			[]BlockSignature{},
 			[]string{"", ""},
 			p.pubKey,
@@ -618,7 +903,7 @@ func TestBadgerBlocks(t *testing.T) {
 	}
 
 	frameHash := []byte("this is the frame hash")
-	block := NewBlock(index, roundReceived, frameHash, []*peers.Peer{}, transactions)
+	block := NewBlock(index, roundReceived, frameHash, []*peers.Peer{}, transactions, nil)
 
 	sig1, err := block.Sign(participants[0].privKey)
 	if err != nil {
@@ -693,6 +978,7 @@ func TestBadgerFrames(t *testing.T) {
 	for id, p := range participants {
 		event := NewEvent(
 			[][]byte{[]byte(fmt.Sprintf("%s_%d", p.hex[:5], 0))},
+			nil,
 			[]BlockSignature{BlockSignature{Validator: []byte("validator"), Index: 0, Signature: "r|s"}},
 			[]string{"", ""},
 			p.pubKey,
@@ -0,0 +1,427 @@
+package hashgraph
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+//VerifyReport is the result of VerifyBadgerStore. Problems lists every piece of
+//corruption that was found; the counters describe what was checked.
+type VerifyReport struct {
+	SchemaVersion int
+	Events        int
+	Blocks        int
+	Frames        int //Frames checked against the FrameHash of their Blocks
+	PrunedFrames  int //Frames of Blocks that are no longer in the DB
+	Unsigned      int //Blocks without enough signatures to be trusted yet
+	Problems      []string
+}
+
+//OK returns true if no corruption was found
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyReport) addProblem(format string, a ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, a...))
+}
+
+//verifiedEvent is what the parent and index checks need to know of an Event
+type verifiedEvent struct {
+	creator     string
+	index       int
+	selfParent  string
+	otherParent string
+}
+
+/*
+VerifyBadgerStore opens the database in path read-only, with its encryption
+keys if it is encrypted, and checks its integrity without modifying it:
+
+  - every Event is stored under its hash, and its signature is valid
+  - the parents of every Event above the Root of its creator are known, and
+    its self-parent is the previous Event of the same creator
+  - the Events of every participant are indexed without gaps
+  - the FrameHash of every Block is the hash of its Frame, unless the Frame
+    was pruned
+  - the PeersHash of every Block is the hash of the PeerSet of its round, and
+    every signature of the Block is valid and comes from that PeerSet
+
+It returns an error only if the database cannot be read; corruption is listed
+in the Problems of the report.
+*/
+func VerifyBadgerStore(path string, keys [][]byte) (*VerifyReport, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	db, err := openBadgerDBReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var c *badgerCipher
+	if len(keys) > 0 {
+		if c, err = newBadgerCipher(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &BadgerStore{
+		db:     db,
+		cipher: c,
+		path:   path,
+	}
+
+	report := &VerifyReport{}
+
+	report.SchemaVersion, err = dbSchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case report.SchemaVersion < 0:
+		report.addProblem("Empty database")
+		return report, nil
+	case report.SchemaVersion != SCHEMA_VERSION:
+		report.addProblem("Schema version %d is not %d", report.SchemaVersion, SCHEMA_VERSION)
+	}
+
+	if err := checkEncryption(db, c, path, false); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyEvents(report); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyBlocks(report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+//verifyEvents checks the Events, their parents, and the participant indexes
+func (s *BadgerStore) verifyEvents(report *VerifyReport) error {
+	repertoire, err := s.dbGetRepertoire()
+	if err != nil {
+		return err
+	}
+
+	participants := []string{}
+	for pub := range repertoire {
+		participants = append(participants, pub)
+	}
+	sort.Strings(participants)
+
+	roots := make(map[string]*Root)
+	for _, pub := range participants {
+		root, err := s.dbGetRoot(pub)
+		if err != nil {
+			report.addProblem("Root of participant %s: %v", pub, err)
+			continue
+		}
+		roots[pub] = root
+	}
+
+	//Events are stored under their hash. Participant and Root keys also start
+	//with a public key in hex, but contain an underscore.
+	events := make(map[string]verifiedEvent)
+	err = s.dbScan([]byte("0x"), func(key string, val []byte) error {
+		if strings.Contains(key, "_") {
+			return nil
+		}
+
+		event := new(Event)
+		if err := event.Unmarshal(val); err != nil {
+			report.addProblem("Event %s: %v", key, err)
+			return nil
+		}
+		report.Events++
+
+		if event.Hex() != key {
+			report.addProblem("Event %s: hash is %s", key, event.Hex())
+		}
+
+		if ok, err := event.Verify(); !ok {
+			if err != nil {
+				report.addProblem("Event %s: invalid signature: %v", key, err)
+			} else {
+				report.addProblem("Event %s: invalid signature", key)
+			}
+		}
+
+		if _, ok := repertoire[event.Creator()]; !ok {
+			report.addProblem("Event %s: unknown creator %s", key, event.Creator())
+		}
+
+		events[key] = verifiedEvent{
+			creator:     event.Creator(),
+			index:       event.Index(),
+			selfParent:  event.SelfParent(),
+			otherParent: event.OtherParent(),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	hashes := []string{}
+	for hash := range events {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	for _, hash := range hashes {
+		verifyEventParents(hash, events, roots, report)
+	}
+
+	indexed := make(map[string]bool)
+	for _, pub := range participants {
+		root, ok := roots[pub]
+		if !ok {
+			continue
+		}
+
+		if err := s.verifyParticipantEvents(pub, root, events, indexed, report); err != nil {
+			return err
+		}
+	}
+
+	for _, hash := range hashes {
+		ev := events[hash]
+		if _, ok := roots[ev.creator]; ok && !indexed[hash] {
+			report.addProblem("Event %s: not indexed as Event %d of %s", hash, ev.index, ev.creator)
+		}
+	}
+
+	return nil
+}
+
+//verifyEventParents checks the parents of an Event like InsertEvent would. The
+//parents of Events below the Root of their creator may have been pruned.
+func verifyEventParents(hash string, events map[string]verifiedEvent, roots map[string]*Root, report *VerifyReport) {
+	ev := events[hash]
+
+	root, ok := roots[ev.creator]
+	if !ok || ev.index <= root.Past[root.Head].Index {
+		return
+	}
+
+	if sp, ok := events[ev.selfParent]; ok {
+		if sp.creator != ev.creator || sp.index != ev.index-1 {
+			report.addProblem("Event %s: self-parent %s is not the previous Event of its creator", hash, ev.selfParent)
+		}
+	} else if re, ok := root.Past[ev.selfParent]; ok {
+		if re.Index != ev.index-1 {
+			report.addProblem("Event %s: self-parent %s is not the previous Event of its creator", hash, ev.selfParent)
+		}
+	} else {
+		report.addProblem("Event %s: self-parent %s not found", hash, ev.selfParent)
+	}
+
+	if ev.otherParent == "" {
+		return
+	}
+
+	if _, ok := events[ev.otherParent]; ok {
+		return
+	}
+
+	for _, r := range roots {
+		if _, ok := r.Past[ev.otherParent]; ok {
+			return
+		}
+	}
+
+	report.addProblem("Event %s: other-parent %s not found", hash, ev.otherParent)
+}
+
+//verifyParticipantEvents checks that the Events of a participant are indexed
+//without gaps above its Root, and that every index points to the right Event
+func (s *BadgerStore) verifyParticipantEvents(pub string, root *Root, events map[string]verifiedEvent, indexed map[string]bool, report *VerifyReport) error {
+	prefix := pub + "__event_"
+	next := root.Past[root.Head].Index + 1
+
+	err := s.dbScan([]byte(prefix), func(key string, val []byte) error {
+		var index int
+		if _, err := fmt.Sscanf(key[len(prefix):], "%d", &index); err != nil {
+			report.addProblem("Invalid key %s", key)
+			return nil
+		}
+
+		//Events below the Root may remain after a Reset
+		if index > next {
+			report.addProblem("Participant %s: Events %d to %d are missing", pub, next, index-1)
+		}
+		next = index + 1
+
+		hash := string(val)
+		ev, ok := events[hash]
+		switch {
+		case !ok:
+			report.addProblem("Participant %s: Event %d (%s) not found", pub, index, hash)
+		case ev.creator != pub || ev.index != index:
+			report.addProblem("Participant %s: Event %d (%s) is Event %d of %s", pub, index, hash, ev.index, ev.creator)
+		default:
+			indexed[hash] = true
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+//verifyBlocks checks the Blocks against their Frames and PeerSets
+func (s *BadgerStore) verifyBlocks(report *VerifyReport) error {
+	recorded, err := s.dbGetPeerSets()
+	if err != nil {
+		return err
+	}
+
+	peerSets := NewPeerSetCache()
+	for round, peerSet := range recorded {
+		if err := peerSets.Set(round, peerSet); err != nil {
+			return err
+		}
+	}
+
+	frameHashes := make(map[int][]byte)
+	next := -1
+
+	err = s.dbScan([]byte(blockPrefix+"_"), func(key string, val []byte) error {
+		var index int
+		if _, err := fmt.Sscanf(key, blockPrefix+"_%d", &index); err != nil {
+			report.addProblem("Invalid key %s", key)
+			return nil
+		}
+
+		if next >= 0 && index != next {
+			report.addProblem("Blocks %d to %d are missing", next, index-1)
+		}
+		next = index + 1
+
+		block := new(Block)
+		if err := block.Unmarshal(val); err != nil {
+			report.addProblem("Block %d: %v", index, err)
+			return nil
+		}
+		report.Blocks++
+
+		if block.Index() != index {
+			report.addProblem("Block %d: index is %d", index, block.Index())
+		}
+
+		rr := block.RoundReceived()
+		frameHash, ok := frameHashes[rr]
+		if !ok {
+			frame, err := s.dbGetFrame(rr)
+			switch {
+			case err != nil && isDBKeyNotFound(err):
+				report.PrunedFrames++
+			case err != nil:
+				report.addProblem("Frame %d: %v", rr, err)
+			default:
+				if frameHash, err = frame.Hash(); err != nil {
+					return err
+				}
+				report.Frames++
+			}
+			frameHashes[rr] = frameHash
+		}
+
+		if frameHash != nil && !bytes.Equal(frameHash, block.FrameHash()) {
+			report.addProblem("Block %d: FrameHash does not match Frame %d", index, rr)
+		}
+
+		peerSet, err := peerSets.Get(rr)
+		if err != nil {
+			report.addProblem("Block %d: no PeerSet for round %d", index, rr)
+			return nil
+		}
+
+		verifyBlockSignatures(block, peerSet, report)
+
+		return nil
+	})
+
+	return err
+}
+
+//verifyBlockSignatures checks the PeersHash and signatures of a Block like
+//CheckBlock, but lists every bad signature
+func verifyBlockSignatures(block *Block, peerSet *peers.PeerSet, report *VerifyReport) {
+	peersHash, err := peerSet.Hash()
+	if err != nil {
+		report.addProblem("PeerSet of round %d: %v", block.RoundReceived(), err)
+		return
+	}
+
+	if !bytes.Equal(peersHash, block.PeersHash()) {
+		report.addProblem("Block %d: PeersHash does not match the PeerSet of round %d", block.Index(), block.RoundReceived())
+		return
+	}
+
+	signatures := block.GetSignatures()
+	sort.Slice(signatures, func(i, j int) bool {
+		return bytes.Compare(signatures[i].Validator, signatures[j].Validator) < 0
+	})
+
+	weight := 0
+	for _, sig := range signatures {
+		validator, ok := peerSet.ByPubKey[sig.ValidatorHex()]
+		if !ok {
+			report.addProblem("Block %d: signature of %s, who is not in the PeerSet", block.Index(), sig.ValidatorHex())
+			continue
+		}
+
+		ok, err := block.Verify(sig)
+		if err != nil {
+			report.addProblem("Block %d: %v", block.Index(), err)
+			return
+		}
+		if !ok {
+			report.addProblem("Block %d: invalid signature of %s", block.Index(), sig.ValidatorHex())
+			continue
+		}
+
+		weight += validator.VotingWeight()
+	}
+
+	if weight <= peerSet.TrustCount() {
+		report.Unsigned++
+	}
+}
+
+//dbScan calls fn on every key of the DB that starts with prefix, in order
+func (s *BadgerStore) dbScan(prefix []byte, fn func(key string, val []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			val, err := s.itemValue(item)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(string(item.Key()), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/mosaicnetworks/babble/src/crypto"
 	"github.com/mosaicnetworks/babble/src/peers"
@@ -16,12 +17,20 @@ BlockBody
 *******************************************************************************/
 
 type BlockBody struct {
-	Index         int
-	RoundReceived int
-	StateHash     []byte
-	FrameHash     []byte
-	PeersHash     []byte
-	Transactions  [][]byte
+	Index                int
+	RoundReceived        int
+	StateHash            []byte
+	FrameHash            []byte
+	PeersHash            []byte
+	Transactions         [][]byte
+	InternalTransactions []InternalTransaction
+	Timestamp            time.Time //latest consensus timestamp of the Block's Events
+	TxRoot               []byte    //Merkle root of the Transactions
+
+	//InternalTransactionReceipts are the decisions of the application on the
+	//InternalTransactions, set with the StateHash when the Block is committed.
+	//They determine the next PeerSet, including the Weights of new Peers.
+	InternalTransactionReceipts []InternalTransactionReceipt `json:",omitempty"`
 }
 
 //json encoding of body only
@@ -51,6 +60,124 @@ func (bb *BlockBody) Hash() ([]byte, error) {
 	return crypto.SHA256(hashBytes), nil
 }
 
+//Header returns the BlockHeader corresponding to the BlockBody
+func (bb *BlockBody) Header() BlockHeader {
+	return BlockHeader{
+		Index:                bb.Index,
+		RoundReceived:        bb.RoundReceived,
+		StateHash:            bb.StateHash,
+		FrameHash:            bb.FrameHash,
+		PeersHash:            bb.PeersHash,
+		TxRoot:               bb.TxRoot,
+		TxCount:              len(bb.Transactions),
+		InternalTransactions: bb.InternalTransactions,
+		Timestamp:            bb.Timestamp,
+
+		InternalTransactionReceipts: bb.InternalTransactionReceipts,
+	}
+}
+
+//TxRoot computes the Merkle root of a list of transactions. The leaves are the
+//MerkleLeafHash of the transactions.
+func TxRoot(txs [][]byte) []byte {
+	return crypto.MerkleRoot(txLeaves(txs))
+}
+
+func txLeaves(txs [][]byte) [][]byte {
+	leaves := make([][]byte, len(txs))
+	for i, tx := range txs {
+		leaves[i] = crypto.MerkleLeafHash(tx)
+	}
+	return leaves
+}
+
+/*******************************************************************************
+BlockHeader
+*******************************************************************************/
+
+/*
+BlockHeader is the part of a BlockBody that validators sign. It replaces the
+Transactions with their Merkle root and their number, so that a client holding
+only a signed BlockHeader can verify, with a TxProof, that a transaction was
+included in the Block. The InternalTransactionReceipts are signed, so that
+clients can follow the PeerSet without running the hashgraph.
+*/
+type BlockHeader struct {
+	Index                int
+	RoundReceived        int
+	StateHash            []byte
+	FrameHash            []byte
+	PeersHash            []byte
+	TxRoot               []byte
+	TxCount              int
+	InternalTransactions []InternalTransaction
+	Timestamp            time.Time
+
+	InternalTransactionReceipts []InternalTransactionReceipt `json:",omitempty"`
+}
+
+//json encoding of header
+func (bh *BlockHeader) Marshal() ([]byte, error) {
+	bf := bytes.NewBuffer([]byte{})
+	enc := json.NewEncoder(bf)
+	if err := enc.Encode(bh); err != nil {
+		return nil, err
+	}
+	return bf.Bytes(), nil
+}
+
+func (bh *BlockHeader) Hash() ([]byte, error) {
+	hashBytes, err := bh.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SHA256(hashBytes), nil
+}
+
+//Verify checks a BlockSignature against the BlockHeader
+func (bh *BlockHeader) Verify(sig BlockSignature) (bool, error) {
+	signBytes, err := bh.Hash()
+	if err != nil {
+		return false, err
+	}
+
+	pubKey := crypto.ToECDSAPub(sig.Validator)
+	if pubKey == nil || pubKey.X == nil {
+		return false, fmt.Errorf("Invalid validator public key")
+	}
+
+	r, s, err := crypto.DecodeSignature(sig.Signature)
+	if err != nil {
+		return false, err
+	}
+
+	return crypto.Verify(pubKey, signBytes, r, s), nil
+}
+
+/*******************************************************************************
+TxProof
+*******************************************************************************/
+
+//TxProof proves that a transaction is included in the Block whose TxRoot is
+//Root
+type TxProof struct {
+	BlockIndex int
+	Index      int //position of the transaction in the Block
+	Tx         []byte
+	Root       []byte
+	Proof      crypto.SimpleProof
+}
+
+//Verify checks the proof against a signed BlockHeader. The number of
+//transactions is taken from the header, because the shape of the tree, and
+//hence the meaning of the proof, depends on it.
+func (tp *TxProof) Verify(header *BlockHeader) bool {
+	if tp.BlockIndex != header.Index || !bytes.Equal(tp.Root, header.TxRoot) {
+		return false
+	}
+	return tp.Proof.Verify(tp.Index, header.TxCount, crypto.MerkleLeafHash(tp.Tx), header.TxRoot)
+}
+
 /*******************************************************************************
 BlockSignature
 *******************************************************************************/
@@ -112,25 +239,87 @@ type Block struct {
 	peerSet *peers.PeerSet
 }
 
+//NewBlockFromFrame creates a single Block with all the transactions of a Frame
 func NewBlockFromFrame(blockIndex int, frame *Frame) (*Block, error) {
+	blocks, err := NewBlocksFromFrame(blockIndex, frame, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks[0], nil
+}
+
+/*
+NewBlocksFromFrame creates consecutive Blocks, starting at firstIndex, with the
+transactions of a Frame. A Block holds at most maxTransactions transactions,
+whose sizes add up to at most maxBytes; a zero limit means no limit. A
+transaction larger than maxBytes gets a Block of its own. InternalTransactions
+are not counted and go in the last Block. All the Blocks point to the same
+Frame, and the Timestamp of each Block is the latest ConsensusTimestamp of the
+Events whose transactions it contains. There is always at least one Block, which
+may be empty.
+*/
+func NewBlocksFromFrame(firstIndex int, frame *Frame, maxTransactions, maxBytes int) ([]*Block, error) {
 	frameHash, err := frame.Hash()
 	if err != nil {
 		return nil, err
 	}
 
-	transactions := [][]byte{}
+	type chunk struct {
+		transactions [][]byte
+		size         int
+		timestamp    time.Time
+	}
+
+	chunks := []*chunk{{transactions: [][]byte{}}}
+	internalTransactions := []InternalTransaction{}
 	for _, e := range frame.Events {
-		transactions = append(transactions, e.Transactions()...)
+		current := chunks[len(chunks)-1]
+
+		for _, tx := range e.Transactions() {
+			full := (maxTransactions > 0 && len(current.transactions) >= maxTransactions) ||
+				(maxBytes > 0 && current.size+len(tx) > maxBytes)
+
+			if full && len(current.transactions) > 0 {
+				current = &chunk{transactions: [][]byte{}}
+				chunks = append(chunks, current)
+			}
+
+			current.transactions = append(current.transactions, tx)
+			current.size += len(tx)
+			if e.ConsensusTimestamp.After(current.timestamp) {
+				current.timestamp = e.ConsensusTimestamp
+			}
+		}
+
+		internalTransactions = append(internalTransactions, e.InternalTransactions()...)
+		if e.ConsensusTimestamp.After(current.timestamp) {
+			current.timestamp = e.ConsensusTimestamp
+		}
 	}
 
-	return NewBlock(blockIndex, frame.Round, frameHash, frame.Peers, transactions), nil
+	blocks := make([]*Block, len(chunks))
+	for i, c := range chunks {
+		itxs := []InternalTransaction{}
+		if i == len(chunks)-1 {
+			itxs = internalTransactions
+		}
+
+		block := NewBlock(firstIndex+i, frame.Round, frameHash, frame.Peers, c.transactions, itxs)
+		block.Body.Timestamp = c.timestamp
+
+		blocks[i] = block
+	}
+
+	return blocks, nil
 }
 
 func NewBlock(blockIndex,
 	roundReceived int,
 	frameHash []byte,
 	peerSlice []*peers.Peer,
-	txs [][]byte) *Block {
+	txs [][]byte,
+	itxs []InternalTransaction) *Block {
 
 	peerSet := peers.NewPeerSet(peerSlice)
 
@@ -140,12 +329,14 @@ func NewBlock(blockIndex,
 	}
 
 	body := BlockBody{
-		Index:         blockIndex,
-		RoundReceived: roundReceived,
-		StateHash:     []byte{},
-		FrameHash:     frameHash,
-		PeersHash:     peersHash,
-		Transactions:  txs,
+		Index:                blockIndex,
+		RoundReceived:        roundReceived,
+		StateHash:            []byte{},
+		FrameHash:            frameHash,
+		PeersHash:            peersHash,
+		Transactions:         txs,
+		InternalTransactions: itxs,
+		TxRoot:               TxRoot(txs),
 	}
 
 	return &Block{
@@ -163,6 +354,14 @@ func (b *Block) Transactions() [][]byte {
 	return b.Body.Transactions
 }
 
+func (b *Block) InternalTransactions() []InternalTransaction {
+	return b.Body.InternalTransactions
+}
+
+func (b *Block) InternalTransactionReceipts() []InternalTransactionReceipt {
+	return b.Body.InternalTransactionReceipts
+}
+
 func (b *Block) RoundReceived() int {
 	return b.Body.RoundReceived
 }
@@ -179,6 +378,10 @@ func (b *Block) PeersHash() []byte {
 	return b.Body.PeersHash
 }
 
+func (b *Block) Timestamp() time.Time {
+	return b.Body.Timestamp
+}
+
 func (b *Block) GetSignatures() []BlockSignature {
 	res := make([]BlockSignature, len(b.Signatures))
 	i := 0
@@ -210,6 +413,30 @@ func (b *Block) GetSignature(validator string) (res BlockSignature, err error) {
 
 func (b *Block) AppendTransactions(txs [][]byte) {
 	b.Body.Transactions = append(b.Body.Transactions, txs...)
+	b.Body.TxRoot = TxRoot(b.Body.Transactions)
+}
+
+//Header returns the BlockHeader, which is what validators sign
+func (b *Block) Header() BlockHeader {
+	return b.Body.Header()
+}
+
+//TxProof returns a proof that the i-th transaction is included in the Block
+func (b *Block) TxProof(i int) (*TxProof, error) {
+	txs := b.Transactions()
+	if i < 0 || i >= len(txs) {
+		return nil, fmt.Errorf("Transaction %d not found in Block %d", i, b.Index())
+	}
+
+	root, proof := crypto.SimpleProofFromHashes(txLeaves(txs), i)
+
+	return &TxProof{
+		BlockIndex: b.Index(),
+		Index:      i,
+		Tx:         txs[i],
+		Root:       root,
+		Proof:      *proof,
+	}, nil
 }
 
 func (b *Block) Marshal() ([]byte, error) {
@@ -249,8 +476,10 @@ func (b *Block) Hex() string {
 	return b.hex
 }
 
+//Sign signs the hash of the BlockHeader
 func (b *Block) Sign(privKey *ecdsa.PrivateKey) (bs BlockSignature, err error) {
-	signBytes, err := b.Body.Hash()
+	header := b.Header()
+	signBytes, err := header.Hash()
 	if err != nil {
 		return bs, err
 	}
@@ -272,18 +501,13 @@ func (b *Block) SetSignature(bs BlockSignature) error {
 	return nil
 }
 
+//Verify checks a BlockSignature against the BlockHeader. It also checks that
+//the TxRoot matches the Transactions.
 func (b *Block) Verify(sig BlockSignature) (bool, error) {
-	signBytes, err := b.Body.Hash()
-	if err != nil {
-		return false, err
+	if !bytes.Equal(b.Body.TxRoot, TxRoot(b.Transactions())) {
+		return false, fmt.Errorf("TxRoot does not match Transactions")
 	}
 
-	pubKey := crypto.ToECDSAPub(sig.Validator)
-
-	r, s, err := crypto.DecodeSignature(sig.Signature)
-	if err != nil {
-		return false, err
-	}
-
-	return crypto.Verify(pubKey, signBytes, r, s), nil
+	header := b.Header()
+	return header.Verify(sig)
 }
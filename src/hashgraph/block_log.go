@@ -0,0 +1,439 @@
+package hashgraph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	cm "github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+const (
+	//BlockLogJSON writes a block log as newline-delimited JSON
+	BlockLogJSON = "json"
+	//BlockLogBinary writes a block log as a stream of length-prefixed records
+	BlockLogBinary = "binary"
+
+	//blockLogMagic starts every binary block log
+	blockLogMagic = "BABBLK01"
+
+	blockLogPeerSet byte = 1
+	blockLogBlock   byte = 2
+)
+
+//BlockLogPeerSet is the PeerSet of the Blocks that follow it in a block log.
+//Round is the RoundReceived of the first of them.
+type BlockLogPeerSet struct {
+	Round int
+	Peers []*peers.Peer
+}
+
+//blockLogEntry is a line of a JSON block log
+type blockLogEntry struct {
+	PeerSet *BlockLogPeerSet `json:",omitempty"`
+	Block   *Block           `json:",omitempty"`
+}
+
+/*
+BlockLogWriter writes signed Blocks to a block log, which is the format of
+`babble blocks export`. Every Block is preceded by the PeerSet that signed it,
+unless it is the PeerSet of the previous Block, so that the log can be verified
+on its own.
+
+In the JSON format, every line is an object with either a PeerSet or a Block. In
+the binary format, the log starts with a magic number, and every record is a
+kind byte, followed by the length of the record, as a big-endian uint32, and
+the record itself, which is the JSON encoding of the PeerSet or Block.
+*/
+type BlockLogWriter struct {
+	w         io.Writer
+	format    string
+	peersHash []byte
+}
+
+//NewBlockLogWriter returns a BlockLogWriter in the format BlockLogJSON or
+//BlockLogBinary
+func NewBlockLogWriter(w io.Writer, format string) (*BlockLogWriter, error) {
+	switch format {
+	case BlockLogJSON:
+	case BlockLogBinary:
+		if _, err := w.Write([]byte(blockLogMagic)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown block log format %s", format)
+	}
+
+	return &BlockLogWriter{
+		w:      w,
+		format: format,
+	}, nil
+}
+
+//Write appends a Block to the log, after the PeerSet that signed it if it is
+//not the PeerSet of the previous Block
+func (bw *BlockLogWriter) Write(block *Block, peerSet *peers.PeerSet) error {
+	peersHash, err := peerSet.Hash()
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(peersHash, bw.peersHash) {
+		ps := &BlockLogPeerSet{
+			Round: block.RoundReceived(),
+			Peers: peerSet.Peers,
+		}
+		if err := bw.write(blockLogPeerSet, blockLogEntry{PeerSet: ps}); err != nil {
+			return err
+		}
+		bw.peersHash = peersHash
+	}
+
+	return bw.write(blockLogBlock, blockLogEntry{Block: block})
+}
+
+func (bw *BlockLogWriter) write(kind byte, entry blockLogEntry) error {
+	if bw.format == BlockLogJSON {
+		return json.NewEncoder(bw.w).Encode(entry)
+	}
+
+	var value interface{} = entry.Block
+	if kind == blockLogPeerSet {
+		value = entry.PeerSet
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 5)
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+
+	if _, err := bw.w.Write(header); err != nil {
+		return err
+	}
+	_, err = bw.w.Write(data)
+	return err
+}
+
+//BlockLogReader reads the Blocks of a block log written by a BlockLogWriter, in
+//either format
+type BlockLogReader struct {
+	r       *bufio.Reader
+	dec     *json.Decoder
+	peerSet *BlockLogPeerSet
+}
+
+//NewBlockLogReader returns a BlockLogReader. The format of the log is detected
+//from its first bytes.
+func NewBlockLogReader(r io.Reader) (*BlockLogReader, error) {
+	br := &BlockLogReader{
+		r: bufio.NewReader(r),
+	}
+
+	magic, err := br.r.Peek(len(blockLogMagic))
+	if err == nil && string(magic) == blockLogMagic {
+		if _, err := br.r.Discard(len(blockLogMagic)); err != nil {
+			return nil, err
+		}
+	} else {
+		br.dec = json.NewDecoder(br.r)
+	}
+
+	return br, nil
+}
+
+//Next returns the next Block of the log, and the PeerSet recorded before it. It
+//returns io.EOF after the last Block.
+func (br *BlockLogReader) Next() (*Block, *BlockLogPeerSet, error) {
+	for {
+		entry, err := br.read()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if entry.PeerSet != nil {
+			br.peerSet = entry.PeerSet
+			continue
+		}
+
+		if entry.Block == nil {
+			return nil, nil, fmt.Errorf("Empty block log record")
+		}
+
+		if br.peerSet == nil {
+			return nil, nil, fmt.Errorf("Block %d has no PeerSet", entry.Block.Index())
+		}
+
+		return entry.Block, br.peerSet, nil
+	}
+}
+
+func (br *BlockLogReader) read() (blockLogEntry, error) {
+	var entry blockLogEntry
+
+	if br.dec != nil {
+		err := br.dec.Decode(&entry)
+		return entry, err
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(br.r, header); err != nil {
+		return entry, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(br.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return entry, err
+	}
+
+	switch header[0] {
+	case blockLogPeerSet:
+		entry.PeerSet = &BlockLogPeerSet{}
+		return entry, json.Unmarshal(data, entry.PeerSet)
+	case blockLogBlock:
+		entry.Block = &Block{}
+		return entry, json.Unmarshal(data, entry.Block)
+	}
+
+	return entry, fmt.Errorf("Unknown block log record kind %d", header[0])
+}
+
+//RecordedPeerSets returns a copy of the PeerSets recorded in the Store, by the
+//round from which they take effect. A persistent Store that was not
+//bootstrapped only has its PeerSets in the DB.
+func RecordedPeerSets(store Store) (*PeerSetCache, error) {
+	var recorded map[int]*peers.PeerSet
+
+	if ps, ok := store.(persistentStore); ok {
+		var err error
+		recorded, err = ps.dbGetPeerSets()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		future, err := store.GetFuturePeerSets(-1)
+		if err != nil {
+			return nil, err
+		}
+		recorded = make(map[int]*peers.PeerSet)
+		for round, ps := range future {
+			recorded[round] = peers.NewPeerSet(ps)
+		}
+	}
+
+	cache := NewPeerSetCache()
+	for round, peerSet := range recorded {
+		if err := cache.Set(round, peerSet); err != nil {
+			return nil, err
+		}
+	}
+
+	return cache, nil
+}
+
+//ExportBlocks writes the Blocks from index from to index to, included, with
+//their PeerSets, to a block log in the given format. A negative to exports
+//all the Blocks from index from. It returns the number of Blocks written.
+func ExportBlocks(store Store, w io.Writer, format string, from, to int) (int, error) {
+	if from < 0 {
+		return 0, fmt.Errorf("Invalid first Block %d", from)
+	}
+
+	recorded, err := RecordedPeerSets(store)
+	if err != nil {
+		return 0, err
+	}
+
+	writer, err := NewBlockLogWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := from; to < 0 || i <= to; i++ {
+		block, err := store.GetBlock(i)
+		if err != nil {
+			if to < 0 && i > from && cm.Is(err, cm.KeyNotFound) {
+				break
+			}
+			return count, fmt.Errorf("Block %d: %v", i, err)
+		}
+
+		peerSet, err := recorded.Get(block.RoundReceived())
+		if err != nil {
+			return count, fmt.Errorf("PeerSet of Block %d: %v", i, err)
+		}
+
+		if err := writer.Write(block, peerSet); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+/*
+ImportBlocks reads a block log, verifies every Block with CheckBlock, and saves
+the Blocks and their PeerSets in the Store. It returns the number of Blocks
+saved.
+
+The PeerSets of the log are not trusted. The PeerSet of the first Block is the
+one the Store has for its round or, if the Store has no PeerSet,
+genesisPeerSet. The following PeerSets are derived from the
+InternalTransactionReceipts of the verified Blocks by a PeerSetTracker, so a
+log that starts while a new PeerSet is waiting to take effect fails to verify
+when it does. The import
+fails if the log or the Store has another PeerSet than the derived one, and a
+PeerSet of the Store is never replaced. Blocks that are already in the Store
+are skipped, but must have the same body.
+*/
+func (h *Hashgraph) ImportBlocks(r io.Reader, genesisPeerSet *peers.PeerSet) (int, error) {
+	reader, err := NewBlockLogReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	recorded, err := RecordedPeerSets(h.Store)
+	if err != nil {
+		return 0, err
+	}
+
+	var tracker *PeerSetTracker
+	var current *BlockLogPeerSet
+	var currentHash []byte
+
+	count := 0
+	for {
+		block, logPeerSet, err := reader.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if tracker == nil {
+			trusted, err := recorded.Get(block.RoundReceived())
+			if cm.Is(err, cm.KeyNotFound) {
+				if genesisPeerSet == nil {
+					return count, fmt.Errorf("No trusted PeerSet for Block %d: the Store has no PeerSet and no genesis PeerSet was given", block.Index())
+				}
+				trusted, err = genesisPeerSet, nil
+			}
+			if err != nil {
+				return count, err
+			}
+			tracker = NewPeerSetTracker(trusted)
+		}
+
+		peerSet, err := tracker.Next(block, func(peerSet *peers.PeerSet) error {
+			return h.CheckBlock(block, peerSet)
+		})
+		if err != nil {
+			return count, err
+		}
+
+		if logPeerSet != current {
+			currentHash, err = peers.NewPeerSet(logPeerSet.Peers).Hash()
+			if err != nil {
+				return count, err
+			}
+			current = logPeerSet
+		}
+		if !bytes.Equal(currentHash, block.PeersHash()) {
+			return count, fmt.Errorf("Block %d: the PeerSet of the block log does not match the Block", block.Index())
+		}
+
+		if err := h.importPeerSet(recorded, block.RoundReceived(), peerSet); err != nil {
+			return count, err
+		}
+
+		saved, err := h.importBlock(block)
+		if err != nil {
+			return count, err
+		}
+		if saved {
+			count++
+		}
+	}
+}
+
+//importPeerSet checks that the Store has peerSet for round. If the Store has no
+//PeerSet for round, or round is after the last PeerSet of the Store and peerSet
+//is new, it saves it in the Store and in recorded.
+func (h *Hashgraph) importPeerSet(recorded *PeerSetCache, round int, peerSet *peers.PeerSet) error {
+	known, err := recorded.Get(round)
+	if err != nil && !cm.Is(err, cm.KeyNotFound) {
+		return err
+	}
+
+	if err == nil {
+		knownHash, err := known.Hash()
+		if err != nil {
+			return err
+		}
+
+		peersHash, err := peerSet.Hash()
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(knownHash, peersHash) {
+			return nil
+		}
+
+		if round <= recorded.rounds[len(recorded.rounds)-1] {
+			return fmt.Errorf("PeerSet of round %d does not match the PeerSet in the Store", round)
+		}
+	}
+
+	if err := h.Store.SetPeerSet(round, peerSet); err != nil {
+		return fmt.Errorf("PeerSet of round %d: %v", round, err)
+	}
+
+	return recorded.Set(round, peerSet)
+}
+
+//importBlock saves a Block, unless the Store already has it. It returns whether
+//the Block was saved.
+func (h *Hashgraph) importBlock(block *Block) (bool, error) {
+	existing, err := h.Store.GetBlock(block.Index())
+	if err != nil && !cm.Is(err, cm.KeyNotFound) {
+		return false, err
+	}
+
+	if err == nil {
+		existingHash, err := existing.Body.Hash()
+		if err != nil {
+			return false, err
+		}
+
+		blockHash, err := block.Body.Hash()
+		if err != nil {
+			return false, err
+		}
+
+		if !bytes.Equal(existingHash, blockHash) {
+			return false, fmt.Errorf("Block %d does not match the Block in the Store", block.Index())
+		}
+
+		return false, nil
+	}
+
+	if err := h.Store.SetBlock(block); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,376 @@
+package hashgraph
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+//initBlockLogStore fills a Store with signed Blocks 0 to 9, with RoundReceived
+//equal to their index. A fourth peer, with a Weight of 2, joins at round 8. If
+//withJoin is false, Block 2 does not contain the InternalTransaction that adds
+//it, nor its receipt, so its PeerSet cannot be derived.
+func initBlockLogStore(store Store, withJoin bool, t *testing.T) []*Block {
+	peerSet, participants := initPeers(3)
+
+	key, _ := crypto.GenerateECDSAKey()
+	pubKey := crypto.FromECDSAPub(&key.PublicKey)
+	newPeer := peers.NewPeer(fmt.Sprintf("0x%X", pubKey), "")
+	participants = append(participants, participant{newPeer.ID(), key, pubKey, newPeer.PubKeyHex})
+	join := NewInternalTransactionJoin(*newPeer)
+	weighted := *newPeer
+	weighted.Weight = 2
+	peerSet8 := peerSet.WithNewPeer(&weighted)
+
+	joinRound := 8 - PEERSET_DELAY
+
+	if err := store.SetPeerSet(0, peerSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetPeerSet(8, peerSet8); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := []*Block{}
+	for i := 0; i < 10; i++ {
+		ps, signers := peerSet, participants[:3]
+		if i >= 8 {
+			ps, signers = peerSet8, participants
+		}
+
+		var itxs []InternalTransaction
+		if withJoin && i == joinRound {
+			itxs = append(itxs, join)
+		}
+
+		block := NewBlock(i, i, []byte("framehash"), ps.Peers,
+			[][]byte{[]byte(fmt.Sprintf("tx%d", i))}, itxs)
+		if withJoin && i == joinRound {
+			block.Body.InternalTransactionReceipts = []InternalTransactionReceipt{join.AsAcceptedWithWeight(2)}
+		}
+
+		for _, p := range signers {
+			sig, err := block.Sign(p.privKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block.SetSignature(sig)
+		}
+
+		if err := store.SetBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+func checkImportedBlocks(store Store, blocks []*Block, t *testing.T) {
+	for _, b := range blocks {
+		res, err := store.GetBlock(b.Index())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, _ := b.Marshal()
+		actual, _ := res.Marshal()
+		if !bytes.Equal(expected, actual) {
+			t.Fatalf("Block %d should be %s, not %s", b.Index(), expected, actual)
+		}
+
+		peerSet, err := store.GetPeerSet(b.RoundReceived())
+		if err != nil {
+			t.Fatal(err)
+		}
+		peersHash, _ := peerSet.Hash()
+		if !bytes.Equal(peersHash, b.PeersHash()) {
+			t.Fatalf("PeerSet of round %d should be the PeerSet of Block %d", b.RoundReceived(), b.Index())
+		}
+	}
+}
+
+func TestBlockLogExportImport(t *testing.T) {
+	for _, format := range []string{BlockLogJSON, BlockLogBinary} {
+		t.Run(format, func(t *testing.T) {
+			store := NewInmemStore(100)
+			blocks := initBlockLogStore(store, true, t)
+
+			var buf bytes.Buffer
+			count, err := ExportBlocks(store, &buf, format, 0, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(blocks) {
+				t.Fatalf("ExportBlocks should write %d Blocks, not %d", len(blocks), count)
+			}
+
+			data := buf.Bytes()
+			genesisPeerSet, _ := store.GetPeerSet(0)
+
+			h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+			count, err = h.ImportBlocks(bytes.NewReader(data), genesisPeerSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(blocks) {
+				t.Fatalf("ImportBlocks should save %d Blocks, not %d", len(blocks), count)
+			}
+
+			checkImportedBlocks(h.Store, blocks, t)
+
+			//Importing the same Blocks again does nothing, and only relies on
+			//the PeerSets of the Store
+			count, err = h.ImportBlocks(bytes.NewReader(data), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Fatalf("ImportBlocks should skip known Blocks, not save %d", count)
+			}
+		})
+	}
+}
+
+func TestBlockLogExportRange(t *testing.T) {
+	store := NewInmemStore(100)
+	blocks := initBlockLogStore(store, true, t)
+
+	var buf bytes.Buffer
+	count, err := ExportBlocks(store, &buf, BlockLogJSON, 6, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Fatalf("ExportBlocks should write 4 Blocks, not %d", count)
+	}
+
+	reader, err := NewBlockLogReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRounds := []int{6, 6, 8, 8}
+	for i := 6; i <= 9; i++ {
+		block, peerSet, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Index() != blocks[i].Index() {
+			t.Fatalf("Block should be %d, not %d", i, block.Index())
+		}
+		if peerSet.Round != expectedRounds[i-6] {
+			t.Fatalf("PeerSet of Block %d should start at round %d, not %d", i, expectedRounds[i-6], peerSet.Round)
+		}
+	}
+
+	if _, _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("Next should return io.EOF after the last Block, not %v", err)
+	}
+
+	if _, err := ExportBlocks(store, &buf, BlockLogJSON, 8, 12); err == nil {
+		t.Fatalf("ExportBlocks should fail on missing Blocks")
+	}
+
+	if _, err := ExportBlocks(store, &buf, "xml", 0, -1); err == nil {
+		t.Fatalf("ExportBlocks should fail on unknown formats")
+	}
+}
+
+func TestBlockLogImportInvalid(t *testing.T) {
+	store := NewInmemStore(100)
+	blocks := initBlockLogStore(store, true, t)
+
+	var valid bytes.Buffer
+	if _, err := ExportBlocks(store, &valid, BlockLogBinary, 0, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	//Change the transactions of Block 3 after it was signed
+	blocks[3].Body.Transactions = append(blocks[3].Body.Transactions, []byte("forged"))
+
+	var buf bytes.Buffer
+	if _, err := ExportBlocks(store, &buf, BlockLogBinary, 0, -1); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	genesisPeerSet, _ := store.GetPeerSet(0)
+
+	t.Run("Bad signatures", func(t *testing.T) {
+		h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+		count, err := h.ImportBlocks(bytes.NewReader(data), genesisPeerSet)
+		if err == nil {
+			t.Fatalf("ImportBlocks should fail on Block 3")
+		}
+		if count != 3 {
+			t.Fatalf("ImportBlocks should save the 3 Blocks before Block 3, not %d", count)
+		}
+	})
+
+	t.Run("Other PeerSet", func(t *testing.T) {
+		otherPeerSet, _ := initPeers(3)
+
+		h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+		if err := h.Init(otherPeerSet); err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := h.ImportBlocks(bytes.NewReader(valid.Bytes()), genesisPeerSet)
+		if err == nil {
+			t.Fatalf("ImportBlocks should fail when the Store has another PeerSet")
+		}
+		if count != 0 {
+			t.Fatalf("ImportBlocks should not save any Block, not %d", count)
+		}
+	})
+
+	t.Run("No trusted PeerSet", func(t *testing.T) {
+		h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+		if _, err := h.ImportBlocks(bytes.NewReader(valid.Bytes()), nil); err == nil {
+			t.Fatalf("ImportBlocks should fail without a PeerSet in the Store or a genesis PeerSet")
+		}
+	})
+
+	t.Run("Other genesis PeerSet", func(t *testing.T) {
+		//A log signed by other validators, that records their own PeerSets
+		otherStore := NewInmemStore(100)
+		initBlockLogStore(otherStore, true, t)
+
+		var other bytes.Buffer
+		if _, err := ExportBlocks(otherStore, &other, BlockLogBinary, 0, -1); err != nil {
+			t.Fatal(err)
+		}
+
+		h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+		count, err := h.ImportBlocks(&other, genesisPeerSet)
+		if err == nil {
+			t.Fatalf("ImportBlocks should fail on the PeerSets of the log")
+		}
+		if count != 0 {
+			t.Fatalf("ImportBlocks should not save any Block, not %d", count)
+		}
+	})
+
+	t.Run("Underived PeerSet", func(t *testing.T) {
+		//The fourth peer joins without an InternalTransaction
+		underivedStore := NewInmemStore(100)
+		underivedBlocks := initBlockLogStore(underivedStore, false, t)
+		underivedGenesis, _ := underivedStore.GetPeerSet(0)
+
+		var underived bytes.Buffer
+		if _, err := ExportBlocks(underivedStore, &underived, BlockLogBinary, 0, -1); err != nil {
+			t.Fatal(err)
+		}
+
+		h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+		count, err := h.ImportBlocks(&underived, underivedGenesis)
+		if err == nil {
+			t.Fatalf("ImportBlocks should fail on Block 8")
+		}
+		if count != 8 {
+			t.Fatalf("ImportBlocks should save the 8 Blocks before Block 8, not %d", count)
+		}
+		peerSet, _ := h.Store.GetPeerSet(8)
+		if peersHash, _ := peerSet.Hash(); bytes.Equal(peersHash, underivedBlocks[8].PeersHash()) {
+			t.Fatalf("ImportBlocks should not save the PeerSet of Block 8")
+		}
+	})
+
+	t.Run("Forged log PeerSet", func(t *testing.T) {
+		//Valid Blocks, preceded by a PeerSet that did not sign them
+		otherPeerSet, _ := initPeers(3)
+
+		var forged bytes.Buffer
+		writer, err := NewBlockLogWriter(&forged, BlockLogJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range blocks[:3] {
+			if err := writer.Write(b, otherPeerSet); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+		if _, err := h.ImportBlocks(&forged, genesisPeerSet); err == nil {
+			t.Fatalf("ImportBlocks should fail when the log records another PeerSet")
+		}
+	})
+
+	t.Run("Other later PeerSet", func(t *testing.T) {
+		//The Store already knows another PeerSet for round 8
+		otherPeerSet, _ := initPeers(4)
+
+		importStore := NewInmemStore(100)
+		if err := importStore.SetPeerSet(0, genesisPeerSet); err != nil {
+			t.Fatal(err)
+		}
+		if err := importStore.SetPeerSet(8, otherPeerSet); err != nil {
+			t.Fatal(err)
+		}
+
+		h := NewHashgraph(importStore, nil, testLogger(t))
+		count, err := h.ImportBlocks(bytes.NewReader(valid.Bytes()), nil)
+		if err == nil {
+			t.Fatalf("ImportBlocks should fail on Block 8")
+		}
+		if count != 8 {
+			t.Fatalf("ImportBlocks should save the 8 Blocks before Block 8, not %d", count)
+		}
+
+		otherHash, _ := otherPeerSet.Hash()
+		peerSet, _ := importStore.GetPeerSet(8)
+		if peersHash, _ := peerSet.Hash(); !bytes.Equal(peersHash, otherHash) {
+			t.Fatalf("ImportBlocks should not replace the PeerSet of round 8")
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+		_, err := h.ImportBlocks(bytes.NewReader(valid.Bytes()[:valid.Len()-10]), genesisPeerSet)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("ImportBlocks should return io.ErrUnexpectedEOF, not %v", err)
+		}
+	})
+}
+
+//TestBlockLogExportBadger exports the Blocks of a BadgerStore that was reopened
+//without bootstrapping, whose PeerSets are only in the DB
+func TestBlockLogExportBadger(t *testing.T) {
+	store := initBadgerStore(100, t)
+
+	blocks := initBlockLogStore(store, true, t)
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewBadgerStore(100, store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeBadgerStore(reopened, t)
+
+	var buf bytes.Buffer
+	count, err := ExportBlocks(reopened, &buf, BlockLogJSON, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(blocks) {
+		t.Fatalf("ExportBlocks should write %d Blocks, not %d", len(blocks), count)
+	}
+
+	genesisPeerSet, _ := reopened.dbGetPeerSet(0)
+
+	h := NewHashgraph(NewInmemStore(100), nil, testLogger(t))
+	if _, err := h.ImportBlocks(&buf, genesisPeerSet); err != nil {
+		t.Fatal(err)
+	}
+
+	checkImportedBlocks(h.Store, blocks, t)
+}
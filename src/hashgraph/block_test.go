@@ -1,8 +1,10 @@
 package hashgraph
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/mosaicnetworks/babble/src/crypto"
 	"github.com/mosaicnetworks/babble/src/peers"
@@ -18,7 +20,7 @@ func TestSignBlock(t *testing.T) {
 			[]byte("abc"),
 			[]byte("def"),
 			[]byte("ghi"),
-		})
+		}, nil)
 
 	sig, err := block.Sign(privateKey)
 	if err != nil {
@@ -45,7 +47,7 @@ func TestAppendSignature(t *testing.T) {
 			[]byte("abc"),
 			[]byte("def"),
 			[]byte("ghi"),
-		})
+		}, nil)
 
 	sig, err := block.Sign(privateKey)
 	if err != nil {
@@ -71,3 +73,185 @@ func TestAppendSignature(t *testing.T) {
 	}
 
 }
+
+func TestBlockTxProof(t *testing.T) {
+	privateKey, _ := crypto.GenerateECDSAKey()
+
+	txs := [][]byte{
+		[]byte("abc"),
+		[]byte("def"),
+		[]byte("ghi"),
+		[]byte("jkl"),
+		[]byte("mno"),
+	}
+
+	block := NewBlock(0, 1,
+		[]byte("framehash"),
+		[]*peers.Peer{},
+		txs, nil)
+
+	sig, err := block.Sign(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A light client only holds the signed header
+	header := block.Header()
+	res, err := header.Verify(sig)
+	if err != nil {
+		t.Fatalf("Error verifying header signature: %v", err)
+	}
+	if !res {
+		t.Fatal("Header Verify returned false")
+	}
+
+	for i := range txs {
+		proof, err := block.TxProof(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.Verify(&header) {
+			t.Fatalf("TxProof %d should verify", i)
+		}
+
+		proof.Tx = []byte("forged")
+		if proof.Verify(&header) {
+			t.Fatalf("TxProof %d should not verify a forged transaction", i)
+		}
+	}
+
+	//A proof does not hold for a header with another number of transactions
+	proof, _ := block.TxProof(0)
+	forgedHeader := header
+	forgedHeader.TxCount = 2
+	if proof.Verify(&forgedHeader) {
+		t.Fatal("TxProof should not verify against another TxCount")
+	}
+
+	if _, err := block.TxProof(len(txs)); err == nil {
+		t.Fatal("TxProof should return an error for a missing transaction")
+	}
+
+	//Tampering with the Transactions invalidates the signature check
+	block.Body.Transactions[0] = []byte("forged")
+	if res, _ := block.Verify(sig); res {
+		t.Fatal("Verify should return false when Transactions do not match TxRoot")
+	}
+}
+
+func TestNewBlocksFromFrame(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	newEvent := func(i int, itxs []InternalTransaction, txs ...string) *Event {
+		transactions := [][]byte{}
+		for _, tx := range txs {
+			transactions = append(transactions, []byte(tx))
+		}
+		ev := NewEvent(transactions, itxs, nil, []string{"", ""}, []byte("creator"), i)
+		ev.ConsensusTimestamp = start.Add(time.Duration(i) * time.Second)
+		return ev
+	}
+
+	peer := peers.NewPeer("0xABCDEF", "addr")
+
+	frame := &Frame{
+		Round: 3,
+		Peers: []*peers.Peer{},
+		Events: []*Event{
+			newEvent(0, nil, "a", "bb"),
+			newEvent(1, nil, "ccc", "dddddddddd", "e"),
+			newEvent(2, []InternalTransaction{NewInternalTransactionJoin(*peer)}),
+			newEvent(3, nil, "f"),
+		},
+	}
+
+	frameHash, err := frame.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type expected struct {
+		txs       []string
+		itxs      int
+		timestamp int
+	}
+
+	cases := []struct {
+		maxTxs   int
+		maxBytes int
+		blocks   []expected
+	}{
+		{0, 0, []expected{
+			{[]string{"a", "bb", "ccc", "dddddddddd", "e", "f"}, 1, 3},
+		}},
+		{2, 0, []expected{
+			{[]string{"a", "bb"}, 0, 0},
+			{[]string{"ccc", "dddddddddd"}, 0, 1},
+			{[]string{"e", "f"}, 1, 3},
+		}},
+		{0, 6, []expected{
+			{[]string{"a", "bb", "ccc"}, 0, 1},
+			{[]string{"dddddddddd"}, 0, 1},
+			{[]string{"e", "f"}, 1, 3},
+		}},
+		{3, 4, []expected{
+			{[]string{"a", "bb"}, 0, 0},
+			{[]string{"ccc"}, 0, 1},
+			{[]string{"dddddddddd"}, 0, 1},
+			{[]string{"e", "f"}, 1, 3},
+		}},
+	}
+
+	for i, c := range cases {
+		blocks, err := NewBlocksFromFrame(7, frame, c.maxTxs, c.maxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(blocks) != len(c.blocks) {
+			t.Fatalf("case %d: expected %d Blocks, got %d", i, len(c.blocks), len(blocks))
+		}
+
+		for j, b := range blocks {
+			exp := c.blocks[j]
+
+			if b.Index() != 7+j {
+				t.Fatalf("case %d, block %d: Index should be %d, not %d", i, j, 7+j, b.Index())
+			}
+
+			if b.RoundReceived() != frame.Round {
+				t.Fatalf("case %d, block %d: RoundReceived should be %d, not %d", i, j, frame.Round, b.RoundReceived())
+			}
+
+			if !bytes.Equal(b.FrameHash(), frameHash) {
+				t.Fatalf("case %d, block %d: wrong FrameHash", i, j)
+			}
+
+			txs := []string{}
+			for _, tx := range b.Transactions() {
+				txs = append(txs, string(tx))
+			}
+			if fmt.Sprint(txs) != fmt.Sprint(exp.txs) {
+				t.Fatalf("case %d, block %d: Transactions should be %v, not %v", i, j, exp.txs, txs)
+			}
+
+			if len(b.InternalTransactions()) != exp.itxs {
+				t.Fatalf("case %d, block %d: expected %d InternalTransactions, got %d", i, j, exp.itxs, len(b.InternalTransactions()))
+			}
+
+			timestamp := start.Add(time.Duration(exp.timestamp) * time.Second)
+			if !b.Timestamp().Equal(timestamp) {
+				t.Fatalf("case %d, block %d: Timestamp should be %v, not %v", i, j, timestamp, b.Timestamp())
+			}
+		}
+	}
+
+	//A Frame without transactions still produces one empty Block
+	blocks, err := NewBlocksFromFrame(0, &Frame{Round: 1, Peers: []*peers.Peer{}}, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || len(blocks[0].Transactions()) != 0 {
+		t.Fatalf("expected one empty Block, got %d", len(blocks))
+	}
+}
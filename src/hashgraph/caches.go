@@ -107,6 +107,15 @@ func (pec *ParticipantEventsCache) Set(participant string, hash string, index in
 	return pec.rim.Set(id, hash, index)
 }
 
+//Prune removes the participant events with index <= index
+func (pec *ParticipantEventsCache) Prune(participant string, index int) error {
+	id, err := pec.participantID(participant)
+	if err != nil {
+		return err
+	}
+	return pec.rim.Prune(id, index)
+}
+
 //returns [participant id] => lastKnownIndex
 func (pec *ParticipantEventsCache) Known() map[uint32]int {
 	return pec.rim.Known()
@@ -279,10 +288,18 @@ func (sp *SigPool) Items() map[string]BlockSignature {
 	return sp.items
 }
 
+//Slice returns the BlockSignatures ordered by Block index and validator, so
+//that the SelfEvents that carry them do not depend on the order of the map
 func (sp *SigPool) Slice() []BlockSignature {
 	res := []BlockSignature{}
 	for _, bs := range sp.items {
 		res = append(res, bs)
 	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Index != res[j].Index {
+			return res[i].Index < res[j].Index
+		}
+		return res[i].ValidatorHex() < res[j].ValidatorHex()
+	})
 	return res
 }
@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/mosaicnetworks/babble/src/crypto"
 )
@@ -14,11 +15,14 @@ EventBody
 *******************************************************************************/
 
 type EventBody struct {
-	Transactions    [][]byte         //the payload
-	Parents         []string         //hashes of the event's parents, self-parent first
-	Creator         []byte           //creator's public key
-	Index           int              //index in the sequence of events created by Creator
-	BlockSignatures []BlockSignature //list of Block signatures signed by the Event's Creator ONLY
+	Transactions         [][]byte              //the payload
+	InternalTransactions []InternalTransaction //peers add and removal internal consensus
+	Parents              []string              //hashes of the event's parents, self-parent first
+	Creator              []byte                //creator's public key
+	Index                int                   //index in the sequence of events created by Creator
+	BlockSignatures      []BlockSignature      //list of Block signatures signed by the Event's Creator ONLY
+	ForkProofs           []ForkProof           //evidence of forks detected by the Event's Creator
+	Timestamp            time.Time             //creator's claimed time of creation (UTC)
 
 	//These fields are not serialized
 	creatorID            uint32
@@ -85,6 +89,12 @@ type Event struct {
 	Body      EventBody
 	Signature string //creator's digital signature of body
 
+	//ConsensusTimestamp is the median of the times at which the creators of
+	//the famous witnesses of the round-received first received the Event. It
+	//is set when the Event reaches consensus, and is not part of the signed
+	//body.
+	ConsensusTimestamp time.Time
+
 	topologicalIndex int
 
 	//used for sorting
@@ -102,17 +112,20 @@ type Event struct {
 }
 
 func NewEvent(transactions [][]byte,
+	internalTransactions []InternalTransaction,
 	blockSignatures []BlockSignature,
 	parents []string,
 	creator []byte,
 	index int) *Event {
 
 	body := EventBody{
-		Transactions:    transactions,
-		BlockSignatures: blockSignatures,
-		Parents:         parents,
-		Creator:         creator,
-		Index:           index,
+		Transactions:         transactions,
+		InternalTransactions: internalTransactions,
+		BlockSignatures:      blockSignatures,
+		Parents:              parents,
+		Creator:              creator,
+		Index:                index,
+		Timestamp:            time.Now().UTC(),
 	}
 	return &Event{
 		Body: body,
@@ -138,14 +151,26 @@ func (e *Event) Transactions() [][]byte {
 	return e.Body.Transactions
 }
 
+func (e *Event) InternalTransactions() []InternalTransaction {
+	return e.Body.InternalTransactions
+}
+
 func (e *Event) Index() int {
 	return e.Body.Index
 }
 
+func (e *Event) ForkProofs() []ForkProof {
+	return e.Body.ForkProofs
+}
+
 func (e *Event) BlockSignatures() []BlockSignature {
 	return e.Body.BlockSignatures
 }
 
+func (e *Event) Timestamp() time.Time {
+	return e.Body.Timestamp
+}
+
 //True if Event contains a payload or is the initial Event of its creator
 func (e *Event) IsLoaded() bool {
 	if e.Body.Index == 0 {
@@ -154,7 +179,9 @@ func (e *Event) IsLoaded() bool {
 
 	hasTransactions := e.Body.Transactions != nil && len(e.Body.Transactions) > 0
 
-	return hasTransactions
+	hasInternalTransactions := e.Body.InternalTransactions != nil && len(e.Body.InternalTransactions) > 0
+
+	return hasTransactions || hasInternalTransactions
 }
 
 //ecdsa sig
@@ -292,12 +319,15 @@ func (e *Event) ToWire() WireEvent {
 	return WireEvent{
 		Body: WireBody{
 			Transactions:         e.Body.Transactions,
+			InternalTransactions: e.Body.InternalTransactions,
 			SelfParentIndex:      e.Body.selfParentIndex,
 			OtherParentCreatorID: e.Body.otherParentCreatorID,
 			OtherParentIndex:     e.Body.otherParentIndex,
 			CreatorID:            e.Body.creatorID,
 			Index:                e.Body.Index,
 			BlockSignatures:      e.WireBlockSignatures(),
+			ForkProofs:           e.Body.ForkProofs,
+			Timestamp:            e.Body.Timestamp,
 		},
 		Signature: e.Signature,
 	}
@@ -347,8 +377,11 @@ func (a ByLamportTimestamp) Less(i, j int) bool {
 *******************************************************************************/
 
 type WireBody struct {
-	Transactions    [][]byte
-	BlockSignatures []WireBlockSignature
+	Transactions         [][]byte
+	InternalTransactions []InternalTransaction
+	BlockSignatures      []WireBlockSignature
+	ForkProofs           []ForkProof
+	Timestamp            time.Time
 
 	CreatorID            uint32
 	OtherParentCreatorID uint32
@@ -0,0 +1,417 @@
+package hashgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	cm "github.com/mosaicnetworks/babble/src/common"
+)
+
+const (
+	//logMagic starts every segment; it identifies the format of the records
+	logMagic = "BABLOG01"
+
+	//Segments are closed, and a new one started, when they reach this size
+	defaultSegmentSize = 64 << 20
+
+	//crc32 (4) + kind (1) + key length (4) + value length (4)
+	logHeaderSize = 13
+
+	logRecordSet    byte = 1
+	logRecordDelete byte = 2
+)
+
+//logRecord is a key-value pair written to the log; deletions are recorded as
+//tombstones
+type logRecord struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+//logPosition locates the value of a key in the segments
+type logPosition struct {
+	segment int
+	offset  int64
+	size    int
+}
+
+type logSegment struct {
+	id   int
+	file *os.File
+	size int64
+	live int //number of keys whose current value is in this segment
+}
+
+/*
+fileLog is an append-only key-value log split in numbered segment files, with
+an in-memory index that maps every key to the position of its latest value. The
+index is rebuilt by reading all the segments when the log is opened. A record
+that was only partially written at the end of the last segment, because the
+process died while writing it, is truncated. Segments in which no value is live
+anymore are deleted, oldest first, so that the space taken by pruned keys is
+reclaimed without compaction.
+*/
+type fileLog struct {
+	path           string
+	maxSegmentSize int64
+
+	lock     sync.RWMutex
+	segments map[int]*logSegment
+	active   *logSegment
+	index    map[string]logPosition
+}
+
+func segmentName(id int) string {
+	return fmt.Sprintf("%09d.log", id)
+}
+
+//openFileLog opens the segments found in path, or creates the first one
+func openFileLog(path string, maxSegmentSize int64) (*fileLog, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+
+	l := &fileLog{
+		path:           path,
+		maxSegmentSize: maxSegmentSize,
+		segments:       make(map[int]*logSegment),
+		index:          make(map[string]logPosition),
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, f := range files {
+		var id int
+		if _, err := fmt.Sscanf(f.Name(), "%09d.log", &id); err == nil && f.Name() == segmentName(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for i, id := range ids {
+		if err := l.load(id, i == len(ids)-1); err != nil {
+			l.close()
+			return nil, err
+		}
+	}
+
+	if l.active == nil {
+		if err := l.newSegment(1); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+//load reads the records of a segment into the index. A truncated or corrupt
+//record is only tolerated at the end of the last segment, where it is the
+//result of an interrupted write.
+func (l *fileLog) load(id int, last bool) error {
+	file, err := os.OpenFile(filepath.Join(l.path, segmentName(id)), os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	seg := &logSegment{id: id, file: file}
+	l.segments[id] = seg
+	l.active = seg
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < len(logMagic) && last {
+		return l.truncate(seg, 0)
+	}
+	if !bytes.HasPrefix(data, []byte(logMagic)) {
+		return fmt.Errorf("Segment %s: unknown format", file.Name())
+	}
+
+	offset := int64(len(logMagic))
+	for offset < int64(len(data)) {
+		record, size, err := decodeRecord(data[offset:])
+		if err != nil {
+			if last {
+				return l.truncate(seg, offset)
+			}
+			return fmt.Errorf("Segment %s at offset %d: %v", file.Name(), offset, err)
+		}
+
+		l.apply(record, logPosition{
+			segment: id,
+			offset:  offset + logHeaderSize + int64(len(record.key)),
+			size:    len(record.value),
+		})
+
+		offset += size
+	}
+	seg.size = offset
+
+	return nil
+}
+
+//truncate drops the end of a segment, from offset, and rewrites the magic
+//number if it was lost
+func (l *fileLog) truncate(seg *logSegment, offset int64) error {
+	if err := seg.file.Truncate(offset); err != nil {
+		return err
+	}
+	if offset == 0 {
+		if _, err := seg.file.WriteAt([]byte(logMagic), 0); err != nil {
+			return err
+		}
+		offset = int64(len(logMagic))
+	}
+	seg.size = offset
+	return nil
+}
+
+func (l *fileLog) newSegment(id int) error {
+	file, err := os.OpenFile(filepath.Join(l.path, segmentName(id)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write([]byte(logMagic)); err != nil {
+		file.Close()
+		return err
+	}
+
+	seg := &logSegment{id: id, file: file, size: int64(len(logMagic))}
+	l.segments[id] = seg
+	l.active = seg
+
+	return nil
+}
+
+//apply updates the index, and the count of live values of the segments, with a
+//record
+func (l *fileLog) apply(record logRecord, pos logPosition) {
+	if old, ok := l.index[record.key]; ok {
+		l.segments[old.segment].live--
+	}
+
+	if record.delete {
+		delete(l.index, record.key)
+		return
+	}
+
+	l.index[record.key] = pos
+	l.segments[pos.segment].live++
+}
+
+func encodeRecord(buf *bytes.Buffer, record logRecord) {
+	kind := logRecordSet
+	if record.delete {
+		kind = logRecordDelete
+	}
+
+	body := make([]byte, 9, 9+len(record.key)+len(record.value))
+	body[0] = kind
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(record.key)))
+	binary.BigEndian.PutUint32(body[5:9], uint32(len(record.value)))
+	body = append(body, record.key...)
+	body = append(body, record.value...)
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(body))
+
+	buf.Write(crc)
+	buf.Write(body)
+}
+
+//decodeRecord reads the record at the start of data, and returns its total size
+func decodeRecord(data []byte) (logRecord, int64, error) {
+	if len(data) < logHeaderSize {
+		return logRecord{}, 0, io.ErrUnexpectedEOF
+	}
+
+	keyLen := int64(binary.BigEndian.Uint32(data[5:9]))
+	valueLen := int64(binary.BigEndian.Uint32(data[9:13]))
+	size := logHeaderSize + keyLen + valueLen
+	if int64(len(data)) < size {
+		return logRecord{}, 0, io.ErrUnexpectedEOF
+	}
+
+	if crc32.ChecksumIEEE(data[4:size]) != binary.BigEndian.Uint32(data[0:4]) {
+		return logRecord{}, 0, fmt.Errorf("Checksum mismatch")
+	}
+
+	record := logRecord{
+		key:    string(data[logHeaderSize : logHeaderSize+keyLen]),
+		value:  data[logHeaderSize+keyLen : size],
+		delete: data[4] == logRecordDelete,
+	}
+
+	switch data[4] {
+	case logRecordSet, logRecordDelete:
+	default:
+		return logRecord{}, 0, fmt.Errorf("Unknown record kind %d", data[4])
+	}
+
+	return record, size, nil
+}
+
+//write appends the records to the active segment in a single write, after
+//starting a new segment if the active one is full
+func (l *fileLog) write(records []logRecord) error {
+	var buf bytes.Buffer
+	positions := make([]logPosition, len(records))
+	for i, r := range records {
+		start := int64(buf.Len())
+		encodeRecord(&buf, r)
+		positions[i] = logPosition{
+			offset: start + logHeaderSize + int64(len(r.key)),
+			size:   len(r.value),
+		}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.active.size > int64(len(logMagic)) &&
+		l.active.size+int64(buf.Len()) > l.maxSegmentSize {
+		if err := l.newSegment(l.active.id + 1); err != nil {
+			return err
+		}
+	}
+
+	seg := l.active
+	if _, err := seg.file.WriteAt(buf.Bytes(), seg.size); err != nil {
+		//Whatever was written is ignored, and overwritten by the next write
+		return err
+	}
+
+	for i, r := range records {
+		pos := positions[i]
+		pos.segment = seg.id
+		pos.offset += seg.size
+		l.apply(r, pos)
+	}
+	seg.size += int64(buf.Len())
+
+	return l.removeDeadSegments()
+}
+
+//removeDeadSegments deletes the oldest segments, up to the first one that still
+//contains a live value. Younger dead segments are kept, because their
+//tombstones hide values in the older segments.
+func (l *fileLog) removeDeadSegments() error {
+	ids := make([]int, 0, len(l.segments))
+	for id := range l.segments {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		seg := l.segments[id]
+		if seg == l.active || seg.live > 0 {
+			return nil
+		}
+
+		if err := seg.file.Close(); err != nil {
+			return err
+		}
+		if err := os.Remove(seg.file.Name()); err != nil {
+			return err
+		}
+		delete(l.segments, id)
+	}
+
+	return nil
+}
+
+func (l *fileLog) set(key []byte, value []byte) error {
+	return l.write([]logRecord{{key: string(key), value: value}})
+}
+
+func (l *fileLog) del(keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	records := make([]logRecord, len(keys))
+	for i, k := range keys {
+		records[i] = logRecord{key: string(k), delete: true}
+	}
+
+	return l.write(records)
+}
+
+//get returns the value of a key, or a KeyNotFound StoreErr
+func (l *fileLog) get(key []byte) ([]byte, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	pos, ok := l.index[string(key)]
+	if !ok {
+		return nil, cm.NewStoreErr("Log", cm.KeyNotFound, string(key))
+	}
+
+	value := make([]byte, pos.size)
+	if _, err := l.segments[pos.segment].file.ReadAt(value, pos.offset); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (l *fileLog) has(key []byte) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	_, ok := l.index[string(key)]
+	return ok
+}
+
+//keys returns the keys that start with prefix, in lexicographic order
+func (l *fileLog) keys(prefix string) []string {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	res := []string{}
+	for k := range l.index {
+		if strings.HasPrefix(k, prefix) {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+func (l *fileLog) close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var res error
+	for _, seg := range l.segments {
+		if seg == l.active {
+			if err := seg.file.Sync(); err != nil && res == nil {
+				res = err
+			}
+		}
+		if err := seg.file.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	l.segments = make(map[int]*logSegment)
+
+	return res
+}
@@ -0,0 +1,828 @@
+package hashgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	cm "github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+//FileStore is an implementation of the Store interface that uses an InmemStore
+//for caching and an append-only log of files to persist values on disk. It
+//uses the same keys and encodings as the BadgerStore.
+type FileStore struct {
+	inmemStore   *InmemStore
+	log          *fileLog
+	path         string
+	needBoostrap bool
+}
+
+//NewFileStore opens an existing log or creates a new one if nothing is found in
+//path.
+func NewFileStore(cacheSize int, path string) (*FileStore, error) {
+	return newFileStore(cacheSize, path, defaultSegmentSize)
+}
+
+func newFileStore(cacheSize int, path string, maxSegmentSize int64) (*FileStore, error) {
+	needBootstrap := false
+	if _, err := os.Stat(path); err == nil {
+		needBootstrap = true
+	}
+
+	log, err := openFileLog(path, maxSegmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{
+		inmemStore:   NewInmemStore(cacheSize),
+		log:          log,
+		path:         path,
+		needBoostrap: needBootstrap,
+	}
+	return store, nil
+}
+
+/*******************************************************************************
+Implement the Store interface
+
+Like the BadgerStore, some objects are only read from the InmemStore, which is
+populated by Bootstrap, while others are written to both and read from the log
+when they are not in the cache.
+
+*******************************************************************************/
+
+func (s *FileStore) CacheSize() int {
+	return s.inmemStore.CacheSize()
+}
+
+func (s *FileStore) GetEvent(key string) (*Event, error) {
+	return s.inmemStore.GetEvent(key)
+}
+
+func (s *FileStore) ParticipantEvents(participant string, skip int) ([]string, error) {
+	return s.inmemStore.ParticipantEvents(participant, skip)
+}
+
+func (s *FileStore) ParticipantEvent(participant string, index int) (string, error) {
+	return s.inmemStore.ParticipantEvent(participant, index)
+}
+
+func (s *FileStore) GetRound(r int) (*RoundInfo, error) {
+	return s.inmemStore.GetRound(r)
+}
+
+func (s *FileStore) RoundWitnesses(r int) []string {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return []string{}
+	}
+	return round.Witnesses()
+}
+
+func (s *FileStore) RoundEvents(r int) int {
+	round, err := s.GetRound(r)
+	if err != nil {
+		return 0
+	}
+	return len(round.CreatedEvents)
+}
+
+func (s *FileStore) GetFrame(rr int) (*Frame, error) {
+	res, err := s.inmemStore.GetFrame(rr)
+	if err != nil {
+		//Same as the BadgerStore; Frames from before a restart are reused.
+		res, err = s.dbGetFrame(rr)
+	}
+	return res, mapLogError(err, "Frame", string(frameKey(rr)))
+}
+
+func (s *FileStore) GetPeerSet(round int) (peerSet *peers.PeerSet, err error) {
+	return s.inmemStore.GetPeerSet(round)
+}
+
+func (s *FileStore) GetFuturePeerSets(baseRound int) (map[int][]*peers.Peer, error) {
+	return s.inmemStore.GetFuturePeerSets(baseRound)
+}
+
+func (s *FileStore) RepertoireByPubKey() map[string]*peers.Peer {
+	return s.inmemStore.RepertoireByPubKey()
+}
+
+func (s *FileStore) RepertoireByID() map[uint32]*peers.Peer {
+	return s.inmemStore.RepertoireByID()
+}
+
+func (s *FileStore) RootsBySelfParent() map[string]*Root {
+	return s.inmemStore.RootsBySelfParent()
+}
+
+func (s *FileStore) LastEventFrom(participant string) (last string, isRoot bool, err error) {
+	return s.inmemStore.LastEventFrom(participant)
+}
+
+func (s *FileStore) LastConsensusEventFrom(participant string) (last string, isRoot bool, err error) {
+	return s.inmemStore.LastConsensusEventFrom(participant)
+}
+
+func (s *FileStore) KnownEvents() map[uint32]int {
+	return s.inmemStore.KnownEvents()
+}
+
+func (s *FileStore) ConsensusEvents() []string {
+	return s.inmemStore.ConsensusEvents()
+}
+
+func (s *FileStore) ConsensusEventsCount() int {
+	return s.inmemStore.ConsensusEventsCount()
+}
+
+func (s *FileStore) AddConsensusEvent(event *Event) error {
+	return s.inmemStore.AddConsensusEvent(event)
+}
+
+func (s *FileStore) LastRound() int {
+	return s.inmemStore.LastRound()
+}
+
+func (s *FileStore) LastBlockIndex() int {
+	return s.inmemStore.LastBlockIndex()
+}
+
+func (s *FileStore) SetPeerSet(round int, peerSet *peers.PeerSet) error {
+	//Update the cache
+	if err := s.inmemStore.SetPeerSet(round, peerSet); err != nil {
+		return err
+	}
+
+	//update the log
+	if err := s.dbSetPeerSet(round, peerSet); err != nil {
+		return err
+	}
+
+	//Extend Repertoire and Roots
+	for _, p := range peerSet.Peers {
+		err := s.AddParticipant(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStore) AddParticipant(p *peers.Peer) error {
+	if err := s.inmemStore.AddParticipant(p); err != nil {
+		return err
+	}
+
+	if err := s.dbSetRepertoire(p); err != nil {
+		return err
+	}
+
+	if !s.log.has(participantRootKey(p.PubKeyHex)) {
+		if err := s.dbSetRoot(p.PubKeyHex, NewBaseRoot(p.ID())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStore) SetEvent(event *Event) error {
+	if err := s.inmemStore.SetEvent(event); err != nil {
+		return err
+	}
+	return s.dbSetEvents([]*Event{event})
+}
+
+func (s *FileStore) SetRound(r int, round *RoundInfo) error {
+	if err := s.inmemStore.SetRound(r, round); err != nil {
+		return err
+	}
+	return s.dbSetRound(r, round)
+}
+
+func (s *FileStore) GetRoot(participant string) (*Root, error) {
+	root, err := s.inmemStore.GetRoot(participant)
+	if err != nil {
+		root, err = s.dbGetRoot(participant)
+	}
+	return root, mapLogError(err, "Root", string(participantRootKey(participant)))
+}
+
+func (s *FileStore) GetBlock(rr int) (*Block, error) {
+	res, err := s.inmemStore.GetBlock(rr)
+	if err != nil {
+		res, err = s.dbGetBlock(rr)
+	}
+	return res, mapLogError(err, "Block", string(blockKey(rr)))
+}
+
+func (s *FileStore) SetBlock(block *Block) error {
+	if err := s.inmemStore.SetBlock(block); err != nil {
+		return err
+	}
+	return s.dbSetBlock(block)
+}
+
+func (s *FileStore) SetFrame(frame *Frame) error {
+	if err := s.inmemStore.SetFrame(frame); err != nil {
+		return err
+	}
+	return s.dbSetFrame(frame)
+}
+
+func (s *FileStore) GetForkProof(creator string, index int) (*ForkProof, error) {
+	res, err := s.inmemStore.GetForkProof(creator, index)
+	if err != nil {
+		res, err = s.dbGetForkProof(creator, index)
+	}
+	return res, mapLogError(err, "ForkProof", string(forkProofKey(creator, index)))
+}
+
+func (s *FileStore) SetForkProof(proof *ForkProof) error {
+	if err := s.inmemStore.SetForkProof(proof); err != nil {
+		return err
+	}
+	return s.dbSetForkProof(proof)
+}
+
+//GetForkProofs reads ForkProofs from the log, because the InmemStore does not
+//contain those that were recorded before the node was restarted.
+func (s *FileStore) GetForkProofs() ([]*ForkProof, error) {
+	return s.dbGetForkProofs()
+}
+
+func (s *FileStore) GetTxLocation(hash string) (*TxLocation, error) {
+	res, err := s.inmemStore.GetTxLocation(hash)
+	if err != nil {
+		res, err = s.dbGetTxLocation(hash)
+	}
+	return res, mapLogError(err, "TxLocation", string(txLocationKey(hash)))
+}
+
+func (s *FileStore) SetTxLocation(location *TxLocation) error {
+	if err := s.inmemStore.SetTxLocation(location); err != nil {
+		return err
+	}
+	return s.dbSetTxLocation(location)
+}
+
+func (s *FileStore) Reset(frame *Frame) error {
+	//Reset InmemStore
+	if err := s.inmemStore.Reset(frame); err != nil {
+		return err
+	}
+
+	//Set Frame, Roots, and PeerSet
+	if err := s.dbSetFrame(frame); err != nil {
+		return err
+	}
+
+	for p, root := range frame.Roots {
+		if err := s.dbSetRoot(p, root); err != nil {
+			return err
+		}
+	}
+
+	peerSet := peers.NewPeerSet(frame.Peers)
+	if err := s.dbSetPeerSet(frame.Round, peerSet); err != nil {
+		return err
+	}
+
+	for round, ps := range frame.FuturePeerSets {
+		if err := s.dbSetPeerSet(round, peers.NewPeerSet(ps)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Prune deletes the Events, Rounds, and Frames below the Frame from the
+//InmemStore and from the log, and records the base to Bootstrap from, like the
+//BadgerStore. The segments that no longer hold any live value are deleted.
+func (s *FileStore) Prune(block *Block, frame *Frame, snapshot []byte) error {
+	if err := s.inmemStore.Prune(block, frame, snapshot); err != nil {
+		return err
+	}
+
+	for p, root := range frame.Roots {
+		if err := s.dbSetRoot(p, root); err != nil {
+			return err
+		}
+	}
+
+	if err := s.dbPruneEvents(frame); err != nil {
+		return err
+	}
+
+	if err := s.dbDeleteBelow(roundPrefix, frame.Round); err != nil {
+		return err
+	}
+
+	if err := s.dbDeleteBelow(framePrefix, frame.Round); err != nil {
+		return err
+	}
+
+	return s.dbSetBase(pruneBaseKey, &storeBase{
+		BlockIndex: block.Index(),
+		Snapshot:   snapshot,
+	})
+}
+
+//Checkpoint records the Block and the application snapshot as the base from
+//which Bootstrap restarts the Hashgraph, like the BadgerStore.
+func (s *FileStore) Checkpoint(block *Block, snapshot []byte, topologicalIndex int) error {
+	if err := s.inmemStore.Checkpoint(block, snapshot, topologicalIndex); err != nil {
+		return err
+	}
+
+	return s.dbSetBase(anchorBaseKey, &storeBase{
+		BlockIndex:       block.Index(),
+		Snapshot:         snapshot,
+		TopologicalIndex: topologicalIndex,
+	})
+}
+
+func (s *FileStore) Close() error {
+	if err := s.inmemStore.Close(); err != nil {
+		return err
+	}
+	return s.log.close()
+}
+
+func (s *FileStore) NeedBoostrap() bool {
+	return s.needBoostrap
+}
+
+func (s *FileStore) StorePath() string {
+	return s.path
+}
+
+func (s *FileStore) cache() *InmemStore {
+	return s.inmemStore
+}
+
+/*******************************************************************************
+Log Methods
+*******************************************************************************/
+
+type unmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+func (s *FileStore) dbGetValue(key []byte, v unmarshaler) error {
+	data, err := s.log.get(key)
+	if err != nil {
+		return err
+	}
+	return v.Unmarshal(data)
+}
+
+func (s *FileStore) dbSetValue(key []byte, v marshaler) error {
+	val, err := v.Marshal()
+	if err != nil {
+		return err
+	}
+	return s.log.set(key, val)
+}
+
+func (s *FileStore) dbGetRepertoire() (map[string]*peers.Peer, error) {
+	repertoire := make(map[string]*peers.Peer)
+	for _, k := range s.log.keys(repertoirePrefix) {
+		peer := &peers.Peer{}
+		if err := s.dbGetValue([]byte(k), peer); err != nil {
+			return nil, err
+		}
+		repertoire[peer.PubKeyHex] = peer
+	}
+	return repertoire, nil
+}
+
+func (s *FileStore) dbSetRepertoire(peer *peers.Peer) error {
+	//insert [pub] => [Peer]
+	return s.dbSetValue(repertoireKey(peer.PubKeyHex), peer)
+}
+
+func (s *FileStore) dbGetPeerSet(round int) (*peers.PeerSet, error) {
+	peerSliceBytes, err := s.log.get(peerSetKey(round))
+	if err != nil {
+		return nil, err
+	}
+	return peers.NewPeerSetFromPeerSliceBytes(peerSliceBytes)
+}
+
+func (s *FileStore) dbGetPeerSets() (map[int]*peers.PeerSet, error) {
+	res := make(map[int]*peers.PeerSet)
+	for _, k := range s.log.keys(peerSetPrefix + "_") {
+		var round int
+		if _, err := fmt.Sscanf(k, peerSetPrefix+"_%d", &round); err != nil {
+			return nil, err
+		}
+
+		peerSet, err := s.dbGetPeerSet(round)
+		if err != nil {
+			return nil, err
+		}
+
+		res[round] = peerSet
+	}
+	return res, nil
+}
+
+func (s *FileStore) dbSetPeerSet(round int, peerSet *peers.PeerSet) error {
+	//insert [round_index] => [PeerSet bytes]
+	return s.dbSetValue(peerSetKey(round), peerSet)
+}
+
+func (s *FileStore) dbGetEvent(key string) (*Event, error) {
+	event := new(Event)
+	if err := s.dbGetValue([]byte(key), event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+//dbSetEvents writes the Events, and the topological and participant keys of
+//those that are new, in a single append
+func (s *FileStore) dbSetEvents(events []*Event) error {
+	records := []logRecord{}
+	for _, event := range events {
+		eventHex := event.Hex()
+		val, err := event.Marshal()
+		if err != nil {
+			return err
+		}
+		new := !s.log.has([]byte(eventHex))
+
+		//insert [event hash] => [event bytes]
+		records = append(records, logRecord{key: eventHex, value: val})
+
+		if new {
+			//insert [topo_index] => [event hash]
+			records = append(records, logRecord{
+				key:   string(topologicalEventKey(event.topologicalIndex)),
+				value: []byte(eventHex),
+			})
+			//insert [participant_index] => [event hash]
+			records = append(records, logRecord{
+				key:   string(participantEventKey(event.Creator(), event.Index())),
+				value: []byte(eventHex),
+			})
+		}
+	}
+	return s.log.write(records)
+}
+
+func (s *FileStore) dbParticipantEvents(participant string, skip int) ([]string, error) {
+	res := []string{}
+	for i := skip + 1; ; i++ {
+		v, err := s.log.get(participantEventKey(participant, i))
+		if err != nil {
+			if cm.Is(err, cm.KeyNotFound) {
+				break
+			}
+			return nil, err
+		}
+		res = append(res, string(v))
+	}
+	return res, nil
+}
+
+func (s *FileStore) dbParticipantEvent(participant string, index int) (string, error) {
+	data, err := s.log.get(participantEventKey(participant, index))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//dbTopologicalEvents returns the Events in topological order, starting at the
+//topological index from, like the BadgerStore.
+func (s *FileStore) dbTopologicalEvents(from int) ([]*Event, error) {
+	res := []*Event{}
+	fromKey := string(topologicalEventKey(from))
+	for _, k := range s.log.keys(topoPrefix + "_") {
+		if k < fromKey {
+			continue
+		}
+
+		var t int
+		if _, err := fmt.Sscanf(k, topoPrefix+"_%d", &t); err != nil {
+			return nil, err
+		}
+
+		hash, err := s.log.get([]byte(k))
+		if err != nil {
+			return nil, err
+		}
+
+		event, err := s.dbGetEvent(string(hash))
+		if err != nil {
+			if cm.Is(err, cm.KeyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		event.topologicalIndex = t
+
+		res = append(res, event)
+	}
+	return res, nil
+}
+
+//dbNextTopologicalIndex returns the topological index that follows the last
+//one in the log
+func (s *FileStore) dbNextTopologicalIndex() (int, error) {
+	keys := s.log.keys(topoPrefix + "_")
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	var t int
+	if _, err := fmt.Sscanf(keys[len(keys)-1], topoPrefix+"_%d", &t); err != nil {
+		return 0, err
+	}
+	return t + 1, nil
+}
+
+func (s *FileStore) dbSetRoot(participant string, root *Root) error {
+	//insert [participant_root] => [root bytes]
+	return s.dbSetValue(participantRootKey(participant), root)
+}
+
+func (s *FileStore) dbGetRoot(participant string) (*Root, error) {
+	root := new(Root)
+	if err := s.dbGetValue(participantRootKey(participant), root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (s *FileStore) dbGetRound(index int) (*RoundInfo, error) {
+	roundInfo := new(RoundInfo)
+	if err := s.dbGetValue(roundKey(index), roundInfo); err != nil {
+		return nil, err
+	}
+	return roundInfo, nil
+}
+
+//dbGetRoundsFrom returns the Round of every Event listed in the RoundInfos from
+//the given Round upwards
+func (s *FileStore) dbGetRoundsFrom(from int) (map[string]int, error) {
+	res := make(map[string]int)
+	fromKey := string(roundKey(from))
+	for _, k := range s.log.keys(roundPrefix + "_") {
+		if k < fromKey {
+			continue
+		}
+
+		var r int
+		if _, err := fmt.Sscanf(k, roundPrefix+"_%d", &r); err != nil {
+			return nil, err
+		}
+
+		roundInfo := new(RoundInfo)
+		if err := s.dbGetValue([]byte(k), roundInfo); err != nil {
+			return nil, err
+		}
+
+		for x := range roundInfo.CreatedEvents {
+			res[x] = r
+		}
+	}
+	return res, nil
+}
+
+func (s *FileStore) dbSetRound(index int, round *RoundInfo) error {
+	//insert [round_index] => [round bytes]
+	return s.dbSetValue(roundKey(index), round)
+}
+
+func (s *FileStore) dbGetBlock(index int) (*Block, error) {
+	block := new(Block)
+	if err := s.dbGetValue(blockKey(index), block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (s *FileStore) dbSetBlock(block *Block) error {
+	//insert [index] => [block bytes]
+	return s.dbSetValue(blockKey(block.Index()), block)
+}
+
+func (s *FileStore) dbGetFrame(index int) (*Frame, error) {
+	frame := new(Frame)
+	if err := s.dbGetValue(frameKey(index), frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (s *FileStore) dbSetFrame(frame *Frame) error {
+	//insert [index] => [frame bytes]
+	return s.dbSetValue(frameKey(frame.Round), frame)
+}
+
+//dbPruneEvents deletes the Events of every participant up to, and including,
+//the head of its Root in the Frame, along with the corresponding participant
+//and topological keys.
+func (s *FileStore) dbPruneEvents(frame *Frame) error {
+	pruned := make(map[string]bool)
+	keys := [][]byte{}
+
+	for p, root := range frame.Roots {
+		for i := root.GetHead().Index; i >= 0; i-- {
+			peKey := participantEventKey(p, i)
+			hash, err := s.log.get(peKey)
+			if err != nil {
+				if cm.Is(err, cm.KeyNotFound) {
+					break
+				}
+				return err
+			}
+
+			pruned[string(hash)] = true
+			keys = append(keys, hash, peKey)
+		}
+	}
+
+	if len(pruned) == 0 {
+		return nil
+	}
+
+	//Pruned Events are the oldest, so their topological keys come first.
+	found := 0
+	for _, k := range s.log.keys(topoPrefix + "_") {
+		if found == len(pruned) {
+			break
+		}
+
+		hash, err := s.log.get([]byte(k))
+		if err != nil {
+			return err
+		}
+
+		if pruned[string(hash)] {
+			keys = append(keys, []byte(k))
+			found++
+		}
+	}
+
+	return s.log.del(keys)
+}
+
+//dbDeleteBelow deletes the keys of the form prefix_index, where index is lower
+//than limit.
+func (s *FileStore) dbDeleteBelow(prefix string, limit int) error {
+	keys := [][]byte{}
+	limitKey := fmt.Sprintf("%s_%09d", prefix, limit)
+	for _, k := range s.log.keys(prefix + "_") {
+		if k >= limitKey {
+			break
+		}
+		keys = append(keys, []byte(k))
+	}
+	return s.log.del(keys)
+}
+
+func (s *FileStore) dbDeleteFrom(prefix string, from int) error {
+	keys := [][]byte{}
+	fromKey := fmt.Sprintf("%s_%09d", prefix, from)
+	for _, k := range s.log.keys(prefix + "_") {
+		if k >= fromKey {
+			keys = append(keys, []byte(k))
+		}
+	}
+	return s.log.del(keys)
+}
+
+//dbGetBootstrapRounds returns the Rounds recorded by dbSetBootstrapRounds, which
+//are only left in the log if Bootstrap was interrupted
+func (s *FileStore) dbGetBootstrapRounds() (map[string]int, error) {
+	roundsBytes, err := s.log.get([]byte(bootRoundsKey))
+	if err != nil {
+		return nil, err
+	}
+
+	rounds := make(map[string]int)
+	if err := json.Unmarshal(roundsBytes, &rounds); err != nil {
+		return nil, err
+	}
+
+	return rounds, nil
+}
+
+//dbSetBootstrapRounds records the Rounds of the Events that Bootstrap replays,
+//before it deletes the RoundInfos they were read from
+func (s *FileStore) dbSetBootstrapRounds(rounds map[string]int) error {
+	val, err := json.Marshal(rounds)
+	if err != nil {
+		return err
+	}
+
+	//insert [key] => [event hash => round]
+	return s.log.set([]byte(bootRoundsKey), val)
+}
+
+//dbDeleteBootstrapRounds deletes the Rounds recorded by dbSetBootstrapRounds,
+//once Bootstrap has replayed the Events and recorded their new RoundInfos
+func (s *FileStore) dbDeleteBootstrapRounds() error {
+	return s.log.del([][]byte{[]byte(bootRoundsKey)})
+}
+
+//dbGetBase returns the newest of the bases recorded by Prune and Checkpoint, or
+//a KeyNotFound StoreErr if there are none.
+func (s *FileStore) dbGetBase() (*storeBase, error) {
+	var res *storeBase
+	for _, key := range []string{pruneBaseKey, anchorBaseKey} {
+		baseBytes, err := s.log.get([]byte(key))
+		if err != nil {
+			if cm.Is(err, cm.KeyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		base := new(storeBase)
+		if err := json.Unmarshal(baseBytes, base); err != nil {
+			return nil, err
+		}
+
+		if res == nil || base.BlockIndex > res.BlockIndex {
+			res = base
+		}
+	}
+
+	if res == nil {
+		return nil, cm.NewStoreErr("Base", cm.KeyNotFound, "")
+	}
+
+	return res, nil
+}
+
+func (s *FileStore) dbSetBase(key string, base *storeBase) error {
+	val, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+
+	//insert [key] => [block index, snapshot, topological index]
+	return s.log.set([]byte(key), val)
+}
+
+func (s *FileStore) dbGetForkProof(creator string, index int) (*ForkProof, error) {
+	proof := new(ForkProof)
+	if err := s.dbGetValue(forkProofKey(creator, index), proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+func (s *FileStore) dbSetForkProof(proof *ForkProof) error {
+	//insert [creator_index] => [ForkProof bytes]
+	return s.dbSetValue(forkProofKey(proof.Creator(), proof.Index()), proof)
+}
+
+func (s *FileStore) dbGetForkProofs() ([]*ForkProof, error) {
+	proofs := []*ForkProof{}
+	for _, k := range s.log.keys(forkProofPrefix) {
+		proof := new(ForkProof)
+		if err := s.dbGetValue([]byte(k), proof); err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
+
+func (s *FileStore) dbGetTxLocation(hash string) (*TxLocation, error) {
+	location := new(TxLocation)
+	if err := s.dbGetValue(txLocationKey(hash), location); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+func (s *FileStore) dbSetTxLocation(location *TxLocation) error {
+	//insert [tx hash] => [TxLocation bytes]
+	return s.dbSetValue(txLocationKey(location.TxHash), location)
+}
+
+//mapLogError renames the KeyNotFound errors of the log after the type of the
+//value that was not found
+func mapLogError(err error, name, key string) error {
+	if err != nil && cm.Is(err, cm.KeyNotFound) {
+		return cm.NewStoreErr(name, cm.KeyNotFound, key)
+	}
+	return err
+}
@@ -0,0 +1,385 @@
+package hashgraph
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	cm "github.com/mosaicnetworks/babble/src/common"
+)
+
+/*******************************************************************************
+Test creating, loading, and closing a FileStore
+*******************************************************************************/
+
+func TestNewFileStore(t *testing.T) {
+	os.RemoveAll("test_data")
+	os.Mkdir("test_data", os.ModeDir|0777)
+	path := filepath.Join("test_data", "file")
+	defer os.RemoveAll(path)
+
+	store, err := NewFileStore(1000, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if store.NeedBoostrap() {
+		t.Fatalf("A new FileStore should not need bootstrapping")
+	}
+
+	peerSet, _ := initPeers(3)
+	block := NewBlock(0, 1, []byte("framehash"), peerSet.Peers, [][]byte{[]byte("tx")}, nil)
+	if err := store.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewFileStore(1000, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if !store.NeedBoostrap() {
+		t.Fatalf("A reopened FileStore should need bootstrapping")
+	}
+
+	storedBlock, err := store.GetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(storedBlock.Body, block.Body) {
+		t.Fatalf("Block and StoredBlock bodies do not match")
+	}
+}
+
+//A record that was only partially written, when the process died, should be
+//dropped when the log is reopened, and the log should remain usable.
+func TestFileLogRecovery(t *testing.T) {
+	os.RemoveAll("test_data")
+	os.Mkdir("test_data", os.ModeDir|0777)
+	dir, err := ioutil.TempDir("test_data", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log, err := openFileLog(dir, defaultSegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.set([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.set([]byte("b"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//Append the beginning of a record
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(1)), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 1, 2, 3, logRecordSet, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	log, err = openFileLog(dir, defaultSegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.set([]byte("c"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err = openFileLog(dir, defaultSegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.close()
+
+	for k, v := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		val, err := log.get([]byte(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != v {
+			t.Fatalf("%s should be %s, not %s", k, v, val)
+		}
+	}
+}
+
+//Values are spread over several segments, and the oldest segments are deleted
+//once all their values are deleted.
+func TestFileLogSegments(t *testing.T) {
+	os.RemoveAll("test_data")
+	os.Mkdir("test_data", os.ModeDir|0777)
+	dir, err := ioutil.TempDir("test_data", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log, err := openFileLog(dir, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := [][]byte{}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key_%09d", i))
+		if err := log.set(key, []byte(fmt.Sprintf("value %d", i))); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	segments := len(log.segments)
+	if segments < 10 {
+		t.Fatalf("There should be at least 10 segments, not %d", segments)
+	}
+
+	if err := log.del(keys[:50]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, segmentName(1))); !os.IsNotExist(err) {
+		t.Fatalf("The first segment should have been deleted. err: %v", err)
+	}
+	if len(log.segments) >= segments {
+		t.Fatalf("Dead segments should have been deleted")
+	}
+
+	if err := log.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err = openFileLog(dir, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.close()
+
+	if n := len(log.keys("key_")); n != 50 {
+		t.Fatalf("There should be 50 keys, not %d", n)
+	}
+	for i, key := range keys {
+		val, err := log.get(key)
+		if i < 50 {
+			if !cm.Is(err, cm.KeyNotFound) {
+				t.Fatalf("%s should have been deleted. err: %v", key, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != fmt.Sprintf("value %d", i) {
+			t.Fatalf("%s should be 'value %d', not %s", key, i, val)
+		}
+	}
+}
+
+//Deletions are written as tombstones. A segment that only holds tombstones is
+//kept as long as an older segment holds the values they delete.
+func TestFileLogTombstones(t *testing.T) {
+	os.RemoveAll("test_data")
+	os.Mkdir("test_data", os.ModeDir|0777)
+	dir, err := ioutil.TempDir("test_data", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log, err := openFileLog(dir, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Overwriting the filler moves its value to new segments, so that the
+	//segments it leaves behind are dead
+	fill := func() {
+		for i := 0; i < 20; i++ {
+			if err := log.set([]byte("filler"), []byte(fmt.Sprintf("filler value %d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := log.set([]byte("x"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.set([]byte("y"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	fill()
+
+	if err := log.del([][]byte{[]byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	tombstones := log.active.id
+	fill()
+
+	if _, err := os.Stat(filepath.Join(dir, segmentName(tombstones))); err != nil {
+		t.Fatalf("The segment of the tombstone should be kept while x is in the first segment. err: %v", err)
+	}
+
+	if err := log.close(); err != nil {
+		t.Fatal(err)
+	}
+	log, err = openFileLog(dir, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.get([]byte("x")); !cm.Is(err, cm.KeyNotFound) {
+		t.Fatalf("x should stay deleted after reopening. err: %v", err)
+	}
+	if val, err := log.get([]byte("y")); err != nil || string(val) != "2" {
+		t.Fatalf("y should be 2, not %s. err: %v", val, err)
+	}
+
+	//Once the first segment is dead, the segments of the tombstones go too
+	if err := log.del([][]byte{[]byte("y")}); err != nil {
+		t.Fatal(err)
+	}
+	fill()
+
+	for _, id := range []int{1, tombstones} {
+		if _, err := os.Stat(filepath.Join(dir, segmentName(id))); !os.IsNotExist(err) {
+			t.Fatalf("Segment %d should have been deleted. err: %v", id, err)
+		}
+	}
+
+	if err := log.close(); err != nil {
+		t.Fatal(err)
+	}
+	log, err = openFileLog(dir, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.close()
+
+	for _, k := range []string{"x", "y"} {
+		if _, err := log.get([]byte(k)); !cm.Is(err, cm.KeyNotFound) {
+			t.Fatalf("%s should stay deleted after reopening. err: %v", k, err)
+		}
+	}
+	if _, err := log.get([]byte("filler")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//A record whose checksum does not match is dropped if it is the last record of
+//the log, where it results from an interrupted write. Anywhere else, the log
+//refuses to open.
+func TestFileLogChecksum(t *testing.T) {
+	os.RemoveAll("test_data")
+	os.Mkdir("test_data", os.ModeDir|0777)
+
+	corrupt := func(path string, offset int64) {
+		f, err := os.OpenFile(path, os.O_RDWR, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, offset); err != nil {
+			t.Fatal(err)
+		}
+		b[0] ^= 0xFF
+		if _, err := f.WriteAt(b, offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Last record", func(t *testing.T) {
+		dir, err := ioutil.TempDir("test_data", "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		log, err := openFileLog(dir, defaultSegmentSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := log.set([]byte("a"), []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := log.set([]byte("b"), []byte("2")); err != nil {
+			t.Fatal(err)
+		}
+		size := log.active.size
+		if err := log.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		//Flip the value of b
+		corrupt(filepath.Join(dir, segmentName(1)), size-1)
+
+		log, err = openFileLog(dir, defaultSegmentSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer log.close()
+
+		if val, err := log.get([]byte("a")); err != nil || string(val) != "1" {
+			t.Fatalf("a should be 1, not %s. err: %v", val, err)
+		}
+		if _, err := log.get([]byte("b")); !cm.Is(err, cm.KeyNotFound) {
+			t.Fatalf("The corrupt record of b should have been dropped. err: %v", err)
+		}
+		if err := log.set([]byte("c"), []byte("3")); err != nil {
+			t.Fatal(err)
+		}
+		if val, err := log.get([]byte("c")); err != nil || string(val) != "3" {
+			t.Fatalf("c should be 3, not %s. err: %v", val, err)
+		}
+	})
+
+	t.Run("Older segment", func(t *testing.T) {
+		dir, err := ioutil.TempDir("test_data", "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		log, err := openFileLog(dir, 256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 50; i++ {
+			if err := log.set([]byte(fmt.Sprintf("key_%d", i)), []byte("value")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(log.segments) < 2 {
+			t.Fatalf("There should be several segments, not %d", len(log.segments))
+		}
+		if err := log.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		//Flip the key of the first record
+		corrupt(filepath.Join(dir, segmentName(1)), int64(len(logMagic)+logHeaderSize))
+
+		if _, err := openFileLog(dir, 256); err == nil {
+			t.Fatalf("A corrupt record in an older segment should be an error")
+		}
+	})
+}
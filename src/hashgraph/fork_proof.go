@@ -0,0 +1,115 @@
+package hashgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+)
+
+/*******************************************************************************
+ForkProof
+*******************************************************************************/
+
+//SignedEventBody is an EventBody together with its creator's signature. It
+//contains everything needed to verify, independently of any hashgraph, that the
+//creator produced the EventBody.
+type SignedEventBody struct {
+	Body      EventBody
+	Signature string
+}
+
+//Verify checks the signature against the creator's public key
+func (s *SignedEventBody) Verify() (bool, error) {
+	pubKey := crypto.ToECDSAPub(s.Body.Creator)
+	if pubKey == nil || pubKey.X == nil {
+		return false, fmt.Errorf("Invalid creator public key")
+	}
+
+	event := Event{
+		Body:      s.Body,
+		Signature: s.Signature,
+	}
+
+	return event.Verify()
+}
+
+/*
+ForkProof is the evidence that a participant created two different Events with
+the same Index, which honest participants never do. It contains both signed
+EventBodies, so any node can verify it on its own without trusting the node
+that detected the fork.
+*/
+type ForkProof struct {
+	EventA SignedEventBody
+	EventB SignedEventBody
+}
+
+//NewForkProof creates a ForkProof from two conflicting Events
+func NewForkProof(a, b *Event) *ForkProof {
+	return &ForkProof{
+		EventA: SignedEventBody{Body: a.Body, Signature: a.Signature},
+		EventB: SignedEventBody{Body: b.Body, Signature: b.Signature},
+	}
+}
+
+//Creator returns the hex representation of the public key of the participant
+//who forked
+func (f *ForkProof) Creator() string {
+	return fmt.Sprintf("0x%X", f.EventA.Body.Creator)
+}
+
+//Index returns the index at which the fork occurred
+func (f *ForkProof) Index() int {
+	return f.EventA.Body.Index
+}
+
+//Verify checks that both EventBodies are signed by the same creator, have the
+//same Index, and are different.
+func (f *ForkProof) Verify() (bool, error) {
+	if !bytes.Equal(f.EventA.Body.Creator, f.EventB.Body.Creator) {
+		return false, fmt.Errorf("ForkProof Events have different creators")
+	}
+
+	if f.EventA.Body.Index != f.EventB.Body.Index {
+		return false, fmt.Errorf("ForkProof Events have different indexes")
+	}
+
+	hashA, err := f.EventA.Body.Hash()
+	if err != nil {
+		return false, err
+	}
+
+	hashB, err := f.EventB.Body.Hash()
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.Equal(hashA, hashB) {
+		return false, fmt.Errorf("ForkProof Events are identical")
+	}
+
+	for _, seb := range []SignedEventBody{f.EventA, f.EventB} {
+		if ok, err := seb.Verify(); !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (f *ForkProof) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b) //will write to b
+	if err := enc.Encode(f); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (f *ForkProof) Unmarshal(data []byte) error {
+	b := bytes.NewBuffer(data)
+	dec := json.NewDecoder(b) //will read from b
+	return dec.Decode(f)
+}
@@ -0,0 +1,87 @@
+package hashgraph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+)
+
+func createForkProof(t *testing.T) (*ForkProof, TestNode) {
+	key, _ := crypto.GenerateECDSAKey()
+	node := NewTestNode(key)
+
+	eventA := NewEvent([][]byte{[]byte("a")}, nil, nil, []string{"", ""}, node.Pub, 1)
+	if err := eventA.Sign(node.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	eventB := NewEvent([][]byte{[]byte("b")}, nil, nil, []string{"", ""}, node.Pub, 1)
+	if err := eventB.Sign(node.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewForkProof(eventA, eventB), node
+}
+
+func TestVerifyForkProof(t *testing.T) {
+	proof, node := createForkProof(t)
+
+	if proof.Creator() != node.PubHex {
+		t.Fatalf("Creator should be %s, not %s", node.PubHex, proof.Creator())
+	}
+
+	if proof.Index() != 1 {
+		t.Fatalf("Index should be 1, not %d", proof.Index())
+	}
+
+	if ok, err := proof.Verify(); !ok {
+		t.Fatalf("ForkProof should verify: %v", err)
+	}
+
+	t.Run("Identical Events", func(t *testing.T) {
+		bad := *proof
+		bad.EventB = bad.EventA
+		if ok, _ := bad.Verify(); ok {
+			t.Fatal("ForkProof with identical Events should not verify")
+		}
+	})
+
+	t.Run("Different indexes", func(t *testing.T) {
+		bad := *proof
+		bad.EventB.Body.Index = 2
+		if ok, _ := bad.Verify(); ok {
+			t.Fatal("ForkProof with different indexes should not verify")
+		}
+	})
+
+	t.Run("Invalid signature", func(t *testing.T) {
+		bad := *proof
+		bad.EventB.Body.Transactions = [][]byte{[]byte("c")}
+		if ok, _ := bad.Verify(); ok {
+			t.Fatal("ForkProof with a tampered Event should not verify")
+		}
+	})
+}
+
+func TestMarshallForkProof(t *testing.T) {
+	proof, _ := createForkProof(t)
+
+	raw, err := proof.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newProof := new(ForkProof)
+	if err := newProof.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(proof, newProof) {
+		t.Fatalf("ForkProofs do not match. Expected %#v, got %#v", proof, newProof)
+	}
+
+	if ok, err := newProof.Verify(); !ok {
+		t.Fatalf("Unmarshalled ForkProof should verify: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"reflect"
 	"sort"
+	"time"
 
 	"github.com/mosaicnetworks/babble/src/common"
 	"github.com/mosaicnetworks/babble/src/peers"
@@ -27,6 +28,24 @@ const (
 		arbitrary. Do something smarter.
 	*/
 	COIN_ROUND_FREQ = float64(4)
+
+	/*
+		PEERSET_DELAY is the number of rounds between the RoundReceived of an
+		accepted PEER_ADD or PEER_REMOVE InternalTransaction, and the Round at
+		which the resulting PeerSet takes effect. This leaves enough time for
+		all nodes to commit the corresponding Block before they start counting
+		votes with the new PeerSet. Like ROOT_DEPTH, all peers must use the same
+		value.
+	*/
+	PEERSET_DELAY = 6
+
+	/*
+		CHECKPOINT_DEPTH is the number of rounds kept between the checkpoint
+		and the AnchorBlock. A node restarted from its checkpoint only holds the
+		Events above it, so this leaves it enough Events to serve the peers
+		that are slightly behind, instead of forcing them to fast-forward.
+	*/
+	CHECKPOINT_DEPTH = 5
 )
 
 //Hashgraph is a DAG of Events. It also contains methods to extract a consensus
@@ -36,15 +55,21 @@ type Hashgraph struct {
 	UndeterminedEvents      []string               //[index] => hash . FIFO queue of Events whose consensus order is not yet determined
 	PendingRounds           *PendingRoundsCache    //FIFO queue of Rounds which have not attained consensus yet
 	PendingSignatures       *SigPool               //Pool of Block signatures that need to be processed (matched with Blocks)
+	PendingForkProofs       []ForkProof            //ForkProofs detected locally that have not been gossiped yet
 	LastConsensusRound      *int                   //index of last consensus round
 	FirstConsensusRound     *int                   //index of first consensus round (only used in tests)
 	AnchorBlock             *int                   //index of last block with enough signatures
 	roundLowerBound         *int                   //rounds and events below this lower bound have a special treatement (cf fastsync)
+	prunedRound             *int                   //round of the Frame used as the base of the last pruning
+	checkpointBlock         *int                   //index of the last Block recorded by Checkpoint
+	bootstrapRounds         map[string]int         //Rounds of the Events replayed by Bootstrap, as recorded in the DB
 	LastCommitedRoundEvents int                    //number of events in round before LastConsensusRound
 	ConsensusTransactions   int                    //number of consensus transactions
 	PendingLoadedEvents     int                    //number of loaded events that are not yet committed
 	commitCallback          InternalCommitCallback //commit block callback
 	topologicalIndex        int                    //counter used to order events in topological order (only local)
+	maxBlockTransactions    int                    //maximum number of transactions per Block (0 means no limit)
+	maxBlockBytes           int                    //maximum size of the transactions of a Block (0 means no limit)
 
 	ancestorCache     *common.LRU
 	selfAncestorCache *common.LRU
@@ -91,6 +116,15 @@ func (h *Hashgraph) Init(peerSet *peers.PeerSet) error {
 	return nil
 }
 
+//SetBlockLimits sets the maximum number of transactions, and the maximum total
+//size of transactions, of a Block. Frames that exceed them are split into
+//consecutive Blocks. A zero limit means no limit. All peers must use the same
+//limits, otherwise they will not produce the same Blocks.
+func (h *Hashgraph) SetBlockLimits(maxTransactions, maxBytes int) {
+	h.maxBlockTransactions = maxTransactions
+	h.maxBlockBytes = maxBytes
+}
+
 /*******************************************************************************
 Private Methods
 *******************************************************************************/
@@ -197,17 +231,35 @@ func (h *Hashgraph) _stronglySee(x, y string, peers *peers.PeerSet) (bool, error
 	}
 
 	c := 0
-	for p := range peers.ByPubKey {
+	for p, peer := range peers.ByPubKey {
 		xla, xlaok := ex.lastAncestors[p]
 		yfd, yfdok := ey.firstDescendants[p]
 		if xlaok && yfdok && xla.index >= yfd.index {
-			c++
+			c += peer.VotingWeight()
 		}
 	}
 
 	return c >= peers.SuperMajority(), nil
 }
 
+//creatorWeight returns the voting weight, in peerSet, of the creator of Event x
+func (h *Hashgraph) creatorWeight(x string, peerSet *peers.PeerSet) (int, error) {
+	ex, err := h.Store.GetEvent(x)
+	if err != nil {
+		return 0, err
+	}
+	return peerSet.WeightOf(ex.Creator()), nil
+}
+
+//weightFunc wraps creatorWeight for RoundInfo.WitnessesDecided. Events that
+//cannot be retrieved weigh nothing.
+func (h *Hashgraph) weightFunc(peerSet *peers.PeerSet) func(string) int {
+	return func(x string) int {
+		weight, _ := h.creatorWeight(x, peerSet)
+		return weight
+	}
+}
+
 func (h *Hashgraph) round(x string) (int, error) {
 	if c, ok := h.roundCache.Get(x); ok {
 		return c.(int), nil
@@ -227,8 +279,18 @@ func (h *Hashgraph) _round(x string) (int, error) {
 		return r.GetHead().Round, nil
 	}
 
+	//x is replayed by Bootstrap; use the value computed before the restart.
+	//Witnesses below the Roots are not loaded, so it could not be recomputed.
+	if r, ok := h.bootstrapRounds[x]; ok {
+		return r, nil
+	}
+
 	ex, err := h.Store.GetEvent(x)
 	if err != nil {
+		//x is below a Root; use the value recorded in the Root's PastEvents
+		if re, ok := h.rootPastEvent(x); ok {
+			return re.Round, nil
+		}
 		return math.MinInt32, err
 	}
 
@@ -289,7 +351,11 @@ func (h *Hashgraph) _round(x string) (int, error) {
 			return math.MinInt32, err
 		}
 		if ss {
-			c++
+			weight, err := h.creatorWeight(w, parentRoundPeerSet)
+			if err != nil {
+				return math.MinInt32, err
+			}
+			c += weight
 		}
 	}
 
@@ -300,6 +366,24 @@ func (h *Hashgraph) _round(x string) (int, error) {
 	return parentRound, nil
 }
 
+/*
+rootPastEvent looks for x in the PastEvents of the Roots. In a Reset Hashgraph,
+an Event above the Frame can have an other-parent that is below the Roots, and
+was only recorded in their PastEvents because a Frame Event also references it.
+*/
+func (h *Hashgraph) rootPastEvent(x string) (RootEvent, bool) {
+	for p := range h.Store.RepertoireByPubKey() {
+		root, err := h.Store.GetRoot(p)
+		if err != nil {
+			continue
+		}
+		if re, ok := root.Past[x]; ok {
+			return re, true
+		}
+	}
+	return RootEvent{}, false
+}
+
 //true if x is a witness (first event of a round for the owner)
 func (h *Hashgraph) witness(x string) (bool, error) {
 	ex, err := h.Store.GetEvent(x)
@@ -365,6 +449,9 @@ func (h *Hashgraph) _lamportTimestamp(x string) (int, error) {
 
 	ex, err := h.Store.GetEvent(x)
 	if err != nil {
+		if re, ok := h.rootPastEvent(x); ok {
+			return re.LamportTimestamp, nil
+		}
 		return math.MinInt32, err
 	}
 
@@ -384,8 +471,10 @@ func (h *Hashgraph) _lamportTimestamp(x string) (int, error) {
 
 	if ex.OtherParent() != "" {
 		opLT := math.MinInt32
-		if _, err := h.Store.GetEvent(ex.OtherParent()); err == nil {
-			//if we know the other-parent, fetch its Round directly
+		_, isRootHead := rootsBySelfParent[ex.OtherParent()]
+		if _, err := h.Store.GetEvent(ex.OtherParent()); err == nil || isRootHead {
+			//if we know the other-parent, or if it is the Head of a Root,
+			//fetch its LamportTimestamp directly
 			t, err := h.lamportTimestamp(ex.OtherParent())
 			if err != nil {
 				return math.MinInt32, err
@@ -435,6 +524,60 @@ func (h *Hashgraph) checkSelfParent(event *Event) error {
 	return nil
 }
 
+//checkFork looks for another Event from the same creator with the same Index.
+//If there is one, it records a ForkProof, adds it to the PendingForkProofs so
+//that it is gossiped in the next self-Event, and returns an error. Conflicting
+//Events which are no longer in the Store (in a Root for example) are not
+//detected.
+func (h *Hashgraph) checkFork(event *Event) error {
+	existingHash, err := h.Store.ParticipantEvent(event.Creator(), event.Index())
+	if err != nil || existingHash == "" || existingHash == event.Hex() {
+		return nil
+	}
+
+	existing, err := h.Store.GetEvent(existingHash)
+	if err != nil {
+		return nil
+	}
+
+	proof := NewForkProof(existing, event)
+
+	if _, err := h.Store.GetForkProof(proof.Creator(), proof.Index()); err != nil {
+		if !common.Is(err, common.KeyNotFound) {
+			return err
+		}
+
+		if err := h.Store.SetForkProof(proof); err != nil {
+			return err
+		}
+
+		h.PendingForkProofs = append(h.PendingForkProofs, *proof)
+	}
+
+	return fmt.Errorf("Fork detected: %s created two Events with index %d",
+		proof.Creator(),
+		proof.Index())
+}
+
+//recordForkProof saves a ForkProof received from another node, unless we
+//already know about this fork.
+func (h *Hashgraph) recordForkProof(proof ForkProof) error {
+	_, err := h.Store.GetForkProof(proof.Creator(), proof.Index())
+	if err == nil {
+		return nil
+	}
+	if !common.Is(err, common.KeyNotFound) {
+		return err
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"creator": proof.Creator(),
+		"index":   proof.Index(),
+	}).Warn("Received ForkProof")
+
+	return h.Store.SetForkProof(&proof)
+}
+
 //Check if we know the OtherParent
 func (h *Hashgraph) checkOtherParent(event *Event) error {
 	otherParent := event.OtherParent()
@@ -709,6 +852,35 @@ func (h *Hashgraph) InsertEvent(event *Event, setWireInfo bool) error {
 		return fmt.Errorf("Invalid Event signature")
 	}
 
+	//verify InternalTransaction signatures
+	for _, itx := range event.InternalTransactions() {
+		if ok, err := itx.Verify(); !ok {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("Invalid InternalTransaction signature")
+		}
+	}
+
+	//verify ForkProofs
+	for _, fp := range event.ForkProofs() {
+		if ok, err := fp.Verify(); !ok {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("Invalid ForkProof")
+		}
+	}
+
+	if err := h.checkFork(event); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"event":   event.Hex(),
+			"creator": event.Creator(),
+			"index":   event.Index(),
+		}).WithError(err).Errorf("CheckFork")
+		return err
+	}
+
 	if err := h.checkSelfParent(event); err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"event":       event.Hex(),
@@ -759,6 +931,13 @@ func (h *Hashgraph) InsertEvent(event *Event, setWireInfo bool) error {
 		h.PendingSignatures.Add(bs)
 	}
 
+	//ForkProofs gossiped by other nodes have already been verified above
+	for _, fp := range event.ForkProofs() {
+		if err := h.recordForkProof(fp); err != nil {
+			return fmt.Errorf("RecordForkProof: %s", err)
+		}
+	}
+
 	return nil
 }
 
@@ -903,14 +1082,19 @@ func (h *Hashgraph) DecideFame() error {
 							}
 						}
 
-						//Collect votes from these witnesses.
+						//Collect votes from these witnesses, weighted by the
+						//voting weight of their creators.
 						yays := 0
 						nays := 0
 						for _, w := range ssWitnesses {
+							weight, err := h.creatorWeight(w, jPrevPeerSet)
+							if err != nil {
+								return err
+							}
 							if votes[w][x] {
-								yays++
+								yays += weight
 							} else {
-								nays++
+								nays += weight
 							}
 						}
 						v := false
@@ -942,7 +1126,7 @@ func (h *Hashgraph) DecideFame() error {
 			}
 		}
 
-		if rRoundInfo.WitnessesDecided(rPeerSet) {
+		if rRoundInfo.WitnessesDecided(rPeerSet, h.weightFunc(rPeerSet)) {
 			decidedRounds = append(decidedRounds, roundIndex)
 		}
 
@@ -994,7 +1178,7 @@ func (h *Hashgraph) DecideRoundReceived() error {
 				have all the round's witnesses. In this case, just continue
 				through the i loop.
 			*/
-			if !(tr.WitnessesDecided(tPeers)) {
+			if !(tr.WitnessesDecided(tPeers, h.weightFunc(tPeers))) {
 				if h.roundLowerBound == nil || *h.roundLowerBound < i {
 					break
 				} else {
@@ -1003,8 +1187,9 @@ func (h *Hashgraph) DecideRoundReceived() error {
 			}
 
 			fws := tr.FamousWitnesses()
-			//set of famous witnesses that see x
+			//set of famous witnesses that see x, and their total weight
 			s := []string{}
+			sWeight := 0
 			for _, w := range fws {
 				see, err := h.see(w, x)
 				if err != nil {
@@ -1012,10 +1197,15 @@ func (h *Hashgraph) DecideRoundReceived() error {
 				}
 				if see {
 					s = append(s, w)
+					weight, err := h.creatorWeight(w, tPeers)
+					if err != nil {
+						return err
+					}
+					sWeight += weight
 				}
 			}
 
-			if len(s) == len(fws) && len(s) >= tPeers.SuperMajority() {
+			if len(s) == len(fws) && sWeight >= tPeers.SuperMajority() {
 				received = true
 
 				ex, err := h.Store.GetEvent(x)
@@ -1025,6 +1215,11 @@ func (h *Hashgraph) DecideRoundReceived() error {
 
 				ex.SetRoundReceived(i)
 
+				ex.ConsensusTimestamp, err = h.consensusTimestamp(ex, fws)
+				if err != nil {
+					return err
+				}
+
 				err = h.Store.SetEvent(ex)
 				if err != nil {
 					return err
@@ -1123,20 +1318,35 @@ func (h *Hashgraph) ProcessDecidedRounds() error {
 			}
 
 			lastBlockIndex := h.Store.LastBlockIndex()
-			block, err := NewBlockFromFrame(lastBlockIndex+1, frame)
+			blocks, err := NewBlocksFromFrame(lastBlockIndex+1,
+				frame,
+				h.maxBlockTransactions,
+				h.maxBlockBytes)
 			if err != nil {
 				return err
 			}
 
-			if len(block.Transactions()) > 0 {
+			if len(blocks) > 1 ||
+				len(blocks[0].Transactions()) > 0 ||
+				len(blocks[0].InternalTransactions()) > 0 {
 
-				if err := h.Store.SetBlock(block); err != nil {
+				//Save all the Blocks of the Frame before committing any of
+				//them, so that SetAnchorBlock can tell which one is the last.
+				for _, block := range blocks {
+					if err := h.Store.SetBlock(block); err != nil {
+						return err
+					}
+				}
+
+				if err := h.indexTransactions(frame, blocks); err != nil {
 					return err
 				}
 
-				err := h.commitCallback(block)
-				if err != nil {
-					h.logger.Warningf("Failed to commit block %d", block.Index())
+				for _, block := range blocks {
+					err := h.commitCallback(block)
+					if err != nil {
+						h.logger.Warningf("Failed to commit block %d", block.Index())
+					}
 				}
 			}
 		} else {
@@ -1153,6 +1363,91 @@ func (h *Hashgraph) ProcessDecidedRounds() error {
 	return nil
 }
 
+/*
+consensusTimestamp computes the consensus timestamp of Event x, given the famous
+witnesses of its round-received. For each famous witness, we take the timestamp
+of the earliest self-ancestor of the witness that is a descendant of x; that is
+the time at which the witness's creator first received x. The consensus
+timestamp is the median of these timestamps.
+*/
+func (h *Hashgraph) consensusTimestamp(x *Event, famousWitnesses []string) (time.Time, error) {
+	timestamps := []time.Time{}
+	for _, w := range famousWitnesses {
+		ew, err := h.Store.GetEvent(w)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		fd, ok := x.firstDescendants[ew.Creator()]
+		if !ok {
+			return time.Time{}, fmt.Errorf("No first descendant of %s from %s", x.Hex(), ew.Creator())
+		}
+
+		efd, err := h.Store.GetEvent(fd.hash)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		timestamps = append(timestamps, efd.Timestamp())
+	}
+
+	if len(timestamps) == 0 {
+		return time.Time{}, fmt.Errorf("No famous witnesses to compute consensus timestamp")
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i].Before(timestamps[j])
+	})
+
+	return timestamps[len(timestamps)/2], nil
+}
+
+/*
+indexTransactions records the TxLocation of every transaction of the Blocks,
+which were created from the Events of the Frame, in order. When the same
+transaction was committed more than once, the first location is kept.
+*/
+func (h *Hashgraph) indexTransactions(frame *Frame, blocks []*Block) error {
+	b, position := 0, 0
+	for _, e := range frame.Events {
+		for i, tx := range e.Transactions() {
+			for b < len(blocks) && position >= len(blocks[b].Transactions()) {
+				b++
+				position = 0
+			}
+
+			if b == len(blocks) {
+				return fmt.Errorf("Frame %d has more transactions than its Blocks", frame.Round)
+			}
+
+			hash := TxHash(tx)
+
+			_, err := h.Store.GetTxLocation(hash)
+			if err != nil && !common.Is(err, common.KeyNotFound) {
+				return err
+			}
+
+			if err != nil {
+				location := &TxLocation{
+					TxHash:        hash,
+					BlockIndex:    blocks[b].Index(),
+					Position:      position,
+					EventHash:     e.Hex(),
+					EventPosition: i,
+				}
+
+				if err := h.Store.SetTxLocation(location); err != nil {
+					return err
+				}
+			}
+
+			position++
+		}
+	}
+
+	return nil
+}
+
 //GetFrame computes the Frame corresponding to a RoundReceived.
 func (h *Hashgraph) GetFrame(roundReceived int) (*Frame, error) {
 	//Try to get it from the Store first
@@ -1354,18 +1649,32 @@ func (h *Hashgraph) ProcessSigPool() error {
 
 /*
 SetAnchorBlock sets the AnchorBlock index if the proposed block has collected
-enough signatures (+1/3) and is above the current AnchorBlock. The AnchorBlock
-is the latest Block that collected +1/3 signatures from validators. It is used
-in FastForward responses when a node wants to sync to the top of the hashgraph.
+enough signatures (+1/3 of the voting weight) and is above the current
+AnchorBlock. The AnchorBlock is the latest Block that collected +1/3 signatures
+from validators. It is used in FastForward responses when a node wants to sync
+to the top of the hashgraph. When a Frame is split into multiple Blocks, only
+the last one can be the AnchorBlock, because a Hashgraph Reset from the Frame
+resumes after the last Block of the Frame.
 */
 func (h *Hashgraph) SetAnchorBlock(block *Block) error {
+	next, err := h.Store.GetBlock(block.Index() + 1)
+	if err == nil && next.RoundReceived() == block.RoundReceived() {
+		h.logger.WithField("index", block.Index()).Debug("Block is not the last of its Frame")
+		return nil
+	}
+
 	peerSet, err := h.Store.GetPeerSet(block.RoundReceived())
 	if err != nil {
 		h.logger.WithError(err).Error("No PeerSet for Block's Round ")
 		return err
 	}
 
-	if len(block.Signatures) > peerSet.TrustCount() &&
+	signatureWeight := 0
+	for validator := range block.Signatures {
+		signatureWeight += peerSet.WeightOf(validator)
+	}
+
+	if signatureWeight > peerSet.TrustCount() &&
 		(h.AnchorBlock == nil ||
 			block.Index() > *h.AnchorBlock) {
 
@@ -1373,12 +1682,14 @@ func (h *Hashgraph) SetAnchorBlock(block *Block) error {
 		h.logger.WithFields(logrus.Fields{
 			"block_index": block.Index(),
 			"signatures":  len(block.Signatures),
+			"weight":      signatureWeight,
 			"trustCount":  peerSet.TrustCount(),
 		}).Debug("Setting AnchorBlock")
 	} else {
 		h.logger.WithFields(logrus.Fields{
 			"index":       block.Index(),
 			"sigs":        len(block.Signatures),
+			"weight":      signatureWeight,
 			"trust_count": peerSet.TrustCount(),
 		}).Debug("Block is not a suitable Anchor")
 	}
@@ -1412,11 +1723,11 @@ func (h *Hashgraph) Reset(block *Block, frame *Frame) error {
 	h.LastConsensusRound = nil
 	h.FirstConsensusRound = nil
 	h.AnchorBlock = nil
+	h.prunedRound = nil
 
 	h.UndeterminedEvents = []string{}
 	h.PendingRounds = NewPendingRoundsCache()
 	h.PendingLoadedEvents = 0
-	h.topologicalIndex = 0
 
 	cacheSize := h.Store.CacheSize()
 	h.ancestorCache = common.NewLRU(cacheSize, nil)
@@ -1438,9 +1749,21 @@ func (h *Hashgraph) Reset(block *Block, frame *Frame) error {
 
 	h.setRoundLowerBound(block.RoundReceived())
 
-	//Insert Frame Events
+	//Insert Frame Events. Their wire info is not part of the Frame, and it is
+	//needed to gossip them to nodes that restarted from an older base.
+	for _, ev := range frame.Events {
+		if err := h.InsertEventAndRunConsensus(ev, true); err != nil {
+			return err
+		}
+	}
+
+	/*
+		The Frame Events are already committed. Record them as consensus Events
+		so that the Roots of the next Frames are created from the same last
+		consensus Events as on the other nodes.
+	*/
 	for _, ev := range frame.Events {
-		if err := h.InsertEventAndRunConsensus(ev, false); err != nil {
+		if err := h.Store.AddConsensusEvent(ev); err != nil {
 			return err
 		}
 	}
@@ -1449,37 +1772,266 @@ func (h *Hashgraph) Reset(block *Block, frame *Frame) error {
 }
 
 /*
-Bootstrap loads all Events from the Store's DB (if there is one) and feeds
-them to the Hashgraph (in topological order) for consensus ordering. After this
+PruneBase returns the Block and Frame that should become the new base of the
+Store, if the Events, Rounds, and Frames that are more than retainRounds rounds
+below the AnchorBlock were pruned. It is the newest Block below that limit. It
+returns nil if there is nothing new to prune.
+*/
+func (h *Hashgraph) PruneBase(retainRounds int) (*Block, *Frame, error) {
+	if h.AnchorBlock == nil {
+		return nil, nil, nil
+	}
+
+	anchorBlock, err := h.Store.GetBlock(*h.AnchorBlock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	base := h.newestBlockBelow(anchorBlock.RoundReceived() - retainRounds)
+
+	if base == nil ||
+		(h.prunedRound != nil && base.RoundReceived() <= *h.prunedRound) {
+		return nil, nil, nil
+	}
+
+	//Only use a Frame that was computed when its Round was processed. The
+	//Roots of a Frame recomputed now would not describe the same base.
+	frame, err := h.Store.GetFrame(base.RoundReceived())
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"block": base.Index(),
+			"round": base.RoundReceived(),
+		}).WithError(err).Debug("PruneBase: Frame not found")
+		return nil, nil, nil
+	}
+
+	return base, frame, nil
+}
+
+//newestBlockBelow returns the newest Block, at or below the AnchorBlock, whose
+//RoundReceived is not above limit, or nil. Blocks may be missing below the base
+//of a Reset hashgraph.
+func (h *Hashgraph) newestBlockBelow(limit int) *Block {
+	for i := *h.AnchorBlock; i >= 0; i-- {
+		block, err := h.Store.GetBlock(i)
+		if err != nil {
+			break
+		}
+		if block.RoundReceived() <= limit {
+			return block
+		}
+	}
+	return nil
+}
+
+/*
+Prune deletes the Events, Rounds, and Frames below the Frame, to keep the size
+of the Store bounded. The Block and Frame, obtained from PruneBase, become the
+new base of the Store; the Roots of the Frame take over from the pruned Events,
+as they do when the Hashgraph is Reset. Blocks are never pruned. The snapshot is
+the application's state at the Block; it is saved with the base, so that the
+application can be restored when the Hashgraph is bootstrapped from it.
+*/
+func (h *Hashgraph) Prune(base *Block, frame *Frame, snapshot []byte) error {
+	if err := h.Store.Prune(base, frame, snapshot); err != nil {
+		return err
+	}
+
+	//Forget PendingRounds that are below the new base. These are left behind
+	//by a Reset (cf ProcessDecidedRounds), and their RoundInfos are gone.
+	prunedRounds := []int{}
+	for _, pr := range h.PendingRounds.GetOrderedPendingRounds() {
+		if pr.Index < frame.Round {
+			prunedRounds = append(prunedRounds, pr.Index)
+		}
+	}
+	h.PendingRounds.Clean(prunedRounds)
+
+	h.setPrunedRound(frame.Round)
+
+	h.logger.WithFields(logrus.Fields{
+		"block": base.Index(),
+		"round": frame.Round,
+	}).Debug("Pruned Hashgraph")
+
+	return nil
+}
+
+/*
+CheckpointBase returns the newest Block that is at least CHECKPOINT_DEPTH rounds
+below the AnchorBlock, if it has not been recorded by Checkpoint yet, and if its
+Frame is in the Store. It returns nil otherwise, or if the Store does not survive
+a restart.
+*/
+func (h *Hashgraph) CheckpointBase() (*Block, error) {
+	if _, ok := h.Store.(persistentStore); !ok {
+		return nil, nil
+	}
+
+	if h.AnchorBlock == nil {
+		return nil, nil
+	}
+
+	anchorBlock, err := h.Store.GetBlock(*h.AnchorBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	block := h.newestBlockBelow(anchorBlock.RoundReceived() - CHECKPOINT_DEPTH)
+
+	if block == nil ||
+		(h.checkpointBlock != nil && block.Index() <= *h.checkpointBlock) {
+		return nil, nil
+	}
+
+	//Same as PruneBase; a Frame recomputed now would not describe the Block.
+	if _, err := h.Store.GetFrame(block.RoundReceived()); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"block": block.Index(),
+			"round": block.RoundReceived(),
+		}).WithError(err).Debug("CheckpointBase: Frame not found")
+		return nil, nil
+	}
+
+	return block, nil
+}
+
+/*
+Checkpoint records the Block, obtained from CheckpointBase, and the
+application's snapshot at that Block, as the base from which Bootstrap restarts
+the Hashgraph. Nothing is deleted; Bootstrap Resets the Hashgraph from the
+Block and its Frame, and only replays the Events that come after the Frame.
+*/
+func (h *Hashgraph) Checkpoint(block *Block, snapshot []byte) error {
+	if err := h.Store.Checkpoint(block, snapshot, h.firstTopologicalIndexAbove(block.RoundReceived())); err != nil {
+		return err
+	}
+
+	h.setCheckpointBlock(block.Index())
+
+	h.logger.WithField("block", block.Index()).Debug("Checkpoint")
+
+	return nil
+}
+
+/*
+firstTopologicalIndexAbove returns the smallest topological index of the Events
+that were not received in, or before, the given round. These are the Events that
+are neither in the round's Frame nor below its Roots. If one of them is no
+longer in the cache, it returns 0, which is always safe.
+*/
+func (h *Hashgraph) firstTopologicalIndexAbove(round int) int {
+	hashes := append([]string{}, h.UndeterminedEvents...)
+	if h.LastConsensusRound != nil {
+		for r := round + 1; r <= *h.LastConsensusRound; r++ {
+			roundInfo, err := h.Store.GetRound(r)
+			if err != nil {
+				return 0
+			}
+			hashes = append(hashes, roundInfo.ReceivedEvents...)
+		}
+	}
+
+	first := h.topologicalIndex
+	for _, x := range hashes {
+		ex, err := h.Store.GetEvent(x)
+		if err != nil {
+			return 0
+		}
+		if ex.topologicalIndex < first {
+			first = ex.topologicalIndex
+		}
+	}
+
+	return first
+}
+
+/*
+Bootstrap loads the Events from the Store's DB (if there is one) and feeds them
+to the Hashgraph (in topological order) for consensus ordering. After this
 method call, the Hashgraph should be in a state coherent with the 'tip' of the
-Hashgraph
+Hashgraph. If a base was recorded by Prune or Checkpoint, the Hashgraph is first
+Reset from the newest base Block and its Frame, the application is restored
+from the snapshot saved with the base, by calling restoreCallback, and only the
+Events above the Frame are replayed. Otherwise, all the Events are replayed
+from genesis. restoreCallback may be nil if the application does not need
+restoring.
 */
-func (h *Hashgraph) Bootstrap() error {
-	if badgerStore, ok := h.Store.(*BadgerStore); ok {
-		//Load Genesis PeerSet
-		peerSet, err := badgerStore.dbGetPeerSet(0)
+func (h *Hashgraph) Bootstrap(restoreCallback InternalRestoreCallback) error {
+	if store, ok := h.Store.(persistentStore); ok {
+		//Replayed Events are appended after those already in the DB, so that
+		//they do not overwrite the topological keys of Events that are not
+		//replayed yet.
+		nextTopologicalIndex, err := store.dbNextTopologicalIndex()
 		if err != nil {
-			return fmt.Errorf("No Genesis PeerSet: %v", err)
+			return err
 		}
+		h.topologicalIndex = nextTopologicalIndex
+
+		from := 0
+
+		base, err := store.dbGetBase()
+		if err == nil {
+			if err := h.bootstrapFromBase(store, base); err != nil {
+				return err
+			}
+			//The Blocks above the base are committed again when the Events are
+			//replayed, so the application must be restored before.
+			if restoreCallback != nil {
+				if err := restoreCallback(base.Snapshot); err != nil {
+					return err
+				}
+			}
+			from = base.TopologicalIndex
+		} else if isDBKeyNotFound(err) || common.Is(err, common.KeyNotFound) {
+			//Load Genesis PeerSet
+			peerSet, err := store.dbGetPeerSet(0)
+			if err != nil {
+				return fmt.Errorf("No Genesis PeerSet: %v", err)
+			}
 
-		//Initialize the InmemStore with Genesis PeerSet. This has side-effects:
-		//It will create the corresponding Roots and populate the Repertoires.
-		badgerStore.inmemStore.SetPeerSet(0, peerSet)
+			//Initialize the InmemStore with Genesis PeerSet. This has
+			//side-effects: It will create the corresponding Roots and populate
+			//the Repertoires.
+			store.cache().SetPeerSet(0, peerSet)
+		} else {
+			return err
+		}
 
 		//Retreive the Events from the underlying DB. They come out in topological
 		//order
-		topologicalEvents, err := badgerStore.dbTopologicalEvents()
+		topologicalEvents, err := store.dbTopologicalEvents(from)
 		if err != nil {
 			return err
 		}
 
-		//Insert the Events in the Hashgraph
+		h.logger.WithFields(logrus.Fields{
+			"from":   from,
+			"events": len(topologicalEvents),
+		}).Debug("Bootstrap: replaying Events")
+
+		//Insert the Events in the Hashgraph, skipping those that were already
+		//inserted with the Frame, and those that are below its Roots
 		for _, e := range topologicalEvents {
+			if _, err := h.Store.GetEvent(e.Hex()); err == nil {
+				continue
+			}
+			root, err := h.Store.GetRoot(e.Creator())
+			if err == nil && e.Index() <= root.GetHead().Index {
+				continue
+			}
 			if err := h.InsertEventAndRunConsensus(e, true); err != nil {
 				return err
 			}
 		}
 
+		if h.bootstrapRounds != nil {
+			if err := store.dbDeleteBootstrapRounds(); err != nil {
+				return err
+			}
+			h.bootstrapRounds = nil
+		}
+
 		//ProcessSigPool
 		if err := h.ProcessSigPool(); err != nil {
 			return err
@@ -1537,11 +2089,14 @@ func (h *Hashgraph) ReadWireInfo(wevent WireEvent) (*Event, error) {
 	}
 
 	body := EventBody{
-		Transactions:    wevent.Body.Transactions,
-		BlockSignatures: wevent.BlockSignatures(creatorBytes),
-		Parents:         []string{selfParent, otherParent},
-		Creator:         creatorBytes,
-		Index:           wevent.Body.Index,
+		Transactions:         wevent.Body.Transactions,
+		InternalTransactions: wevent.Body.InternalTransactions,
+		BlockSignatures:      wevent.BlockSignatures(creatorBytes),
+		ForkProofs:           wevent.Body.ForkProofs,
+		Parents:              []string{selfParent, otherParent},
+		Creator:              creatorBytes,
+		Index:                wevent.Body.Index,
+		Timestamp:            wevent.Body.Timestamp,
 
 		selfParentIndex:      wevent.Body.SelfParentIndex,
 		otherParentCreatorID: wevent.Body.OtherParentCreatorID,
@@ -1558,7 +2113,7 @@ func (h *Hashgraph) ReadWireInfo(wevent WireEvent) (*Event, error) {
 }
 
 //CheckBlock returns an error if the Block does not contain valid signatures
-//from MORE than 1/3 of participants
+//from participants holding MORE than 1/3 of the voting weight
 func (h *Hashgraph) CheckBlock(block *Block, peerSet *peers.PeerSet) error {
 	psh, err := peerSet.Hash()
 	if err != nil {
@@ -1572,15 +2127,16 @@ func (h *Hashgraph) CheckBlock(block *Block, peerSet *peers.PeerSet) error {
 	validSignatures := 0
 	for _, s := range block.GetSignatures() {
 		validatorHex := fmt.Sprintf("0x%X", s.Validator)
-		if _, ok := peerSet.ByPubKey[validatorHex]; !ok {
+		validator, ok := peerSet.ByPubKey[validatorHex]
+		if !ok {
 			h.logger.WithFields(logrus.Fields{
 				"validator": validatorHex,
 			}).Warning("Verifying Block signature. Unknown validator")
 			continue
 		}
-		ok, _ := block.Verify(s)
+		ok, _ = block.Verify(s)
 		if ok {
-			validSignatures++
+			validSignatures += validator.VotingWeight()
 		}
 	}
 
@@ -1608,6 +2164,94 @@ func (h *Hashgraph) setLastConsensusRound(i int) {
 	}
 }
 
+//bootstrapFromBase resets the Hashgraph from the Block recorded as the base of
+//the DB, and its Frame. The Events below the Frame are not loaded, so the
+//Hashgraph behaves as if they had been pruned.
+func (h *Hashgraph) bootstrapFromBase(store persistentStore, base *storeBase) error {
+	block, err := store.dbGetBlock(base.BlockIndex)
+	if err != nil {
+		return fmt.Errorf("Base Block %d: %v", base.BlockIndex, err)
+	}
+
+	frame, err := store.dbGetFrame(block.RoundReceived())
+	if err != nil {
+		return fmt.Errorf("Base Frame %d: %v", block.RoundReceived(), err)
+	}
+
+	/*
+		The RoundInfos that the replayed Events belong to are computed again.
+		Those in the DB also list Events below the Roots, which are not loaded,
+		so they must not be read back in place of the new ones. Only the Rounds
+		they assign to the replayed Events are kept. No replayed Event has a
+		lower Round than the PastEvents of the Roots.
+
+		The Rounds are recorded before the RoundInfos are deleted, and until the
+		replay has finished, so that a Bootstrap that fails or is interrupted
+		can start again from the same Rounds.
+	*/
+	lowestRound := frame.Round
+	for _, root := range frame.Roots {
+		for _, re := range root.Past {
+			if re.Round < lowestRound {
+				lowestRound = re.Round
+			}
+		}
+	}
+	if lowestRound < 0 {
+		lowestRound = 0
+	}
+	rounds, err := store.dbGetBootstrapRounds()
+	if err != nil {
+		if !isDBKeyNotFound(err) && !common.Is(err, common.KeyNotFound) {
+			return err
+		}
+		rounds, err = store.dbGetRoundsFrom(lowestRound)
+		if err != nil {
+			return err
+		}
+		if err := store.dbSetBootstrapRounds(rounds); err != nil {
+			return err
+		}
+	}
+	if err := store.dbDeleteFrom(roundPrefix, lowestRound); err != nil {
+		return err
+	}
+	h.bootstrapRounds = rounds
+
+	if err := h.Reset(block, frame); err != nil {
+		return err
+	}
+
+	h.setPrunedRound(frame.Round)
+
+	h.setCheckpointBlock(block.Index())
+
+	return nil
+}
+
+func (h *Hashgraph) setPrunedRound(i int) {
+	if h.prunedRound == nil {
+		h.prunedRound = new(int)
+	}
+	*h.prunedRound = i
+}
+
+//CheckpointBlock returns the index of the last Block recorded by Checkpoint, or
+//the Block that the Hashgraph was bootstrapped from, or -1
+func (h *Hashgraph) CheckpointBlock() int {
+	if h.checkpointBlock == nil {
+		return -1
+	}
+	return *h.checkpointBlock
+}
+
+func (h *Hashgraph) setCheckpointBlock(i int) {
+	if h.checkpointBlock == nil {
+		h.checkpointBlock = new(int)
+	}
+	*h.checkpointBlock = i
+}
+
 func (h *Hashgraph) setRoundLowerBound(i int) {
 	if h.roundLowerBound == nil {
 		h.roundLowerBound = new(int)
@@ -1650,6 +2294,10 @@ an error or not.
 */
 type InternalCommitCallback func(*Block) error
 
+//InternalRestoreCallback is called by the Hashgraph to restore the application
+//from a snapshot, when it is bootstrapped from a pruned Store.
+type InternalRestoreCallback func(snapshot []byte) error
+
 //DummyInternalCommitCallback is used for testing
 func DummyInternalCommitCallback(b *Block) error {
 	return nil
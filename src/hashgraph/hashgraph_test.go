@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mosaicnetworks/babble/src/common"
 	"github.com/mosaicnetworks/babble/src/crypto"
@@ -101,6 +102,7 @@ func initHashgraphNodes(n int) ([]TestNode, map[string]string, *[]*Event, *peers
 func playEvents(plays []play, nodes []TestNode, index map[string]string, orderedEvents *[]*Event) {
 	for _, p := range plays {
 		e := NewEvent(p.txPayload,
+			nil,
 			p.sigPayload,
 			[]string{index[p.selfParent], index[p.otherParent]},
 			nodes[p.to].Pub,
@@ -140,7 +142,7 @@ func initHashgraphFull(plays []play, db bool, n int, logger *logrus.Entry) (*Has
 	nodes, index, orderedEvents, peerSet := initHashgraphNodes(n)
 
 	for i, n := range nodes {
-		event := NewEvent(nil, nil, []string{rootSelfParent(n.ID), ""}, n.Pub, 0)
+		event := NewEvent(nil, nil, nil, []string{rootSelfParent(n.ID), ""}, n.Pub, 0)
 		n.signAndAddEvent(event, fmt.Sprintf("e%d", i), index, orderedEvents)
 	}
 
@@ -362,21 +364,21 @@ func TestFork(t *testing.T) {
 	hashgraph.Init(peerSet)
 
 	for i, node := range nodes {
-		event := NewEvent(nil, nil, []string{"", ""}, node.Pub, 0)
+		event := NewEvent(nil, nil, nil, []string{"", ""}, node.Pub, 0)
 		event.Sign(node.Key)
 		index[fmt.Sprintf("e%d", i)] = event.Hex()
 		hashgraph.InsertEvent(event, true)
 	}
 
 	//a and e2 need to have different hashes
-	eventA := NewEvent([][]byte{[]byte("yo")}, nil, []string{"", ""}, nodes[2].Pub, 0)
+	eventA := NewEvent([][]byte{[]byte("yo")}, nil, nil, []string{"", ""}, nodes[2].Pub, 0)
 	eventA.Sign(nodes[2].Key)
 	index["a"] = eventA.Hex()
 	if err := hashgraph.InsertEvent(eventA, true); err == nil {
 		t.Fatal("InsertEvent should return error for 'a'")
 	}
 
-	event01 := NewEvent(nil, nil,
+	event01 := NewEvent(nil, nil, nil,
 		[]string{index["e0"], index["a"]}, //e0 and a
 		nodes[0].Pub, 1)
 	event01.Sign(nodes[0].Key)
@@ -385,7 +387,7 @@ func TestFork(t *testing.T) {
 		t.Fatal("InsertEvent should return error for e01")
 	}
 
-	event20 := NewEvent(nil, nil,
+	event20 := NewEvent(nil, nil, nil,
 		[]string{index["e2"], index["e01"]}, //e2 and e01
 		nodes[2].Pub, 1)
 	event20.Sign(nodes[2].Key)
@@ -395,6 +397,80 @@ func TestFork(t *testing.T) {
 	}
 }
 
+func TestForkProof(t *testing.T) {
+	nodes, index, orderedEvents, peerSet := initHashgraphNodes(n)
+
+	for i, n := range nodes {
+		event := NewEvent(nil, nil, nil, []string{rootSelfParent(n.ID), ""}, n.Pub, 0)
+		n.signAndAddEvent(event, fmt.Sprintf("e%d", i), index, orderedEvents)
+	}
+
+	h := createHashgraph(false, orderedEvents, peerSet, testLogger(t))
+
+	//fork is another Event by node 2 with index 0
+	fork := NewEvent([][]byte{[]byte("fork")}, nil, nil,
+		[]string{rootSelfParent(nodes[2].ID), ""}, nodes[2].Pub, 0)
+	fork.Sign(nodes[2].Key)
+
+	if err := h.InsertEvent(fork, true); err == nil {
+		t.Fatal("InsertEvent should return error for fork")
+	}
+
+	proof, err := h.Store.GetForkProof(nodes[2].PubHex, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := proof.Verify(); !ok {
+		t.Fatalf("ForkProof should verify: %v", err)
+	}
+
+	if l := len(h.PendingForkProofs); l != 1 {
+		t.Fatalf("There should be 1 PendingForkProof, not %d", l)
+	}
+
+	//Detecting the same fork again should not produce another ForkProof
+	if err := h.InsertEvent(fork, true); err == nil {
+		t.Fatal("InsertEvent should return error for fork")
+	}
+
+	if l := len(h.PendingForkProofs); l != 1 {
+		t.Fatalf("There should still be 1 PendingForkProof, not %d", l)
+	}
+
+	//Node 0 gossips the ForkProof in its next Event. Another hashgraph, which
+	//never saw the fork, should record the ForkProof.
+	e01 := NewEvent(nil, nil, nil, []string{index["e0"], index["e1"]}, nodes[0].Pub, 1)
+	e01.Body.ForkProofs = h.PendingForkProofs
+	e01.Sign(nodes[0].Key)
+
+	h2 := createHashgraph(false, orderedEvents, peerSet, testLogger(t))
+
+	if err := h2.InsertEvent(e01, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h2.Store.GetForkProof(nodes[2].PubHex, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(h2.PendingForkProofs); l != 0 {
+		t.Fatalf("ForkProofs received from other nodes should not be pending")
+	}
+
+	//An Event carrying an invalid ForkProof should be rejected
+	badProof := *proof
+	badProof.EventB = badProof.EventA
+
+	e12 := NewEvent(nil, nil, nil, []string{index["e1"], e01.Hex()}, nodes[1].Pub, 1)
+	e12.Body.ForkProofs = []ForkProof{badProof}
+	e12.Sign(nodes[1].Key)
+
+	if err := h2.InsertEvent(e12, true); err == nil {
+		t.Fatal("InsertEvent should return error for Event with invalid ForkProof")
+	}
+}
+
 /*
 |  s11  |
 |   |   |
@@ -657,6 +733,51 @@ func TestStronglySee(t *testing.T) {
 	}
 }
 
+func TestWeightedStronglySee(t *testing.T) {
+	h, index := initRoundHashgraph(t)
+
+	peerSet, err := h.Store.GetPeerSet(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Same participants, but 1 and 2 weigh twice as much as 0, so that they
+	//form a super-majority (4 out of 5) on their own.
+	weights := []int{1, 2, 2}
+	weightedPeers := []*peers.Peer{}
+	for i, p := range peerSet.Peers {
+		weightedPeers = append(weightedPeers, &peers.Peer{
+			NetAddr:   p.NetAddr,
+			PubKeyHex: p.PubKeyHex,
+			Weight:    weights[i],
+		})
+	}
+	weightedPeerSet := peers.NewPeerSet(weightedPeers)
+
+	if sm := weightedPeerSet.SuperMajority(); sm != 4 {
+		t.Fatalf("SuperMajority should be 4, not %d", sm)
+	}
+
+	expected := []ancestryItem{
+		ancestryItem{"e21", "e0", true, false},
+		ancestryItem{"f1", "e2", true, false},
+		//only strongly seen through 1 and 2
+		ancestryItem{"e21", "e1", true, false},
+		//only strongly seen through 0 and 2
+		ancestryItem{"e02", "e2", false, false},
+	}
+
+	for _, exp := range expected {
+		a, err := h.stronglySee(index[exp.descendant], index[exp.ancestor], weightedPeerSet)
+		if err != nil && !exp.err {
+			t.Fatalf("Error computing stronglySee(%s, %s). Err: %v", exp.descendant, exp.ancestor, err)
+		}
+		if a != exp.val {
+			t.Fatalf("stronglySee(%s, %s) should be %v, not %v", exp.descendant, exp.ancestor, exp.val, a)
+		}
+	}
+}
+
 func TestWitness(t *testing.T) {
 	h, index := initRoundHashgraph(t)
 
@@ -896,7 +1017,7 @@ func initBlockHashgraph(t *testing.T) (*Hashgraph, []TestNode, map[string]string
 	nodes, index, orderedEvents, peerSet := initHashgraphNodes(n)
 
 	for i, peer := range peerSet.Peers {
-		event := NewEvent(nil, nil, []string{rootSelfParent(peer.ID()), ""}, nodes[i].Pub, 0)
+		event := NewEvent(nil, nil, nil, []string{rootSelfParent(peer.ID()), ""}, nodes[i].Pub, 0)
 		nodes[i].signAndAddEvent(event, fmt.Sprintf("e%d", i), index, orderedEvents)
 	}
 
@@ -908,7 +1029,7 @@ func initBlockHashgraph(t *testing.T) (*Hashgraph, []TestNode, map[string]string
 	block := NewBlock(0, 1,
 		[]byte("framehash"),
 		peerSet.Peers,
-		[][]byte{[]byte("block tx")})
+		[][]byte{[]byte("block tx")}, nil)
 
 	err := hashgraph.Store.SetBlock(block)
 	if err != nil {
@@ -958,6 +1079,7 @@ func TestInsertEventsWithBlockSignatures(t *testing.T) {
 
 		for _, p := range plays {
 			e := NewEvent(p.txPayload,
+				nil,
 				p.sigPayload,
 				[]string{index[p.selfParent], index[p.otherParent]},
 				nodes[p.to].Pub,
@@ -996,7 +1118,7 @@ func TestInsertEventsWithBlockSignatures(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		block1 := NewBlock(1, 2, []byte("framehash"), peerSet.Peers, [][]byte{})
+		block1 := NewBlock(1, 2, []byte("framehash"), peerSet.Peers, [][]byte{}, nil)
 		sig, _ := block1.Sign(nodes[2].Key)
 
 		//unknown block
@@ -1008,6 +1130,7 @@ func TestInsertEventsWithBlockSignatures(t *testing.T) {
 		p := play{2, 2, "s20", "e10", "e21", nil, []BlockSignature{unknownBlockSig}}
 
 		e := NewEvent(nil,
+			nil,
 			p.sigPayload,
 			[]string{index[p.selfParent], index[p.otherParent]},
 			nodes[p.to].Pub,
@@ -1039,6 +1162,7 @@ func TestInsertEventsWithBlockSignatures(t *testing.T) {
 		p := play{0, 2, "s00", "e21", "e02", nil, []BlockSignature{badNodeSig}}
 
 		e := NewEvent(nil,
+			nil,
 			p.sigPayload,
 			[]string{index[p.selfParent], index[p.otherParent]},
 			nodes[p.to].Pub,
@@ -1429,6 +1553,85 @@ func TestDecideRoundReceived(t *testing.T) {
 	}
 }
 
+func TestConsensusTimestamp(t *testing.T) {
+	h, index := initConsensusHashgraph(false, t)
+
+	h.DivideRounds()
+	h.DecideFame()
+	if err := h.DecideRoundReceived(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, hash := range index {
+		e, _ := h.Store.GetEvent(hash)
+		if e.roundReceived == nil {
+			if !e.ConsensusTimestamp.IsZero() {
+				t.Fatalf("%s should not have a ConsensusTimestamp", name)
+			}
+			continue
+		}
+
+		//The consensus timestamp is the time at which one of the famous
+		//witnesses' creators first received the Event, so it cannot be earlier
+		//than the Event itself.
+		if e.ConsensusTimestamp.Before(e.Timestamp()) {
+			t.Fatalf("%s ConsensusTimestamp (%v) should not be before its Timestamp (%v)",
+				name, e.ConsensusTimestamp, e.Timestamp())
+		}
+
+		round, err := h.Store.GetRound(*e.roundReceived)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//It is the median of the first-received times
+		timestamps := []time.Time{}
+		for _, w := range round.FamousWitnesses() {
+			ew, _ := h.Store.GetEvent(w)
+			efd, _ := h.Store.GetEvent(e.firstDescendants[ew.Creator()].hash)
+			timestamps = append(timestamps, efd.Timestamp())
+		}
+		before, after := 0, 0
+		for _, ts := range timestamps {
+			if ts.Before(e.ConsensusTimestamp) {
+				before++
+			} else if ts.After(e.ConsensusTimestamp) {
+				after++
+			}
+		}
+		if before > len(timestamps)/2 || after > len(timestamps)/2 {
+			t.Fatalf("%s ConsensusTimestamp is not the median of %v", name, timestamps)
+		}
+	}
+
+	if err := h.ProcessDecidedRounds(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i <= h.Store.LastBlockIndex(); i++ {
+		block, err := h.Store.GetBlock(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame, err := h.GetFrame(block.RoundReceived())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		latest := time.Time{}
+		for _, e := range frame.Events {
+			if e.ConsensusTimestamp.After(latest) {
+				latest = e.ConsensusTimestamp
+			}
+		}
+
+		if !block.Timestamp().Equal(latest) {
+			t.Fatalf("Block %d Timestamp should be %v, not %v", i, latest, block.Timestamp())
+		}
+	}
+}
+
 func TestProcessDecidedRounds(t *testing.T) {
 	h, index := initConsensusHashgraph(false, t)
 
@@ -1934,7 +2137,7 @@ func TestBootstrap(t *testing.T) {
 
 	nh := NewHashgraph(recycledStore, DummyInternalCommitCallback, logrus.New().WithField("id", "bootstrapped"))
 
-	err = nh.Bootstrap()
+	err = nh.Bootstrap(nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2038,7 +2241,7 @@ func initFunkyHashgraph(logger *logrus.Logger, full bool) (*Hashgraph, map[strin
 
 	for i, peer := range participants.Peers {
 		name := fmt.Sprintf("w0%d", i)
-		event := NewEvent([][]byte{[]byte(name)}, nil, []string{rootSelfParent(peer.ID()), ""}, nodes[i].Pub, 0)
+		event := NewEvent([][]byte{[]byte(name)}, nil, nil, []string{rootSelfParent(peer.ID()), ""}, nodes[i].Pub, 0)
 		nodes[i].signAndAddEvent(event, name, index, orderedEvents)
 	}
 
@@ -2371,7 +2574,7 @@ func initSparseHashgraph(logger *logrus.Logger) (*Hashgraph, map[string]string)
 
 	for i, peer := range participants.Peers {
 		name := fmt.Sprintf("w0%d", i)
-		event := NewEvent([][]byte{[]byte(name)}, nil, []string{rootSelfParent(peer.ID()), ""}, nodes[i].Pub, 0)
+		event := NewEvent([][]byte{[]byte(name)}, nil, nil, []string{rootSelfParent(peer.ID()), ""}, nodes[i].Pub, 0)
 		nodes[i].signAndAddEvent(event, name, index, orderedEvents)
 	}
 
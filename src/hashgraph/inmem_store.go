@@ -1,6 +1,7 @@
 package hashgraph
 
 import (
+	"fmt"
 	"strconv"
 
 	cm "github.com/mosaicnetworks/babble/src/common"
@@ -24,6 +25,9 @@ type InmemStore struct {
 	lastRound              int
 	lastConsensusEvents    map[string]string //[participant] => hex() of last consensus event
 	lastBlock              int
+	forkProofs             map[string]*ForkProof //[creator_index] => ForkProof
+	forkProofKeys          []string              //keys of forkProofs in insertion order
+	txLocationCache        *cm.LRU               //[tx hash] => TxLocation
 }
 
 func NewInmemStore(cacheSize int) *InmemStore {
@@ -43,6 +47,8 @@ func NewInmemStore(cacheSize int) *InmemStore {
 		lastRound:              -1,
 		lastBlock:              -1,
 		lastConsensusEvents:    map[string]string{},
+		forkProofs:             make(map[string]*ForkProof),
+		txLocationCache:        cm.NewLRU(cacheSize, nil),
 	}
 	return store
 }
@@ -309,6 +315,52 @@ func (s *InmemStore) SetFrame(frame *Frame) error {
 	return nil
 }
 
+func (s *InmemStore) GetForkProof(creator string, index int) (*ForkProof, error) {
+	key := inmemForkProofKey(creator, index)
+	res, ok := s.forkProofs[key]
+	if !ok {
+		return nil, cm.NewStoreErr("ForkProofs", cm.KeyNotFound, key)
+	}
+	return res, nil
+}
+
+func (s *InmemStore) SetForkProof(proof *ForkProof) error {
+	key := inmemForkProofKey(proof.Creator(), proof.Index())
+	if _, ok := s.forkProofs[key]; !ok {
+		s.forkProofKeys = append(s.forkProofKeys, key)
+	}
+	s.forkProofs[key] = proof
+	return nil
+}
+
+//GetForkProofs returns all the ForkProofs in the order they were recorded
+func (s *InmemStore) GetForkProofs() ([]*ForkProof, error) {
+	res := make([]*ForkProof, len(s.forkProofKeys))
+	for i, k := range s.forkProofKeys {
+		res[i] = s.forkProofs[k]
+	}
+	return res, nil
+}
+
+func (s *InmemStore) GetTxLocation(hash string) (*TxLocation, error) {
+	res, ok := s.txLocationCache.Get(hash)
+	if !ok {
+		return nil, cm.NewStoreErr("TxLocationCache", cm.KeyNotFound, hash)
+	}
+	return res.(*TxLocation), nil
+}
+
+func (s *InmemStore) SetTxLocation(location *TxLocation) error {
+	s.txLocationCache.Add(location.TxHash, location)
+	return nil
+}
+
+func inmemForkProofKey(creator string, index int) string {
+	return fmt.Sprintf("%s_%d", creator, index)
+}
+
+//Reset clears the caches and sets the new base from the Frame. ForkProofs are
+//not cleared because they remain valid evidence regardless of the Frame.
 func (s *InmemStore) Reset(frame *Frame) error {
 	//Clear all caches
 	s.peerSetCache = NewPeerSetCache()
@@ -318,6 +370,7 @@ func (s *InmemStore) Reset(frame *Frame) error {
 	s.roundCache = cm.NewLRU(s.cacheSize, nil)
 	s.blockCache = cm.NewLRU(s.cacheSize, nil)
 	s.frameCache = cm.NewLRU(s.cacheSize, nil)
+	s.txLocationCache = cm.NewLRU(s.cacheSize, nil)
 	s.participantEventsCache = NewParticipantEventsCache(s.cacheSize)
 	s.rootsByParticipant = make(map[string]*Root)
 	s.rootsBySelfParent = make(map[string]*Root)
@@ -350,6 +403,59 @@ func (s *InmemStore) Reset(frame *Frame) error {
 	return s.SetFrame(frame)
 }
 
+/*
+Prune deletes the Events, Rounds, and Frames below the Frame, which becomes the
+new base of the Store. The Roots of the Frame replace the current Roots, so that
+the pruned Events can still be referenced through them, like after a Reset. The
+Block and snapshot are not used by the InmemStore, which does not survive a
+restart.
+*/
+func (s *InmemStore) Prune(block *Block, frame *Frame, snapshot []byte) error {
+	for p, root := range frame.Roots {
+		headIndex := root.GetHead().Index
+
+		//Delete participant Events up to, and including, the Root's head
+		for i := headIndex; i >= 0; i-- {
+			hash, err := s.participantEventsCache.GetItem(p, i)
+			if err != nil {
+				break
+			}
+			s.eventCache.Remove(hash)
+		}
+
+		if err := s.participantEventsCache.Prune(p, headIndex); err != nil {
+			return err
+		}
+
+		//Replace Root
+		if oldRoot, ok := s.rootsByParticipant[p]; ok {
+			delete(s.rootsBySelfParent, oldRoot.Head)
+		}
+		s.rootsByParticipant[p] = root
+		s.rootsBySelfParent[root.Head] = root
+	}
+
+	for _, k := range s.roundCache.Keys() {
+		if k.(int) < frame.Round {
+			s.roundCache.Remove(k)
+		}
+	}
+
+	for _, k := range s.frameCache.Keys() {
+		if k.(int) < frame.Round {
+			s.frameCache.Remove(k)
+		}
+	}
+
+	return nil
+}
+
+//Checkpoint does nothing. The InmemStore does not survive a restart, so there
+//is nothing to bootstrap from.
+func (s *InmemStore) Checkpoint(block *Block, snapshot []byte, topologicalIndex int) error {
+	return nil
+}
+
 func (s *InmemStore) Close() error {
 	return nil
 }
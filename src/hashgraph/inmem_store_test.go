@@ -55,6 +55,7 @@ func TestInmemEvents(t *testing.T) {
 			items := []*Event{}
 			for k := 0; k < testSize; k++ {
 				event := NewEvent([][]byte{[]byte(fmt.Sprintf("%s_%d", p.hex[:5], k))},
+					nil,
 					[]BlockSignature{BlockSignature{Validator: []byte("validator"), Index: 0, Signature: "r|s"}},
 					[]string{"", ""},
 					p.pubKey,
@@ -144,6 +145,7 @@ func TestInmemRounds(t *testing.T) {
 	events := make(map[string]*Event)
 	for _, p := range participants {
 		event := NewEvent([][]byte{},
+			nil,
 			[]BlockSignature{},
 			[]string{"", ""},
 			p.pubKey,
@@ -211,7 +213,7 @@ func TestInmemBlocks(t *testing.T) {
 
 	frameHash := []byte("this is the frame hash")
 
-	block := NewBlock(index, roundReceived, frameHash, []*peers.Peer{}, transactions)
+	block := NewBlock(index, roundReceived, frameHash, []*peers.Peer{}, transactions, nil)
 
 	sig1, err := block.Sign(participants[0].privKey)
 	if err != nil {
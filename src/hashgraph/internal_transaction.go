@@ -0,0 +1,230 @@
+package hashgraph
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+/*******************************************************************************
+TransactionType
+*******************************************************************************/
+
+//TransactionType identifies the type of an InternalTransaction
+type TransactionType uint8
+
+const (
+	//PEER_ADD is used to add a Peer to the PeerSet
+	PEER_ADD TransactionType = iota
+	//PEER_REMOVE is used to remove a Peer from the PeerSet
+	PEER_REMOVE
+)
+
+func (t TransactionType) String() string {
+	switch t {
+	case PEER_ADD:
+		return "PEER_ADD"
+	case PEER_REMOVE:
+		return "PEER_REMOVE"
+	default:
+		return "Unknown TransactionType"
+	}
+}
+
+/*******************************************************************************
+InternalTransactionBody
+*******************************************************************************/
+
+//InternalTransactionBody contains the payload of an InternalTransaction
+type InternalTransactionBody struct {
+	Type TransactionType
+	Peer peers.Peer
+}
+
+//json encoding of body only
+func (i *InternalTransactionBody) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b) //will write to b
+	if err := enc.Encode(i); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (i *InternalTransactionBody) Hash() ([]byte, error) {
+	hashBytes, err := i.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SHA256(hashBytes), nil
+}
+
+/*******************************************************************************
+InternalTransaction
+*******************************************************************************/
+
+/*
+InternalTransactions are transactions that affect the internal state of Babble,
+like adding or removing a Peer. They go through consensus like regular
+transactions, and are then submitted to the application, which decides to
+accept or refuse them. An InternalTransaction is signed by the Peer it concerns,
+which proves that the request originates from the owner of the key.
+*/
+type InternalTransaction struct {
+	Body      InternalTransactionBody
+	Signature string
+}
+
+func NewInternalTransaction(tType TransactionType, peer peers.Peer) InternalTransaction {
+	return InternalTransaction{
+		Body: InternalTransactionBody{Type: tType, Peer: peer},
+	}
+}
+
+func NewInternalTransactionJoin(peer peers.Peer) InternalTransaction {
+	return NewInternalTransaction(PEER_ADD, peer)
+}
+
+func NewInternalTransactionLeave(peer peers.Peer) InternalTransaction {
+	return NewInternalTransaction(PEER_REMOVE, peer)
+}
+
+func (t *InternalTransaction) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b) //will write to b
+	if err := enc.Encode(t); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (t *InternalTransaction) Unmarshal(data []byte) error {
+	b := bytes.NewBuffer(data)
+	dec := json.NewDecoder(b) //will read from b
+	return dec.Decode(t)
+}
+
+//Sign returns the ecdsa signature of the SHA256 hash of the transaction's body
+func (t *InternalTransaction) Sign(privKey *ecdsa.PrivateKey) error {
+	signBytes, err := t.Body.Hash()
+	if err != nil {
+		return err
+	}
+
+	R, S, err := crypto.Sign(privKey, signBytes)
+	if err != nil {
+		return err
+	}
+
+	t.Signature = crypto.EncodeSignature(R, S)
+
+	return err
+}
+
+//Verify checks that the transaction was signed by the Peer it concerns
+func (t *InternalTransaction) Verify() (bool, error) {
+	if len(t.Body.Peer.PubKeyHex) < 3 {
+		return false, fmt.Errorf("Invalid PubKeyHex: %s", t.Body.Peer.PubKeyHex)
+	}
+
+	pubBytes := t.Body.Peer.PubKeyBytes()
+	pubKey := crypto.ToECDSAPub(pubBytes)
+	if pubKey == nil || pubKey.X == nil {
+		return false, fmt.Errorf("Invalid public key: %s", t.Body.Peer.PubKeyHex)
+	}
+
+	signBytes, err := t.Body.Hash()
+	if err != nil {
+		return false, err
+	}
+
+	r, s, err := crypto.DecodeSignature(t.Signature)
+	if err != nil {
+		return false, err
+	}
+
+	return crypto.Verify(pubKey, signBytes, r, s), nil
+}
+
+//HashString returns the hexadecimal representation of the body's hash. It is
+//used as a key to match InternalTransactions with their receipts.
+func (t *InternalTransaction) HashString() string {
+	hash, _ := t.Body.Hash()
+	return fmt.Sprintf("0x%X", hash)
+}
+
+//AsAccepted returns a receipt to accept an InternalTransaction
+func (t *InternalTransaction) AsAccepted() InternalTransactionReceipt {
+	return InternalTransactionReceipt{
+		InternalTransaction: *t,
+		Accepted:            true,
+	}
+}
+
+//AsAcceptedWithWeight returns a receipt to accept a PEER_ADD
+//InternalTransaction, which gives the new Peer the voting weight chosen by the
+//application
+func (t *InternalTransaction) AsAcceptedWithWeight(weight int) InternalTransactionReceipt {
+	receipt := t.AsAccepted()
+	receipt.Weight = weight
+	return receipt
+}
+
+//AsRefused return a receipt to refuse an InternalTransaction
+func (t *InternalTransaction) AsRefused() InternalTransactionReceipt {
+	return InternalTransactionReceipt{
+		InternalTransaction: *t,
+		Accepted:            false,
+	}
+}
+
+/*******************************************************************************
+InternalTransactionReceipt
+*******************************************************************************/
+
+//InternalTransactionReceipt records the decision taken by the application
+//regarding an InternalTransaction. Weight is the voting weight of the Peer
+//added by an accepted PEER_ADD; the Weight in the InternalTransaction itself is
+//chosen by the joining node, so it is never used.
+type InternalTransactionReceipt struct {
+	InternalTransaction InternalTransaction
+	Accepted            bool
+	Weight              int `json:",omitempty"`
+}
+
+/*
+ApplyInternalTransactionReceipts returns the PeerSet that results from applying
+the accepted InternalTransactions of receipts, in order, to peerSet. A Peer
+added by a PEER_ADD gets the Weight of its receipt. If nothing changes, it
+returns peerSet itself.
+*/
+func ApplyInternalTransactionReceipts(peerSet *peers.PeerSet, receipts []InternalTransactionReceipt) *peers.PeerSet {
+	for _, r := range receipts {
+		if !r.Accepted {
+			continue
+		}
+
+		txBody := r.InternalTransaction.Body
+
+		switch txBody.Type {
+		case PEER_ADD:
+			if _, ok := peerSet.ByPubKey[txBody.Peer.PubKeyHex]; !ok {
+				//The weight is assigned by the application, not by the joining
+				//node
+				peer := txBody.Peer
+				peer.Weight = r.Weight
+				peerSet = peerSet.WithNewPeer(&peer)
+			}
+		case PEER_REMOVE:
+			if _, ok := peerSet.ByPubKey[txBody.Peer.PubKeyHex]; ok {
+				peerSet = peerSet.WithRemovedPeer(&txBody.Peer)
+			}
+		}
+	}
+
+	return peerSet
+}
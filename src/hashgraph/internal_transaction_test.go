@@ -0,0 +1,71 @@
+package hashgraph
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+func TestSignInternalTransaction(t *testing.T) {
+	privateKey, _ := crypto.GenerateECDSAKey()
+	pubKeyHex := fmt.Sprintf("0x%X", crypto.FromECDSAPub(&privateKey.PublicKey))
+
+	peer := peers.NewPeer(pubKeyHex, "127.0.0.1:1337")
+
+	itx := NewInternalTransactionJoin(*peer)
+
+	if err := itx.Sign(privateKey); err != nil {
+		t.Fatalf("Error signing InternalTransaction: %s", err)
+	}
+
+	res, err := itx.Verify()
+	if err != nil {
+		t.Fatalf("Error verifying signature: %s", err)
+	}
+	if !res {
+		t.Fatalf("Verify returned false")
+	}
+
+	//A signature from another key should not verify
+	otherKey, _ := crypto.GenerateECDSAKey()
+	if err := itx.Sign(otherKey); err != nil {
+		t.Fatalf("Error signing InternalTransaction: %s", err)
+	}
+
+	res, err = itx.Verify()
+	if err != nil {
+		t.Fatalf("Error verifying signature: %s", err)
+	}
+	if res {
+		t.Fatalf("Verify should return false for a signature from another key")
+	}
+}
+
+func TestMarshallInternalTransaction(t *testing.T) {
+	privateKey, _ := crypto.GenerateECDSAKey()
+	pubKeyHex := fmt.Sprintf("0x%X", crypto.FromECDSAPub(&privateKey.PublicKey))
+
+	itx := NewInternalTransactionJoin(*peers.NewPeer(pubKeyHex, "127.0.0.1:1337"))
+	itx.Sign(privateKey)
+
+	raw, err := itx.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling InternalTransaction: %s", err)
+	}
+
+	newItx := new(InternalTransaction)
+	if err := newItx.Unmarshal(raw); err != nil {
+		t.Fatalf("Error unmarshalling InternalTransaction: %s", err)
+	}
+
+	if !reflect.DeepEqual(itx, *newItx) {
+		t.Fatalf("InternalTransactions do not match. Expected %#v, got %#v", itx, *newItx)
+	}
+
+	if itx.HashString() != newItx.HashString() {
+		t.Fatalf("Hashes do not match")
+	}
+}
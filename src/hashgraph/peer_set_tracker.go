@@ -0,0 +1,123 @@
+package hashgraph
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+/*
+PeerSetTracker follows the PeerSet of a chain of Blocks without running the
+hashgraph. It starts from a trusted PeerSet, and only trusts the PeerSets it
+derives from the Blocks it has already verified.
+
+Blocks carry the InternalTransactionReceipts returned by the application, which
+are signed with the rest of the BlockHeader. Like nodes do, the PeerSetTracker
+applies the accepted ones, with their Weights, to the latest PeerSet, and the
+resulting PeerSet takes effect PEERSET_DELAY rounds after the Block that
+contains them.
+*/
+type PeerSetTracker struct {
+	peerSet   *peers.PeerSet
+	scheduled []scheduledPeerSet
+}
+
+//NewPeerSetTracker creates a PeerSetTracker that starts from a trusted PeerSet
+func NewPeerSetTracker(peerSet *peers.PeerSet) *PeerSetTracker {
+	return &PeerSetTracker{
+		peerSet:   peerSet,
+		scheduled: []scheduledPeerSet{},
+	}
+}
+
+//PeerSet returns the PeerSet of the last Block accepted by Next
+func (t *PeerSetTracker) PeerSet() *peers.PeerSet {
+	return t.peerSet
+}
+
+//Scheduled returns the number of PeerSets that have not taken effect yet
+func (t *PeerSetTracker) Scheduled() int {
+	return len(t.scheduled)
+}
+
+/*
+Next derives the PeerSet of block, which must follow the last Block accepted by
+Next, checks that it is the PeerSet designated by the Block's PeersHash, and
+calls check with it. If check succeeds, the PeerSet becomes the current
+PeerSet, and the PeerSet resulting from the Block's receipts is scheduled. It
+returns the PeerSet of block.
+*/
+func (t *PeerSetTracker) Next(block *Block, check func(*peers.PeerSet) error) (*peers.PeerSet, error) {
+	peerSet := t.peerSet
+	scheduled := t.scheduled
+	for len(scheduled) > 0 && scheduled[0].round <= block.RoundReceived() {
+		peerSet = scheduled[0].peerSet
+		scheduled = scheduled[1:]
+	}
+
+	peersHash, err := peerSet.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(peersHash, block.PeersHash()) {
+		return nil, fmt.Errorf("Block %d: unknown PeerSet 0x%X, expected 0x%X", block.Index(), block.PeersHash(), peersHash)
+	}
+
+	if err := check(peerSet); err != nil {
+		return nil, fmt.Errorf("Block %d: %v", block.Index(), err)
+	}
+
+	if err := checkReceipts(block); err != nil {
+		return nil, err
+	}
+
+	latest := peerSet
+	if len(scheduled) > 0 {
+		latest = scheduled[len(scheduled)-1].peerSet
+	}
+
+	if next := ApplyInternalTransactionReceipts(latest, block.InternalTransactionReceipts()); next != latest {
+		round := block.RoundReceived() + PEERSET_DELAY
+
+		//A later PeerSet for the same round replaces the previous one, as in
+		//the Store
+		if len(scheduled) > 0 && scheduled[len(scheduled)-1].round == round {
+			scheduled = scheduled[:len(scheduled)-1]
+		}
+
+		scheduled = append(scheduled, scheduledPeerSet{
+			peerSet: next,
+			round:   round,
+		})
+	}
+
+	t.peerSet = peerSet
+	t.scheduled = scheduled
+
+	return peerSet, nil
+}
+
+//scheduledPeerSet is a PeerSet derived from a verified Block, and the Round from
+//which it takes effect
+type scheduledPeerSet struct {
+	peerSet *peers.PeerSet
+	round   int
+}
+
+//checkReceipts checks that the receipts of a Block are about its own
+//InternalTransactions
+func checkReceipts(block *Block) error {
+	itxs := make(map[string]bool)
+	for _, itx := range block.InternalTransactions() {
+		itxs[itx.HashString()] = true
+	}
+
+	for _, r := range block.InternalTransactionReceipts() {
+		if !itxs[r.InternalTransaction.HashString()] {
+			return fmt.Errorf("Block %d: receipt of an InternalTransaction that is not in the Block", block.Index())
+		}
+	}
+
+	return nil
+}
@@ -80,18 +80,20 @@ WitnessesDecided returns true if a super-majority of witnesses are decided,
 and there are no undecided witnesses. Our algorithm relies on the fact that a
 witness that is not yet known when a super-majority of witnesses are already
 decided, has no chance of ever being famous. Once a Round is decided it stays
-decided, even if new witnesses are added after it was first decided.
+decided, even if new witnesses are added after it was first decided. The
+super-majority is measured in voting weight; weight returns the weight of a
+witness's creator.
 */
-func (r *RoundInfo) WitnessesDecided(peerSet *peers.PeerSet) bool {
+func (r *RoundInfo) WitnessesDecided(peerSet *peers.PeerSet, weight func(x string) int) bool {
 	//if the round was already decided, it stays decided no matter what.
 	if r.decided {
 		return true
 	}
 
 	c := 0
-	for _, e := range r.CreatedEvents {
+	for x, e := range r.CreatedEvents {
 		if e.Witness && e.Famous != Undefined {
-			c++
+			c += weight(x)
 		} else if e.Witness && e.Famous == Undefined {
 			return false
 		}
@@ -32,8 +32,34 @@ type Store interface {
 	LastBlockIndex() int
 	GetFrame(int) (*Frame, error)
 	SetFrame(*Frame) error
+	GetForkProof(string, int) (*ForkProof, error)
+	SetForkProof(*ForkProof) error
+	GetForkProofs() ([]*ForkProof, error)
+	GetTxLocation(string) (*TxLocation, error)
+	SetTxLocation(*TxLocation) error
 	Reset(*Frame) error
+	Prune(*Block, *Frame, []byte) error
+	Checkpoint(*Block, []byte, int) error
 	Close() error
 	NeedBoostrap() bool // Was the store loaded from existing db
 	StorePath() string
 }
+
+//persistentStore is implemented by the Stores that survive a restart. Bootstrap
+//uses it to reload the Hashgraph from disk.
+type persistentStore interface {
+	Store
+	cache() *InmemStore
+	dbGetPeerSet(int) (*peers.PeerSet, error)
+	dbGetPeerSets() (map[int]*peers.PeerSet, error)
+	dbGetBlock(int) (*Block, error)
+	dbGetFrame(int) (*Frame, error)
+	dbGetBase() (*storeBase, error)
+	dbGetRoundsFrom(int) (map[string]int, error)
+	dbGetBootstrapRounds() (map[string]int, error)
+	dbSetBootstrapRounds(map[string]int) error
+	dbDeleteBootstrapRounds() error
+	dbDeleteFrom(string, int) error
+	dbTopologicalEvents(int) ([]*Event, error)
+	dbNextTopologicalIndex() (int, error)
+}
@@ -0,0 +1,1157 @@
+/*
+Package storetest is a conformance test suite for implementations of the
+hashgraph.Store interface. A Store passes the suite when it behaves like the
+InmemStore for everything the Hashgraph relies on: the values it returns, the
+KeyNotFound, TooLate, and other StoreErrs it returns, and the effects of
+SetPeerSet, Reset, and Prune.
+
+A Store is wired into the suite by passing a Constructor to Run from a test:
+
+	func TestMyStore(t *testing.T) {
+		storetest.Run(t, func(cacheSize int) (hashgraph.Store, error) {
+			return NewMyStore(cacheSize, newPath())
+		})
+	}
+*/
+package storetest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	cm "github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/crypto"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+//Constructor creates a new, empty Store with the given cache size. Stores that
+//write to disk must use a different location every time.
+type Constructor func(cacheSize int) (hg.Store, error)
+
+type storeTest struct {
+	name      string
+	cacheSize int
+	run       func(t *testing.T, store hg.Store)
+}
+
+var tests = []storeTest{
+	{"New", 100, testNew},
+	{"PeerSets", 100, testPeerSets},
+	{"Participants", 100, testParticipants},
+	{"Events", 1000, testEvents},
+	{"TooLate", 10, testTooLate},
+	{"ConsensusEvents", 1000, testConsensusEvents},
+	{"Rounds", 100, testRounds},
+	{"Blocks", 100, testBlocks},
+	{"Frames", 100, testFrames},
+	{"ForkProofs", 100, testForkProofs},
+	{"TxLocations", 100, testTxLocations},
+	{"Reset", 1000, testReset},
+	{"Prune", 1000, testPrune},
+}
+
+//Run runs every test of the suite, as a subtest, on a new Store created by
+//newStore. The Store is closed at the end of each test.
+func Run(t *testing.T, newStore Constructor) {
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			store, err := newStore(test.cacheSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}()
+
+			test.run(t, store)
+		})
+	}
+}
+
+/*******************************************************************************
+Helpers
+*******************************************************************************/
+
+type participant struct {
+	key    *ecdsa.PrivateKey
+	pubKey []byte
+	peer   *peers.Peer
+}
+
+func (p participant) hex() string {
+	return p.peer.PubKeyHex
+}
+
+func newParticipants(n int) ([]participant, *peers.PeerSet) {
+	participants := []participant{}
+	pirs := []*peers.Peer{}
+
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateECDSAKey()
+		pubKey := crypto.FromECDSAPub(&key.PublicKey)
+		peer := peers.NewPeer(fmt.Sprintf("0x%X", pubKey), "")
+		participants = append(participants, participant{key, pubKey, peer})
+		pirs = append(pirs, peer)
+	}
+
+	return participants, peers.NewPeerSet(pirs)
+}
+
+//newEvents creates, for every participant, count Events with consecutive
+//indexes
+func newEvents(t *testing.T, participants []participant, count int) map[string][]*hg.Event {
+	events := make(map[string][]*hg.Event)
+
+	for _, p := range participants {
+		selfParent := hg.NewBaseRootEvent(p.peer.ID()).Hash
+		for k := 0; k < count; k++ {
+			event := hg.NewEvent(
+				[][]byte{[]byte(fmt.Sprintf("%s_%d", p.hex()[:6], k))},
+				nil,
+				nil,
+				[]string{selfParent, ""},
+				p.pubKey,
+				k)
+			if err := event.Sign(p.key); err != nil {
+				t.Fatal(err)
+			}
+			selfParent = event.Hex()
+			events[p.hex()] = append(events[p.hex()], event)
+		}
+	}
+
+	return events
+}
+
+//setEvents inserts the Events of all participants, index by index
+func setEvents(t *testing.T, store hg.Store, participants []participant, events map[string][]*hg.Event) {
+	for k := 0; k < len(events[participants[0].hex()]); k++ {
+		for _, p := range participants {
+			if err := store.SetEvent(events[p.hex()][k]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func initPeerSet(t *testing.T, store hg.Store, n int) ([]participant, *peers.PeerSet) {
+	participants, peerSet := newParticipants(n)
+	if err := store.SetPeerSet(0, peerSet); err != nil {
+		t.Fatal(err)
+	}
+	return participants, peerSet
+}
+
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+//checkEncoding compares values through their encoding, so that values read
+//back from disk compare equal to the originals
+func checkEncoding(t *testing.T, name string, expected, actual marshaler) {
+	t.Helper()
+
+	e, err := expected.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := actual.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(e, a) {
+		t.Fatalf("%s should be %s, not %s", name, e, a)
+	}
+}
+
+func checkErr(t *testing.T, name string, err error, errType cm.StoreErrType) {
+	t.Helper()
+
+	if !cm.Is(err, errType) {
+		t.Fatalf("%s should return a StoreErr of type %d, not %v", name, errType, err)
+	}
+}
+
+func checkPeerSet(t *testing.T, name string, expected, actual *peers.PeerSet) {
+	t.Helper()
+
+	if actual == nil {
+		t.Fatalf("%s should not be nil", name)
+	}
+
+	if !reflect.DeepEqual(expected.PubKeys(), actual.PubKeys()) {
+		t.Fatalf("%s should contain %v, not %v", name, expected.PubKeys(), actual.PubKeys())
+	}
+}
+
+func checkPeers(t *testing.T, name string, expected, actual []*peers.Peer) {
+	t.Helper()
+
+	checkPeerSet(t, name, peers.NewPeerSet(expected), peers.NewPeerSet(actual))
+}
+
+//checkRepertoire checks that the Repertoires contain exactly the peers
+func checkRepertoire(t *testing.T, store hg.Store, pirs []*peers.Peer) {
+	t.Helper()
+
+	byPubKey := store.RepertoireByPubKey()
+	byID := store.RepertoireByID()
+
+	if len(byPubKey) != len(pirs) || len(byID) != len(pirs) {
+		t.Fatalf("Repertoire should contain %d peers, not %d by PubKey and %d by ID",
+			len(pirs), len(byPubKey), len(byID))
+	}
+
+	for _, p := range pirs {
+		if rp, ok := byPubKey[p.PubKeyHex]; !ok || rp.ID() != p.ID() {
+			t.Fatalf("RepertoireByPubKey should contain %s", p.PubKeyHex)
+		}
+		if rp, ok := byID[p.ID()]; !ok || rp.PubKeyHex != p.PubKeyHex {
+			t.Fatalf("RepertoireByID should contain %d", p.ID())
+		}
+	}
+}
+
+/*******************************************************************************
+Tests
+*******************************************************************************/
+
+func testNew(t *testing.T, store hg.Store) {
+	if c := store.CacheSize(); c != 100 {
+		t.Fatalf("CacheSize should be 100, not %d", c)
+	}
+
+	if store.NeedBoostrap() {
+		t.Fatalf("A new Store should not need bootstrapping")
+	}
+
+	if r := store.LastRound(); r != -1 {
+		t.Fatalf("LastRound should be -1, not %d", r)
+	}
+
+	if b := store.LastBlockIndex(); b != -1 {
+		t.Fatalf("LastBlockIndex should be -1, not %d", b)
+	}
+
+	if c := store.ConsensusEventsCount(); c != 0 {
+		t.Fatalf("ConsensusEventsCount should be 0, not %d", c)
+	}
+
+	if l := len(store.ConsensusEvents()); l != 0 {
+		t.Fatalf("ConsensusEvents should be empty, not %d long", l)
+	}
+
+	_, err := store.GetPeerSet(0)
+	checkErr(t, "GetPeerSet", err, cm.KeyNotFound)
+
+	proofs, err := store.GetForkProofs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs) != 0 {
+		t.Fatalf("GetForkProofs should be empty, not %d long", len(proofs))
+	}
+}
+
+func testPeerSets(t *testing.T, store hg.Store) {
+	participants, peerSet := initPeerSet(t, store, 3)
+
+	t.Run("Get PeerSet", func(t *testing.T) {
+		ps, err := store.GetPeerSet(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPeerSet(t, "PeerSet 0", peerSet, ps)
+	})
+
+	t.Run("Set PeerSet twice", func(t *testing.T) {
+		err := store.SetPeerSet(0, peerSet)
+		checkErr(t, "SetPeerSet", err, cm.KeyAlreadyExists)
+	})
+
+	newParticipant, _ := newParticipants(1)
+	peerSet10 := peerSet.WithNewPeer(newParticipant[0].peer)
+	peerSet20 := peerSet10.WithRemovedPeer(participants[0].peer)
+
+	if err := store.SetPeerSet(10, peerSet10); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetPeerSet(20, peerSet20); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Get PeerSet of later Rounds", func(t *testing.T) {
+		expected := map[int]*peers.PeerSet{
+			0:  peerSet,
+			5:  peerSet,
+			10: peerSet10,
+			15: peerSet10,
+			20: peerSet20,
+			30: peerSet20,
+		}
+		for r, ps := range expected {
+			actual, err := store.GetPeerSet(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPeerSet(t, fmt.Sprintf("PeerSet %d", r), ps, actual)
+		}
+	})
+
+	t.Run("Get future PeerSets", func(t *testing.T) {
+		future, err := store.GetFuturePeerSets(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(future) != 2 {
+			t.Fatalf("There should be 2 future PeerSets, not %d", len(future))
+		}
+		checkPeers(t, "Future PeerSet 10", peerSet10.Peers, future[10])
+		checkPeers(t, "Future PeerSet 20", peerSet20.Peers, future[20])
+
+		future, err = store.GetFuturePeerSets(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(future) != 1 {
+			t.Fatalf("There should be 1 future PeerSet, not %d", len(future))
+		}
+		checkPeers(t, "Future PeerSet 20", peerSet20.Peers, future[20])
+
+		future, err = store.GetFuturePeerSets(20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(future) != 0 {
+			t.Fatalf("There should be no future PeerSets, not %d", len(future))
+		}
+	})
+
+	t.Run("Repertoire keeps removed peers", func(t *testing.T) {
+		checkRepertoire(t, store, peerSet10.Peers)
+	})
+}
+
+func testParticipants(t *testing.T, store hg.Store) {
+	participants, peerSet := initPeerSet(t, store, 3)
+
+	checkRepertoire(t, store, peerSet.Peers)
+
+	t.Run("Base Roots", func(t *testing.T) {
+		for _, p := range participants {
+			root, err := store.GetRoot(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			base := hg.NewBaseRoot(p.peer.ID())
+			if root.Head != base.Head {
+				t.Fatalf("Root of %s should be %s, not %s", p.hex(), base.Head, root.Head)
+			}
+
+			if _, ok := store.RootsBySelfParent()[root.Head]; !ok {
+				t.Fatalf("RootsBySelfParent should contain %s", root.Head)
+			}
+
+			last, isRoot, err := store.LastEventFrom(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isRoot || last != root.Head {
+				t.Fatalf("LastEventFrom %s should be the Root %s, not %s", p.hex(), root.Head, last)
+			}
+
+			last, isRoot, err = store.LastConsensusEventFrom(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isRoot || last != root.Head {
+				t.Fatalf("LastConsensusEventFrom %s should be the Root %s, not %s", p.hex(), root.Head, last)
+			}
+		}
+	})
+
+	t.Run("Known of base Roots", func(t *testing.T) {
+		expected := make(map[uint32]int)
+		for _, p := range participants {
+			expected[p.peer.ID()] = -1
+		}
+		if known := store.KnownEvents(); !reflect.DeepEqual(expected, known) {
+			t.Fatalf("KnownEvents should be %v, not %v", expected, known)
+		}
+	})
+
+	t.Run("Add participant", func(t *testing.T) {
+		newParticipant, _ := newParticipants(1)
+		p := newParticipant[0]
+
+		if err := store.AddParticipant(p.peer); err != nil {
+			t.Fatal(err)
+		}
+
+		checkRepertoire(t, store, append(peerSet.Peers, p.peer))
+
+		root, err := store.GetRoot(p.hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root.Head != hg.NewBaseRoot(p.peer.ID()).Head {
+			t.Fatalf("New participant should have a base Root, not %s", root.Head)
+		}
+
+		if known, ok := store.KnownEvents()[p.peer.ID()]; !ok || known != -1 {
+			t.Fatalf("KnownEvents of new participant should be -1, not %d", known)
+		}
+
+		//Adding it again does not change anything
+		if err := store.AddParticipant(p.peer); err != nil {
+			t.Fatal(err)
+		}
+		checkRepertoire(t, store, append(peerSet.Peers, p.peer))
+	})
+
+	t.Run("Unknown participant", func(t *testing.T) {
+		unknown, _ := newParticipants(1)
+
+		_, err := store.GetRoot(unknown[0].hex())
+		checkErr(t, "GetRoot", err, cm.KeyNotFound)
+
+		_, _, err = store.LastEventFrom(unknown[0].hex())
+		checkErr(t, "LastEventFrom", err, cm.UnknownParticipant)
+
+		_, _, err = store.LastConsensusEventFrom(unknown[0].hex())
+		checkErr(t, "LastConsensusEventFrom", err, cm.NoRoot)
+
+		_, err = store.ParticipantEvents(unknown[0].hex(), -1)
+		checkErr(t, "ParticipantEvents", err, cm.UnknownParticipant)
+	})
+}
+
+func testEvents(t *testing.T, store hg.Store) {
+	testSize := 20
+
+	participants, _ := initPeerSet(t, store, 3)
+	events := newEvents(t, participants, testSize)
+	setEvents(t, store, participants, events)
+
+	t.Run("Get Events", func(t *testing.T) {
+		for p, evs := range events {
+			for k, ev := range evs {
+				rev, err := store.GetEvent(ev.Hex())
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkEncoding(t, fmt.Sprintf("events[%s][%d]", p, k), ev, rev)
+			}
+		}
+
+		_, err := store.GetEvent("0xUNKNOWN")
+		checkErr(t, "GetEvent", err, cm.KeyNotFound)
+	})
+
+	t.Run("Set Event twice", func(t *testing.T) {
+		ev := events[participants[0].hex()][0]
+		if err := store.SetEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+
+		pEvents, err := store.ParticipantEvents(participants[0].hex(), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pEvents) != testSize {
+			t.Fatalf("Setting an Event twice should not add it twice")
+		}
+	})
+
+	t.Run("Participant Events", func(t *testing.T) {
+		for _, p := range participants {
+			for _, skip := range []int{-1, 0, testSize / 2, testSize - 1} {
+				pEvents, err := store.ParticipantEvents(p.hex(), skip)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				expected := events[p.hex()][skip+1:]
+				if len(pEvents) != len(expected) {
+					t.Fatalf("ParticipantEvents(%s, %d) should contain %d Events, not %d",
+						p.hex(), skip, len(expected), len(pEvents))
+				}
+				for k, e := range expected {
+					if pEvents[k] != e.Hex() {
+						t.Fatalf("ParticipantEvents(%s, %d)[%d] should be %s, not %s",
+							p.hex(), skip, k, e.Hex(), pEvents[k])
+					}
+				}
+			}
+
+			for k, e := range events[p.hex()] {
+				hash, err := store.ParticipantEvent(p.hex(), k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if hash != e.Hex() {
+					t.Fatalf("ParticipantEvent(%s, %d) should be %s, not %s", p.hex(), k, e.Hex(), hash)
+				}
+			}
+
+			_, err := store.ParticipantEvent(p.hex(), testSize)
+			checkErr(t, "ParticipantEvent", err, cm.KeyNotFound)
+		}
+	})
+
+	t.Run("Last Events", func(t *testing.T) {
+		expectedKnown := make(map[uint32]int)
+		for _, p := range participants {
+			last, isRoot, err := store.LastEventFrom(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := events[p.hex()][testSize-1].Hex()
+			if isRoot || last != expected {
+				t.Fatalf("LastEventFrom %s should be %s, not %s", p.hex(), expected, last)
+			}
+			expectedKnown[p.peer.ID()] = testSize - 1
+		}
+
+		if known := store.KnownEvents(); !reflect.DeepEqual(expectedKnown, known) {
+			t.Fatalf("KnownEvents should be %v, not %v", expectedKnown, known)
+		}
+	})
+
+	t.Run("Skipped index", func(t *testing.T) {
+		p := participants[0]
+		event := hg.NewEvent(nil, nil, nil,
+			[]string{events[p.hex()][testSize-1].Hex(), ""},
+			p.pubKey,
+			testSize+1)
+		if err := event.Sign(p.key); err != nil {
+			t.Fatal(err)
+		}
+
+		err := store.SetEvent(event)
+		checkErr(t, "SetEvent", err, cm.SkippedIndex)
+	})
+}
+
+//testTooLate checks that participant Events that dropped out of the cache are
+//reported as TooLate
+func testTooLate(t *testing.T, store hg.Store) {
+	cacheSize := store.CacheSize()
+	testSize := 3 * cacheSize
+
+	participants, _ := initPeerSet(t, store, 2)
+	events := newEvents(t, participants, testSize)
+	setEvents(t, store, participants, events)
+
+	for _, p := range participants {
+		_, err := store.ParticipantEvents(p.hex(), -1)
+		checkErr(t, "ParticipantEvents", err, cm.TooLate)
+
+		_, err = store.ParticipantEvent(p.hex(), 0)
+		checkErr(t, "ParticipantEvent", err, cm.TooLate)
+
+		//The last cacheSize Events are always available
+		skip := testSize - cacheSize - 1
+		pEvents, err := store.ParticipantEvents(p.hex(), skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pEvents) != cacheSize {
+			t.Fatalf("ParticipantEvents(%s, %d) should contain %d Events, not %d",
+				p.hex(), skip, cacheSize, len(pEvents))
+		}
+
+		last, _, err := store.LastEventFrom(p.hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last != events[p.hex()][testSize-1].Hex() {
+			t.Fatalf("LastEventFrom %s should be its last Event", p.hex())
+		}
+	}
+}
+
+func testConsensusEvents(t *testing.T, store hg.Store) {
+	testSize := 10
+
+	participants, _ := initPeerSet(t, store, 3)
+	events := newEvents(t, participants, testSize)
+	setEvents(t, store, participants, events)
+
+	expected := []string{}
+	for k := 0; k < testSize; k++ {
+		for _, p := range participants {
+			ev := events[p.hex()][k]
+			if err := store.AddConsensusEvent(ev); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, ev.Hex())
+		}
+	}
+
+	if c := store.ConsensusEventsCount(); c != len(expected) {
+		t.Fatalf("ConsensusEventsCount should be %d, not %d", len(expected), c)
+	}
+
+	if ce := store.ConsensusEvents(); !reflect.DeepEqual(expected, ce) {
+		t.Fatalf("ConsensusEvents should be %v, not %v", expected, ce)
+	}
+
+	for _, p := range participants {
+		last, isRoot, err := store.LastConsensusEventFrom(p.hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := events[p.hex()][testSize-1].Hex()
+		if isRoot || last != expected {
+			t.Fatalf("LastConsensusEventFrom %s should be %s, not %s", p.hex(), expected, last)
+		}
+	}
+}
+
+func testRounds(t *testing.T, store hg.Store) {
+	participants, _ := initPeerSet(t, store, 3)
+	events := newEvents(t, participants, 1)
+
+	round := hg.NewRoundInfo()
+	for i, p := range participants {
+		round.AddCreatedEvent(events[p.hex()][0].Hex(), i > 0)
+	}
+
+	if err := store.SetRound(3, round); err != nil {
+		t.Fatal(err)
+	}
+
+	storedRound, err := store.GetRound(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEncoding(t, "Round 3", round, storedRound)
+
+	if r := store.LastRound(); r != 3 {
+		t.Fatalf("LastRound should be 3, not %d", r)
+	}
+
+	witnesses := store.RoundWitnesses(3)
+	expectedWitnesses := round.Witnesses()
+	sort.Strings(witnesses)
+	sort.Strings(expectedWitnesses)
+	if !reflect.DeepEqual(expectedWitnesses, witnesses) {
+		t.Fatalf("RoundWitnesses should be %v, not %v", expectedWitnesses, witnesses)
+	}
+
+	if c := store.RoundEvents(3); c != len(participants) {
+		t.Fatalf("RoundEvents should be %d, not %d", len(participants), c)
+	}
+
+	//Lower Rounds do not change LastRound
+	if err := store.SetRound(1, hg.NewRoundInfo()); err != nil {
+		t.Fatal(err)
+	}
+	if r := store.LastRound(); r != 3 {
+		t.Fatalf("LastRound should still be 3, not %d", r)
+	}
+
+	_, err = store.GetRound(2)
+	checkErr(t, "GetRound", err, cm.KeyNotFound)
+
+	if w := store.RoundWitnesses(2); len(w) != 0 {
+		t.Fatalf("RoundWitnesses of an unknown Round should be empty")
+	}
+
+	if c := store.RoundEvents(2); c != 0 {
+		t.Fatalf("RoundEvents of an unknown Round should be 0, not %d", c)
+	}
+}
+
+func testBlocks(t *testing.T, store hg.Store) {
+	participants, peerSet := initPeerSet(t, store, 3)
+
+	txs := [][]byte{[]byte("tx1"), []byte("tx2"), []byte("tx3")}
+	block := hg.NewBlock(0, 5, []byte("framehash"), peerSet.Peers, txs, nil)
+
+	for _, p := range participants[:2] {
+		sig, err := block.Sign(p.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.SetSignature(sig)
+	}
+
+	if err := store.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	storedBlock, err := store.GetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEncoding(t, "Block 0", block, storedBlock)
+
+	if b := store.LastBlockIndex(); b != 0 {
+		t.Fatalf("LastBlockIndex should be 0, not %d", b)
+	}
+
+	block1 := hg.NewBlock(1, 6, []byte("framehash"), peerSet.Peers, txs, nil)
+	if err := store.SetBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := store.LastBlockIndex(); b != 1 {
+		t.Fatalf("LastBlockIndex should be 1, not %d", b)
+	}
+
+	//Setting a Block again replaces it, for example to add signatures
+	sig, err := block1.Sign(participants[2].key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block1.SetSignature(sig)
+	if err := store.SetBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+
+	storedBlock, err = store.GetBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEncoding(t, "Block 1", block1, storedBlock)
+
+	_, err = store.GetBlock(2)
+	checkErr(t, "GetBlock", err, cm.KeyNotFound)
+}
+
+func newFrame(t *testing.T, round int, participants []participant, peerSet *peers.PeerSet) *hg.Frame {
+	events := newEvents(t, participants, 1)
+
+	frame := &hg.Frame{
+		Round:  round,
+		Peers:  peerSet.Peers,
+		Roots:  make(map[string]*hg.Root),
+		Events: []*hg.Event{},
+	}
+
+	for _, p := range participants {
+		frame.Roots[p.hex()] = hg.NewBaseRoot(p.peer.ID())
+		frame.Events = append(frame.Events, events[p.hex()][0])
+	}
+
+	return frame
+}
+
+func testFrames(t *testing.T, store hg.Store) {
+	participants, peerSet := initPeerSet(t, store, 3)
+
+	frame := newFrame(t, 4, participants, peerSet)
+
+	if err := store.SetFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	storedFrame, err := store.GetFrame(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEncoding(t, "Frame 4", frame, storedFrame)
+
+	_, err = store.GetFrame(5)
+	checkErr(t, "GetFrame", err, cm.KeyNotFound)
+}
+
+func newForkProof(t *testing.T, p participant, index int) *hg.ForkProof {
+	a := hg.NewEvent([][]byte{[]byte("a")}, nil, nil, []string{"", ""}, p.pubKey, index)
+	if err := a.Sign(p.key); err != nil {
+		t.Fatal(err)
+	}
+
+	b := hg.NewEvent([][]byte{[]byte("b")}, nil, nil, []string{"", ""}, p.pubKey, index)
+	if err := b.Sign(p.key); err != nil {
+		t.Fatal(err)
+	}
+
+	return hg.NewForkProof(a, b)
+}
+
+func testForkProofs(t *testing.T, store hg.Store) {
+	participants, _ := initPeerSet(t, store, 2)
+
+	proofs := []*hg.ForkProof{
+		newForkProof(t, participants[0], 3),
+		newForkProof(t, participants[1], 1),
+		newForkProof(t, participants[0], 5),
+	}
+
+	for _, proof := range proofs {
+		if err := store.SetForkProof(proof); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, proof := range proofs {
+		storedProof, err := store.GetForkProof(proof.Creator(), proof.Index())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEncoding(t, "ForkProof", proof, storedProof)
+	}
+
+	_, err := store.GetForkProof(participants[1].hex(), 3)
+	checkErr(t, "GetForkProof", err, cm.KeyNotFound)
+
+	//GetForkProofs returns every ForkProof once, in no particular order
+	storedProofs, err := store.GetForkProofs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(storedProofs) != len(proofs) {
+		t.Fatalf("GetForkProofs should return %d ForkProofs, not %d", len(proofs), len(storedProofs))
+	}
+	for _, proof := range proofs {
+		found := false
+		for _, sp := range storedProofs {
+			if sp.Creator() == proof.Creator() && sp.Index() == proof.Index() {
+				checkEncoding(t, "ForkProof", proof, sp)
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("GetForkProofs should contain the ForkProof of %s at %d", proof.Creator(), proof.Index())
+		}
+	}
+}
+
+func testTxLocations(t *testing.T, store hg.Store) {
+	location := &hg.TxLocation{
+		TxHash:        hg.TxHash([]byte("tx")),
+		BlockIndex:    3,
+		Position:      1,
+		EventHash:     "0xEVENT",
+		EventPosition: 2,
+	}
+
+	if err := store.SetTxLocation(location); err != nil {
+		t.Fatal(err)
+	}
+
+	storedLocation, err := store.GetTxLocation(location.TxHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(location, storedLocation) {
+		t.Fatalf("TxLocation should be %#v, not %#v", location, storedLocation)
+	}
+
+	_, err = store.GetTxLocation(hg.TxHash([]byte("other tx")))
+	checkErr(t, "GetTxLocation", err, cm.KeyNotFound)
+}
+
+//newRoots returns Roots whose heads are the Events at index head
+func newRoots(participants []participant, events map[string][]*hg.Event, head int) map[string]*hg.Root {
+	roots := make(map[string]*hg.Root)
+	for _, p := range participants {
+		roots[p.hex()] = hg.NewRoot(hg.RootEvent{
+			Hash:             events[p.hex()][head].Hex(),
+			CreatorID:        p.peer.ID(),
+			Index:            head,
+			Round:            0,
+			LamportTimestamp: head,
+		})
+	}
+	return roots
+}
+
+func testReset(t *testing.T, store hg.Store) {
+	testSize := 10
+	head := 5
+
+	participants, peerSet := initPeerSet(t, store, 3)
+	events := newEvents(t, participants, testSize)
+	setEvents(t, store, participants, events)
+
+	for r := 0; r < 3; r++ {
+		if err := store.SetRound(r, hg.NewRoundInfo()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proof := newForkProof(t, participants[0], 2)
+	if err := store.SetForkProof(proof); err != nil {
+		t.Fatal(err)
+	}
+
+	newParticipant, _ := newParticipants(1)
+	futurePeerSet := peerSet.WithNewPeer(newParticipant[0].peer)
+
+	frame := &hg.Frame{
+		Round:  7,
+		Peers:  peerSet.Peers,
+		Roots:  newRoots(participants, events, head),
+		Events: []*hg.Event{},
+		FuturePeerSets: map[int][]*peers.Peer{
+			9: futurePeerSet.Peers,
+		},
+	}
+
+	if err := store.Reset(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Roots", func(t *testing.T) {
+		for _, p := range participants {
+			root, err := store.GetRoot(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if root.Head != frame.Roots[p.hex()].Head {
+				t.Fatalf("Root of %s should be %s, not %s", p.hex(), frame.Roots[p.hex()].Head, root.Head)
+			}
+
+			if _, ok := store.RootsBySelfParent()[root.Head]; !ok {
+				t.Fatalf("RootsBySelfParent should contain %s", root.Head)
+			}
+
+			last, isRoot, err := store.LastEventFrom(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isRoot || last != root.Head {
+				t.Fatalf("LastEventFrom %s should be the Root %s, not %s", p.hex(), root.Head, last)
+			}
+
+			last, isRoot, err = store.LastConsensusEventFrom(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isRoot || last != root.Head {
+				t.Fatalf("LastConsensusEventFrom %s should be the Root %s, not %s", p.hex(), root.Head, last)
+			}
+
+			//The head of the Root can still be looked up by index
+			hash, err := store.ParticipantEvent(p.hex(), head)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != root.Head {
+				t.Fatalf("ParticipantEvent(%s, %d) should be the Root head", p.hex(), head)
+			}
+		}
+	})
+
+	t.Run("Known", func(t *testing.T) {
+		//Future participants are known, without Events
+		expected := map[uint32]int{newParticipant[0].peer.ID(): -1}
+		for _, p := range participants {
+			expected[p.peer.ID()] = head
+		}
+		if known := store.KnownEvents(); !reflect.DeepEqual(expected, known) {
+			t.Fatalf("KnownEvents should be %v, not %v", expected, known)
+		}
+	})
+
+	t.Run("Events are cleared", func(t *testing.T) {
+		for _, p := range participants {
+			_, err := store.GetEvent(events[p.hex()][testSize-1].Hex())
+			checkErr(t, "GetEvent", err, cm.KeyNotFound)
+		}
+
+		if r := store.LastRound(); r != -1 {
+			t.Fatalf("LastRound should be -1, not %d", r)
+		}
+
+		if l := len(store.ConsensusEvents()); l != 0 {
+			t.Fatalf("ConsensusEvents should be empty, not %d long", l)
+		}
+	})
+
+	t.Run("PeerSets", func(t *testing.T) {
+		ps, err := store.GetPeerSet(frame.Round)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPeerSet(t, "Frame PeerSet", peerSet, ps)
+
+		ps, err = store.GetPeerSet(9)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPeerSet(t, "Future PeerSet", futurePeerSet, ps)
+
+		future, err := store.GetFuturePeerSets(frame.Round)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(future) != 1 {
+			t.Fatalf("There should be 1 future PeerSet, not %d", len(future))
+		}
+		checkPeers(t, "Future PeerSet", futurePeerSet.Peers, future[9])
+
+		checkRepertoire(t, store, futurePeerSet.Peers)
+	})
+
+	t.Run("Frame", func(t *testing.T) {
+		storedFrame, err := store.GetFrame(frame.Round)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEncoding(t, "Frame", frame, storedFrame)
+	})
+
+	t.Run("ForkProofs are kept", func(t *testing.T) {
+		if _, err := store.GetForkProof(proof.Creator(), proof.Index()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Insert above Roots", func(t *testing.T) {
+		for _, p := range participants {
+			if err := store.SetEvent(events[p.hex()][head+1]); err != nil {
+				t.Fatal(err)
+			}
+
+			last, isRoot, err := store.LastEventFrom(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isRoot || last != events[p.hex()][head+1].Hex() {
+				t.Fatalf("LastEventFrom %s should be the Event above the Root", p.hex())
+			}
+		}
+	})
+}
+
+func testPrune(t *testing.T, store hg.Store) {
+	testSize := 10
+	head := 5
+
+	participants, peerSet := initPeerSet(t, store, 3)
+	events := newEvents(t, participants, testSize)
+	setEvents(t, store, participants, events)
+
+	for r := 0; r < 5; r++ {
+		if err := store.SetRound(r, hg.NewRoundInfo()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for r := 1; r < 4; r++ {
+		if err := store.SetFrame(newFrame(t, r, participants, peerSet)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	block := hg.NewBlock(0, 3, []byte("framehash"), peerSet.Peers, nil, nil)
+	if err := store.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := &hg.Frame{
+		Round:  3,
+		Peers:  peerSet.Peers,
+		Roots:  newRoots(participants, events, head),
+		Events: []*hg.Event{},
+	}
+	if err := store.SetFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Prune(block, frame, []byte("snapshot")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Pruned Events", func(t *testing.T) {
+		for _, p := range participants {
+			for k, ev := range events[p.hex()] {
+				_, err := store.GetEvent(ev.Hex())
+				if k <= head {
+					checkErr(t, "GetEvent", err, cm.KeyNotFound)
+				} else if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := store.ParticipantEvents(p.hex(), -1)
+			checkErr(t, "ParticipantEvents", err, cm.TooLate)
+
+			_, err = store.ParticipantEvent(p.hex(), head-1)
+			checkErr(t, "ParticipantEvent", err, cm.TooLate)
+
+			//The head is in the Root
+			hash, err := store.ParticipantEvent(p.hex(), head)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != events[p.hex()][head].Hex() {
+				t.Fatalf("ParticipantEvent(%s, %d) should be the Root head", p.hex(), head)
+			}
+
+			pEvents, err := store.ParticipantEvents(p.hex(), head)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pEvents) != testSize-head-1 {
+				t.Fatalf("ParticipantEvents(%s, %d) should contain %d Events, not %d",
+					p.hex(), head, testSize-head-1, len(pEvents))
+			}
+
+			last, isRoot, err := store.LastEventFrom(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isRoot || last != events[p.hex()][testSize-1].Hex() {
+				t.Fatalf("LastEventFrom %s should be its last Event", p.hex())
+			}
+
+			root, err := store.GetRoot(p.hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if root.Head != frame.Roots[p.hex()].Head {
+				t.Fatalf("Root of %s should be replaced by the Root of the Frame", p.hex())
+			}
+		}
+	})
+
+	t.Run("Pruned Rounds and Frames", func(t *testing.T) {
+		for r := 0; r < 5; r++ {
+			_, err := store.GetRound(r)
+			if r < frame.Round {
+				checkErr(t, "GetRound", err, cm.KeyNotFound)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for r := 1; r < 4; r++ {
+			_, err := store.GetFrame(r)
+			if r < frame.Round {
+				checkErr(t, "GetFrame", err, cm.KeyNotFound)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("Blocks are kept", func(t *testing.T) {
+		if _, err := store.GetBlock(0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Checkpoint", func(t *testing.T) {
+		if err := store.Checkpoint(block, []byte("snapshot"), 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package storetest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+)
+
+//pathMaker returns a function that creates new paths in a temporary directory.
+//The paths do not exist yet, so that the Stores are not bootstrapped.
+func pathMaker(t *testing.T, prefix string) (func() string, func()) {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	newPath := func() string {
+		count++
+		return filepath.Join(dir, fmt.Sprintf("store%d", count))
+	}
+
+	return newPath, func() { os.RemoveAll(dir) }
+}
+
+func TestInmemStore(t *testing.T) {
+	Run(t, func(cacheSize int) (hg.Store, error) {
+		return hg.NewInmemStore(cacheSize), nil
+	})
+}
+
+func TestBadgerStore(t *testing.T) {
+	newPath, cleanup := pathMaker(t, "badger")
+	defer cleanup()
+
+	Run(t, func(cacheSize int) (hg.Store, error) {
+		return hg.NewBadgerStore(cacheSize, newPath())
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	newPath, cleanup := pathMaker(t, "file")
+	defer cleanup()
+
+	Run(t, func(cacheSize int) (hg.Store, error) {
+		return hg.NewFileStore(cacheSize, newPath())
+	})
+}
+
+func TestEncryptedBadgerStore(t *testing.T) {
+	newPath, cleanup := pathMaker(t, "encrypted")
+	defer cleanup()
+
+	keys := [][]byte{bytes.Repeat([]byte{1}, hg.EncryptionKeySize)}
+
+	Run(t, func(cacheSize int) (hg.Store, error) {
+		return hg.NewEncryptedBadgerStore(cacheSize, newPath(), keys)
+	})
+}
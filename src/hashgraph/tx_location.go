@@ -0,0 +1,50 @@
+package hashgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+)
+
+//TxLocation records where a committed transaction was found: the Block that
+//contains it, and the Event that carried it into the hashgraph.
+type TxLocation struct {
+	TxHash        string
+	BlockIndex    int
+	Position      int //index of the transaction in the Block
+	EventHash     string
+	EventPosition int //index of the transaction in the Event
+}
+
+//TxHash returns the hex encoded SHA256 hash of a transaction
+func TxHash(tx []byte) string {
+	return fmt.Sprintf("0x%X", crypto.SHA256(tx))
+}
+
+//NormalizeTxHash returns the canonical form of a transaction hash, with the 0x
+//prefix and uppercase hex digits, so that lookups are case-insensitive
+func NormalizeTxHash(hash string) string {
+	if strings.HasPrefix(hash, "0x") || strings.HasPrefix(hash, "0X") {
+		hash = hash[2:]
+	}
+	return "0x" + strings.ToUpper(hash)
+}
+
+//json encoding of TxLocation
+func (l *TxLocation) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	if err := enc.Encode(l); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (l *TxLocation) Unmarshal(data []byte) error {
+	b := bytes.NewBuffer(data)
+	dec := json.NewDecoder(b)
+	return dec.Decode(l)
+}
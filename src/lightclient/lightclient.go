@@ -0,0 +1,173 @@
+package lightclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+LightClient follows the chain of Blocks produced by a Babble network without
+running the hashgraph. It starts from a trusted genesis PeerSet and checks that
+every Block is signed by validators holding more than 1/3 of the voting weight
+of the PeerSet identified by the Block's PeersHash.
+
+New PeerSets are derived, by a hashgraph.PeerSetTracker, from the signed
+InternalTransactionReceipts of already verified Blocks. A PeerSet that cannot
+be derived this way is never trusted.
+*/
+type LightClient struct {
+	addr   string
+	client *http.Client
+
+	tracker   *hg.PeerSetTracker
+	lastBlock *hg.Block
+
+	logger *logrus.Entry
+}
+
+//NewLightClient creates a LightClient that fetches Blocks from the HTTP
+//service at addr (host:port), starting from the genesis PeerSet
+func NewLightClient(addr string, genesisPeerSet *peers.PeerSet, timeout time.Duration, logger *logrus.Entry) *LightClient {
+	return &LightClient{
+		addr:    addr,
+		client:  &http.Client{Timeout: timeout},
+		tracker: hg.NewPeerSetTracker(genesisPeerSet),
+		logger:  logger,
+	}
+}
+
+//PeerSet returns the PeerSet of the last verified Block
+func (c *LightClient) PeerSet() *peers.PeerSet {
+	return c.tracker.PeerSet()
+}
+
+//LastBlockIndex returns the index of the last verified Block, or -1
+func (c *LightClient) LastBlockIndex() int {
+	if c.lastBlock == nil {
+		return -1
+	}
+	return c.lastBlock.Index()
+}
+
+//StateHash returns the StateHash of the last verified Block
+func (c *LightClient) StateHash() []byte {
+	if c.lastBlock == nil {
+		return nil
+	}
+	return c.lastBlock.StateHash()
+}
+
+//FetchBlock retrieves a Block from the service without verifying it
+func (c *LightClient) FetchBlock(index int) (*hg.Block, error) {
+	resp, err := c.client.Get(fmt.Sprintf("http://%s/block/%d", c.addr, index))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fetching Block %d: %s: %s", index, resp.Status, bytes.TrimSpace(body))
+	}
+
+	block := new(hg.Block)
+	if err := json.Unmarshal(body, block); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+//Next fetches and verifies the Block that follows the last verified Block
+func (c *LightClient) Next() (*hg.Block, error) {
+	block, err := c.FetchBlock(c.LastBlockIndex() + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Verify(block); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+//Sync verifies all the Blocks up to, and including, toIndex
+func (c *LightClient) Sync(toIndex int) error {
+	for c.LastBlockIndex() < toIndex {
+		if _, err := c.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Verify checks that block directly follows the last verified Block, that its
+PeerSet is the one derived from the previous Blocks for its round, and that it
+carries enough valid signatures. If so, the block becomes the last
+verified Block.
+*/
+func (c *LightClient) Verify(block *hg.Block) error {
+	if expected := c.LastBlockIndex() + 1; block.Index() != expected {
+		return fmt.Errorf("Expected Block %d, got %d", expected, block.Index())
+	}
+
+	previous := c.tracker.PeerSet()
+
+	peerSet, err := c.tracker.Next(block, func(peerSet *peers.PeerSet) error {
+		return verifySignatures(block, peerSet)
+	})
+	if err != nil {
+		return err
+	}
+
+	if peerSet != previous {
+		c.logger.WithFields(logrus.Fields{
+			"block": block.Index(),
+			"peers": peerSet.Len(),
+		}).Debug("PeerSet changed")
+	}
+
+	c.lastBlock = block
+
+	c.logger.WithFields(logrus.Fields{
+		"block":      block.Index(),
+		"state_hash": fmt.Sprintf("0x%X", block.StateHash()),
+	}).Debug("Verified Block")
+
+	return nil
+}
+
+//verifySignatures checks that the Block contains valid signatures from
+//validators holding MORE than 1/3 of the voting weight of peerSet
+func verifySignatures(block *hg.Block, peerSet *peers.PeerSet) error {
+	weight := 0
+	for _, sig := range block.GetSignatures() {
+		validator, ok := peerSet.ByPubKey[sig.ValidatorHex()]
+		if !ok {
+			continue
+		}
+		if ok, _ := block.Verify(sig); ok {
+			weight += validator.VotingWeight()
+		}
+	}
+
+	if weight <= peerSet.TrustCount() {
+		return fmt.Errorf("Not enough valid signatures: got %d, need more than %d", weight, peerSet.TrustCount())
+	}
+
+	return nil
+}
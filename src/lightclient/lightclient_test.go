@@ -0,0 +1,267 @@
+package lightclient
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/crypto"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+type validator struct {
+	key  *ecdsa.PrivateKey
+	peer *peers.Peer
+}
+
+func newValidator(i int) validator {
+	key, _ := crypto.GenerateECDSAKey()
+	pubHex := fmt.Sprintf("0x%X", crypto.FromECDSAPub(&key.PublicKey))
+	return validator{
+		key:  key,
+		peer: peers.NewPeer(pubHex, fmt.Sprintf("127.0.0.1:%d", 1337+i)),
+	}
+}
+
+//newSignedBlock creates a Block with RoundReceived index+1, that contains the
+//InternalTransactions of receipts, and records the receipts
+func newSignedBlock(t *testing.T, index int, peerSlice []*peers.Peer, receipts []hg.InternalTransactionReceipt, signers []validator) *hg.Block {
+	itxs := []hg.InternalTransaction{}
+	for _, r := range receipts {
+		itxs = append(itxs, r.InternalTransaction)
+	}
+
+	block := hg.NewBlock(index, index+1,
+		[]byte(fmt.Sprintf("framehash%d", index)),
+		peerSlice,
+		[][]byte{[]byte(fmt.Sprintf("block%d tx", index))},
+		itxs)
+	block.Body.StateHash = []byte(fmt.Sprintf("statehash%d", index))
+	block.Body.InternalTransactionReceipts = receipts
+
+	for _, v := range signers {
+		sig, err := block.Sign(v.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.SetSignature(sig)
+	}
+
+	return block
+}
+
+//newBlockServer stands in for the HTTP service of a Babble node
+func newBlockServer(blocks []*hg.Block) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/block/"))
+		if err != nil || index < 0 || index >= len(blocks) {
+			http.Error(w, "block not found", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocks[index])
+	}))
+}
+
+func newTestLightClient(t *testing.T, server *httptest.Server, genesis *peers.PeerSet) *LightClient {
+	return NewLightClient(strings.TrimPrefix(server.URL, "http://"),
+		genesis,
+		time.Second,
+		common.NewTestLogger(t).WithField("id", "lightclient"))
+}
+
+func TestLightClientPeerSetChange(t *testing.T) {
+	validators := []validator{}
+	for i := 0; i < 5; i++ {
+		validators = append(validators, newValidator(i))
+	}
+
+	genesisPeers := []*peers.Peer{}
+	for _, v := range validators[:4] {
+		genesisPeers = append(genesisPeers, v.peer)
+	}
+	genesis := peers.NewPeerSet(genesisPeers)
+
+	//The application gives the new validator a Weight of 2
+	join := hg.NewInternalTransactionJoin(*validators[4].peer)
+	weighted := *validators[4].peer
+	weighted.Weight = 2
+	joined := genesis.WithNewPeer(&weighted)
+
+	//The join is received in round 2, so the new PeerSet takes effect in round
+	//2 + PEERSET_DELAY, which is the round of Block 1 + PEERSET_DELAY
+	last := 1 + hg.PEERSET_DELAY
+	blocks := []*hg.Block{}
+	for i := 0; i < last; i++ {
+		var receipts []hg.InternalTransactionReceipt
+		if i == 1 {
+			receipts = []hg.InternalTransactionReceipt{join.AsAcceptedWithWeight(2)}
+		}
+		blocks = append(blocks, newSignedBlock(t, i, genesis.Peers, receipts, validators[:3]))
+	}
+	//The new validator signs with the new PeerSet. TrustCount is 2, and its
+	//signature counts for 2.
+	blocks = append(blocks, newSignedBlock(t, last, joined.Peers, nil, validators[3:5]))
+
+	server := newBlockServer(blocks)
+	defer server.Close()
+
+	client := newTestLightClient(t, server, genesis)
+
+	if err := client.Sync(last); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := client.LastBlockIndex(); l != last {
+		t.Fatalf("LastBlockIndex should be %d, not %d", last, l)
+	}
+
+	if sh, expected := client.StateHash(), []byte(fmt.Sprintf("statehash%d", last)); !reflect.DeepEqual(sh, expected) {
+		t.Fatalf("StateHash should be %s, not %s", expected, sh)
+	}
+
+	if client.PeerSet().Hex() != joined.Hex() {
+		t.Fatalf("LightClient should have followed the PeerSet change")
+	}
+
+	if w := client.PeerSet().ByPubKey[weighted.PubKeyHex].Weight; w != 2 {
+		t.Fatalf("The new validator should have the Weight of its receipt, 2, not %d", w)
+	}
+
+	//there is no next Block
+	if _, err := client.Next(); err == nil {
+		t.Fatal("Next should return an error when the Block does not exist")
+	}
+}
+
+func TestLightClientInternalTransactionReceipts(t *testing.T) {
+	validators := []validator{}
+	for i := 0; i < 4; i++ {
+		validators = append(validators, newValidator(i))
+	}
+
+	genesisPeers := []*peers.Peer{}
+	for _, v := range validators {
+		genesisPeers = append(genesisPeers, v.peer)
+	}
+	genesis := peers.NewPeerSet(genesisPeers)
+
+	client := NewLightClient("", genesis, time.Second, common.NewTestLogger(t).WithField("id", "lightclient"))
+
+	//A refused join does not change the PeerSet
+	refused := hg.NewInternalTransactionJoin(*newValidator(4).peer)
+	if err := client.Verify(newSignedBlock(t, 0, genesis.Peers, []hg.InternalTransactionReceipt{refused.AsRefused()}, validators)); err != nil {
+		t.Fatal(err)
+	}
+	if s := client.tracker.Scheduled(); s != 0 {
+		t.Fatalf("A refused join should not schedule a PeerSet, %d scheduled", s)
+	}
+
+	//Any number of joins can be accepted in the same Block
+	joining := []validator{}
+	receipts := []hg.InternalTransactionReceipt{}
+	joined := genesis
+	for i := 0; i < 20; i++ {
+		v := newValidator(10 + i)
+		joining = append(joining, v)
+		join := hg.NewInternalTransactionJoin(*v.peer)
+		receipts = append(receipts, join.AsAccepted())
+		joined = joined.WithNewPeer(v.peer)
+	}
+	if err := client.Verify(newSignedBlock(t, 1, genesis.Peers, receipts, validators)); err != nil {
+		t.Fatal(err)
+	}
+	all := append(append([]validator{}, validators...), joining...)
+	if s := client.tracker.Scheduled(); s != 1 {
+		t.Fatalf("The joins should schedule 1 PeerSet, not %d", s)
+	}
+
+	//The new PeerSet takes effect PEERSET_DELAY rounds later, not before
+	effective := 1 + hg.PEERSET_DELAY
+	for i := 2; i < effective; i++ {
+		if err := client.Verify(newSignedBlock(t, i, joined.Peers, nil, all)); err == nil {
+			t.Fatalf("Block %d should not use the new PeerSet yet", i)
+		}
+		if err := client.Verify(newSignedBlock(t, i, genesis.Peers, nil, validators)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Verify(newSignedBlock(t, effective, joined.Peers, nil, all)); err != nil {
+		t.Fatal(err)
+	}
+	if client.PeerSet().Len() != 24 {
+		t.Fatalf("PeerSet should have 24 peers, not %d", client.PeerSet().Len())
+	}
+
+	//Receipts must be about the InternalTransactions of the Block
+	forged := newSignedBlock(t, effective+1, joined.Peers, nil, nil)
+	forged.Body.InternalTransactionReceipts = []hg.InternalTransactionReceipt{refused.AsAccepted()}
+	for _, v := range all {
+		sig, err := forged.Sign(v.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged.SetSignature(sig)
+	}
+	if err := client.Verify(forged); err == nil || !strings.Contains(err.Error(), "not in the Block") {
+		t.Fatalf("Verify should reject a receipt of an InternalTransaction that is not in the Block, not return %v", err)
+	}
+	if l := client.LastBlockIndex(); l != effective {
+		t.Fatalf("LastBlockIndex should be %d, not %d", effective, l)
+	}
+}
+
+func TestLightClientRejectBlocks(t *testing.T) {
+	validators := []validator{}
+	for i := 0; i < 5; i++ {
+		validators = append(validators, newValidator(i))
+	}
+
+	genesisPeers := []*peers.Peer{}
+	for _, v := range validators[:4] {
+		genesisPeers = append(genesisPeers, v.peer)
+	}
+	genesis := peers.NewPeerSet(genesisPeers)
+
+	//A PeerSet that no verified Block introduced
+	forgedPeerSet := genesis.WithNewPeer(validators[4].peer)
+
+	cases := map[string]*hg.Block{
+		//TrustCount is 2, so 2 signatures are not enough
+		"not enough signatures": newSignedBlock(t, 0, genesis.Peers, nil, validators[:2]),
+		//signatures from outside the PeerSet do not count
+		"unknown validator": newSignedBlock(t, 0, genesis.Peers, nil, validators[2:5]),
+		"unknown PeerSet":   newSignedBlock(t, 0, forgedPeerSet.Peers, nil, validators[:4]),
+	}
+
+	for name, block := range cases {
+		server := newBlockServer([]*hg.Block{block})
+
+		client := newTestLightClient(t, server, genesis)
+
+		if _, err := client.Next(); err == nil {
+			t.Fatalf("%s: Next should return an error", name)
+		}
+
+		if l := client.LastBlockIndex(); l != -1 {
+			t.Fatalf("%s: LastBlockIndex should be -1, not %d", name, l)
+		}
+
+		server.Close()
+	}
+
+	//Blocks must be verified in order
+	client := NewLightClient("", genesis, time.Second, common.NewTestLogger(t).WithField("id", "lightclient"))
+	if err := client.Verify(newSignedBlock(t, 1, genesis.Peers, nil, validators[:4])); err == nil {
+		t.Fatal("Verify should return an error for a Block that does not follow the last one")
+	}
+}
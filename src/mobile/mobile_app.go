@@ -37,8 +37,15 @@ func (m *mobileApp) CommitHandler(block hashgraph.Block) (proxy.CommitResponse,
 
 	stateHash := m.commitHandler.OnCommit(blockBytes)
 
+	//Accept all InternalTransactions
+	receipts := []hashgraph.InternalTransactionReceipt{}
+	for _, itx := range block.InternalTransactions() {
+		receipts = append(receipts, itx.AsAccepted())
+	}
+
 	commitResponse := proxy.CommitResponse{
-		StateHash: stateHash,
+		StateHash:                   stateHash,
+		InternalTransactionReceipts: receipts,
 	}
 
 	return commitResponse, nil
@@ -10,7 +10,6 @@ import (
 	"github.com/mosaicnetworks/babble/src/crypto"
 	"github.com/mosaicnetworks/babble/src/node"
 	"github.com/mosaicnetworks/babble/src/peers"
-	"github.com/mosaicnetworks/babble/src/proxy"
 	"github.com/mosaicnetworks/babble/src/proxy/inmem"
 	"github.com/sirupsen/logrus"
 )
@@ -18,7 +17,7 @@ import (
 type Node struct {
 	nodeID uint32
 	node   *node.Node
-	proxy  proxy.AppProxy
+	proxy  *inmem.InmemProxy
 	logger *logrus.Logger
 }
 
@@ -66,7 +65,8 @@ func New(privKey string,
 	//mobileApp implements the ProxyHandler interface, and we use it to
 	//instantiates an InmemProxy
 	mobileApp := newMobileApp(commitHandler, exceptionHandler, babbleConfig.Logger)
-	babbleConfig.Proxy = inmem.NewInmemProxy(mobileApp, babbleConfig.Logger)
+	inmemProxy := inmem.NewInmemProxy(mobileApp, babbleConfig.Logger)
+	babbleConfig.Proxy = inmemProxy
 
 	engine := babble.NewBabble(babbleConfig)
 
@@ -79,7 +79,7 @@ func New(privKey string,
 
 	return &Node{
 		node:   engine.Node,
-		proxy:  babbleConfig.Proxy,
+		proxy:  inmemProxy,
 		nodeID: engine.Node.ID(),
 		logger: babbleConfig.Logger,
 	}
@@ -97,12 +97,16 @@ func (n *Node) Shutdown() {
 	n.node.Shutdown()
 }
 
-func (n *Node) SubmitTx(tx []byte) {
-	//have to make a copy or the tx will be garbage collected and weird stuff
-	//happens in transaction pool
-	t := make([]byte, len(tx), len(tx))
-	copy(t, tx)
-	n.proxy.SubmitCh() <- t
+//Leave submits a request to leave the network, and shuts the node down once
+//the request has gone through consensus
+func (n *Node) Leave() error {
+	return n.node.Leave()
+}
+
+//SubmitTx submits a transaction to the node, and returns an error if the node's
+//transaction pool rejects it
+func (n *Node) SubmitTx(tx []byte) error {
+	return n.proxy.SubmitTx(tx)
 }
 
 func (n *Node) GetPeers() string {
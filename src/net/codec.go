@@ -0,0 +1,123 @@
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Version bytes of the Codecs. They have the high bit set, while rpcTypes do
+// not, so a NetworkTransport can tell a request that starts with a version byte
+// from a request of a node that predates Codecs, which starts with the rpcType
+// and is encoded in JSON.
+const (
+	codecVersionFlag    uint8 = 0x80
+	codecVersionJSON          = codecVersionFlag
+	codecVersionMsgpack       = codecVersionFlag + 1
+)
+
+// Encoder writes values to a stream
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads values from a stream
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+/*
+Codec encodes the requests and responses of a NetworkTransport. A request is
+framed by the version byte of its Codec, followed by its rpcType. The response is
+encoded with the Codec of the request, so a NetworkTransport answers requests in
+every Codec, whichever Codec it uses to send its own requests.
+
+Requests in JSON omit the version byte, which is what nodes that predate Codecs
+expect. A NetworkTransport falls back to JSON for the nodes that close the
+connection instead of answering a request with a version byte.
+*/
+type Codec interface {
+	// Name is the name of the Codec in the configuration
+	Name() string
+
+	// Version is the byte that precedes the rpcType of requests
+	Version() uint8
+
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+var (
+	// JSONCodec encodes RPCs with encoding/json. It is the default Codec.
+	JSONCodec Codec = jsonCodec{}
+
+	// MsgpackCodec encodes RPCs with msgpack, where byte slices are raw binary
+	// instead of base64 strings, which roughly halves the size of gossip.
+	MsgpackCodec Codec = msgpackCodec{
+		handle: &codec.MsgpackHandle{WriteExt: true},
+	}
+
+	codecs = []Codec{JSONCodec, MsgpackCodec}
+)
+
+// CodecByName returns the Codec with the given name: json or msgpack.
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown wire codec %s", name)
+}
+
+// codecByVersion returns the Codec of a version byte
+func codecByVersion(version uint8) (Codec, error) {
+	for _, c := range codecs {
+		if c.Version() == version {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec version %d", version)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Version() uint8 {
+	return codecVersionJSON
+}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (jsonCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// msgpackCodec does not buffer reads, so the version and rpcType of the next
+// request can be read from the underlying bufio.Reader.
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Version() uint8 {
+	return codecVersionMsgpack
+}
+
+func (c msgpackCodec) NewEncoder(w io.Writer) Encoder {
+	return codec.NewEncoder(w, c.handle)
+}
+
+func (c msgpackCodec) NewDecoder(r io.Reader) Decoder {
+	return codec.NewDecoder(r, c.handle)
+}
@@ -0,0 +1,196 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/crypto"
+	"github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+func TestCodecByName(t *testing.T) {
+	for _, c := range []Codec{JSONCodec, MsgpackCodec} {
+		found, err := CodecByName(c.Name())
+		if err != nil || found != c {
+			t.Fatalf("CodecByName(%s) should return the codec, not %v, %v", c.Name(), found, err)
+		}
+	}
+	if _, err := CodecByName("xml"); err == nil {
+		t.Fatalf("CodecByName should refuse an unknown codec")
+	}
+}
+
+// Signatures are computed over the JSON encoding of requests and Events, so a
+// request decoded by any Codec must still verify
+func TestCodec_SignedRequest(t *testing.T) {
+	key, err := crypto.GenerateECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := peers.NewPeer(fmt.Sprintf("0x%X", crypto.FromECDSAPub(&key.PublicKey)), "")
+
+	req := EagerSyncRequest{
+		SignedHeader: SignedHeader{
+			FromID: peer.ID(),
+			ToID:   2,
+			Time:   time.Now().UnixNano(),
+			Nonce:  3,
+		},
+		Events: []hashgraph.WireEvent{
+			{
+				Body: hashgraph.WireBody{
+					Transactions:    [][]byte{[]byte("tx"), {}},
+					BlockSignatures: []hashgraph.WireBlockSignature{},
+					Timestamp:       time.Now().UTC(),
+					CreatorID:       peer.ID(),
+					Index:           1,
+				},
+				Signature: "signature",
+			},
+			{},
+		},
+	}
+	if err := SignRequest(&req, key); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []Codec{JSONCodec, MsgpackCodec} {
+		var b bytes.Buffer
+		if err := c.NewEncoder(&b).Encode(&req); err != nil {
+			t.Fatal(err)
+		}
+
+		var out EagerSyncRequest
+		if err := c.NewDecoder(&b).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, err := VerifyRequest(&out, peer); !ok {
+			t.Fatalf("%s request should verify after decoding, err: %v", c.Name(), err)
+		}
+	}
+}
+
+// A NetworkTransport answers the JSON requests of nodes that predate Codecs,
+// which have no version byte, even when it sends msgpack itself
+func TestCodec_LegacyRequest(t *testing.T) {
+	trans, err := NewTCPTransport("127.0.0.1:0", nil, 2, time.Second, common.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trans.Close()
+	trans.SetCodec(MsgpackCodec)
+
+	resp := SyncResponse{FromID: 1, Known: map[uint32]int{0: 5}}
+	go func() {
+		rpc := <-trans.Consumer()
+		rpc.Respond(&resp, nil)
+	}()
+
+	conn, err := net.Dial("tcp", trans.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := bufio.NewWriter(conn)
+	w.WriteByte(rpcSync)
+	if err := JSONCodec.NewEncoder(w).Encode(&SyncRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	netConn := &netConn{conn: conn, dec: JSONCodec.NewDecoder(bufio.NewReader(conn))}
+	var out SyncResponse
+	if _, err := decodeResponse(netConn, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.FromID != 1 || out.Known[0] != 5 {
+		t.Fatalf("SyncResponse should be %#v, not %#v", resp, out)
+	}
+}
+
+// A NetworkTransport that sends msgpack falls back to JSON for nodes that
+// predate Codecs, and remembers it
+func TestCodec_LegacyTarget(t *testing.T) {
+	// The legacy node closes the connection when it reads a version byte,
+	// because it is not a known rpcType
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	resp := SyncResponse{FromID: 1, Known: map[uint32]int{0: 5}}
+	versioned := make(chan uint8, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				w := bufio.NewWriter(conn)
+				dec := JSONCodec.NewDecoder(r)
+				enc := JSONCodec.NewEncoder(w)
+				for {
+					rpcType, err := r.ReadByte()
+					if err != nil {
+						return
+					}
+					if rpcType != rpcSync {
+						versioned <- rpcType
+						return
+					}
+					var req SyncRequest
+					if err := dec.Decode(&req); err != nil {
+						return
+					}
+					enc.Encode("")
+					enc.Encode(&resp)
+					if err := w.Flush(); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	trans, err := NewTCPTransport("127.0.0.1:0", nil, 2, time.Second, common.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trans.Close()
+	trans.SetCodec(MsgpackCodec)
+
+	target := listener.Addr().String()
+	for i := 0; i < 3; i++ {
+		var out SyncResponse
+		if err := trans.Sync(target, &SyncRequest{}, &out); err != nil {
+			t.Fatalf("Sync %d: %v", i, err)
+		}
+		if out.FromID != 1 || out.Known[0] != 5 {
+			t.Fatalf("SyncResponse should be %#v, not %#v", resp, out)
+		}
+	}
+
+	if len(versioned) != 1 {
+		t.Fatalf("The legacy node should receive 1 msgpack request, not %d", len(versioned))
+	}
+	if v := <-versioned; v != MsgpackCodec.Version() {
+		t.Fatalf("The legacy node should read the msgpack version byte, not %d", v)
+	}
+	if codec := trans.targetCodec(target); codec != JSONCodec {
+		t.Fatalf("The legacy node should be sent JSON, not %s", codec.Name())
+	}
+}
@@ -1,14 +1,55 @@
 package net
 
 import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
 	"github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
 )
 
+// SignedRequest is a request that is signed by the private key of its sender,
+// so that the receiver can check that it was sent by the peer identified by
+// FromID, rather than trust the FromID field. SignedRequests embed a
+// SignedHeader.
+type SignedRequest interface {
+	//Header returns the SignedHeader of the request
+	Header() *SignedHeader
+}
+
+// SignedHeader identifies the sender of a SignedRequest, binds the request to
+// its receiver, and makes it unique, so that it cannot be replayed to another
+// peer, or later to the same peer.
+type SignedHeader struct {
+	//FromID is the ID of the peer that sends the request
+	FromID uint32
+
+	//ToID is the ID of the peer the request is sent to
+	ToID uint32
+
+	//Time is when the request was signed, in Unix nanoseconds
+	Time int64
+
+	//Nonce distinguishes the requests that a peer signs at the same Time
+	Nonce uint32
+
+	//Signature is the signature of the request, with an empty Signature
+	Signature string
+}
+
+// Header implements the SignedRequest interface
+func (h *SignedHeader) Header() *SignedHeader {
+	return h
+}
+
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
 type SyncRequest struct {
-	FromID uint32
-	Known  map[uint32]int
+	SignedHeader
+	Known map[uint32]int
 }
 
 type SyncResponse struct {
@@ -21,7 +62,7 @@ type SyncResponse struct {
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
 type EagerSyncRequest struct {
-	FromID uint32
+	SignedHeader
 	Events []hashgraph.WireEvent
 }
 
@@ -33,7 +74,7 @@ type EagerSyncResponse struct {
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
 type FastForwardRequest struct {
-	FromID uint32
+	SignedHeader
 }
 
 type FastForwardResponse struct {
@@ -44,3 +85,79 @@ type FastForwardResponse struct {
 }
 
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+type JoinRequest struct {
+	InternalTransaction hashgraph.InternalTransaction
+}
+
+type JoinResponse struct {
+	FromID        uint32
+	Accepted      bool
+	AcceptedRound int
+	Peers         []*peers.Peer
+}
+
+//++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+// SignRequest signs a request, including its SignedHeader, with the private key
+// of its sender
+func SignRequest(req SignedRequest, key *ecdsa.PrivateKey) error {
+	hash, err := requestHash(req)
+	if err != nil {
+		return err
+	}
+
+	r, s, err := crypto.Sign(key, hash)
+	if err != nil {
+		return err
+	}
+
+	req.Header().Signature = crypto.EncodeSignature(r, s)
+	return nil
+}
+
+// VerifyRequest checks that a request was signed by the private key of the peer
+func VerifyRequest(req SignedRequest, peer *peers.Peer) (bool, error) {
+	signature := req.Header().Signature
+	if signature == "" {
+		return false, nil
+	}
+
+	if len(peer.PubKeyHex) < 3 {
+		return false, fmt.Errorf("Invalid PubKeyHex: %s", peer.PubKeyHex)
+	}
+
+	pubKey := crypto.ToECDSAPub(peer.PubKeyBytes())
+	if pubKey == nil || pubKey.X == nil {
+		return false, fmt.Errorf("Invalid public key: %s", peer.PubKeyHex)
+	}
+
+	hash, err := requestHash(req)
+	if err != nil {
+		return false, err
+	}
+
+	r, s, err := crypto.DecodeSignature(signature)
+	if err != nil {
+		return false, err
+	}
+	if r == nil || s == nil {
+		return false, fmt.Errorf("Invalid signature: %s", signature)
+	}
+
+	return crypto.Verify(pubKey, hash, r, s), nil
+}
+
+// requestHash is the hash of the JSON encoding of a request with an empty
+// Signature. It hashes a copy, so that the request is left untouched.
+func requestHash(req SignedRequest) ([]byte, error) {
+	unsigned := reflect.New(reflect.TypeOf(req).Elem())
+	unsigned.Elem().Set(reflect.ValueOf(req).Elem())
+	unsigned.Interface().(SignedRequest).Header().Signature = ""
+
+	data, err := json.Marshal(unsigned.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SHA256(data), nil
+}
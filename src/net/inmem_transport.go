@@ -33,10 +33,11 @@ func generateUUID() string {
 // tested in-memory without going over a network.
 type InmemTransport struct {
 	sync.RWMutex
-	consumerCh chan RPC
-	localAddr  string
-	peers      map[string]*InmemTransport
-	timeout    time.Duration
+	consumerCh  chan RPC
+	localAddr   string
+	peers       map[string]*InmemTransport
+	timeout     time.Duration
+	joinTimeout time.Duration
 }
 
 // NewInmemTransport is used to initialize a new transport
@@ -46,10 +47,11 @@ func NewInmemTransport(addr string) (string, *InmemTransport) {
 		addr = NewInmemAddr()
 	}
 	trans := &InmemTransport{
-		consumerCh: make(chan RPC, 16),
-		localAddr:  addr,
-		peers:      make(map[string]*InmemTransport),
-		timeout:    50 * time.Millisecond,
+		consumerCh:  make(chan RPC, 16),
+		localAddr:   addr,
+		peers:       make(map[string]*InmemTransport),
+		timeout:     50 * time.Millisecond,
+		joinTimeout: DefaultJoinTimeout,
 	}
 	return addr, trans
 }
@@ -103,6 +105,19 @@ func (i *InmemTransport) FastForward(target string, args *FastForwardRequest, re
 	return nil
 }
 
+// Join implements the Transport interface.
+func (i *InmemTransport) Join(target string, args *JoinRequest, resp *JoinResponse) error {
+	rpcResp, err := i.makeRPC(target, args, nil, i.joinTimeout)
+	if err != nil {
+		return err
+	}
+
+	// Copy the result back
+	out := rpcResp.Response.(*JoinResponse)
+	*resp = *out
+	return nil
+}
+
 func (i *InmemTransport) makeRPC(target string, args interface{}, r io.Reader, timeout time.Duration) (rpcResp RPCResponse, err error) {
 	i.RLock()
 	peer, ok := i.peers[target]
@@ -113,12 +128,20 @@ func (i *InmemTransport) makeRPC(target string, args interface{}, r io.Reader, t
 		return
 	}
 
-	// Send the RPC over
-	respCh := make(chan RPCResponse)
-	peer.consumerCh <- RPC{
+	// Send the RPC over, unless the peer stopped consuming RPCs. The response
+	// channel is buffered so that the peer does not block on a response that
+	// comes after the timeout.
+	respCh := make(chan RPCResponse, 1)
+	timer := time.After(timeout)
+	select {
+	case peer.consumerCh <- RPC{
 		Command:  args,
 		Reader:   r,
 		RespChan: respCh,
+	}:
+	case <-timer:
+		err = fmt.Errorf("command enqueue timeout")
+		return
 	}
 
 	// Wait for a response
@@ -127,7 +150,7 @@ func (i *InmemTransport) makeRPC(target string, args interface{}, r io.Reader, t
 		if rpcResp.Error != nil {
 			err = rpcResp.Error
 		}
-	case <-time.After(timeout):
+	case <-timer:
 		err = fmt.Errorf("command timed out")
 	}
 	return
@@ -2,7 +2,6 @@ package net
 
 import (
 	"bufio"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -24,25 +23,39 @@ const (
 	rpcFastForward
 )
 
+// DefaultJoinTimeout is the time a Join RPC waits for a response. It is larger
+// than the timeout of other RPCs because JoinRequests are only answered once
+// the corresponding InternalTransaction has been committed.
+const DefaultJoinTimeout = 30 * time.Second
+
 var (
 	// ErrTransportShutdown is returned when operations on a transport are
 	// invoked after it's been terminated.
 	ErrTransportShutdown = errors.New("transport shutdown")
+
+	// errNoResponse is returned when a target closes a new connection instead
+	// of answering a request that starts with a version byte, which is what
+	// nodes that predate Codecs do.
+	errNoResponse = errors.New("connection closed without response")
 )
 
 /*
-
 NetworkTransport provides a network based transport that can be
 used to communicate with babble on remote machines. It requires
 an underlying stream layer to provide a stream abstraction, which can
 be simple TCP, TLS, etc.
 
 This transport is very simple and lightweight. Each RPC request is
-framed by sending a byte that indicates the message type, followed
-by the json encoded request.
+framed by sending the version byte of its Codec, followed by a byte
+that indicates the message type, and by the encoded request. JSON
+requests omit the version byte.
 
 The response is an error string followed by the response object,
-both are encoded using msgpack
+both are encoded with the Codec of the request.
+
+Nodes that predate Codecs close the connection when they read a version byte.
+When that happens, the request is sent again in JSON, and the target is sent
+JSON from then on.
 */
 type NetworkTransport struct {
 	logger *logrus.Logger
@@ -58,6 +71,11 @@ type NetworkTransport struct {
 	shutdownLock sync.Mutex
 
 	stream StreamLayer
+	codec  Codec
+
+	// jsonTargets are the targets that predate Codecs
+	jsonTargets     map[string]bool
+	jsonTargetsLock sync.Mutex
 
 	timeout     time.Duration
 	joinTimeout time.Duration
@@ -77,8 +95,9 @@ type netConn struct {
 	conn   net.Conn
 	r      *bufio.Reader
 	w      *bufio.Writer
-	dec    *json.Decoder
-	enc    *json.Encoder
+	codec  Codec
+	dec    Decoder
+	enc    Encoder
 }
 
 func (n *netConn) Release() error {
@@ -99,18 +118,27 @@ func NewNetworkTransport(
 		logger.Level = logrus.DebugLevel
 	}
 	trans := &NetworkTransport{
-		connPool:   make(map[string][]*netConn),
-		consumeCh:  make(chan RPC),
-		logger:     logger,
-		maxPool:    maxPool,
-		shutdownCh: make(chan struct{}),
-		stream:     stream,
-		timeout:    timeout,
+		connPool:    make(map[string][]*netConn),
+		consumeCh:   make(chan RPC),
+		logger:      logger,
+		maxPool:     maxPool,
+		shutdownCh:  make(chan struct{}),
+		stream:      stream,
+		codec:       JSONCodec,
+		jsonTargets: make(map[string]bool),
+		timeout:     timeout,
+		joinTimeout: DefaultJoinTimeout,
 	}
 	go trans.listen()
 	return trans
 }
 
+// SetCodec sets the Codec of the requests that the transport sends. It must be
+// called before the first request. Requests are received in every Codec.
+func (n *NetworkTransport) SetCodec(codec Codec) {
+	n.codec = codec
+}
+
 // Close is used to stop the network transport.
 func (n *NetworkTransport) Close() error {
 	n.shutdownLock.Lock()
@@ -161,17 +189,18 @@ func (n *NetworkTransport) getPooledConn(target string) *netConn {
 	return conn
 }
 
-// getConn is used to get a connection from the pool.
-func (n *NetworkTransport) getConn(target string, timeout time.Duration) (*netConn, error) {
+// getConn is used to get a connection from the pool. It also reports whether
+// the connection was dialed for this request.
+func (n *NetworkTransport) getConn(target string, codec Codec, timeout time.Duration) (*netConn, bool, error) {
 	// Check for a pooled conn
 	if conn := n.getPooledConn(target); conn != nil {
-		return conn, nil
+		return conn, false, nil
 	}
 
 	// Dial a new connection
 	conn, err := n.stream.Dial(target, timeout)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// Wrap the conn
@@ -180,13 +209,25 @@ func (n *NetworkTransport) getConn(target string, timeout time.Duration) (*netCo
 		conn:   conn,
 		r:      bufio.NewReader(conn),
 		w:      bufio.NewWriter(conn),
+		codec:  codec,
 	}
 	// Setup encoder/decoders
-	netConn.dec = json.NewDecoder(netConn.r)
-	netConn.enc = json.NewEncoder(netConn.w)
+	netConn.dec = codec.NewDecoder(netConn.r)
+	netConn.enc = codec.NewEncoder(netConn.w)
 
 	// Done
-	return netConn, nil
+	return netConn, true, nil
+}
+
+// targetCodec returns the Codec of the requests sent to a target.
+func (n *NetworkTransport) targetCodec(target string) Codec {
+	n.jsonTargetsLock.Lock()
+	defer n.jsonTargetsLock.Unlock()
+
+	if n.jsonTargets[target] {
+		return JSONCodec
+	}
+	return n.codec
 }
 
 // returnConn returns a connection back to the pool.
@@ -219,12 +260,45 @@ func (n *NetworkTransport) FastForward(target string, args *FastForwardRequest,
 	return n.genericRPC(target, rpcFastForward, n.timeout, args, resp)
 }
 
-// genericRPC handles a simple request/response RPC.
+// Join implements the Transport interface. A JoinRequest is only answered once
+// the corresponding InternalTransaction has gone through consensus, so it uses
+// a longer timeout.
+func (n *NetworkTransport) Join(target string, args *JoinRequest, resp *JoinResponse) error {
+	return n.genericRPC(target, rpcJoin, n.joinTimeout, args, resp)
+}
+
+// genericRPC handles a simple request/response RPC. If the target predates
+// Codecs, the request is sent again in JSON, and once the target answers, it is
+// remembered as a JSON target.
 func (n *NetworkTransport) genericRPC(target string, rpcType uint8, timeout time.Duration, args interface{}, resp interface{}) error {
+	codec := n.targetCodec(target)
+
+	_, err := n.codecRPC(target, codec, rpcType, timeout, args, resp)
+	if err != errNoResponse {
+		return err
+	}
+
+	answered, err := n.codecRPC(target, JSONCodec, rpcType, timeout, args, resp)
+	if answered {
+		n.logger.WithFields(logrus.Fields{
+			"target": target,
+			"codec":  codec.Name(),
+		}).Info("Target predates Codecs, falling back to JSON")
+
+		n.jsonTargetsLock.Lock()
+		n.jsonTargets[target] = true
+		n.jsonTargetsLock.Unlock()
+	}
+	return err
+}
+
+// codecRPC sends a request in a given Codec, and reports whether the target
+// answered it.
+func (n *NetworkTransport) codecRPC(target string, codec Codec, rpcType uint8, timeout time.Duration, args interface{}, resp interface{}) (bool, error) {
 	// Get a conn
-	conn, err := n.getConn(target, timeout)
+	conn, dialed, err := n.getConn(target, codec, timeout)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Set a deadline
@@ -234,7 +308,20 @@ func (n *NetworkTransport) genericRPC(target string, rpcType uint8, timeout time
 
 	// Send the RPC
 	if err = sendRPC(conn, rpcType, args); err != nil {
-		return err
+		return false, err
+	}
+
+	// A node that predates Codecs closes the connection, with an EOF or a
+	// reset, instead of answering. Pooled connections have been answered
+	// before.
+	if dialed && conn.codec != JSONCodec {
+		if _, err := conn.r.Peek(1); err != nil {
+			conn.Release()
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return false, err
+			}
+			return false, errNoResponse
+		}
 	}
 
 	// Decode the response
@@ -242,11 +329,19 @@ func (n *NetworkTransport) genericRPC(target string, rpcType uint8, timeout time
 	if canReturn {
 		n.returnConn(conn)
 	}
-	return err
+	return canReturn, err
 }
 
 // sendRPC is used to encode and send the RPC.
 func sendRPC(conn *netConn, rpcType uint8, args interface{}) error {
+	// Write the codec version, unless the request is in JSON
+	if conn.codec != JSONCodec {
+		if err := conn.w.WriteByte(conn.codec.Version()); err != nil {
+			conn.Release()
+			return err
+		}
+	}
+
 	// Write the request type
 	if err := conn.w.WriteByte(rpcType); err != nil {
 		conn.Release()
@@ -315,33 +410,67 @@ func (n *NetworkTransport) listen() {
 // handleConn is used to handle an inbound connection for its lifespan.
 func (n *NetworkTransport) handleConn(conn net.Conn) {
 	defer conn.Close()
-	r := bufio.NewReader(conn)
-	w := bufio.NewWriter(conn)
-	dec := json.NewDecoder(r)
-	enc := json.NewEncoder(w)
+	c := &serverConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+		decs: make(map[Codec]Decoder),
+		encs: make(map[Codec]Encoder),
+	}
 
 	for {
-		if err := n.handleCommand(r, dec, enc); err != nil {
+		if err := n.handleCommand(c); err != nil {
 			if err != io.EOF {
 				n.logger.WithField("error", err).Error("Failed to decode incoming command")
 			}
 			return
 		}
-		if err := w.Flush(); err != nil {
+		if err := c.w.Flush(); err != nil {
 			n.logger.WithField("error", err).Error("Failed to flush response")
 			return
 		}
 	}
 }
 
+// serverConn is an inbound connection. It keeps an Encoder and a Decoder for
+// every Codec that the remote node uses.
+type serverConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	decs map[Codec]Decoder
+	encs map[Codec]Encoder
+}
+
+func (c *serverConn) codecs(codec Codec) (Decoder, Encoder) {
+	if _, ok := c.decs[codec]; !ok {
+		c.decs[codec] = codec.NewDecoder(c.r)
+		c.encs[codec] = codec.NewEncoder(c.w)
+	}
+	return c.decs[codec], c.encs[codec]
+}
+
 // handleCommand is used to decode and dispatch a single command.
-func (n *NetworkTransport) handleCommand(r *bufio.Reader, dec *json.Decoder, enc *json.Encoder) error {
-	// Get the rpc type
-	rpcType, err := r.ReadByte()
+func (n *NetworkTransport) handleCommand(c *serverConn) error {
+	// Get the codec version and the rpc type. Requests without a version are
+	// in JSON.
+	rpcType, err := c.r.ReadByte()
 	if err != nil {
 		return err
 	}
 
+	codec := JSONCodec
+	if rpcType&codecVersionFlag != 0 {
+		if codec, err = codecByVersion(rpcType); err != nil {
+			return err
+		}
+		if rpcType, err = c.r.ReadByte(); err != nil {
+			return err
+		}
+	}
+
+	dec, enc := c.codecs(codec)
+
 	// Create the RPC object
 	respCh := make(chan RPCResponse, 1)
 	rpc := RPC{
@@ -368,10 +497,27 @@ func (n *NetworkTransport) handleCommand(r *bufio.Reader, dec *json.Decoder, enc
 			return err
 		}
 		rpc.Command = &req
+	case rpcJoin:
+		var req JoinRequest
+		if err := dec.Decode(&req); err != nil {
+			return err
+		}
+		rpc.Command = &req
 	default:
 		return fmt.Errorf("unknown rpc type %d", rpcType)
 	}
 
+	// On authenticated connections, nodes that are not peers can only join
+	if pc, ok := c.conn.(PeerConn); ok && rpcType != rpcJoin && !pc.IsPeer() {
+		pubKeyHex, err := pc.RemotePubKeyHex()
+		if err != nil {
+			return err
+		}
+		return encodeResponse(enc, RPCResponse{
+			Error: fmt.Errorf("Unauthorized request: %s is not a peer", pubKeyHex),
+		})
+	}
+
 	// Dispatch the RPC
 	select {
 	case n.consumeCh <- rpc:
@@ -382,21 +528,23 @@ func (n *NetworkTransport) handleCommand(r *bufio.Reader, dec *json.Decoder, enc
 	// Wait for response
 	select {
 	case resp := <-respCh:
-		// Send the error first
-		respErr := ""
-		if resp.Error != nil {
-			respErr = resp.Error.Error()
-		}
-		if err := enc.Encode(respErr); err != nil {
-			return err
-		}
-
-		// Send the response
-		if err := enc.Encode(resp.Response); err != nil {
-			return err
-		}
+		return encodeResponse(enc, resp)
 	case <-n.shutdownCh:
 		return ErrTransportShutdown
 	}
-	return nil
+}
+
+// encodeResponse sends the error of a response, followed by the response.
+func encodeResponse(enc Encoder, resp RPCResponse) error {
+	// Send the error first
+	respErr := ""
+	if resp.Error != nil {
+		respErr = resp.Error.Error()
+	}
+	if err := enc.Encode(respErr); err != nil {
+		return err
+	}
+
+	// Send the response
+	return enc.Encode(resp.Response)
 }
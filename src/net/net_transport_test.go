@@ -21,7 +21,6 @@ func TestNetworkTransport_PooledConn(t *testing.T) {
 
 	// Make the RPC request
 	args := SyncRequest{
-		FromID: 0,
 		Known: map[uint32]int{
 			0: 1,
 			1: 2,
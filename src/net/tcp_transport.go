@@ -62,8 +62,7 @@ func newTCPTransport(bindAddr string,
 	maxPool int,
 	timeout time.Duration,
 	transportCreator func(stream StreamLayer) *NetworkTransport) (*NetworkTransport, error) {
-	// Try to bind
-	list, err := net.Listen("tcp", bindAddr)
+	list, err := listenTCP(bindAddr, advertise)
 	if err != nil {
 		return nil, err
 	}
@@ -71,21 +70,38 @@ func newTCPTransport(bindAddr string,
 	// Create stream
 	stream := &TCPStreamLayer{
 		advertise: advertise,
-		listener:  list.(*net.TCPListener),
+		listener:  list,
+	}
+
+	// Create the network transport
+	trans := transportCreator(stream)
+	return trans, nil
+}
+
+// listenTCP binds a TCP listener, and verifies that the address advertised to
+// other nodes, which is the listener's address unless advertise is set, is
+// usable.
+func listenTCP(bindAddr string, advertise net.Addr) (*net.TCPListener, error) {
+	// Try to bind
+	list, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, err
 	}
 
 	// Verify that we have a usable advertise address
-	addr, ok := stream.Addr().(*net.TCPAddr)
+	addr := advertise
+	if addr == nil {
+		addr = list.Addr()
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
 	if !ok {
 		list.Close()
 		return nil, errNotTCP
 	}
-	if addr.IP.IsUnspecified() {
+	if tcpAddr.IP.IsUnspecified() {
 		list.Close()
 		return nil, errNotAdvertisable
 	}
 
-	// Create the network transport
-	trans := transportCreator(stream)
-	return trans, nil
+	return list.(*net.TCPListener), nil
 }
@@ -0,0 +1,233 @@
+package net
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+	"github.com/sirupsen/logrus"
+)
+
+var errNoCertificate = errors.New("remote node presented no certificate")
+
+// PeerVerifier reports whether a public key, in the PubKeyHex format of Peers,
+// belongs to a peer of the local node. When dialing, netAddr is the dialed
+// address, and the peer must be registered at that address; it is empty for
+// incoming connections, which can come from any address.
+type PeerVerifier func(pubKeyHex string, netAddr string) bool
+
+// PeerConn is a connection whose remote node proved, during the TLS
+// handshake, that it holds the private key of a public key.
+type PeerConn interface {
+	net.Conn
+
+	// RemotePubKeyHex returns the public key of the remote node, in the
+	// PubKeyHex format of Peers. It completes the handshake if necessary.
+	RemotePubKeyHex() (string, error)
+
+	// IsPeer reports whether the remote node is currently a peer
+	IsPeer() bool
+}
+
+/*
+TLSStreamLayer implements the StreamLayer interface over TLS, with mutual
+authentication. Every node presents a self-signed certificate derived from its
+ECDSA key, so the public key of a certificate is the PubKeyHex of a Peer, and
+no certificate authority is involved.
+
+When dialing, the handshake fails unless the key of the remote certificate
+belongs to the peer at the dialed address, according to the PeerVerifier. When
+accepting, it only requires a valid client certificate, because a node that is
+not a peer yet must be able to send a JoinRequest; the connection is a
+PeerConn, and NetworkTransport refuses other requests from nodes that are not
+peers.
+*/
+type TLSStreamLayer struct {
+	advertise net.Addr
+	listener  net.Listener
+	config    *tls.Config
+	verify    PeerVerifier
+}
+
+// NewTLSStreamLayer binds a TLSStreamLayer. The key is the ECDSA key of the
+// local node, from which its certificate is derived.
+func NewTLSStreamLayer(
+	bindAddr string,
+	advertise net.Addr,
+	key *ecdsa.PrivateKey,
+	verify PeerVerifier,
+) (*TLSStreamLayer, error) {
+	cert, err := selfSignedCertificate(key)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := listenTCP(bindAddr, advertise)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS12,
+		//Certificates are self-signed; VerifyPeerCertificate checks their keys
+		InsecureSkipVerify: true,
+	}
+
+	return &TLSStreamLayer{
+		advertise: advertise,
+		listener:  tls.NewListener(list, config),
+		config:    config,
+		verify:    verify,
+	}, nil
+}
+
+// Dial implements the StreamLayer interface.
+func (t *TLSStreamLayer) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	config := t.config.Clone()
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errNoCertificate
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		pubKeyHex, err := certificatePubKeyHex(cert)
+		if err != nil {
+			return err
+		}
+		if !t.verify(pubKeyHex, address) {
+			return fmt.Errorf("Key of %s is not the key of a peer at that address: %s", address, pubKeyHex)
+		}
+		return nil
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsPeerConn{Conn: conn, verify: t.verify}, nil
+}
+
+// Accept implements the net.Listener interface.
+func (t *TLSStreamLayer) Accept() (c net.Conn, err error) {
+	conn, err := t.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsPeerConn{Conn: conn.(*tls.Conn), verify: t.verify}, nil
+}
+
+// Close implements the net.Listener interface.
+func (t *TLSStreamLayer) Close() (err error) {
+	return t.listener.Close()
+}
+
+// Addr implements the net.Listener interface.
+func (t *TLSStreamLayer) Addr() net.Addr {
+	// Use an advertise addr if provided
+	if t.advertise != nil {
+		return t.advertise
+	}
+	return t.listener.Addr()
+}
+
+// tlsPeerConn is the PeerConn of a TLSStreamLayer
+type tlsPeerConn struct {
+	*tls.Conn
+	verify PeerVerifier
+}
+
+// RemotePubKeyHex implements the PeerConn interface.
+func (c *tlsPeerConn) RemotePubKeyHex() (string, error) {
+	if err := c.Handshake(); err != nil {
+		return "", err
+	}
+
+	certs := c.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", errNoCertificate
+	}
+	return certificatePubKeyHex(certs[0])
+}
+
+// IsPeer implements the PeerConn interface.
+func (c *tlsPeerConn) IsPeer() bool {
+	pubKeyHex, err := c.RemotePubKeyHex()
+	if err != nil {
+		return false
+	}
+	return c.verify(pubKeyHex, "")
+}
+
+// NewTLSTransport returns a NetworkTransport that is built on top of a
+// TLSStreamLayer, with log output going to the supplied Logger
+func NewTLSTransport(
+	bindAddr string,
+	advertise net.Addr,
+	maxPool int,
+	timeout time.Duration,
+	key *ecdsa.PrivateKey,
+	verify PeerVerifier,
+	logger *logrus.Logger,
+) (*NetworkTransport, error) {
+	stream, err := NewTLSStreamLayer(bindAddr, advertise, key, verify)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewNetworkTransport(stream, maxPool, timeout, logger), nil
+}
+
+// selfSignedCertificate creates a certificate for the public key of an ECDSA
+// key, signed by the key itself
+func selfSignedCertificate(key *ecdsa.PrivateKey) (tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "babble"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// certificatePubKeyHex returns the public key of a certificate, in the
+// PubKeyHex format of Peers
+func certificatePubKeyHex(cert *x509.Certificate) (string, error) {
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return "", fmt.Errorf("Remote certificate does not have a P-256 ECDSA key")
+	}
+
+	return fmt.Sprintf("0x%X", crypto.FromECDSAPub(pub)), nil
+}
@@ -0,0 +1,139 @@
+package net
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/crypto"
+)
+
+func acceptAll(pubKeyHex string, netAddr string) bool {
+	return true
+}
+
+// acceptKeys returns a PeerVerifier that only accepts the public keys of keys
+func acceptKeys(keys ...*ecdsa.PrivateKey) PeerVerifier {
+	accepted := make(map[string]bool)
+	for _, k := range keys {
+		accepted[fmt.Sprintf("0x%X", crypto.FromECDSAPub(&k.PublicKey))] = true
+	}
+	return func(pubKeyHex string, netAddr string) bool {
+		return accepted[pubKeyHex]
+	}
+}
+
+// acceptPeer returns a PeerVerifier that only accepts the public key of key,
+// and only at netAddr when dialing
+func acceptPeer(key *ecdsa.PrivateKey, netAddr string) PeerVerifier {
+	accepted := acceptKeys(key)
+	return func(pubKeyHex string, addr string) bool {
+		return accepted(pubKeyHex, addr) && (addr == "" || addr == netAddr)
+	}
+}
+
+func newTestTLSTransport(addr string, verify PeerVerifier, t *testing.T) (*NetworkTransport, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans, err := NewTLSTransport(addr, nil, 2, time.Second, key, verify, common.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trans, key
+}
+
+func TestTLSTransport_BadAddr(t *testing.T) {
+	key, err := crypto.GenerateECDSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewTLSTransport("0.0.0.0:0", nil, 1, 0, key, acceptAll, common.NewTestLogger(t))
+	if err != errNotAdvertisable {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestTLSTransport_UnknownPeer(t *testing.T) {
+	trans1, _ := newTestTLSTransport("127.0.0.1:0", acceptAll, t)
+	defer trans1.Close()
+
+	// trans2 does not accept the key of trans1
+	trans2, _ := newTestTLSTransport("127.0.0.1:0", acceptKeys(), t)
+	defer trans2.Close()
+
+	var out SyncResponse
+	err := trans2.Sync(trans1.LocalAddr(), &SyncRequest{}, &out)
+	if err == nil || !strings.Contains(err.Error(), "not the key of a peer") {
+		t.Fatalf("Dialing a node that is not a peer should fail, not return %v", err)
+	}
+}
+
+func TestTLSTransport_WrongAddress(t *testing.T) {
+	trans1, key1 := newTestTLSTransport("127.0.0.1:0", acceptAll, t)
+	defer trans1.Close()
+
+	rpcCh := trans1.Consumer()
+	go func() {
+		for rpc := range rpcCh {
+			rpc.Respond(&SyncResponse{FromID: 1}, nil)
+		}
+	}()
+
+	// trans1 is a peer, but registered at another address
+	trans2, _ := newTestTLSTransport("127.0.0.1:0", acceptPeer(key1, "127.0.0.1:1"), t)
+	defer trans2.Close()
+
+	var out SyncResponse
+	err := trans2.Sync(trans1.LocalAddr(), &SyncRequest{}, &out)
+	if err == nil || !strings.Contains(err.Error(), "not the key of a peer") {
+		t.Fatalf("Dialing a peer at an address it is not registered at should fail, not return %v", err)
+	}
+
+	trans3, _ := newTestTLSTransport("127.0.0.1:0", acceptPeer(key1, trans1.LocalAddr()), t)
+	defer trans3.Close()
+
+	if err := trans3.Sync(trans1.LocalAddr(), &SyncRequest{}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.FromID != 1 {
+		t.Fatalf("SyncResponse should come from 1, not %d", out.FromID)
+	}
+}
+
+func TestTLSTransport_NonPeerCanOnlyJoin(t *testing.T) {
+	// trans1 does not accept the key of trans2, which accepts the key of trans1
+	trans1, key1 := newTestTLSTransport("127.0.0.1:0", acceptKeys(), t)
+	defer trans1.Close()
+
+	trans2, _ := newTestTLSTransport("127.0.0.1:0", acceptKeys(key1), t)
+	defer trans2.Close()
+
+	rpcCh := trans1.Consumer()
+	go func() {
+		for rpc := range rpcCh {
+			if _, ok := rpc.Command.(*JoinRequest); !ok {
+				t.Errorf("Request %T should not be served", rpc.Command)
+			}
+			rpc.Respond(&JoinResponse{FromID: 1, Accepted: true}, nil)
+		}
+	}()
+
+	var syncResp SyncResponse
+	err := trans2.Sync(trans1.LocalAddr(), &SyncRequest{SignedHeader: SignedHeader{FromID: 2}}, &syncResp)
+	if err == nil || !strings.Contains(err.Error(), "is not a peer") {
+		t.Fatalf("SyncRequest from a node that is not a peer should fail, not return %v", err)
+	}
+
+	var joinResp JoinResponse
+	if err := trans2.Join(trans1.LocalAddr(), &JoinRequest{}, &joinResp); err != nil {
+		t.Fatal(err)
+	}
+	if !joinResp.Accepted {
+		t.Fatalf("JoinResponse should be accepted")
+	}
+}
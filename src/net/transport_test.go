@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/crypto"
 	"github.com/mosaicnetworks/babble/src/hashgraph"
 	"github.com/mosaicnetworks/babble/src/peers"
 )
@@ -13,6 +14,8 @@ import (
 const (
 	INMEM = iota
 	TCP
+	TLS
+	MSGPACK
 	numTestTransports // NOTE: must be last
 )
 
@@ -27,6 +30,26 @@ func NewTestTransport(ttype int, addr string, t *testing.T) Transport {
 			t.Fatal(err)
 		}
 		return tt
+	case TLS:
+		key, err := crypto.GenerateECDSAKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Bind any port, because the TCP transports of a test are only closed
+		// when it returns
+		tt, err := NewTLSTransport("127.0.0.1:0", nil, 2, time.Second, key, acceptAll, common.NewTestLogger(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tt
+	case MSGPACK:
+		// Bind any port, like TLS
+		tt, err := NewTCPTransport("127.0.0.1:0", nil, 2, time.Second, common.NewTestLogger(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.SetCodec(MsgpackCodec)
+		return tt
 	default:
 		panic("Unknown transport type")
 	}
@@ -51,7 +74,6 @@ func TestTransport_Sync(t *testing.T) {
 
 		// Make the RPC request
 		args := SyncRequest{
-			FromID: 0,
 			Known: map[uint32]int{
 				0: 1,
 				1: 2,
@@ -129,7 +151,6 @@ func TestTransport_EagerSync(t *testing.T) {
 
 		// Make the RPC request
 		args := EagerSyncRequest{
-			FromID: 0,
 			Events: []hashgraph.WireEvent{
 				hashgraph.WireEvent{
 					Body: hashgraph.WireBody{
@@ -220,6 +241,7 @@ func TestTransport_FastForward(t *testing.T) {
 						[]byte("tx1"),
 						[]byte("tx2"),
 					},
+					nil,
 					[]hashgraph.BlockSignature{
 						hashgraph.BlockSignature{
 							[]byte("pub1"),
@@ -265,9 +287,7 @@ func TestTransport_FastForward(t *testing.T) {
 
 		// Make the RPC request and response
 
-		args := FastForwardRequest{
-			FromID: 0,
-		}
+		args := FastForwardRequest{}
 		resp := FastForwardResponse{
 			FromID:   1,
 			Block:    unmarshalledBlock,
@@ -0,0 +1,175 @@
+package node
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+)
+
+/*
+Misbehaviour turns a node into an adversary, to test that honest nodes still
+reach consensus in its presence. The Core consults it every time it would act
+honestly: when it sends Events to a peer, after it pushes Events to a peer, and
+when it signs a Block. Its methods are called with the coreLock held. The
+default is Honest.
+*/
+type Misbehaviour interface {
+	//Events is called with the WireEvents that the node is about to send to
+	//peer, in a SyncResponse or an EagerSyncRequest, and returns the WireEvents
+	//that are actually sent
+	Events(core *Core, peer uint32, events []hg.WireEvent) []hg.WireEvent
+
+	//Replays is called after the node pushed events to peer in an
+	//EagerSyncRequest, and returns the Events of additional EagerSyncRequests
+	//to send to the same peer
+	Replays(peer uint32, events []hg.WireEvent) [][]hg.WireEvent
+
+	//SignBlock reports whether the node signs the Block it just committed
+	SignBlock(block *hg.Block) bool
+}
+
+//Honest is the Misbehaviour of honest nodes. Adversaries embed it and only
+//override the methods they need.
+type Honest struct{}
+
+func (Honest) Events(core *Core, peer uint32, events []hg.WireEvent) []hg.WireEvent {
+	return events
+}
+
+func (Honest) Replays(peer uint32, events []hg.WireEvent) [][]hg.WireEvent {
+	return nil
+}
+
+func (Honest) SignBlock(block *hg.Block) bool {
+	return true
+}
+
+//Forker sends its victims a conflicting twin of its latest self-Event, after
+//the genuine one. The victims detect the fork and gossip the ForkProof.
+type Forker struct {
+	Honest
+	Victims []uint32
+}
+
+func (f *Forker) Events(core *Core, peer uint32, events []hg.WireEvent) []hg.WireEvent {
+	if !containsID(f.Victims, peer) {
+		return events
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Body.CreatorID != core.id {
+			continue
+		}
+
+		twin, err := core.hg.ReadWireInfo(events[i])
+		if err != nil {
+			core.logger.WithError(err).Error("Forker: ReadWireInfo")
+			return events
+		}
+
+		twin.Body.Transactions = append([][]byte{[]byte("fork")}, twin.Body.Transactions...)
+		if err := twin.Sign(core.key); err != nil {
+			core.logger.WithError(err).Error("Forker: Sign")
+			return events
+		}
+
+		return append(events, twin.ToWire())
+	}
+
+	return events
+}
+
+//Withholder never sends Events to its victims
+type Withholder struct {
+	Honest
+	Victims []uint32
+}
+
+func (w *Withholder) Events(core *Core, peer uint32, events []hg.WireEvent) []hg.WireEvent {
+	if containsID(w.Victims, peer) {
+		return []hg.WireEvent{}
+	}
+	return events
+}
+
+//SignatureForger replaces the signatures of its own Events with signatures
+//from another key
+type SignatureForger struct {
+	Honest
+	key *ecdsa.PrivateKey
+}
+
+func (s *SignatureForger) Events(core *Core, peer uint32, events []hg.WireEvent) []hg.WireEvent {
+	if s.key == nil {
+		key, err := crypto.GenerateECDSAKey()
+		if err != nil {
+			core.logger.WithError(err).Error("SignatureForger: GenerateECDSAKey")
+			return events
+		}
+		s.key = key
+	}
+
+	forged := make([]hg.WireEvent, len(events))
+	for i, we := range events {
+		forged[i] = we
+
+		if we.Body.CreatorID != core.id {
+			continue
+		}
+
+		ev, err := core.hg.ReadWireInfo(we)
+		if err != nil {
+			core.logger.WithError(err).Error("SignatureForger: ReadWireInfo")
+			continue
+		}
+
+		if err := ev.Sign(s.key); err != nil {
+			core.logger.WithError(err).Error("SignatureForger: Sign")
+			continue
+		}
+
+		forged[i].Signature = ev.Signature
+	}
+
+	return forged
+}
+
+//Replayer sends every peer, after each EagerSyncRequest, the Events of the
+//previous EagerSyncRequest it sent to that peer
+type Replayer struct {
+	Honest
+	sent map[uint32][]hg.WireEvent
+}
+
+func (r *Replayer) Replays(peer uint32, events []hg.WireEvent) [][]hg.WireEvent {
+	if r.sent == nil {
+		r.sent = make(map[uint32][]hg.WireEvent)
+	}
+
+	previous, ok := r.sent[peer]
+	r.sent[peer] = events
+
+	if !ok {
+		return nil
+	}
+	return [][]hg.WireEvent{previous}
+}
+
+//SilentSigner commits Blocks but never signs them
+type SilentSigner struct {
+	Honest
+}
+
+func (SilentSigner) SignBlock(block *hg.Block) bool {
+	return false
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
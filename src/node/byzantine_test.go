@@ -0,0 +1,152 @@
+package node
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/crypto"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/net"
+	"github.com/mosaicnetworks/babble/src/peers"
+	dummy "github.com/mosaicnetworks/babble/src/proxy/dummy"
+	"github.com/sirupsen/logrus"
+)
+
+//initInmemNodes creates nodes connected by InmemTransports
+func initInmemNodes(keys []*ecdsa.PrivateKey, peerSet *peers.PeerSet, logger *logrus.Logger, t *testing.T) []*Node {
+	transports := make(map[string]*net.InmemTransport)
+	for _, p := range peerSet.Peers {
+		_, trans := net.NewInmemTransport(p.NetAddr)
+		transports[p.NetAddr] = trans
+	}
+
+	for addr1, t1 := range transports {
+		for addr2, t2 := range transports {
+			if addr1 != addr2 {
+				t1.Connect(addr2, t2)
+			}
+		}
+	}
+
+	nodes := []*Node{}
+	for _, k := range keys {
+		peer := peerSet.ByPubKey[fmt.Sprintf("0x%X", crypto.FromECDSAPub(&k.PublicKey))]
+
+		conf := NewConfig(5*time.Millisecond, time.Second, 1000, 1000, logger)
+
+		node := NewNode(conf,
+			peer.ID(),
+			k,
+			peerSet,
+			hg.NewInmemStore(conf.CacheSize),
+			transports[peer.NetAddr],
+			dummy.NewInmemDummyClient(logger))
+
+		if err := node.Init(); err != nil {
+			t.Fatalf("failed to initialize node%d: %s", peer.ID(), err)
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+//runAdversaries runs numNodes nodes, of which the first ones misbehave, and
+//checks that the honest ones commit the same Blocks
+func runAdversaries(t *testing.T, numNodes int, misbehaviours func(nodes []*Node) []Misbehaviour) []*Node {
+	logger := common.NewTestLogger(t)
+	logger.Level = logrus.WarnLevel
+
+	keys, peerSet := initPeers(numNodes)
+	nodes := initInmemNodes(keys, peerSet, logger, t)
+	defer shutdownNodes(nodes)
+
+	adversaries := misbehaviours(nodes)
+	if 3*len(adversaries) >= numNodes {
+		t.Fatalf("%d adversaries out of %d nodes", len(adversaries), numNodes)
+	}
+
+	for i, m := range adversaries {
+		nodes[i].SetMisbehaviour(m)
+	}
+
+	honest := nodes[len(adversaries):]
+
+	runNodes(nodes, true)
+	if err := bombardAndWait(honest, 10, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	checkGossip(honest, 0, t)
+
+	return nodes
+}
+
+func victims(nodes []*Node) []uint32 {
+	return []uint32{nodes[1].ID(), nodes[2].ID()}
+}
+
+func TestByzantineForker(t *testing.T) {
+	nodes := runAdversaries(t, 4, func(nodes []*Node) []Misbehaviour {
+		return []Misbehaviour{&Forker{Victims: victims(nodes)}}
+	})
+
+	forkProofs := 0
+	for _, n := range nodes[1:] {
+		proofs, err := n.GetForkProofs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		forkProofs += len(proofs)
+	}
+
+	if forkProofs == 0 {
+		t.Fatal("Honest nodes should have detected the forks")
+	}
+}
+
+func TestByzantineWithholder(t *testing.T) {
+	runAdversaries(t, 4, func(nodes []*Node) []Misbehaviour {
+		return []Misbehaviour{&Withholder{Victims: victims(nodes)}}
+	})
+}
+
+func TestByzantineSignatureForger(t *testing.T) {
+	runAdversaries(t, 4, func(nodes []*Node) []Misbehaviour {
+		return []Misbehaviour{&SignatureForger{}}
+	})
+}
+
+func TestByzantineReplayer(t *testing.T) {
+	runAdversaries(t, 4, func(nodes []*Node) []Misbehaviour {
+		return []Misbehaviour{&Replayer{}}
+	})
+}
+
+func TestByzantineSilentSigner(t *testing.T) {
+	nodes := runAdversaries(t, 4, func(nodes []*Node) []Misbehaviour {
+		return []Misbehaviour{SilentSigner{}}
+	})
+
+	block, err := nodes[1].GetBlock(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := block.Signatures[nodes[0].core.HexID()]; ok {
+		t.Fatal("SilentSigner should not have signed Block 10")
+	}
+}
+
+func TestByzantineMixed(t *testing.T) {
+	runAdversaries(t, 7, func(nodes []*Node) []Misbehaviour {
+		return []Misbehaviour{
+			&Forker{Victims: []uint32{nodes[2].ID(), nodes[3].ID()}},
+			&SignatureForger{},
+		}
+	})
+}
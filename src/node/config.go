@@ -5,15 +5,27 @@ import (
 	"time"
 
 	"github.com/mosaicnetworks/babble/src/common"
+	"github.com/mosaicnetworks/babble/src/net"
 	"github.com/sirupsen/logrus"
 )
 
 type Config struct {
-	HeartbeatTimeout time.Duration `mapstructure:"heartbeat"`
-	TCPTimeout       time.Duration `mapstructure:"timeout"`
-	CacheSize        int           `mapstructure:"cache-size"`
-	SyncLimit        int           `mapstructure:"sync-limit"`
-	Logger           *logrus.Logger
+	HeartbeatTimeout     time.Duration `mapstructure:"heartbeat"`
+	TCPTimeout           time.Duration `mapstructure:"timeout"`
+	CacheSize            int           `mapstructure:"cache-size"`
+	SyncLimit            int           `mapstructure:"sync-limit"`
+	JoinTimeout          time.Duration `mapstructure:"join-timeout"`
+	RetainRounds         int           `mapstructure:"retain-rounds"`   //rounds kept below the AnchorBlock. 0 disables pruning
+	MaxBlockTransactions int           `mapstructure:"max-block-txs"`   //transactions per Block. 0 means no limit. Must be the same on all peers
+	MaxBlockBytes        int           `mapstructure:"max-block-bytes"` //bytes of transactions per Block. 0 means no limit. Must be the same on all peers
+	MaxTxBytes           int           `mapstructure:"max-tx-bytes"`    //size of a single transaction. 0 means no limit. Must be the same on all peers
+	TxPoolSize           int           `mapstructure:"tx-pool-size"`    //transactions waiting to be included in an Event. 0 means no limit. Must be the same on all peers
+	TxPoolBytes          int           `mapstructure:"tx-pool-bytes"`   //bytes of transactions waiting to be included in an Event. 0 means no limit. Must be the same on all peers
+	TimerFactory         TimerFactory  `mapstructure:"-"`               //replaces the ControlTimer's randomized wall-clock timeouts if set
+	Logger               *logrus.Logger
+
+	//Clock replaces time.Now for the timestamps of Events if set
+	Clock func() time.Time `mapstructure:"-"`
 }
 
 func NewConfig(heartbeat time.Duration,
@@ -27,6 +39,7 @@ func NewConfig(heartbeat time.Duration,
 		TCPTimeout:       timeout,
 		CacheSize:        cacheSize,
 		SyncLimit:        syncLimit,
+		JoinTimeout:      net.DefaultJoinTimeout,
 		Logger:           logger,
 	}
 }
@@ -40,6 +53,7 @@ func DefaultConfig() *Config {
 		TCPTimeout:       1000 * time.Millisecond,
 		CacheSize:        5000,
 		SyncLimit:        1000,
+		JoinTimeout:      net.DefaultJoinTimeout,
 		Logger:           logger,
 	}
 }
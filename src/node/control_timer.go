@@ -5,10 +5,12 @@ import (
 	"time"
 )
 
-type timerFactory func(time.Duration) <-chan time.Time
+//TimerFactory returns a channel that receives the time once the given duration
+//has elapsed, like time.After
+type TimerFactory func(time.Duration) <-chan time.Time
 
 type ControlTimer struct {
-	timerFactory timerFactory
+	timerFactory TimerFactory
 	tickCh       chan struct{}      //sends a signal to listening process
 	resetCh      chan time.Duration //receives instruction to reset the heartbeatTimer
 	stopCh       chan struct{}      //receives instruction to stop the heartbeatTimer
@@ -16,7 +18,7 @@ type ControlTimer struct {
 	set          bool
 }
 
-func NewControlTimer(timerFactory timerFactory) *ControlTimer {
+func NewControlTimer(timerFactory TimerFactory) *ControlTimer {
 	return &ControlTimer{
 		timerFactory: timerFactory,
 		tickCh:       make(chan struct{}),
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/mosaicnetworks/babble/src/crypto"
 	hg "github.com/mosaicnetworks/babble/src/hashgraph"
@@ -43,11 +44,27 @@ type Core struct {
 	*/
 	heads map[uint32]*hg.Event
 
-	transactionPool     [][]byte
-	selfBlockSignatures *hg.SigPool
+	transactionPool         [][]byte
+	txPool                  *proxy.TxPool //accounts for the transactionPool and bounds the transactions of Events
+	internalTransactionPool []hg.InternalTransaction
+	selfBlockSignatures     *hg.SigPool
+
+	//promises are used to notify the callers of AddInternalTransaction when
+	//their InternalTransaction is committed. [tx hash] => promise
+	promises map[string]*InternalTransactionPromise
+
+	//leavingPeers are the peers whose removal was accepted, and when it was
+	//accepted. [id] => leavingPeer
+	leavingPeers map[uint32]leavingPeer
 
 	proxyCommitCallback proxy.CommitCallback
 
+	//misbehaviour makes the Core act as an adversary in tests
+	misbehaviour Misbehaviour
+
+	//clock gives the creator Timestamp of SelfEvents
+	clock func() time.Time
+
 	logger *logrus.Entry
 }
 
@@ -68,18 +85,23 @@ func NewCore(
 	peerSelector := NewRandomPeerSelector(peers, id)
 
 	core := &Core{
-		id:                  id,
-		key:                 key,
-		proxyCommitCallback: proxyCommitCallback,
-		peers:               peers,
-		peerSelector:        peerSelector,
-		transactionPool:     [][]byte{},
-		selfBlockSignatures: hg.NewSigPool(),
-		heads:               make(map[uint32]*hg.Event),
-		logger:              logEntry,
-		Head:                "",
-		Seq:                 -1,
-		AcceptedRound:       -1,
+		id:                      id,
+		key:                     key,
+		proxyCommitCallback:     proxyCommitCallback,
+		peers:                   peers,
+		peerSelector:            peerSelector,
+		transactionPool:         [][]byte{},
+		internalTransactionPool: []hg.InternalTransaction{},
+		selfBlockSignatures:     hg.NewSigPool(),
+		promises:                make(map[string]*InternalTransactionPromise),
+		leavingPeers:            make(map[uint32]leavingPeer),
+		heads:                   make(map[uint32]*hg.Event),
+		misbehaviour:            Honest{},
+		clock:                   time.Now,
+		logger:                  logEntry,
+		Head:                    "",
+		Seq:                     -1,
+		AcceptedRound:           -1,
 	}
 
 	core.hg = hg.NewHashgraph(store, core.Commit, logEntry)
@@ -160,21 +182,28 @@ func (c *Core) SetHeadAndSeq() error {
 	return nil
 }
 
-func (c *Core) Bootstrap() error {
-	return c.hg.Bootstrap()
+//Bootstrap loads the Hashgraph from the Store's DB. restoreCallback is used to
+//restore the application if the DB was pruned.
+func (c *Core) Bootstrap(restoreCallback hg.InternalRestoreCallback) error {
+	return c.hg.Bootstrap(restoreCallback)
 }
 
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
-func (c *Core) SignAndInsertSelfEvent(event *hg.Event) error {
+//SignAndInsertSelfEvent signs and inserts a SelfEvent, and reports whether it
+//was inserted. It is not inserted before the node reaches its AcceptedRound.
+func (c *Core) SignAndInsertSelfEvent(event *hg.Event) (bool, error) {
 	if c.hg.Store.LastRound() < c.AcceptedRound {
 		c.logger.Debugf("Too early to gossip (%d / %d)", c.hg.Store.LastRound(), c.AcceptedRound)
-		return nil
+		return false, nil
 	}
 	if err := event.Sign(c.key); err != nil {
-		return err
+		return false, err
 	}
-	return c.InsertEventAndRunConsensus(event, true)
+	if err := c.InsertEventAndRunConsensus(event, true); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func (c *Core) InsertEventAndRunConsensus(event *hg.Event, setWireInfo bool) error {
@@ -204,10 +233,26 @@ func (c *Core) Commit(block *hg.Block) error {
 		"err":        err,
 	}).Debug("CommitBlock Response")
 
-	//Handle the response to set Block StateHash and process accepted
-	//InternalTransactions which might update the PeerSet.
+	//Handle the response to set Block StateHash and receipts, and process
+	//accepted InternalTransactions which might update the PeerSet.
 	if err == nil {
 		block.Body.StateHash = commitResponse.StateHash
+		if len(commitResponse.InternalTransactionReceipts) > 0 {
+			block.Body.InternalTransactionReceipts = commitResponse.InternalTransactionReceipts
+		}
+
+		err = c.ProcessAcceptedInternalTransactions(block.RoundReceived(), commitResponse.InternalTransactionReceipts)
+		if err != nil {
+			return err
+		}
+
+		if !c.misbehaviour.SignBlock(block) {
+			//Save the StateHash without signing
+			if err := c.hg.Store.SetBlock(block); err != nil {
+				return err
+			}
+			return c.hg.SetAnchorBlock(block)
+		}
 
 		sig, err := c.SignBlock(block)
 		if err != nil {
@@ -225,6 +270,82 @@ func (c *Core) Commit(block *hg.Block) error {
 	return err
 }
 
+/*
+ProcessAcceptedInternalTransactions applies the InternalTransactions that were
+accepted by the application. The resulting PeerSet takes effect PEERSET_DELAY
+rounds after the round in which the InternalTransactions were received. It
+also resolves the corresponding promises, if any.
+*/
+func (c *Core) ProcessAcceptedInternalTransactions(roundReceived int, receipts []hg.InternalTransactionReceipt) error {
+	effectiveRound := roundReceived + hg.PEERSET_DELAY
+
+	for _, r := range receipts {
+		txBody := r.InternalTransaction.Body
+
+		if r.Accepted {
+			c.logger.WithFields(logrus.Fields{
+				"type":            txBody.Type.String(),
+				"peer":            txBody.Peer,
+				"round_received":  roundReceived,
+				"effective_round": effectiveRound,
+			}).Debug("Processing accepted InternalTransaction")
+
+			if txBody.Type != hg.PEER_ADD && txBody.Type != hg.PEER_REMOVE {
+				c.logger.WithField("type", txBody.Type.String()).Error("Unknown InternalTransaction type")
+			}
+		}
+	}
+
+	newPeers := hg.ApplyInternalTransactionReceipts(c.peers, receipts)
+	changed := newPeers != c.peers
+
+	if changed {
+		for _, peer := range c.peers.Peers {
+			if _, ok := newPeers.ByID[peer.ID()]; !ok {
+				c.leavingPeers[peer.ID()] = leavingPeer{peer: peer, removed: c.clock()}
+			}
+		}
+
+		//If the Round is already known, the hashgraph might have computed
+		//rounds with the wrong PeerSet.
+		if lastRound := c.hg.Store.LastRound(); lastRound >= effectiveRound {
+			c.logger.WithFields(logrus.Fields{
+				"last_round":      lastRound,
+				"effective_round": effectiveRound,
+			}).Warning("New PeerSet takes effect in a Round that is already known")
+		}
+
+		if err := c.hg.Store.SetPeerSet(effectiveRound, newPeers); err != nil {
+			return fmt.Errorf("Updating Store PeerSet: %s", err)
+		}
+
+		c.setPeers(newPeers)
+	}
+
+	for _, r := range receipts {
+		if p, ok := c.promises[r.InternalTransaction.HashString()]; ok {
+			p.Respond(r.Accepted, effectiveRound, newPeers.Peers)
+			delete(c.promises, r.InternalTransaction.HashString())
+		}
+	}
+
+	return nil
+}
+
+//SetMisbehaviour makes the Core act as an adversary; see Misbehaviour
+func (c *Core) SetMisbehaviour(m Misbehaviour) {
+	c.misbehaviour = m
+}
+
+//setPeers updates the Core's latest known PeerSet and PeerSelector
+func (c *Core) setPeers(peerSet *peers.PeerSet) {
+	c.peers = peerSet
+
+	c.selectorLock.Lock()
+	c.peerSelector = NewRandomPeerSelector(peerSet, c.id)
+	c.selectorLock.Unlock()
+}
+
 func (c *Core) SignBlock(block *hg.Block) (hg.BlockSignature, error) {
 	sig, err := block.Sign(c.key)
 	if err != nil {
@@ -271,7 +392,7 @@ func (c *Core) EventDiff(known map[uint32]int) (events []*hg.Event, err error) {
 	//compare this to our view of events and fill unknown with events that we know of
 	// and the other doesnt
 	for id, ct := range known {
-		peer, ok := c.peers.ByID[id]
+		peer, ok := c.hg.Store.RepertoireByID()[id]
 
 		if !ok {
 			continue
@@ -299,13 +420,24 @@ func (c *Core) EventDiff(known map[uint32]int) (events []*hg.Event, err error) {
 //expected to be in topoligical order.
 func (c *Core) Sync(fromID uint32, unknownEvents []hg.WireEvent) error {
 	c.logger.WithFields(logrus.Fields{
-		"unknown_events":      len(unknownEvents),
-		"transaction_pool":    len(c.transactionPool),
-		"self_signature_pool": c.selfBlockSignatures.Len(),
+		"unknown_events":            len(unknownEvents),
+		"transaction_pool":          len(c.transactionPool),
+		"internal_transaction_pool": len(c.internalTransactionPool),
+		"self_signature_pool":       c.selfBlockSignatures.Len(),
+		"fork_proofs":               len(c.hg.PendingForkProofs),
 	}).Debug("Sync")
 
 	var otherHead *hg.Event
 	for _, we := range unknownEvents {
+		if err := c.txPool.CheckEvent(we.Body.Transactions); err != nil {
+			c.logger.WithFields(logrus.Fields{
+				"creator": we.Body.CreatorID,
+				"index":   we.Body.Index,
+				"error":   err,
+			}).Error("Rejecting WireEvent")
+			return fmt.Errorf("WireEvent %d from %d rejected: %v", we.Body.Index, we.Body.CreatorID, err)
+		}
+
 		ev, err := c.hg.ReadWireInfo(we)
 		if err != nil {
 			c.logger.WithFields(logrus.Fields{
@@ -344,7 +476,9 @@ func (c *Core) Sync(fromID uint32, unknownEvents []hg.WireEvent) error {
 	//loaded events or the pools are not empty
 	if c.hg.PendingLoadedEvents > 0 ||
 		len(c.transactionPool) > 0 ||
-		c.selfBlockSignatures.Len() > 0 {
+		len(c.internalTransactionPool) > 0 ||
+		c.selfBlockSignatures.Len() > 0 ||
+		len(c.hg.PendingForkProofs) > 0 {
 
 		return c.RecordHeads()
 	}
@@ -376,23 +510,42 @@ func (c *Core) AddSelfEvent(otherHead string) error {
 	//create new event with self head and otherHead
 	//empty pools in its payload
 	newHead := hg.NewEvent(c.transactionPool,
+		c.internalTransactionPool,
 		sigs,
 		[]string{c.Head, otherHead},
 		c.PubKey(), c.Seq+1)
+	newHead.Body.Timestamp = c.clock().UTC()
+
+	//Add evidence of forks detected since the last self-Event
+	forkProofs := c.hg.PendingForkProofs
+	if len(forkProofs) > 0 {
+		newHead.Body.ForkProofs = forkProofs
+	}
 
-	if err := c.SignAndInsertSelfEvent(newHead); err != nil {
+	inserted, err := c.SignAndInsertSelfEvent(newHead)
+	if err != nil {
 		c.logger.WithError(err).Errorf("Error inserting new head")
 		return err
 	}
 
+	//Keep the pools for the next SelfEvent
+	if !inserted {
+		return nil
+	}
+
 	c.logger.WithFields(logrus.Fields{
 		"loaded_events":         c.hg.PendingLoadedEvents,
 		"transactions":          len(c.transactionPool),
+		"internal_transactions": len(c.internalTransactionPool),
 		"self_block_signatures": len(sigs),
+		"fork_proofs":           len(forkProofs),
 	}).Debug("Created Self-Event")
 
+	c.txPool.Release(c.transactionPool)
 	c.transactionPool = [][]byte{}
+	c.internalTransactionPool = []hg.InternalTransaction{}
 	c.selfBlockSignatures.RemoveSlice(sigs)
+	c.hg.PendingForkProofs = c.hg.PendingForkProofs[len(forkProofs):]
 
 	return nil
 }
@@ -426,9 +579,26 @@ func (c *Core) FastForward(peer string, block *hg.Block, frame *hg.Frame) error
 		return err
 	}
 
+	//Update the PeerSet with the latest one known to the Frame
+	c.setPeers(lastFramePeerSet(frame))
+
 	return nil
 }
 
+//lastFramePeerSet returns the PeerSet of the Frame's furthest future round,
+//or the Frame's own PeerSet if there are no future PeerSets.
+func lastFramePeerSet(frame *hg.Frame) *peers.PeerSet {
+	lastRound := frame.Round
+	lastPeers := frame.Peers
+	for r, ps := range frame.FuturePeerSets {
+		if r > lastRound {
+			lastRound = r
+			lastPeers = ps
+		}
+	}
+	return peers.NewPeerSet(lastPeers)
+}
+
 func (c *Core) FromWire(wireEvents []hg.WireEvent) ([]hg.Event, error) {
 	events := make([]hg.Event, len(wireEvents), len(wireEvents))
 
@@ -458,10 +628,92 @@ func (c *Core) ProcessSigPool() error {
 	return c.hg.ProcessSigPool()
 }
 
+//PruneBase returns the Block and Frame that should become the new base of the
+//Hashgraph to keep retainRounds rounds below the AnchorBlock, or nil if there is
+//nothing to prune
+func (c *Core) PruneBase(retainRounds int) (*hg.Block, *hg.Frame, error) {
+	return c.hg.PruneBase(retainRounds)
+}
+
+//Prune deletes the parts of the Hashgraph that are below the Block and Frame
+func (c *Core) Prune(block *hg.Block, frame *hg.Frame, snapshot []byte) error {
+	return c.hg.Prune(block, frame, snapshot)
+}
+
+//CheckpointBase returns the AnchorBlock if it should be recorded as the base
+//from which the Hashgraph is bootstrapped, or nil
+func (c *Core) CheckpointBase() (*hg.Block, error) {
+	return c.hg.CheckpointBase()
+}
+
+//Checkpoint records the Block and the application snapshot as the base from
+//which the Hashgraph is bootstrapped
+func (c *Core) Checkpoint(block *hg.Block, snapshot []byte) error {
+	return c.hg.Checkpoint(block, snapshot)
+}
+
+//SetTxPool sets the TxPool that accounts for the transactions added to the
+//Core, and whose limits are enforced on the Events received from peers
+func (c *Core) SetTxPool(pool *proxy.TxPool) {
+	c.txPool = pool
+}
+
+//leavingPeer is a peer that is not in the current PeerSet anymore, because its
+//removal was accepted
+type leavingPeer struct {
+	peer    *peers.Peer
+	removed time.Time
+}
+
+//getLeavingPeer returns a peer whose removal was accepted after since. The
+//leaving peer must keep gossiping until it has committed its own removal, which
+//can lag far behind the rest of the network, but only for a bounded time.
+func (c *Core) getLeavingPeer(id uint32, since time.Time) (*peers.Peer, bool) {
+	leaving, ok := c.leavingPeers[id]
+	if !ok {
+		return nil, false
+	}
+
+	if !leaving.removed.After(since) {
+		delete(c.leavingPeers, id)
+		return nil, false
+	}
+
+	return leaving.peer, true
+}
+
+//SetClock sets the clock that timestamps the SelfEvents
+func (c *Core) SetClock(clock func() time.Time) {
+	c.clock = clock
+}
+
 func (c *Core) AddTransactions(txs [][]byte) {
 	c.transactionPool = append(c.transactionPool, txs...)
 }
 
+//AddInternalTransaction adds an InternalTransaction to the pool, and returns
+//a promise which is resolved when the InternalTransaction is committed.
+func (c *Core) AddInternalTransaction(tx hg.InternalTransaction) *InternalTransactionPromise {
+	promise := NewInternalTransactionPromise(tx)
+
+	c.promises[tx.HashString()] = promise
+
+	c.internalTransactionPool = append(c.internalTransactionPool, tx)
+
+	return promise
+}
+
+//DropPromise forgets the promise of an InternalTransaction that nobody waits
+//for anymore. The InternalTransaction still goes through consensus. The promise
+//is kept if it was replaced by the promise of a new submission of the same
+//InternalTransaction.
+func (c *Core) DropPromise(promise *InternalTransactionPromise) {
+	key := promise.Tx.HashString()
+	if c.promises[key] == promise {
+		delete(c.promises, key)
+	}
+}
+
 func (c *Core) GetHead() (*hg.Event, error) {
 	return c.hg.Store.GetEvent(c.Head)
 }
@@ -42,12 +42,13 @@ func initCores(n int, t *testing.T) ([]*Core, map[uint32]*ecdsa.PrivateKey, map[
 
 		//Create and save the first Event
 		initialEvent := hg.NewEvent([][]byte(nil),
+			nil,
 			nil,
 			[]string{fmt.Sprintf("Root%d", peer.ID()), ""},
 			core.PubKey(),
 			0)
 
-		err := core.SignAndInsertSelfEvent(initialEvent)
+		_, err := core.SignAndInsertSelfEvent(initialEvent)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -82,6 +83,7 @@ func initHashgraph(cores []*Core, keys map[uint32]*ecdsa.PrivateKey, index map[s
 	}
 
 	event01 := hg.NewEvent([][]byte{},
+		nil,
 		nil,
 		[]string{index["e0"], index["e1"]}, //e0 and e1
 		cores[0].PubKey(), 1)
@@ -90,6 +92,7 @@ func initHashgraph(cores []*Core, keys map[uint32]*ecdsa.PrivateKey, index map[s
 	}
 
 	event20 := hg.NewEvent([][]byte{},
+		nil,
 		nil,
 		[]string{index["e2"], index["e01"]}, //e2 and e01
 		cores[2].PubKey(), 1)
@@ -98,6 +101,7 @@ func initHashgraph(cores []*Core, keys map[uint32]*ecdsa.PrivateKey, index map[s
 	}
 
 	event12 := hg.NewEvent([][]byte{},
+		nil,
 		nil,
 		[]string{index["e1"], index["e20"]}, //e1 and e20
 		cores[1].PubKey(), 1)
@@ -110,7 +114,7 @@ func insertEvent(cores []*Core, keys map[uint32]*ecdsa.PrivateKey, index map[str
 	event *hg.Event, name string, particant uint32, creator uint32) error {
 
 	if particant == creator {
-		if err := cores[particant].SignAndInsertSelfEvent(event); err != nil {
+		if _, err := cores[particant].SignAndInsertSelfEvent(event); err != nil {
 			return err
 		}
 		//event is not signed because passed by value
@@ -426,6 +430,187 @@ func TestOverSyncLimit(t *testing.T) {
 
 }
 
+func TestDropPromise(t *testing.T) {
+	cores, _, _ := initCores(1, t)
+	core := cores[0]
+
+	tx := hg.NewInternalTransactionJoin(*peers.NewPeer("0xABCDEF", "addr"))
+
+	first := core.AddInternalTransaction(tx)
+	second := core.AddInternalTransaction(tx)
+
+	//The first promise was replaced, so dropping it keeps the second one
+	core.DropPromise(first)
+	if core.promises[tx.HashString()] != second {
+		t.Fatalf("DropPromise should keep the promise of the last submission")
+	}
+
+	core.DropPromise(second)
+	if len(core.promises) != 0 {
+		t.Fatalf("DropPromise should remove the promise, %d left", len(core.promises))
+	}
+}
+
+func TestJoinWeightFromReceipt(t *testing.T) {
+	cores, _, _ := initCores(1, t)
+	core := cores[0]
+
+	//The Weight chosen by the joining node is ignored
+	peer := peers.NewPeer("0xABCDEF", "addr")
+	peer.Weight = 100
+	tx := hg.NewInternalTransactionJoin(*peer)
+
+	err := core.ProcessAcceptedInternalTransactions(0, []hg.InternalTransactionReceipt{tx.AsAccepted()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := core.peers.ByPubKey[peer.PubKeyHex].Weight; w != 0 {
+		t.Fatalf("New peer should have no Weight, not %d", w)
+	}
+
+	//The Weight assigned by the application in its receipt is used
+	other := peers.NewPeer("0x123456", "addr2")
+	tx = hg.NewInternalTransactionJoin(*other)
+
+	err = core.ProcessAcceptedInternalTransactions(1, []hg.InternalTransactionReceipt{tx.AsAcceptedWithWeight(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := core.peers.ByPubKey[other.PubKeyHex].Weight; w != 5 {
+		t.Fatalf("New peer should have Weight 5, not %d", w)
+	}
+}
+
+func TestCommitRecordsReceipts(t *testing.T) {
+	cores, _, _ := initCores(1, t)
+	core := cores[0]
+
+	peer := peers.NewPeer("0xABCDEF", "addr")
+	tx := hg.NewInternalTransactionJoin(*peer)
+
+	core.proxyCommitCallback = func(block hg.Block) (proxy.CommitResponse, error) {
+		return proxy.CommitResponse{
+			StateHash:                   []byte("state"),
+			InternalTransactionReceipts: []hg.InternalTransactionReceipt{tx.AsAcceptedWithWeight(3)},
+		}, nil
+	}
+
+	block := hg.NewBlock(0, 1, []byte("framehash"), core.peers.Peers, [][]byte{}, []hg.InternalTransaction{tx})
+	if err := core.Commit(block); err != nil {
+		t.Fatal(err)
+	}
+
+	//The receipts are part of the signed BlockHeader, so that clients can
+	//derive the Weight of the new peer
+	receipts := block.InternalTransactionReceipts()
+	if len(receipts) != 1 || receipts[0].Weight != 3 {
+		t.Fatalf("Block should record the receipt with Weight 3, not %v", receipts)
+	}
+	if header := block.Header(); len(header.InternalTransactionReceipts) != 1 {
+		t.Fatalf("BlockHeader should contain the receipt")
+	}
+	sig, err := block.GetSignature(core.HexID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Body.InternalTransactionReceipts[0].Weight = 1
+	if ok, _ := block.Verify(sig); ok {
+		t.Fatalf("The signature of the Block should cover the receipts")
+	}
+}
+
+func TestSyncTxPool(t *testing.T) {
+	cores, _, _ := initCores(3, t)
+
+	payload := [][]byte{[]byte("tx 1"), []byte("tx 2"), []byte("tx 3")}
+
+	//The transactions of core 1 are accounted for until they are included in
+	//an Event
+	pool := proxy.NewTxPool(0, 3, 0)
+	cores[1].SetTxPool(pool)
+	for _, tx := range payload {
+		if err := pool.Admit(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := synchronizeCores(cores, 0, 1, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, bytes := pool.Len(); count != 0 || bytes != 0 {
+		t.Fatalf("TxPool should be empty, not %d transactions and %d bytes", count, bytes)
+	}
+
+	//core 0 rejects the Event of core 1, which has too many transactions
+	cores[0].SetTxPool(proxy.NewTxPool(0, 2, 0))
+	if err := synchronizeCores(cores, 1, 0, [][]byte{}); err == nil {
+		t.Fatal("Sync should reject an Event with too many transactions")
+	}
+
+	//core 2 has the same limits as core 1
+	cores[2].SetTxPool(proxy.NewTxPool(0, 3, 0))
+	if err := synchronizeCores(cores, 1, 2, [][]byte{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//A node that has not reached its AcceptedRound does not create SelfEvents, and
+//keeps its pools for the first SelfEvent it creates
+func TestAddSelfEventTooEarly(t *testing.T) {
+	cores, _, _ := initCores(2, t)
+	core := cores[0]
+
+	pool := proxy.NewTxPool(0, 1, 0)
+	core.SetTxPool(pool)
+	if err := pool.Admit([]byte("tx")); err != nil {
+		t.Fatal(err)
+	}
+	core.AddTransactions([][]byte{[]byte("tx")})
+	key, _ := crypto.GenerateECDSAKey()
+	itx := hg.NewInternalTransactionJoin(*peers.NewPeer(fmt.Sprintf("0x%X", crypto.FromECDSAPub(&key.PublicKey)), "addr"))
+	if err := itx.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	core.AddInternalTransaction(itx)
+
+	seq := core.Seq
+	core.AcceptedRound = 10
+	if err := core.AddSelfEvent(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if core.Seq != seq {
+		t.Fatalf("No SelfEvent should be created before the AcceptedRound")
+	}
+	if len(core.transactionPool) != 1 || len(core.internalTransactionPool) != 1 {
+		t.Fatalf("The pools should be kept, not %d transactions and %d internal transactions",
+			len(core.transactionPool), len(core.internalTransactionPool))
+	}
+	if count, _ := pool.Len(); count != 1 {
+		t.Fatalf("The TxPool should still account for the transaction, not %d", count)
+	}
+
+	core.AcceptedRound = -1
+	if err := core.AddSelfEvent(""); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := core.GetHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if core.Seq != seq+1 || len(head.Transactions()) != 1 || len(head.InternalTransactions()) != 1 {
+		t.Fatalf("The SelfEvent should carry the pools")
+	}
+	if len(core.transactionPool) != 0 || len(core.internalTransactionPool) != 0 {
+		t.Fatalf("The pools should be empty after the SelfEvent")
+	}
+	if count, _ := pool.Len(); count != 0 {
+		t.Fatalf("The TxPool should be empty, not %d", count)
+	}
+}
+
 /*
     |   |   |   |-----------------
 	|   w31 |   | R3
@@ -6,6 +6,7 @@ import (
 
 type Infos struct {
 	ParticipantEvents map[string]map[string]*hg.Event
+	FirstRound        int //index of Rounds[0]
 	Rounds            []*hg.RoundInfo
 	Blocks            []*hg.Block
 }
@@ -35,6 +36,7 @@ func (g *Graph) GetParticipantEvents() (map[string]map[string]*hg.Event, error)
 
 		res[p.PubKeyHex][root.Head] = hg.NewEvent(
 			[][]byte{},
+			nil,
 			[]hg.BlockSignature{},
 			[]string{},
 			[]byte{},
@@ -56,26 +58,30 @@ func (g *Graph) GetParticipantEvents() (map[string]map[string]*hg.Event, error)
 	return res, nil
 }
 
-func (g *Graph) GetRounds() []*hg.RoundInfo {
-	res := []*hg.RoundInfo{}
-
-	round := 0
-
+//GetRounds returns the Rounds that are still in the Store, and the index of the
+//first one. Rounds below a pruning base, or below the Frame that a node was
+//bootstrapped from, are gone, so it walks down from the last Round.
+func (g *Graph) GetRounds() (int, []*hg.RoundInfo) {
 	store := g.Node.core.hg.Store
 
-	for round <= store.LastRound() {
-		r, err := store.GetRound(round)
+	round := store.LastRound()
+	for round >= 0 {
+		if _, err := store.GetRound(round); err != nil {
+			break
+		}
+		round--
+	}
 
+	res := []*hg.RoundInfo{}
+	for r := round + 1; r <= store.LastRound(); r++ {
+		info, err := store.GetRound(r)
 		if err != nil {
 			break
 		}
-
-		res = append(res, r)
-
-		round++
+		res = append(res, info)
 	}
 
-	return res
+	return round + 1, res
 }
 
 func (g *Graph) GetBlocks() []*hg.Block {
@@ -106,9 +112,12 @@ func (g *Graph) GetInfos() (Infos, error) {
 		return Infos{}, err
 	}
 
+	firstRound, rounds := g.GetRounds()
+
 	return Infos{
 		ParticipantEvents: participantEvents,
-		Rounds:            g.GetRounds(),
+		FirstRound:        firstRound,
+		Rounds:            rounds,
 		Blocks:            g.GetBlocks(),
 	}, nil
 }
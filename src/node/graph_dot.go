@@ -0,0 +1,204 @@
+package node
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+//eventInfo is what the Rounds of an Infos say about an Event
+type eventInfo struct {
+	round         int
+	roundReceived int
+	witness       bool
+	famous        hg.Trilean
+}
+
+//eventInfos maps Event hashes to the Round that created them and the Round
+//that received them. Rounds[0] is Round FirstRound.
+func (i Infos) eventInfos() map[string]*eventInfo {
+	res := make(map[string]*eventInfo)
+
+	get := func(hash string) *eventInfo {
+		info, ok := res[hash]
+		if !ok {
+			info = &eventInfo{round: -1, roundReceived: -1}
+			res[hash] = info
+		}
+		return info
+	}
+
+	for n, round := range i.Rounds {
+		if round == nil {
+			continue
+		}
+		r := i.FirstRound + n
+
+		for hash, re := range round.CreatedEvents {
+			info := get(hash)
+			info.round = r
+			info.witness = re.Witness
+			info.famous = re.Famous
+		}
+
+		for _, hash := range round.ReceivedEvents {
+			get(hash).roundReceived = r
+		}
+	}
+
+	return res
+}
+
+/*
+FilterRounds returns a copy of the Infos that only contains the Events created
+in the Rounds from to to, included, and the Blocks received in those Rounds. A
+negative to means no upper bound. Events whose Round is not known yet are only
+kept if there is no upper bound. The Rounds are kept, so that the Events can
+still be annotated.
+*/
+func (i Infos) FilterRounds(from, to int) Infos {
+	infos := i.eventInfos()
+
+	inRange := func(round int) bool {
+		return round >= from && (to < 0 || round <= to)
+	}
+
+	res := Infos{
+		ParticipantEvents: make(map[string]map[string]*hg.Event),
+		FirstRound:        i.FirstRound,
+		Rounds:            i.Rounds,
+		Blocks:            []*hg.Block{},
+	}
+
+	for p, events := range i.ParticipantEvents {
+		res.ParticipantEvents[p] = make(map[string]*hg.Event)
+		for hash, event := range events {
+			info, ok := infos[hash]
+			if (ok && info.round >= 0 && inRange(info.round)) ||
+				((!ok || info.round < 0) && to < 0) {
+				res.ParticipantEvents[p][hash] = event
+			}
+		}
+	}
+
+	for _, block := range i.Blocks {
+		if inRange(block.RoundReceived()) {
+			res.Blocks = append(res.Blocks, block)
+		}
+	}
+
+	return res
+}
+
+/*
+WriteDot draws the Events of the Infos in Graphviz DOT format. Each participant
+gets a column, labelled with its ID, where Events are nodes labelled with their
+index, their round, and their round-received. Witnesses are coloured according
+to their fame. Self-parent edges are solid and other-parent edges are dashed;
+edges to Events that are not in the Infos are left out.
+*/
+func (i Infos) WriteDot(w io.Writer) error {
+	infos := i.eventInfos()
+
+	buf := bufio.NewWriter(w)
+
+	fmt.Fprintln(buf, "digraph hashgraph {")
+	fmt.Fprintln(buf, "\trankdir=BT;")
+	fmt.Fprintln(buf, "\tnode [shape=box, style=\"rounded,filled\", fillcolor=white, fontname=monospace];")
+
+	participants := make([]string, 0, len(i.ParticipantEvents))
+	for p := range i.ParticipantEvents {
+		participants = append(participants, p)
+	}
+	sort.Strings(participants)
+
+	edges := []string{}
+	for n, p := range participants {
+		events := []*hg.Event{}
+		hashes := make(map[*hg.Event]string)
+		for hash, event := range i.ParticipantEvents[p] {
+			//Skip the placeholders of Roots, which are not real Events
+			if event.Index() < 0 {
+				continue
+			}
+			events = append(events, event)
+			hashes[event] = hash
+		}
+		sort.Slice(events, func(a, b int) bool {
+			return events[a].Index() < events[b].Index()
+		})
+
+		fmt.Fprintf(buf, "\tsubgraph cluster_%d {\n", n)
+		fmt.Fprintf(buf, "\t\tlabel=\"%d\";\n", peers.NewPeer(p, "").ID())
+		fmt.Fprintln(buf, "\t\tstyle=invis;")
+
+		for _, event := range events {
+			hash := hashes[event]
+
+			round, roundReceived := "?", "?"
+			color := "white"
+			if info, ok := infos[hash]; ok {
+				if info.round >= 0 {
+					round = fmt.Sprintf("%d", info.round)
+				}
+				if info.roundReceived >= 0 {
+					roundReceived = fmt.Sprintf("%d", info.roundReceived)
+				}
+				color = witnessColor(info)
+			}
+
+			fmt.Fprintf(buf, "\t\t\"%s\" [label=\"%d\\nr=%s rr=%s\", fillcolor=%s];\n",
+				hash,
+				event.Index(),
+				round,
+				roundReceived,
+				color)
+
+			if sp := event.SelfParent(); i.hasEvent(sp) {
+				edges = append(edges, fmt.Sprintf("\t\"%s\" -> \"%s\";", hash, sp))
+			}
+			if op := event.OtherParent(); op != "" && i.hasEvent(op) {
+				edges = append(edges, fmt.Sprintf("\t\"%s\" -> \"%s\" [style=dashed];", hash, op))
+			}
+		}
+
+		fmt.Fprintln(buf, "\t}")
+	}
+
+	for _, e := range edges {
+		fmt.Fprintln(buf, e)
+	}
+
+	fmt.Fprintln(buf, "}")
+
+	return buf.Flush()
+}
+
+//hasEvent reports whether the Infos contain a real Event with that hash
+func (i Infos) hasEvent(hash string) bool {
+	for _, events := range i.ParticipantEvents {
+		if event, ok := events[hash]; ok {
+			return event.Index() >= 0
+		}
+	}
+	return false
+}
+
+func witnessColor(info *eventInfo) string {
+	if !info.witness {
+		return "white"
+	}
+
+	switch info.famous {
+	case hg.True:
+		return "gold"
+	case hg.False:
+		return "gray"
+	default:
+		return "lightblue"
+	}
+}
@@ -38,6 +38,14 @@ type Node struct {
 	syncRequests int
 	syncErrors   int
 
+	//requestNonce is the nonce of the last signed request, and requests are
+	//the signed requests received recently
+	requestNonce uint32
+	requests     requestCache
+
+	//joinBackoff is the time to wait before retrying a failed JoinRequest
+	joinBackoff time.Duration
+
 	needBoostrap bool
 }
 
@@ -63,29 +71,54 @@ func NewNode(conf *Config,
 		controlTimer: NewRandomControlTimer(),
 	}
 
+	if conf.TimerFactory != nil {
+		node.controlTimer = NewControlTimer(conf.TimerFactory)
+	}
+
+	if conf.Clock != nil {
+		node.core.SetClock(conf.Clock)
+	}
+
+	node.core.hg.SetBlockLimits(conf.MaxBlockTransactions, conf.MaxBlockBytes)
+	node.core.SetTxPool(newTxPool(conf, proxy))
+
 	node.needBoostrap = store.NeedBoostrap()
 
 	return &node
 }
 
+//newTxPool creates the TxPool that bounds the transactions waiting to be
+//included in an Event, and shares it with the AppProxy if the AppProxy can
+//reject the transactions submitted by the App
+func newTxPool(conf *Config, appProxy proxy.AppProxy) *proxy.TxPool {
+	pool := proxy.NewTxPool(conf.MaxTxBytes, conf.TxPoolSize, conf.TxPoolBytes)
+
+	if p, ok := appProxy.(proxy.TxPoolProxy); ok {
+		p.SetTxPool(pool)
+	}
+
+	return pool
+}
+
 func (n *Node) Init() error {
 	if n.needBoostrap {
 		n.logger.Debug("Bootstrap")
 
-		if err := n.core.Bootstrap(); err != nil {
+		if err := n.core.Bootstrap(n.proxy.Restore); err != nil {
 			return err
 		}
 	}
 
-	if _, ok := n.core.peers.ByID[n.id]; !ok {
-		n.logger.Debug("Node does not belong to PeerSet => Shutdown")
-	}
-
 	if err := n.core.SetHeadAndSeq(); err != nil {
 		n.core.SetHeadAndSeq()
 	}
 
-	n.setState(Babbling)
+	if _, ok := n.core.peers.ByID[n.id]; !ok {
+		n.logger.Debug("Node does not belong to PeerSet => Joining")
+		n.setState(Joining)
+	} else {
+		n.setState(Babbling)
+	}
 
 	return nil
 }
@@ -117,6 +150,8 @@ func (n *Node) Run(gossip bool) {
 			n.babble(gossip)
 		case CatchingUp:
 			n.fastForward()
+		case Joining:
+			n.join()
 		case Shutdown:
 			return
 		}
@@ -128,17 +163,23 @@ func (n *Node) resetTimer() {
 	defer n.coreLock.Unlock()
 
 	if !n.controlTimer.set {
-		ts := n.conf.HeartbeatTimeout
-
-		//Slow gossip if nothing interesting to say
-		if n.core.hg.PendingLoadedEvents == 0 &&
-			len(n.core.transactionPool) == 0 &&
-			n.core.selfBlockSignatures.Len() == 0 {
-			ts = time.Duration(time.Second)
-		}
+		n.controlTimer.resetCh <- n.heartbeatTimeout()
+	}
+}
 
-		n.controlTimer.resetCh <- ts
+//heartbeatTimeout returns the time to wait before the next gossip. Callers
+//must hold the coreLock.
+func (n *Node) heartbeatTimeout() time.Duration {
+	//Slow gossip if nothing interesting to say
+	if n.core.hg.PendingLoadedEvents == 0 &&
+		len(n.core.transactionPool) == 0 &&
+		len(n.core.internalTransactionPool) == 0 &&
+		n.core.selfBlockSignatures.Len() == 0 &&
+		len(n.core.hg.PendingForkProofs) == 0 {
+		return time.Duration(time.Second)
 	}
+
+	return n.conf.HeartbeatTimeout
 }
 
 func (n *Node) doBackgroundWork() {
@@ -173,7 +214,9 @@ func (n *Node) babble(gossip bool) {
 		case <-n.controlTimer.tickCh:
 			if gossip {
 				n.logger.Debug("Time to gossip!")
+				n.core.selectorLock.Lock()
 				peer := n.core.peerSelector.Next()
+				n.core.selectorLock.Unlock()
 				if peer != nil {
 					n.goFunc(func() { n.gossip(peer, returnCh) })
 				} else {
@@ -189,6 +232,125 @@ func (n *Node) babble(gossip bool) {
 	}
 }
 
+/*
+Heartbeat does, in the calling goroutine, what the Run loop does when the
+ControlTimer ticks, with peer in place of the PeerSelector's choice: a Babbling
+node first adds the transactions waiting on the proxy's SubmitCh, and gossips
+with peer, or creates a self-Event if peer is nil; a CatchingUp node
+fast-forwards from peer. Together with NextHeartbeat and ProcessRPC, it allows
+a caller, like the simulation package, to drive the node without Run.
+*/
+func (n *Node) Heartbeat(peer *peers.Peer) error {
+	switch n.getState() {
+	case Babbling:
+		for pending := true; pending; {
+			select {
+			case t := <-n.submitCh:
+				n.addTransaction(t)
+			default:
+				pending = false
+			}
+		}
+
+		if peer == nil {
+			return n.monologue()
+		}
+
+		return n.gossip(peer, make(chan struct{}, 1))
+	case CatchingUp:
+		if peer == nil {
+			return fmt.Errorf("No peer to fast-forward from")
+		}
+
+		return n.fastForwardFrom(peer)
+	default:
+		return fmt.Errorf("Heartbeat not supported in state %s", n.getState())
+	}
+}
+
+//NextHeartbeat returns the channel on which the next Heartbeat is due. It is
+//obtained from the ControlTimer's TimerFactory, with the same timeout that the
+//Run loop would use.
+func (n *Node) NextHeartbeat() <-chan time.Time {
+	n.coreLock.Lock()
+	timeout := n.heartbeatTimeout()
+	n.coreLock.Unlock()
+
+	return n.controlTimer.timerFactory(timeout)
+}
+
+//join sends a JoinRequest to a random peer, and waits for the corresponding
+//InternalTransaction to go through consensus. If the request is accepted, the
+//node switches to the CatchingUp state, where it will fast-forward to the
+//top of the hashgraph. It only starts creating Events when it reaches the
+//AcceptedRound.
+func (n *Node) join() error {
+	n.logger.Debug("JOINING")
+
+	n.core.selectorLock.Lock()
+	peer := n.core.peerSelector.Next()
+	n.core.selectorLock.Unlock()
+
+	if peer == nil {
+		err := fmt.Errorf("No peer to send a JoinRequest to")
+		n.logger.Error(err)
+		n.waitJoinBackoff()
+		return err
+	}
+
+	start := time.Now()
+	resp, err := n.requestJoin(peer.NetAddr)
+	elapsed := time.Since(start)
+	n.logger.WithField("duration", elapsed.Nanoseconds()).Debug("requestJoin()")
+	if err != nil {
+		n.logger.WithField("error", err).Error("requestJoin()")
+		n.waitJoinBackoff()
+		return err
+	}
+
+	n.joinBackoff = 0
+
+	n.logger.WithFields(logrus.Fields{
+		"from_id":        resp.FromID,
+		"accepted":       resp.Accepted,
+		"accepted_round": resp.AcceptedRound,
+		"peers":          len(resp.Peers),
+	}).Debug("JoinResponse")
+
+	if !resp.Accepted {
+		n.logger.Debug("JoinRequest refused => Shutdown")
+		n.Shutdown()
+		return nil
+	}
+
+	n.coreLock.Lock()
+	n.core.AcceptedRound = resp.AcceptedRound
+	n.coreLock.Unlock()
+
+	n.setState(CatchingUp)
+
+	return nil
+}
+
+//waitJoinBackoff waits before the Run loop retries a failed JoinRequest. The
+//wait starts at the HeartbeatTimeout and doubles after every failure, up to the
+//JoinTimeout.
+func (n *Node) waitJoinBackoff() {
+	if n.joinBackoff == 0 {
+		n.joinBackoff = n.conf.HeartbeatTimeout
+	} else if n.joinBackoff *= 2; n.joinBackoff > n.conf.JoinTimeout {
+		n.joinBackoff = n.conf.JoinTimeout
+	}
+
+	timer := time.NewTimer(n.joinBackoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-n.shutdownCh:
+	}
+}
+
 func (n *Node) fastForward() error {
 	n.logger.Debug("CATCHING-UP")
 
@@ -196,10 +358,16 @@ func (n *Node) fastForward() error {
 	n.waitRoutines()
 
 	//fastForwardRequest
+	n.core.selectorLock.Lock()
 	peer := n.core.peerSelector.Next()
+	n.core.selectorLock.Unlock()
 
+	return n.fastForwardFrom(peer)
+}
+
+func (n *Node) fastForwardFrom(peer *peers.Peer) error {
 	start := time.Now()
-	resp, err := n.requestFastForward(peer.NetAddr)
+	resp, err := n.requestFastForward(peer)
 	elapsed := time.Since(start)
 	n.logger.WithField("duration", elapsed.Nanoseconds()).Debug("requestFastForward()")
 	if err != nil {
@@ -217,6 +385,15 @@ func (n *Node) fastForward() error {
 		"snapshot":             resp.Snapshot,
 	}).Debug("FastForwardResponse")
 
+	//A node that is joining the network must wait for a Frame that knows about
+	//its PeerSet change; otherwise it would not be able to insert its own
+	//Events in the reset hashgraph.
+	if _, ok := lastFramePeerSet(&resp.Frame).ByID[n.id]; !ok {
+		n.logger.Debug("Frame does not include this node yet")
+		time.Sleep(n.conf.HeartbeatTimeout)
+		return fmt.Errorf("Frame does not include this node yet")
+	}
+
 	//prepare core. ie: fresh hashgraph
 	n.coreLock.Lock()
 	err = n.core.FastForward(peer.PubKeyHex, &resp.Block, &resp.Frame)
@@ -304,7 +481,7 @@ func (n *Node) pull(peer *peers.Peer) (syncLimit bool, otherKnownEvents map[uint
 
 	//Send SyncRequest
 	start := time.Now()
-	resp, err := n.requestSync(peer.NetAddr, knownEvents)
+	resp, err := n.requestSync(peer, knownEvents)
 	elapsed := time.Since(start)
 	n.logger.WithField("duration", elapsed.Nanoseconds()).Debug("requestSync()")
 
@@ -368,9 +545,13 @@ func (n *Node) push(peer *peers.Peer, knownEvents map[uint32]int) error {
 			return err
 		}
 
+		n.coreLock.Lock()
+		wireEvents = n.core.misbehaviour.Events(n.core, peer.ID(), wireEvents)
+		n.coreLock.Unlock()
+
 		//Create and Send EagerSyncRequest
 		start = time.Now()
-		resp2, err := n.requestEagerSync(peer.NetAddr, wireEvents)
+		resp2, err := n.requestEagerSync(peer, wireEvents)
 		elapsed = time.Since(start)
 		n.logger.WithField("duration", elapsed.Nanoseconds()).Debug("requestEagerSync()")
 		if err != nil {
@@ -381,6 +562,16 @@ func (n *Node) push(peer *peers.Peer, knownEvents map[uint32]int) error {
 			"from_id": resp2.FromID,
 			"success": resp2.Success,
 		}).Debug("EagerSyncResponse")
+
+		n.coreLock.Lock()
+		replays := n.core.misbehaviour.Replays(peer.ID(), wireEvents)
+		n.coreLock.Unlock()
+
+		for _, events := range replays {
+			if _, err := n.requestEagerSync(peer, events); err != nil {
+				n.logger.WithField("error", err).Debug("Replaying EagerSyncRequest")
+			}
+		}
 	}
 
 	return nil
@@ -407,9 +598,68 @@ func (n *Node) sync(fromID uint32, events []hg.WireEvent) error {
 		return err
 	}
 
+	//Record the AnchorBlock as the base from which to restart
+	start = time.Now()
+	err = n.checkpoint()
+	elapsed = time.Since(start)
+	n.logger.WithField("duration", elapsed.Nanoseconds()).Debug("Checkpoint()")
+	if err != nil {
+		n.logger.WithError(err).Error()
+		return err
+	}
+
+	//Prune old Events, Rounds, and Frames if a retention policy is set
+	if n.conf.RetainRounds > 0 {
+		start = time.Now()
+		err = n.prune()
+		elapsed = time.Since(start)
+		n.logger.WithField("duration", elapsed.Nanoseconds()).Debug("Prune()")
+		if err != nil {
+			n.logger.WithError(err).Error()
+			return err
+		}
+	}
+
 	return nil
 }
 
+//prune deletes the parts of the Hashgraph that are more than RetainRounds rounds
+//below the AnchorBlock. The application's snapshot at the new base is saved
+//with it, so that the node can restart from the pruned Store.
+func (n *Node) prune() error {
+	block, frame, err := n.core.PruneBase(n.conf.RetainRounds)
+	if err != nil || block == nil {
+		return err
+	}
+
+	snapshot, err := n.proxy.GetSnapshot(block.Index())
+	if err != nil {
+		//Try again later; the application might not have the snapshot yet
+		n.logger.WithError(err).Debug("Prune: GetSnapshot")
+		return nil
+	}
+
+	return n.core.Prune(block, frame, snapshot)
+}
+
+//checkpoint saves the AnchorBlock, with the application's snapshot at that
+//Block, so that a restarted node only replays the Events above it.
+func (n *Node) checkpoint() error {
+	block, err := n.core.CheckpointBase()
+	if err != nil || block == nil {
+		return err
+	}
+
+	snapshot, err := n.proxy.GetSnapshot(block.Index())
+	if err != nil {
+		//Try again later; the application might not have the snapshot yet
+		n.logger.WithError(err).Debug("Checkpoint: GetSnapshot")
+		return nil
+	}
+
+	return n.core.Checkpoint(block, snapshot)
+}
+
 func (n *Node) addTransaction(tx []byte) {
 	n.coreLock.Lock()
 	defer n.coreLock.Unlock()
@@ -417,6 +667,100 @@ func (n *Node) addTransaction(tx []byte) {
 	n.core.AddTransactions([][]byte{tx})
 }
 
+/*
+Leave causes the node to politely leave the network. It submits a PEER_REMOVE
+InternalTransaction signed by this node, and waits for it to go through
+consensus. If the request is accepted, it waits until the new PeerSet, which no
+longer contains this node, takes effect at the AcceptedRound, before shutting
+down. From then on, the node does not count towards the SuperMajority or
+TrustCount of the other nodes.
+*/
+func (n *Node) Leave() error {
+	n.logger.Debug("LEAVING")
+
+	defer n.Shutdown()
+
+	err := n.leave()
+	if err != nil {
+		n.logger.WithField("error", err).Error("Leaving")
+		return err
+	}
+
+	return nil
+}
+
+func (n *Node) leave() error {
+	n.coreLock.Lock()
+	peerCount := n.core.peers.Len()
+	n.coreLock.Unlock()
+
+	//If this node is alone, there is nobody to notify.
+	if peerCount <= 1 {
+		n.logger.Debug("Leave: no other peers")
+		return nil
+	}
+
+	leaveTx := hg.NewInternalTransactionLeave(*peers.NewPeer(n.core.HexID(), n.trans.LocalAddr()))
+	if err := leaveTx.Sign(n.core.key); err != nil {
+		return err
+	}
+
+	n.coreLock.Lock()
+	promise := n.core.AddInternalTransaction(leaveTx)
+	n.coreLock.Unlock()
+
+	n.resetTimer()
+
+	timer := time.NewTimer(n.conf.JoinTimeout)
+	defer timer.Stop()
+
+	var acceptedRound int
+	select {
+	case resp := <-promise.RespCh:
+		n.logger.WithFields(logrus.Fields{
+			"accepted":       resp.Accepted,
+			"accepted_round": resp.AcceptedRound,
+			"peers":          len(resp.Peers),
+		}).Debug("LeaveRequest processed")
+
+		if !resp.Accepted {
+			return fmt.Errorf("Leave request refused")
+		}
+		acceptedRound = resp.AcceptedRound
+	case <-timer.C:
+		n.dropPromise(promise)
+		return fmt.Errorf("Timeout waiting for leave request to go through consensus")
+	case <-n.shutdownCh:
+		n.dropPromise(promise)
+		return fmt.Errorf("Node shutdown while leaving")
+	}
+
+	//Keep gossiping until the new PeerSet takes effect. The removal is already
+	//committed, so if the network goes idle before that, it is safe to stop
+	//waiting; the other nodes will still switch PeerSets at the AcceptedRound.
+	ticker := time.NewTicker(n.conf.HeartbeatTimeout)
+	defer ticker.Stop()
+
+	for {
+		n.coreLock.Lock()
+		lastConsensusRound := n.core.GetLastConsensusRoundIndex()
+		n.coreLock.Unlock()
+
+		if lastConsensusRound != nil && *lastConsensusRound >= acceptedRound {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			n.logger.WithField("accepted_round", acceptedRound).Warn("Leave: timeout waiting for AcceptedRound")
+			return nil
+		case <-n.shutdownCh:
+			return nil
+		}
+	}
+}
+
 func (n *Node) Shutdown() {
 	if n.getState() != Shutdown {
 		n.logger.Debug("Shutdown")
@@ -452,6 +796,13 @@ func (n *Node) GetStats() map[string]string {
 
 	timeElapsed := time.Since(n.start)
 
+	n.core.selectorLock.Lock()
+	numPeers := n.core.peerSelector.Peers().Len()
+	n.core.selectorLock.Unlock()
+
+	n.coreLock.Lock()
+	defer n.coreLock.Unlock()
+
 	consensusEvents := n.core.GetConsensusEventsCount()
 
 	consensusEventsPerSecond := float64(consensusEvents) / timeElapsed.Seconds()
@@ -471,7 +822,7 @@ func (n *Node) GetStats() map[string]string {
 		"consensus_transactions": strconv.Itoa(n.core.GetConsensusTransactionsCount()),
 		"undetermined_events":    strconv.Itoa(len(n.core.GetUndeterminedEvents())),
 		"transaction_pool":       strconv.Itoa(len(n.core.transactionPool)),
-		"num_peers":              strconv.Itoa(n.core.peerSelector.Peers().Len()),
+		"num_peers":              strconv.Itoa(numPeers),
 		"sync_rate":              strconv.FormatFloat(n.SyncRate(), 'f', 2, 64),
 		"events_per_second":      strconv.FormatFloat(consensusEventsPerSecond, 'f', 2, 64),
 		"rounds_per_second":      strconv.FormatFloat(consensusRoundsPerSecond, 'f', 2, 64),
@@ -516,6 +867,22 @@ func (n *Node) GetBlock(blockIndex int) (*hg.Block, error) {
 	return n.core.hg.Store.GetBlock(blockIndex)
 }
 
+//GetLastBlockIndex returns the index of the last committed Block, or -1
+func (n *Node) GetLastBlockIndex() int {
+	return n.core.GetLastBlockIndex()
+}
+
+//GetForkProofs returns the evidence of all the forks known to this node
+func (n *Node) GetForkProofs() ([]*hg.ForkProof, error) {
+	return n.core.hg.Store.GetForkProofs()
+}
+
+//GetTxLocation returns the location of a committed transaction, from the hex
+//encoded hash of the transaction
+func (n *Node) GetTxLocation(hash string) (*hg.TxLocation, error) {
+	return n.core.hg.Store.GetTxLocation(hg.NormalizeTxHash(hash))
+}
+
 func (n *Node) GetEvents() (map[uint32]int, error) {
 	res := n.core.KnownEvents()
 
@@ -526,6 +893,48 @@ func (n *Node) ID() uint32 {
 	return n.id
 }
 
+//SetMisbehaviour makes the node act as an adversary; see Misbehaviour. It is
+//meant for tests.
+func (n *Node) SetMisbehaviour(m Misbehaviour) {
+	n.coreLock.Lock()
+	defer n.coreLock.Unlock()
+
+	n.core.SetMisbehaviour(m)
+}
+
+//GetState returns the current state of the node
+func (n *Node) GetState() NodeState {
+	return n.getState()
+}
+
 func (n *Node) GetPeers() []*peers.Peer {
+	n.coreLock.Lock()
+	defer n.coreLock.Unlock()
+
 	return n.core.peers.Peers
 }
+
+//HasPeer reports whether the public key belongs to a peer that the node accepts
+//requests from, like authenticate does. If netAddr is not empty, the peer must
+//also be registered at that address.
+func (n *Node) HasPeer(pubKeyHex string, netAddr string) bool {
+	n.coreLock.Lock()
+	defer n.coreLock.Unlock()
+
+	peer, ok := n.getPeer(peers.NewPeer(pubKeyHex, "").ID(), n.core.clock())
+	if !ok || peer.PubKeyHex != pubKeyHex {
+		return false
+	}
+	return netAddr == "" || peer.NetAddr == netAddr
+}
+
+//getPeer returns the peer with the given ID if it is in the current PeerSet,
+//or if its removal was accepted less than JoinTimeout before now, which is how
+//long a leaving node waits for its removal to be committed. It must be called
+//with the coreLock.
+func (n *Node) getPeer(id uint32, now time.Time) (*peers.Peer, bool) {
+	if peer, ok := n.core.peers.ByID[id]; ok {
+		return peer, true
+	}
+	return n.core.getLeavingPeer(id, now.Add(-n.conf.JoinTimeout))
+}
@@ -2,56 +2,117 @@ package node
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	cm "github.com/mosaicnetworks/babble/src/common"
 	hg "github.com/mosaicnetworks/babble/src/hashgraph"
 	"github.com/mosaicnetworks/babble/src/net"
+	"github.com/mosaicnetworks/babble/src/peers"
 	"github.com/sirupsen/logrus"
 )
 
-func (n *Node) requestSync(target string, known map[uint32]int) (net.SyncResponse, error) {
+func (n *Node) requestSync(target *peers.Peer, known map[uint32]int) (net.SyncResponse, error) {
 	args := net.SyncRequest{
-		FromID: n.id,
-		Known:  known,
+		Known: known,
+	}
+
+	if err := n.signRequest(&args, target.ID()); err != nil {
+		return net.SyncResponse{}, err
 	}
 
 	var out net.SyncResponse
 
-	err := n.trans.Sync(target, &args, &out)
+	err := n.trans.Sync(target.NetAddr, &args, &out)
 
 	return out, err
 }
 
-func (n *Node) requestEagerSync(target string, events []hg.WireEvent) (net.EagerSyncResponse, error) {
+func (n *Node) requestEagerSync(target *peers.Peer, events []hg.WireEvent) (net.EagerSyncResponse, error) {
 	args := net.EagerSyncRequest{
-		FromID: n.id,
 		Events: events,
 	}
 
+	if err := n.signRequest(&args, target.ID()); err != nil {
+		return net.EagerSyncResponse{}, err
+	}
+
 	var out net.EagerSyncResponse
 
-	err := n.trans.EagerSync(target, &args, &out)
+	err := n.trans.EagerSync(target.NetAddr, &args, &out)
 
 	return out, err
 }
 
-func (n *Node) requestFastForward(target string) (net.FastForwardResponse, error) {
+func (n *Node) requestFastForward(target *peers.Peer) (net.FastForwardResponse, error) {
 	n.logger.WithFields(logrus.Fields{
-		"target": target,
+		"target": target.NetAddr,
 	}).Debug("RequestFastForward()")
 
-	args := net.FastForwardRequest{
-		FromID: n.id,
+	args := net.FastForwardRequest{}
+
+	if err := n.signRequest(&args, target.ID()); err != nil {
+		return net.FastForwardResponse{}, err
 	}
 
 	var out net.FastForwardResponse
 
-	err := n.trans.FastForward(target, &args, &out)
+	err := n.trans.FastForward(target.NetAddr, &args, &out)
 
 	return out, err
 }
 
+func (n *Node) requestJoin(target string) (net.JoinResponse, error) {
+	n.logger.WithFields(logrus.Fields{
+		"target": target,
+	}).Debug("RequestJoin()")
+
+	joinTx := hg.NewInternalTransactionJoin(*peers.NewPeer(n.core.HexID(), n.trans.LocalAddr()))
+
+	if err := joinTx.Sign(n.core.key); err != nil {
+		return net.JoinResponse{}, err
+	}
+
+	args := net.JoinRequest{
+		InternalTransaction: joinTx,
+	}
+
+	var out net.JoinResponse
+
+	err := n.trans.Join(target, &args, &out)
+
+	return out, err
+}
+
+//signRequest addresses a request from this node to the peer with ID toID,
+//stamps it with the clock of the node and a new nonce, and signs it
+func (n *Node) signRequest(req net.SignedRequest, toID uint32) error {
+	*req.Header() = net.SignedHeader{
+		FromID: n.id,
+		ToID:   toID,
+		Time:   n.core.clock().UnixNano(),
+		Nonce:  atomic.AddUint32(&n.requestNonce, 1),
+	}
+
+	return net.SignRequest(req, n.core.key)
+}
+
+//ProcessRPC handles an RPC request in the calling goroutine, instead of the Run
+//loop, and sends the response on the RPC's RespChan
+func (n *Node) ProcessRPC(rpc net.RPC) {
+	n.processRPC(rpc)
+}
+
 func (n *Node) processRPC(rpc net.RPC) {
+	if req, ok := rpc.Command.(net.SignedRequest); ok {
+		if err := n.authenticate(req); err != nil {
+			n.logger.WithField("error", err).Warning("Rejecting RPC")
+			rpc.Respond(nil, err)
+			return
+		}
+	}
+
 	switch cmd := rpc.Command.(type) {
 	case *net.SyncRequest:
 		n.processSyncRequest(rpc, cmd)
@@ -59,12 +120,102 @@ func (n *Node) processRPC(rpc net.RPC) {
 		n.processEagerSyncRequest(rpc, cmd)
 	case *net.FastForwardRequest:
 		n.processFastForwardRequest(rpc, cmd)
+	case *net.JoinRequest:
+		n.processJoinRequest(rpc, cmd)
 	default:
 		n.logger.WithField("cmd", rpc.Command).Error("Unexpected RPC command")
 		rpc.Respond(nil, fmt.Errorf("unexpected command"))
 	}
 }
 
+//authenticate checks that a request was signed by the peer that its FromID
+//designates, for this node, less than requestWindow away from the clock of the
+//node, and that it was not received before. The peer must be in the current
+//PeerSet, or be leaving it (see getPeer).
+func (n *Node) authenticate(req net.SignedRequest) error {
+	auth := req.Header()
+
+	n.coreLock.Lock()
+	now := n.core.clock()
+	peer, ok := n.getPeer(auth.FromID, now)
+	n.coreLock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Unauthenticated %T: %d is not in the PeerSet", req, auth.FromID)
+	}
+
+	if auth.ToID != n.id {
+		return fmt.Errorf("Unauthenticated %T from %d: addressed to %d", req, auth.FromID, auth.ToID)
+	}
+
+	signed := time.Unix(0, auth.Time)
+	if d := now.Sub(signed); d > requestWindow || d < -requestWindow {
+		return fmt.Errorf("Unauthenticated %T from %d: signed at %v, more than %v away from %v",
+			req, auth.FromID, signed.UTC(), requestWindow, now.UTC())
+	}
+
+	verified, err := net.VerifyRequest(req, peer)
+	if err != nil {
+		return fmt.Errorf("Unauthenticated %T from %d: %v", req, auth.FromID, err)
+	}
+	if !verified {
+		return fmt.Errorf("Unauthenticated %T: invalid signature for %d", req, auth.FromID)
+	}
+
+	if !n.requests.add(auth, now) {
+		return fmt.Errorf("Unauthenticated %T from %d: replayed request", req, auth.FromID)
+	}
+
+	return nil
+}
+
+//requestWindow is how far the Time of a signed request can be from the clock of
+//the node that receives it. Clocks of peers must not drift further apart.
+const requestWindow = time.Minute
+
+//requestCache remembers the signed requests received in the last
+//requestWindow, to detect replays. Older requests are rejected by their Time.
+type requestCache struct {
+	sync.Mutex
+	seen      map[requestKey]struct{}
+	nextPrune int64
+}
+
+//requestKey identifies a signed request. The signature is not part of it,
+//because an ECDSA signature can be altered without being invalidated.
+type requestKey struct {
+	from  uint32
+	time  int64
+	nonce uint32
+}
+
+//add records a request, and returns false if it was already recorded
+func (c *requestCache) add(auth *net.SignedHeader, now time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.seen == nil {
+		c.seen = make(map[requestKey]struct{})
+	}
+
+	if now.UnixNano() >= c.nextPrune {
+		for k := range c.seen {
+			if now.UnixNano()-k.time > int64(requestWindow) {
+				delete(c.seen, k)
+			}
+		}
+		c.nextPrune = now.UnixNano() + int64(requestWindow)
+	}
+
+	key := requestKey{auth.FromID, auth.Time, auth.Nonce}
+	if _, ok := c.seen[key]; ok {
+		return false
+	}
+	c.seen[key] = struct{}{}
+
+	return true
+}
+
 func (n *Node) processSyncRequest(rpc net.RPC, cmd *net.SyncRequest) {
 	n.logger.WithFields(logrus.Fields{
 		"from_id": cmd.FromID,
@@ -96,8 +247,15 @@ func (n *Node) processSyncRequest(rpc net.RPC, cmd *net.SyncRequest) {
 		n.logger.WithField("duration", elapsed.Nanoseconds()).Debug("Diff()")
 
 		if err != nil {
-			n.logger.WithField("error", err).Error("Calculating Diff")
-			respErr = err
+			if cm.Is(err, cm.TooLate) {
+				//The Events that the requester is missing were pruned or
+				//evicted; it needs to fast-forward.
+				n.logger.WithField("error", err).Debug("Calculating Diff")
+				resp.SyncLimit = true
+			} else {
+				n.logger.WithField("error", err).Error("Calculating Diff")
+				respErr = err
+			}
 		}
 
 		//Convert to WireEvents
@@ -106,7 +264,9 @@ func (n *Node) processSyncRequest(rpc net.RPC, cmd *net.SyncRequest) {
 			n.logger.WithField("error", err).Debug("Converting to WireEvent")
 			respErr = err
 		} else {
-			resp.Events = wireEvents
+			n.coreLock.Lock()
+			resp.Events = n.core.misbehaviour.Events(n.core, cmd.FromID, wireEvents)
+			n.coreLock.Unlock()
 		}
 	}
 
@@ -193,3 +353,69 @@ func (n *Node) processFastForwardRequest(rpc net.RPC, cmd *net.FastForwardReques
 
 	rpc.Respond(resp, respErr)
 }
+
+//dropPromise forgets a promise that timed out
+func (n *Node) dropPromise(promise *InternalTransactionPromise) {
+	n.coreLock.Lock()
+	n.core.DropPromise(promise)
+	n.coreLock.Unlock()
+}
+
+//processJoinRequest submits the JoinRequest's InternalTransaction to consensus
+//and only responds when it has been committed, or when the JoinTimeout
+//expires.
+func (n *Node) processJoinRequest(rpc net.RPC, cmd *net.JoinRequest) {
+	n.logger.WithFields(logrus.Fields{
+		"peer": cmd.InternalTransaction.Body.Peer,
+	}).Debug("process JoinRequest")
+
+	resp := &net.JoinResponse{
+		FromID: n.id,
+	}
+
+	var respErr error
+
+	if ok, err := cmd.InternalTransaction.Verify(); !ok {
+		respErr = fmt.Errorf("Unable to verify signature on JoinRequest")
+		if err != nil {
+			respErr = err
+		}
+	} else if cmd.InternalTransaction.Body.Type != hg.PEER_ADD {
+		respErr = fmt.Errorf("JoinRequest does not contain a PEER_ADD InternalTransaction")
+	} else if cmd.InternalTransaction.Body.Peer.Weight != 0 {
+		respErr = fmt.Errorf("JoinRequest cannot set the Weight of the Peer")
+	} else {
+		//Submit the join request to consensus
+		n.coreLock.Lock()
+		promise := n.core.AddInternalTransaction(cmd.InternalTransaction)
+		n.coreLock.Unlock()
+
+		n.resetTimer()
+
+		//Wait for the InternalTransaction to be committed
+		timer := time.NewTimer(n.conf.JoinTimeout)
+		defer timer.Stop()
+
+		select {
+		case promiseResp := <-promise.RespCh:
+			resp.Accepted = promiseResp.Accepted
+			resp.AcceptedRound = promiseResp.AcceptedRound
+			resp.Peers = promiseResp.Peers
+		case <-timer.C:
+			n.dropPromise(promise)
+			respErr = fmt.Errorf("Timeout waiting for JoinRequest to go through consensus")
+		case <-n.shutdownCh:
+			n.dropPromise(promise)
+			respErr = fmt.Errorf("Node shutdown")
+		}
+	}
+
+	n.logger.WithFields(logrus.Fields{
+		"accepted":       resp.Accepted,
+		"accepted_round": resp.AcceptedRound,
+		"peers":          len(resp.Peers),
+		"rpc_err":        respErr,
+	}).Debug("Responding to JoinRequest")
+
+	rpc.Respond(resp, respErr)
+}
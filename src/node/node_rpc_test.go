@@ -1,7 +1,9 @@
 package node
 
 import (
+	"crypto/ecdsa"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -64,8 +66,10 @@ func TestProcessSync(t *testing.T) {
 	}
 
 	args := net.SyncRequest{
-		FromID: node0.id,
-		Known:  node0KnownEvents,
+		Known: node0KnownEvents,
+	}
+	if err := node0.signRequest(&args, node1.id); err != nil {
+		t.Fatal(err)
 	}
 	expectedResp := net.SyncResponse{
 		FromID: node1.id,
@@ -159,9 +163,11 @@ func TestProcessEagerSync(t *testing.T) {
 	}
 
 	args := net.EagerSyncRequest{
-		FromID: node0.id,
 		Events: unknownWireEvents,
 	}
+	if err := node0.signRequest(&args, node1.id); err != nil {
+		t.Fatal(err)
+	}
 	expectedResp := net.EagerSyncResponse{
 		FromID:  node1.id,
 		Success: true,
@@ -222,8 +228,9 @@ func TestProcessFastForward(t *testing.T) {
 
 	//Manually prepare FastForwardRequest. We expect a 'No Anchor Block' error
 
-	args := net.FastForwardRequest{
-		FromID: node0.id,
+	args := net.FastForwardRequest{}
+	if err := node0.signRequest(&args, node1.id); err != nil {
+		t.Fatal(err)
 	}
 
 	//Make actual FastForwardRequest and check FastForwardResponse
@@ -238,3 +245,102 @@ func TestProcessFastForward(t *testing.T) {
 	node0.Shutdown()
 	node1.Shutdown()
 }
+
+func TestProcessRPCAuthentication(t *testing.T) {
+	keys, p := initPeers(2)
+	nodes := initNodes(keys, p, 1000, 1000, "inmem", common.NewTestLogger(t), t)
+	defer shutdownNodes(nodes)
+
+	outsiderKeys, outsiders := initPeers(1)
+
+	process := func(req net.SignedRequest) error {
+		respCh := make(chan net.RPCResponse, 1)
+		nodes[1].ProcessRPC(net.RPC{Command: req, RespChan: respCh})
+		return (<-respCh).Error
+	}
+
+	nonce := uint32(0)
+	sign := func(req net.SignedRequest, from uint32, key *ecdsa.PrivateKey, to uint32, at time.Time) net.SignedRequest {
+		nonce++
+		*req.Header() = net.SignedHeader{FromID: from, ToID: to, Time: at.UnixNano(), Nonce: nonce}
+		if err := net.SignRequest(req, key); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	known := nodes[0].core.KnownEvents()
+	to := nodes[1].id
+
+	signed := sign(&net.SyncRequest{Known: known}, nodes[0].id, keys[0], to, time.Now())
+	if err := process(signed); err != nil {
+		t.Fatalf("Signed SyncRequest should be processed: %v", err)
+	}
+
+	tampered := sign(&net.SyncRequest{Known: known}, nodes[0].id, keys[0], to, time.Now()).(*net.SyncRequest)
+	tampered.Known = map[uint32]int{}
+
+	unsigned := &net.SyncRequest{Known: known}
+	unsigned.SignedHeader = net.SignedHeader{FromID: nodes[0].id, ToID: to, Time: time.Now().UnixNano()}
+
+	rejected := []struct {
+		name string
+		req  net.SignedRequest
+		err  string
+	}{
+		{"replayed", signed, "replayed request"},
+		{"unsigned", unsigned, "invalid signature"},
+		{"forged", sign(&net.EagerSyncRequest{}, nodes[0].id, keys[1], to, time.Now()), "invalid signature"},
+		{"tampered", tampered, "invalid signature"},
+		{"outsider", sign(&net.FastForwardRequest{}, outsiders.Peers[0].ID(), outsiderKeys[0], to, time.Now()), "not in the PeerSet"},
+		{"other receiver", sign(&net.SyncRequest{Known: known}, nodes[0].id, keys[0], nodes[0].id, time.Now()), "addressed to"},
+		{"old", sign(&net.SyncRequest{Known: known}, nodes[0].id, keys[0], to, time.Now().Add(-2*requestWindow)), "more than"},
+		{"future", sign(&net.SyncRequest{Known: known}, nodes[0].id, keys[0], to, time.Now().Add(2*requestWindow)), "more than"},
+	}
+
+	for _, r := range rejected {
+		err := process(r.req)
+		if err == nil || !strings.Contains(err.Error(), r.err) {
+			t.Fatalf("%s %T should be rejected with %q, not %v", r.name, r.req, r.err, err)
+		}
+	}
+
+	//The removal of the first node is accepted. It stays a peer for
+	//JoinTimeout, to commit its own removal.
+	now := time.Now()
+	nodes[1].coreLock.Lock()
+	nodes[1].core.SetClock(func() time.Time { return now })
+	leaveTx := hg.NewInternalTransactionLeave(*p.Peers[0])
+	if err := nodes[1].core.ProcessAcceptedInternalTransactions(0, []hg.InternalTransactionReceipt{leaveTx.AsAccepted()}); err != nil {
+		t.Fatal(err)
+	}
+	nodes[1].coreLock.Unlock()
+
+	if _, ok := nodes[1].core.peers.ByID[nodes[0].id]; ok {
+		t.Fatal("The leaving peer should not be in the PeerSet anymore")
+	}
+
+	now = now.Add(nodes[1].conf.JoinTimeout - time.Millisecond)
+	leaving := sign(&net.SyncRequest{Known: known}, nodes[0].id, keys[0], to, now)
+	if err := process(leaving); err != nil {
+		t.Fatalf("SyncRequest of a leaving peer should be processed: %v", err)
+	}
+
+	//The TLS transport makes the same membership check
+	if !nodes[1].HasPeer(p.Peers[0].PubKeyHex, p.Peers[0].NetAddr) {
+		t.Fatal("The leaving peer should be accepted by the transport")
+	}
+	if nodes[1].HasPeer(p.Peers[0].PubKeyHex, p.Peers[1].NetAddr) {
+		t.Fatal("The leaving peer should only be accepted at its own address")
+	}
+
+	//After that, the node is not a peer anymore
+	now = now.Add(time.Millisecond)
+	removed := sign(&net.SyncRequest{Known: known}, nodes[0].id, keys[0], to, now)
+	if err := process(removed); err == nil || !strings.Contains(err.Error(), "not in the PeerSet") {
+		t.Fatalf("SyncRequest of a removed peer should be rejected, not return %v", err)
+	}
+	if nodes[1].HasPeer(p.Peers[0].PubKeyHex, "") {
+		t.Fatal("The removed peer should be rejected by the transport")
+	}
+}
@@ -1,6 +1,7 @@
 package node
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"math/rand"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -69,8 +71,10 @@ func TestAddTransaction(t *testing.T) {
 
 	node0KnownEvents := node0.core.KnownEvents()
 	args := net.SyncRequest{
-		FromID: node0.id,
-		Known:  node0KnownEvents,
+		Known: node0KnownEvents,
+	}
+	if err := node0.signRequest(&args, node1.id); err != nil {
+		t.Fatal(err)
 	}
 
 	var out net.SyncResponse
@@ -148,8 +152,10 @@ func TestSyncLimit(t *testing.T) {
 	}
 
 	args := net.SyncRequest{
-		FromID: nodes[0].id,
-		Known:  node0KnownEvents,
+		Known: node0KnownEvents,
+	}
+	if err := nodes[0].signRequest(&args, nodes[1].id); err != nil {
+		t.Fatal(err)
 	}
 	expectedResp := net.SyncResponse{
 		FromID:    nodes[1].id,
@@ -207,6 +213,260 @@ func TestFastForward(t *testing.T) {
 	}
 }
 
+func TestBlockLimits(t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peers := initPeers(4)
+	nodes := initNodes(keys, peers, 1000, 1000, "inmem", logger, t)
+	defer shutdownNodes(nodes)
+
+	for _, n := range nodes {
+		n.core.hg.SetBlockLimits(1, 0)
+	}
+
+	err := gossip(nodes[1:], 20, false, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGossip(nodes[1:], 0, t)
+
+	//Frames with more than one transaction should have been split into
+	//consecutive Blocks pointing to the same Frame
+	splits := 0
+	var previous *hg.Block
+	for i := 0; i <= nodes[1].core.GetLastBlockIndex(); i++ {
+		block, err := nodes[1].GetBlock(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(block.Transactions()) > 1 {
+			t.Fatalf("Block %d has %d transactions", i, len(block.Transactions()))
+		}
+
+		if previous != nil && previous.RoundReceived() == block.RoundReceived() {
+			if !reflect.DeepEqual(previous.FrameHash(), block.FrameHash()) {
+				t.Fatalf("Blocks %d and %d should have the same FrameHash", i-1, i)
+			}
+			splits++
+		}
+
+		previous = block
+	}
+
+	if splits == 0 {
+		t.Fatal("No Frame was split")
+	}
+
+	//FastForward to the last Block of a split Frame
+	err = nodes[0].fastForward()
+	if err != nil {
+		t.Fatalf("Error FastForwarding: %s", err)
+	}
+
+	lbi := nodes[0].core.GetLastBlockIndex()
+
+	sBlock, err := nodes[0].GetBlock(lbi)
+	if err != nil {
+		t.Fatalf("Error retrieving latest Block from reset hashgraph: %v", err)
+	}
+
+	expectedBlock, err := nodes[1].GetBlock(lbi)
+	if err != nil {
+		t.Fatalf("Failed to retrieve block %d from node1: %v", lbi, err)
+	}
+
+	if !reflect.DeepEqual(sBlock.Body, expectedBlock.Body) {
+		t.Fatalf("Blocks defer")
+	}
+
+	if next, err := nodes[1].GetBlock(lbi + 1); err == nil &&
+		next.RoundReceived() == sBlock.RoundReceived() {
+		t.Fatalf("Block %d is not the last Block of its Frame", lbi)
+	}
+}
+
+func TestTxLocation(t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peers := initPeers(4)
+	nodes := initNodes(keys, peers, 1000, 1000, "inmem", logger, t)
+	defer shutdownNodes(nodes)
+
+	err := gossip(nodes, 5, true, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range nodes {
+		for i := 0; i <= 5; i++ {
+			block, err := n.GetBlock(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for j, tx := range block.Transactions() {
+				//Lookups are case-insensitive
+				hash := strings.ToLower(hg.TxHash(tx))
+
+				location, err := n.GetTxLocation(hash)
+				if err != nil {
+					t.Fatalf("Block %d tx %d: %v", i, j, err)
+				}
+
+				if location.BlockIndex != i || location.Position != j {
+					t.Fatalf("Block %d tx %d: wrong location %d %d", i, j, location.BlockIndex, location.Position)
+				}
+
+				event, err := n.core.hg.Store.GetEvent(location.EventHash)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(event.Transactions()[location.EventPosition], tx) {
+					t.Fatalf("Block %d tx %d: not in Event %s", i, j, location.EventHash)
+				}
+			}
+		}
+	}
+
+	_, err = nodes[0].GetTxLocation(hg.TxHash([]byte("unknown")))
+	if !common.Is(err, common.KeyNotFound) {
+		t.Fatalf("GetTxLocation should return KeyNotFound, not %v", err)
+	}
+}
+
+func TestGraphDot(t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peers := initPeers(4)
+	nodes := initNodes(keys, peers, 1000, 1000, "inmem", logger, t)
+	defer shutdownNodes(nodes)
+
+	err := gossip(nodes, 3, true, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := NewGraph(nodes[0]).GetInfos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dot bytes.Buffer
+	if err := infos.WriteDot(&dot); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"digraph hashgraph {", "fillcolor=gold", "[style=dashed]"} {
+		if !strings.Contains(dot.String(), s) {
+			t.Fatalf("DOT output should contain %q", s)
+		}
+	}
+
+	//The JSON dump, as served by /graph, is enough to draw the same graph
+	dump, err := json.Marshal(infos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded Infos
+	if err := json.Unmarshal(dump, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	var loadedDot bytes.Buffer
+	if err := loaded.WriteDot(&loadedDot); err != nil {
+		t.Fatal(err)
+	}
+
+	if dot.String() != loadedDot.String() {
+		t.Fatal("DOT output from the JSON dump should be the same")
+	}
+
+	//Only Events and Blocks of rounds 1 and 2 are kept
+	filtered := infos.FilterRounds(1, 2)
+	eventInfos := filtered.eventInfos()
+	count := 0
+	for _, events := range filtered.ParticipantEvents {
+		for hash := range events {
+			if r := eventInfos[hash].round; r < 1 || r > 2 {
+				t.Fatalf("Event %s of round %d should have been filtered out", hash, r)
+			}
+			count++
+		}
+	}
+
+	if count == 0 {
+		t.Fatal("Rounds 1 and 2 should contain Events")
+	}
+
+	for _, b := range filtered.Blocks {
+		if b.RoundReceived() < 1 || b.RoundReceived() > 2 {
+			t.Fatalf("Block %d should have been filtered out", b.Index())
+		}
+	}
+}
+
+//Once Round 0 is pruned, the Rounds that are left are still annotated with
+//their own index, and can be filtered
+func TestGraphDotPruned(t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peers := initPeers(4)
+	nodes := initNodes(keys, peers, 1000, 1000, "badger", logger, t)
+	defer shutdownNodes(nodes)
+	for _, n := range nodes {
+		n.conf.RetainRounds = 5
+	}
+
+	err := gossip(nodes, 30, true, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := NewGraph(nodes[0]).GetInfos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if infos.FirstRound == 0 || len(infos.Rounds) == 0 {
+		t.Fatalf("Graph should start above the pruned Rounds, not at %d with %d Rounds",
+			infos.FirstRound, len(infos.Rounds))
+	}
+	lastRound := infos.FirstRound + len(infos.Rounds) - 1
+	if lastRound != nodes[0].core.hg.Store.LastRound() {
+		t.Fatalf("Graph should end at Round %d, not %d", nodes[0].core.hg.Store.LastRound(), lastRound)
+	}
+
+	var dot bytes.Buffer
+	if err := infos.WriteDot(&dot); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot.String(), fmt.Sprintf("r=%d ", lastRound)) {
+		t.Fatalf("DOT output should contain Events of Round %d", lastRound)
+	}
+
+	//Only Events and Blocks of the last two Rounds are kept
+	from := lastRound - 1
+	filtered := infos.FilterRounds(from, lastRound)
+	eventInfos := filtered.eventInfos()
+	count := 0
+	for _, events := range filtered.ParticipantEvents {
+		for hash := range events {
+			if r := eventInfos[hash].round; r < from || r > lastRound {
+				t.Fatalf("Event %s of round %d should have been filtered out", hash, r)
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		t.Fatalf("Rounds %d and %d should contain Events", from, lastRound)
+	}
+
+	for _, b := range filtered.Blocks {
+		if b.RoundReceived() < from || b.RoundReceived() > lastRound {
+			t.Fatalf("Block %d should have been filtered out", b.Index())
+		}
+	}
+}
+
 func TestCatchUp(t *testing.T) {
 	logger := common.NewTestLogger(t)
 	keys, peers := initPeers(4)
@@ -318,6 +578,110 @@ func TestFastSync(t *testing.T) {
 	checkGossip(nodes, *start, t)
 }
 
+func TestJoin(t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peerSet := initPeers(4)
+	nodes := initNodes(keys, peerSet, 1000000, 400, "inmem", logger, t)
+	defer shutdownNodes(nodes)
+
+	target := 30
+	err := gossip(nodes, target, false, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGossip(nodes, 0, t)
+
+	key, _ := crypto.GenerateECDSAKey()
+	peer := peers.NewPeer(
+		fmt.Sprintf("0x%X", crypto.FromECDSAPub(&key.PublicKey)),
+		fmt.Sprintf("127.0.0.1:%d", ip),
+	)
+	ip++
+
+	//The new node is initialized with the genesis PeerSet, which it does not
+	//belong to.
+	newNode := newNode(peer, key, peerSet, 1000000, 400, "inmem", logger, t)
+	defer newNode.Shutdown()
+
+	if state := newNode.getState(); state != Joining {
+		t.Fatalf("newNode should be Joining, not %s", state.String())
+	}
+
+	newNode.RunAsync(true)
+
+	nodes = append(nodes, newNode)
+
+	//Gossip some more
+	secondTarget := target + 50
+	err = bombardAndWait(nodes, secondTarget, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := newNode.core.hg.FirstConsensusRound
+	checkGossip(nodes, *start, t)
+
+	for i, n := range nodes {
+		if _, ok := n.core.peers.ByPubKey[peer.PubKeyHex]; !ok {
+			t.Fatalf("nodes[%d] PeerSet does not contain the new peer", i)
+		}
+	}
+}
+
+func TestLeave(t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peerSet := initPeers(4)
+	nodes := initNodes(keys, peerSet, 1000000, 400, "inmem", logger, t)
+	defer shutdownNodes(nodes)
+
+	target := 30
+	err := gossip(nodes, target, false, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGossip(nodes, 0, t)
+
+	leavingNode := nodes[3]
+	remainingNodes := nodes[:3]
+
+	leaveCh := make(chan error, 1)
+	go func() {
+		leaveCh <- leavingNode.Leave()
+	}()
+
+	//The remaining nodes need to keep gossiping for the leave request to go
+	//through consensus
+	secondTarget := target + 50
+	err = bombardAndWait(remainingNodes, secondTarget, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-leaveCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for Leave")
+	}
+
+	if state := leavingNode.getState(); state != Shutdown {
+		t.Fatalf("leavingNode should be Shutdown, not %s", state.String())
+	}
+
+	checkGossip(remainingNodes, 0, t)
+
+	for i, n := range remainingNodes {
+		if _, ok := n.core.peers.ByPubKey[leavingNode.core.HexID()]; ok {
+			t.Fatalf("nodes[%d] PeerSet still contains the leaving peer", i)
+		}
+		if l := n.core.peers.Len(); l != 3 {
+			t.Fatalf("nodes[%d] PeerSet should contain 3 peers, not %d", i, l)
+		}
+	}
+}
+
 func TestShutdown(t *testing.T) {
 	logger := common.NewTestLogger(t)
 	keys, peers := initPeers(4)
@@ -335,32 +699,108 @@ func TestShutdown(t *testing.T) {
 }
 
 func TestBootstrapAllNodes(t *testing.T) {
+	bootstrapAllNodes("badger", t)
+}
+
+func TestBootstrapAllNodesFileStore(t *testing.T) {
+	bootstrapAllNodes("file", t)
+}
+
+func bootstrapAllNodes(storeType string, t *testing.T) {
 	os.RemoveAll("test_data")
 	os.Mkdir("test_data", os.ModeDir|0777)
 
-	//create a first network with BadgerStore and wait till it reaches 10 blocks
-	//before shutting it down
+	//create a first network with a persistent Store and wait till it reaches
+	//10 blocks before shutting it down
 	logger := common.NewTestLogger(t)
 	keys, peers := initPeers(4)
-	nodes := initNodes(keys, peers, 1000, 1000, "badger", logger, t)
+	nodes := initNodes(keys, peers, 1000, 1000, storeType, logger, t)
 
-	err := gossip(nodes, 10, true, 3*time.Second)
+	err := gossip(nodes, 10, false, 3*time.Second)
 	if err != nil {
 		t.Fatal(err)
 	}
+	//Every node must have recorded a checkpoint to restart from
+	err = bombardAndWaitCheckpoint(nodes, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdownNodes(nodes)
 	checkGossip(nodes, 0, t)
 
 	//Now try to recreate a network from the databases created in the first step
 	//and advance it to 20 blocks
 	newNodes := recycleNodes(nodes, logger, t)
 
+	//The new nodes should have restarted from their last checkpoint, without
+	//replaying the Events from genesis. The Blocks below the checkpoint are
+	//not loaded, and the DB is closed after gossip, so they are not compared.
+	fromBlock := 0
+	for i, n := range newNodes {
+		if c := n.core.hg.CheckpointBlock(); c > fromBlock {
+			fromBlock = c
+		}
+
+		first, err := nodes[i].core.hg.Store.ParticipantEvent(nodes[i].core.HexID(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := n.core.hg.Store.GetEvent(first); err == nil {
+			t.Fatalf("newNodes[%d] should not have replayed Events from genesis", i)
+		}
+	}
+
 	err = gossip(newNodes, 20, true, 3*time.Second)
 	if err != nil {
 		t.Fatal(err)
 	}
-	checkGossip(newNodes, 0, t)
+	checkGossip(newNodes, fromBlock, t)
 
 	//Check that both networks did not have completely different consensus events
+	checkGossip([]*Node{nodes[0], newNodes[0]}, fromBlock, t)
+}
+
+func TestPrune(t *testing.T) {
+	prune("badger", t)
+}
+
+func TestPruneFileStore(t *testing.T) {
+	prune("file", t)
+}
+
+func prune(storeType string, t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peers := initPeers(4)
+	nodes := initNodes(keys, peers, 1000, 1000, storeType, logger, t)
+	for _, n := range nodes {
+		n.conf.RetainRounds = 5
+	}
+
+	err := gossip(nodes, 30, true, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGossip(nodes, 0, t)
+
+	//Rounds below the pruning base should be gone from the stores
+	for i, n := range nodes {
+		if _, err := n.core.hg.Store.GetRound(0); !common.Is(err, common.KeyNotFound) {
+			t.Fatalf("nodes[%d] Round 0 should have been pruned. err: %v", i, err)
+		}
+	}
+
+	//Nodes restarted from a pruned Store should keep going from the pruning
+	//base
+	newNodes := recycleNodes(nodes, logger, t)
+	defer shutdownNodes(newNodes)
+
+	err = gossip(newNodes, 40, false, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Blocks are never pruned, so they should all still be there and match
+	checkGossip(newNodes, 0, t)
 	checkGossip([]*Node{nodes[0], newNodes[0]}, 0, t)
 }
 
@@ -397,6 +837,82 @@ func initPeers(n int) ([]*ecdsa.PrivateKey, *peers.PeerSet) {
 	return keys, peerSet
 }
 
+func TestReplay(t *testing.T) {
+	logger := common.NewTestLogger(t)
+	keys, peers := initPeers(4)
+	nodes := initNodes(keys, peers, 1000, 1000, "badger", logger, t)
+	defer deleteStores(nodes, t)
+
+	err := gossip(nodes, 8, true, 6*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedTxs, err := getCommittedTransactions(nodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Reopen the database of the first node, without Init, and replay it into a
+	//new application
+	old := nodes[0]
+	store, err := hg.NewBadgerStore(old.conf.CacheSize, old.core.hg.Store.StorePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trans := net.NewInmemTransport("")
+	node := NewNode(old.conf, old.id, old.core.key, old.core.peers, store, trans, dummy.NewInmemDummyClient(logger))
+	defer node.Shutdown()
+
+	count, err := node.Replay(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 6 {
+		t.Fatalf("Replay should commit at least 6 Blocks, not %d", count)
+	}
+
+	//The application should have the transactions of the replayed Blocks, which
+	//are those of the first node up to the last Block it committed
+	replayedTxs, err := getCommittedTransactions(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayedTxs) > len(expectedTxs) || !reflect.DeepEqual(expectedTxs[:len(replayedTxs)], replayedTxs) {
+		t.Fatalf("Replayed transactions should be the committed transactions")
+	}
+
+	//Replay stops at the first Block whose StateHash differs. The application
+	//already has the state of the replayed Blocks.
+	count, err = node.Replay(0)
+	if err == nil || !strings.Contains(err.Error(), "StateHash") {
+		t.Fatalf("Replay should fail on the StateHash of Block 0, not %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("Replay should not commit any Block, not %d", count)
+	}
+
+	//Replay stops at the first Block that fails CheckBlock
+	block, err := store.GetBlock(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Body.StateHash = []byte("wrong")
+	if err := store.SetBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	node.proxy = dummy.NewInmemDummyClient(logger)
+
+	count, err = node.Replay(0)
+	if err == nil || !strings.Contains(err.Error(), "signatures") {
+		t.Fatalf("Replay should fail on the signatures of Block 3, not %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Replay should commit the 3 Blocks before Block 3, not %d", count)
+	}
+}
+
 func newNode(peer *peers.Peer,
 	k *ecdsa.PrivateKey,
 	peers *peers.PeerSet,
@@ -428,6 +944,12 @@ func newNode(peer *peers.Peer,
 		if err != nil {
 			t.Fatalf("failed to create BadgerStore for peer %d: %s", peer.ID(), err)
 		}
+	case "file":
+		path, _ := ioutil.TempDir("", "file")
+		store, err = hg.NewFileStore(conf.CacheSize, path)
+		if err != nil {
+			t.Fatalf("failed to create FileStore for peer %d: %s", peer.ID(), err)
+		}
 	case "inmem":
 		store = hg.NewInmemStore(conf.CacheSize)
 	}
@@ -490,12 +1012,18 @@ func recycleNode(oldNode *Node, logger *logrus.Logger, t *testing.T) *Node {
 
 	var store hg.Store
 	var err error
-	if _, ok := oldNode.core.hg.Store.(*hg.BadgerStore); ok {
+	switch oldNode.core.hg.Store.(type) {
+	case *hg.BadgerStore:
 		store, err = hg.NewBadgerStore(conf.CacheSize, oldNode.core.hg.Store.StorePath())
 		if err != nil {
 			t.Fatal(err)
 		}
-	} else {
+	case *hg.FileStore:
+		store, err = hg.NewFileStore(conf.CacheSize, oldNode.core.hg.Store.StorePath())
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
 		store = hg.NewInmemStore(conf.CacheSize)
 	}
 
@@ -577,6 +1105,37 @@ func bombardAndWait(nodes []*Node, target int, timeout time.Duration) error {
 	return nil
 }
 
+// bombardAndWaitCheckpoint sends transactions to the nodes until they have all
+// recorded a checkpoint
+func bombardAndWaitCheckpoint(nodes []*Node, timeout time.Duration) error {
+	quit := make(chan struct{})
+	defer close(quit)
+	makeRandomTransactions(nodes, quit)
+
+	stopper := time.After(timeout)
+	for {
+		select {
+		case <-stopper:
+			return fmt.Errorf("TIMEOUT")
+		default:
+		}
+		time.Sleep(10 * time.Millisecond)
+		done := true
+		for _, n := range nodes {
+			n.coreLock.Lock()
+			checkpoint := n.core.hg.CheckpointBlock()
+			n.coreLock.Unlock()
+			if checkpoint < 0 {
+				done = false
+				break
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
 func makeRandomTransactions(nodes []*Node, quit chan struct{}) {
 	go func() {
 		seq := make(map[int]int)
@@ -0,0 +1,42 @@
+package node
+
+import (
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+)
+
+//InternalTransactionPromiseResponse captures the outcome of an
+//InternalTransaction once it has gone through consensus and was processed by
+//the application.
+type InternalTransactionPromiseResponse struct {
+	Accepted      bool
+	AcceptedRound int
+	Peers         []*peers.Peer
+}
+
+/*
+InternalTransactionPromise is used to wait for an InternalTransaction to be
+committed. It is created when the InternalTransaction is added to the pool, and
+resolved when the corresponding receipt comes back from the application.
+*/
+type InternalTransactionPromise struct {
+	Tx     hg.InternalTransaction
+	RespCh chan InternalTransactionPromiseResponse
+}
+
+func NewInternalTransactionPromise(tx hg.InternalTransaction) *InternalTransactionPromise {
+	return &InternalTransactionPromise{
+		Tx: tx,
+		//make buffered so that the Core does not block when resolving a promise
+		//that nobody is waiting for
+		RespCh: make(chan InternalTransactionPromiseResponse, 1),
+	}
+}
+
+func (p *InternalTransactionPromise) Respond(accepted bool, acceptedRound int, peers []*peers.Peer) {
+	p.RespCh <- InternalTransactionPromiseResponse{
+		Accepted:      accepted,
+		AcceptedRound: acceptedRound,
+		Peers:         peers,
+	}
+}
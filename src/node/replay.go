@@ -0,0 +1,152 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mosaicnetworks/babble/src/common"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/peers"
+	"github.com/mosaicnetworks/babble/src/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ReplayBlocks rebuilds the state of an application from the committed Blocks of
+a Store. It feeds the Blocks, in order from index fromBlock, to the CommitBlock
+method of the AppProxy, and checks that the StateHash and the
+InternalTransactionReceipts returned by the application are the ones recorded
+in each Block. Before committing a Block, it
+verifies it with CheckBlock against the PeerSet that the Store records for its
+round. It stops at the first Block that fails these checks, with an error, or
+after the last committed Block. A Block that has no signatures was not
+committed, because Core signs every Block that it commits, and a Block whose
+signatures are valid but not yet enough was committed just before the node
+stopped, so both end the replay.
+
+The application must be in the state that follows Block fromBlock-1, which is
+its initial state if fromBlock is 0. Nothing is gossiped, and neither the Store
+nor the PeerSets are modified. ReplayBlocks returns the number of Blocks that
+were replayed successfully.
+*/
+func ReplayBlocks(store hg.Store, appProxy proxy.AppProxy, fromBlock int, logger *logrus.Entry) (int, error) {
+	recorded, err := hg.RecordedPeerSets(store)
+	if err != nil {
+		return 0, err
+	}
+
+	h := hg.NewHashgraph(store, nil, logger)
+
+	count := 0
+
+	for i := fromBlock; ; i++ {
+		block, err := store.GetBlock(i)
+		if err != nil {
+			if i > fromBlock && common.Is(err, common.KeyNotFound) {
+				break
+			}
+			return count, fmt.Errorf("Block %d: %v", i, err)
+		}
+
+		if len(block.Signatures) == 0 {
+			logger.WithField("block", i).Debug("Replay: Block not committed")
+			break
+		}
+
+		peerSet, err := recorded.Get(block.RoundReceived())
+		if err != nil {
+			return count, fmt.Errorf("PeerSet of Block %d: %v", i, err)
+		}
+
+		if err := h.CheckBlock(block, peerSet); err != nil {
+			if !awaitingSignatures(block, peerSet) {
+				return count, fmt.Errorf("Block %d: %v", i, err)
+			}
+			logger.WithField("block", i).Debug("Replay: Block not signed by enough validators")
+			break
+		}
+
+		//The application receives the Block as it was before it was committed
+		replayed := *block
+		replayed.Body.StateHash = []byte{}
+		replayed.Body.InternalTransactionReceipts = nil
+
+		res, err := appProxy.CommitBlock(replayed)
+		if err != nil {
+			return count, fmt.Errorf("Committing Block %d: %v", i, err)
+		}
+
+		if !bytes.Equal(res.StateHash, block.StateHash()) {
+			return count, fmt.Errorf("Block %d: StateHash %X differs from the recorded StateHash %X",
+				i, res.StateHash, block.StateHash())
+		}
+
+		if !sameReceipts(res.InternalTransactionReceipts, block.InternalTransactionReceipts()) {
+			return count, fmt.Errorf("Block %d: InternalTransactionReceipts differ from the recorded receipts", i)
+		}
+
+		logger.WithFields(logrus.Fields{
+			"block":      i,
+			"state_hash": fmt.Sprintf("%X", res.StateHash),
+		}).Debug("Replay: Block committed")
+
+		count++
+	}
+
+	logger.WithFields(logrus.Fields{
+		"from":   fromBlock,
+		"blocks": count,
+	}).Info("Replay done")
+
+	return count, nil
+}
+
+//awaitingSignatures returns true if a Block that fails CheckBlock is only
+//missing signatures: its PeersHash is the hash of peerSet, and all its
+//signatures are valid signatures of validators of peerSet.
+func awaitingSignatures(block *hg.Block, peerSet *peers.PeerSet) bool {
+	peersHash, err := peerSet.Hash()
+	if err != nil || !bytes.Equal(peersHash, block.PeersHash()) {
+		return false
+	}
+
+	for _, sig := range block.GetSignatures() {
+		if _, ok := peerSet.ByPubKey[sig.ValidatorHex()]; !ok {
+			return false
+		}
+		if ok, _ := block.Verify(sig); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+//sameReceipts returns true if two lists of receipts take the same decisions on
+//the same InternalTransactions
+func sameReceipts(a, b []hg.InternalTransactionReceipt) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].InternalTransaction.HashString() != b[i].InternalTransaction.HashString() ||
+			a[i].Accepted != b[i].Accepted ||
+			a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+
+	return true
+}
+
+//Replay feeds the committed Blocks of the node, from index fromBlock, to its
+//AppProxy, to rebuild the state of the application; see ReplayBlocks. It must
+//not be called while the node is running. On a node created from an existing
+//database, it is called instead of Init, whose Bootstrap would commit Blocks.
+func (n *Node) Replay(fromBlock int) (int, error) {
+	n.coreLock.Lock()
+	defer n.coreLock.Unlock()
+
+	return ReplayBlocks(n.core.hg.Store, n.proxy, fromBlock, n.logger)
+}
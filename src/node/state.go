@@ -26,6 +26,8 @@ func (s NodeState) String() string {
 		return "Babbling"
 	case CatchingUp:
 		return "CatchingUp"
+	case Joining:
+		return "Joining"
 	case Shutdown:
 		return "Shutdown"
 	default:
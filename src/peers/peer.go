@@ -11,6 +11,9 @@ import (
 type Peer struct {
 	NetAddr   string
 	PubKeyHex string
+	//Weight is the voting power of the Peer. When it is not set, the Peer
+	//counts for 1, which is equivalent to counting heads.
+	Weight int `json:",omitempty"`
 
 	id uint32
 }
@@ -31,6 +34,14 @@ func (p *Peer) ID() uint32 {
 	return p.id
 }
 
+//VotingWeight returns the Peer's Weight, or 1 if it is not set
+func (p *Peer) VotingWeight() int {
+	if p.Weight <= 0 {
+		return 1
+	}
+	return p.Weight
+}
+
 func (p *Peer) PubKeyBytes() []byte {
 	res, _ := hex.DecodeString(p.PubKeyHex[2:])
 	return res
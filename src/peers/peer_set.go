@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"strconv"
 
 	"github.com/mosaicnetworks/babble/src/crypto"
 )
@@ -18,6 +19,7 @@ type PeerSet struct {
 	//cached values
 	hash          []byte
 	hex           string
+	totalWeight   *int
 	superMajority *int
 	trustCount    *int
 }
@@ -58,7 +60,10 @@ func NewPeerSetFromPeerSliceBytes(peerSliceBytes []byte) (*PeerSet, error) {
 
 //WithNewPeer returns a new PeerSet with a list of peers including the new one.
 func (peerSet *PeerSet) WithNewPeer(peer *Peer) *PeerSet {
-	peers := append(peerSet.Peers, peer)
+	//copy the slice so as not to modify the underlying array of the original
+	peers := make([]*Peer, len(peerSet.Peers), len(peerSet.Peers)+1)
+	copy(peers, peerSet.Peers)
+	peers = append(peers, peer)
 	newPeerSet := NewPeerSet(peers)
 	return newPeerSet
 }
@@ -107,14 +112,41 @@ func (c *PeerSet) Len() int {
 	return len(c.ByPubKey)
 }
 
+//TotalWeight returns the sum of the voting weights of the Peers
+func (c *PeerSet) TotalWeight() int {
+	if c.totalWeight == nil {
+		val := 0
+		for _, p := range c.ByPubKey {
+			val += p.VotingWeight()
+		}
+		c.totalWeight = &val
+	}
+	return *c.totalWeight
+}
+
+//WeightOf returns the voting weight of the Peer identified by pubKey, or 0 if
+//it does not belong to the PeerSet
+func (c *PeerSet) WeightOf(pubKey string) int {
+	p, ok := c.ByPubKey[pubKey]
+	if !ok {
+		return 0
+	}
+	return p.VotingWeight()
+}
+
 //Hash uniquely identifies a PeerSet. It is computed by sorting the peers set
-//by ID, and hashing (SHA256) their public keys together, one by one.
+//by ID, and hashing (SHA256) their public keys together, one by one. Weights
+//are only hashed when they differ from 1, so the Hash of an unweighted PeerSet
+//is the same as before weights were introduced.
 func (c *PeerSet) Hash() ([]byte, error) {
 	if len(c.hash) == 0 {
 		hash := []byte{}
 		for _, p := range c.Peers {
 			pk := p.PubKeyBytes()
 			hash = crypto.SimpleHashFromTwoHashes(hash, pk)
+			if w := p.VotingWeight(); w != 1 {
+				hash = crypto.SimpleHashFromTwoHashes(hash, []byte(strconv.Itoa(w)))
+			}
 		}
 		c.hash = hash
 	}
@@ -139,21 +171,23 @@ func (c *PeerSet) Marshal() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-//SuperMajority return the number of peers that forms a strong majortiy (+2/3)
-//in the PeerSet
+//SuperMajority return the voting weight that forms a strong majortiy (+2/3) in
+//the PeerSet. Without weights, this is a number of peers.
 func (c *PeerSet) SuperMajority() int {
 	if c.superMajority == nil {
-		val := 2*c.Len()/3 + 1
+		val := 2*c.TotalWeight()/3 + 1
 		c.superMajority = &val
 	}
 	return *c.superMajority
 }
 
+//TrustCount returns the voting weight (+1/3) above which a group of peers is
+//guaranteed to contain at least one honest peer
 func (c *PeerSet) TrustCount() int {
 	if c.trustCount == nil {
 		val := 0
 		if len(c.Peers) > 1 {
-			val = int(math.Ceil(float64(c.Len()) / float64(3)))
+			val = int(math.Ceil(float64(c.TotalWeight()) / float64(3)))
 		}
 		c.trustCount = &val
 	}
@@ -163,5 +197,7 @@ func (c *PeerSet) TrustCount() int {
 func (c *PeerSet) clearCache() {
 	c.hash = []byte{}
 	c.hex = ""
+	c.totalWeight = nil
 	c.superMajority = nil
+	c.trustCount = nil
 }
@@ -0,0 +1,112 @@
+package peers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	scrypto "github.com/mosaicnetworks/babble/src/crypto"
+)
+
+func newTestPeers(weights []int) []*Peer {
+	peers := []*Peer{}
+	for i, w := range weights {
+		key, _ := scrypto.GenerateECDSAKey()
+		peers = append(peers, &Peer{
+			NetAddr:   fmt.Sprintf("addr%d", i),
+			PubKeyHex: fmt.Sprintf("0x%X", scrypto.FromECDSAPub(&key.PublicKey)),
+			Weight:    w,
+		})
+	}
+	return peers
+}
+
+func TestPeerSetWeights(t *testing.T) {
+	//Unweighted PeerSets count heads
+	peerSet := NewPeerSet(newTestPeers([]int{0, 0, 0, 0}))
+
+	if tw := peerSet.TotalWeight(); tw != 4 {
+		t.Fatalf("TotalWeight should be 4, not %d", tw)
+	}
+	if sm := peerSet.SuperMajority(); sm != 3 {
+		t.Fatalf("SuperMajority should be 3, not %d", sm)
+	}
+	if tc := peerSet.TrustCount(); tc != 2 {
+		t.Fatalf("TrustCount should be 2, not %d", tc)
+	}
+
+	//One Peer holds more than a third of the weight
+	peerSet = NewPeerSet(newTestPeers([]int{1, 1, 1, 5}))
+
+	if tw := peerSet.TotalWeight(); tw != 8 {
+		t.Fatalf("TotalWeight should be 8, not %d", tw)
+	}
+	if sm := peerSet.SuperMajority(); sm != 6 {
+		t.Fatalf("SuperMajority should be 6, not %d", sm)
+	}
+	if tc := peerSet.TrustCount(); tc != 3 {
+		t.Fatalf("TrustCount should be 3, not %d", tc)
+	}
+	if w := peerSet.WeightOf(peerSet.Peers[3].PubKeyHex); w != 5 {
+		t.Fatalf("WeightOf should be 5, not %d", w)
+	}
+	if w := peerSet.WeightOf("0xUNKNOWN"); w != 0 {
+		t.Fatalf("WeightOf unknown Peer should be 0, not %d", w)
+	}
+
+	//The cached values follow the new weights
+	newPeerSet := peerSet.WithRemovedPeer(peerSet.Peers[3])
+	if sm := newPeerSet.SuperMajority(); sm != 3 {
+		t.Fatalf("SuperMajority should be 3, not %d", sm)
+	}
+}
+
+func TestPeerSetHashWeights(t *testing.T) {
+	peers := newTestPeers([]int{0, 0, 0})
+
+	unweighted := NewPeerSet(peers)
+	unweightedHash, _ := unweighted.Hash()
+
+	//A Weight of 1 is the same as no Weight
+	ones := []*Peer{}
+	for _, p := range peers {
+		ones = append(ones, &Peer{NetAddr: p.NetAddr, PubKeyHex: p.PubKeyHex, Weight: 1})
+	}
+	onesHash, _ := NewPeerSet(ones).Hash()
+	if !reflect.DeepEqual(unweightedHash, onesHash) {
+		t.Fatalf("PeerSets with Weight 1 should have the same Hash as unweighted PeerSets")
+	}
+
+	weighted := []*Peer{}
+	for i, p := range peers {
+		weighted = append(weighted, &Peer{NetAddr: p.NetAddr, PubKeyHex: p.PubKeyHex, Weight: i + 1})
+	}
+	weightedHash, _ := NewPeerSet(weighted).Hash()
+	if reflect.DeepEqual(unweightedHash, weightedHash) {
+		t.Fatalf("Weighted PeerSet should not have the same Hash as unweighted PeerSet")
+	}
+}
+
+func TestPeerSetMarshalWeights(t *testing.T) {
+	peerSet := NewPeerSet(newTestPeers([]int{0, 2, 3}))
+
+	raw, err := peerSet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPeerSet, err := NewPeerSetFromPeerSliceBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, p := range newPeerSet.Peers {
+		if p.Weight != peerSet.Peers[i].Weight {
+			t.Fatalf("peers[%d] Weight should be %d, not %d", i, peerSet.Peers[i].Weight, p.Weight)
+		}
+	}
+
+	if newPeerSet.TotalWeight() != 6 {
+		t.Fatalf("TotalWeight should be 6, not %d", newPeerSet.TotalWeight())
+	}
+}
@@ -50,6 +50,7 @@ func TestInmemDummyServerSide(t *testing.T) {
 			[][]byte{
 				[]byte(fmt.Sprintf("block %d transaction", i)),
 			},
+			nil,
 		)
 	}
 
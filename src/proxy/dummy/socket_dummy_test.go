@@ -85,6 +85,7 @@ func TestSocketProxyClient(t *testing.T) {
 			[][]byte{
 				[]byte(fmt.Sprintf("block %d transaction", i)),
 			},
+			nil,
 		)
 	}
 
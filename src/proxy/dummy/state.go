@@ -46,8 +46,15 @@ func (a *State) CommitHandler(block hashgraph.Block) (proxy.CommitResponse, erro
 		return proxy.CommitResponse{}, err
 	}
 
+	//The dummy app accepts all InternalTransactions
+	receipts := []hashgraph.InternalTransactionReceipt{}
+	for _, itx := range block.InternalTransactions() {
+		receipts = append(receipts, itx.AsAccepted())
+	}
+
 	response := proxy.CommitResponse{
-		StateHash: a.stateHash,
+		StateHash:                   a.stateHash,
+		InternalTransactionReceipts: receipts,
 	}
 
 	return response, nil
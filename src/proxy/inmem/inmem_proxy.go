@@ -10,6 +10,7 @@ import (
 type InmemProxy struct {
 	handler  proxy.ProxyHandler
 	submitCh chan []byte
+	txPool   *proxy.TxPool
 	logger   *logrus.Logger
 }
 
@@ -35,8 +36,14 @@ func NewInmemProxy(handler proxy.ProxyHandler,
 * SubmitTx                                                                     *
 *******************************************************************************/
 
-//SubmitTx is called by the App to submit a transaction to Babble
-func (p *InmemProxy) SubmitTx(tx []byte) {
+//SubmitTx is called by the App to submit a transaction to Babble. It returns
+//an error if the transaction is rejected by the node's TxPool.
+func (p *InmemProxy) SubmitTx(tx []byte) error {
+	if err := p.txPool.Admit(tx); err != nil {
+		p.logger.WithError(err).Debug("InmemProxy.SubmitTx rejected")
+		return err
+	}
+
 	//have to make a copy, or the tx will be garbage collected and weird stuff
 	//happens in transaction pool
 	t := make([]byte, len(tx), len(tx))
@@ -44,6 +51,13 @@ func (p *InmemProxy) SubmitTx(tx []byte) {
 	copy(t, tx)
 
 	p.submitCh <- t
+
+	return nil
+}
+
+//SetTxPool implements the TxPoolProxy interface
+func (p *InmemProxy) SetTxPool(pool *proxy.TxPool) {
+	p.txPool = pool
 }
 
 /*******************************************************************************
@@ -65,6 +79,7 @@ func (p *InmemProxy) CommitBlock(block hg.Block) (proxy.CommitResponse, error) {
 		"frame_hash":     block.FrameHash(),
 		"peers_hash":     block.PeersHash(),
 		"state_hash":     block.StateHash(),
+		"timestamp":      block.Timestamp(),
 		"txs":            len(block.Transactions()),
 		"response":       commitResponse,
 		"err":            err,
@@ -87,7 +87,7 @@ func TestInmemProxyBabbleSide(t *testing.T) {
 		[]byte("tx 3"),
 	}
 
-	block := hashgraph.NewBlock(0, 1, []byte{}, []*peers.Peer{}, transactions)
+	block := hashgraph.NewBlock(0, 1, []byte{}, []*peers.Peer{}, transactions, nil)
 
 	/***************************************************************************
 	Commit
@@ -128,3 +128,36 @@ func TestInmemProxyBabbleSide(t *testing.T) {
 		t.Fatalf("Error restoring snapshot: %v", err)
 	}
 }
+
+func TestInmemProxyTxPool(t *testing.T) {
+	testProxy := NewTestProxy(t)
+
+	pool := proxy.NewTxPool(10, 2, 0)
+	testProxy.SetTxPool(pool)
+
+	go func() {
+		for range testProxy.SubmitCh() {
+		}
+	}()
+
+	if err := testProxy.SubmitTx([]byte("this is too large")); err != proxy.ErrTxTooLarge {
+		t.Fatalf("SubmitTx should return ErrTxTooLarge, not %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := testProxy.SubmitTx([]byte("tx")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := testProxy.SubmitTx([]byte("tx")); err != proxy.ErrTxPoolFull {
+		t.Fatalf("SubmitTx should return ErrTxPoolFull, not %v", err)
+	}
+
+	//Room is made when the transactions are included in an Event
+	pool.Release([][]byte{[]byte("tx")})
+
+	if err := testProxy.SubmitTx([]byte("tx")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -52,6 +52,11 @@ func (p *SocketAppProxy) SubmitCh() chan []byte {
 	return p.server.submitCh
 }
 
+//SetTxPool implements the TxPoolProxy interface
+func (p *SocketAppProxy) SetTxPool(pool *proxy.TxPool) {
+	p.server.txPool = pool
+}
+
 func (p *SocketAppProxy) CommitBlock(block hashgraph.Block) (proxy.CommitResponse, error) {
 	return p.client.CommitBlock(block)
 }
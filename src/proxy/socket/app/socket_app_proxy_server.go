@@ -5,6 +5,7 @@ import (
 	"net/rpc"
 	"net/rpc/jsonrpc"
 
+	"github.com/mosaicnetworks/babble/src/proxy"
 	"github.com/sirupsen/logrus"
 )
 
@@ -12,6 +13,7 @@ type SocketAppProxyServer struct {
 	netListener *net.Listener
 	rpcServer   *rpc.Server
 	submitCh    chan []byte
+	txPool      *proxy.TxPool
 	logger      *logrus.Logger
 }
 
@@ -63,6 +65,12 @@ func (p *SocketAppProxyServer) listen() {
 func (p *SocketAppProxyServer) SubmitTx(tx []byte, ack *bool) error {
 	p.logger.Debug("SubmitTx")
 
+	if err := p.txPool.Admit(tx); err != nil {
+		p.logger.WithError(err).Debug("SubmitTx rejected")
+		*ack = false
+		return err
+	}
+
 	p.submitCh <- tx
 
 	*ack = true
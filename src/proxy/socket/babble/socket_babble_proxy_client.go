@@ -44,7 +44,10 @@ func (p *SocketBabbleProxyClient) SubmitTx(tx []byte) (*bool, error) {
 	err := p.rpc.Call("Babble.SubmitTx", tx, &ack)
 
 	if err != nil {
-		p.rpc = nil
+		//A transaction rejected by Babble does not break the connection
+		if _, ok := err.(rpc.ServerError); !ok {
+			p.rpc = nil
+		}
 
 		return nil, err
 	}
@@ -103,6 +103,37 @@ func TestSocketProxyServer(t *testing.T) {
 	}
 }
 
+func TestSocketProxyServerTxPool(t *testing.T) {
+	clientAddr := "127.0.0.1:6994"
+	proxyAddr := "127.0.0.1:6995"
+
+	appProxy, err := aproxy.NewSocketAppProxy(clientAddr, proxyAddr, 1*time.Second, common.NewTestLogger(t))
+	if err != nil {
+		t.Fatalf("Cannot create SocketAppProxy: %s", err)
+	}
+
+	appProxy.SetTxPool(proxy.NewTxPool(0, 1, 0))
+
+	go func() {
+		for range appProxy.SubmitCh() {
+		}
+	}()
+
+	babbleProxy, err := bproxy.NewSocketBabbleProxy(proxyAddr, clientAddr, NewTestHandler(t), 1*time.Second, common.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := babbleProxy.SubmitTx([]byte("tx 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = babbleProxy.SubmitTx([]byte("tx 2"))
+	if err == nil || err.Error() != proxy.ErrTxPoolFull.Error() {
+		t.Fatalf("SubmitTx should return %v, not %v", proxy.ErrTxPoolFull, err)
+	}
+}
+
 func TestSocketProxyClient(t *testing.T) {
 	clientAddr := "127.0.0.1:6992"
 	proxyAddr := "127.0.0.1:6993"
@@ -126,7 +157,7 @@ func TestSocketProxyClient(t *testing.T) {
 		[]byte("tx 3"),
 	}
 
-	block := hashgraph.NewBlock(0, 1, []byte{}, []*peers.Peer{}, transactions)
+	block := hashgraph.NewBlock(0, 1, []byte{}, []*peers.Peer{}, transactions, nil)
 
 	expectedStateHash := []byte("statehash")
 	expectedSnapshot := []byte("snapshot")
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	//ErrTxTooLarge is returned when a transaction is larger than the maximum
+	//transaction size
+	ErrTxTooLarge = errors.New("Transaction too large")
+
+	//ErrTxPoolFull is returned when accepting a transaction would take the
+	//pool over its maximum number of transactions or bytes
+	ErrTxPoolFull = errors.New("Transaction pool full")
+)
+
+/*
+TxPool keeps count of the transactions that were accepted from the App and are
+not yet included in an Event, and rejects new transactions beyond its limits.
+A zero limit means no limit. Events created by a node carry all the
+transactions of its pool, so the limits also bound the transactions of an Event;
+all peers must use the same limits, otherwise they will reject each other's
+Events. A nil TxPool accepts everything.
+*/
+type TxPool struct {
+	maxTxBytes      int
+	maxTransactions int
+	maxBytes        int
+
+	lock         sync.Mutex
+	transactions int
+	bytes        int
+}
+
+//NewTxPool creates a TxPool with a maximum transaction size, a maximum number
+//of transactions, and a maximum total size of transactions
+func NewTxPool(maxTxBytes, maxTransactions, maxBytes int) *TxPool {
+	return &TxPool{
+		maxTxBytes:      maxTxBytes,
+		maxTransactions: maxTransactions,
+		maxBytes:        maxBytes,
+	}
+}
+
+//Admit accounts for a new transaction, or returns ErrTxTooLarge or
+//ErrTxPoolFull if the transaction must be rejected
+func (p *TxPool) Admit(tx []byte) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.maxTxBytes > 0 && len(tx) > p.maxTxBytes {
+		return ErrTxTooLarge
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if (p.maxTransactions > 0 && p.transactions+1 > p.maxTransactions) ||
+		(p.maxBytes > 0 && p.bytes+len(tx) > p.maxBytes) {
+		return ErrTxPoolFull
+	}
+
+	p.transactions++
+	p.bytes += len(tx)
+
+	return nil
+}
+
+//Release frees the room taken by admitted transactions once they are included
+//in an Event
+func (p *TxPool) Release(txs [][]byte) {
+	if p == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, tx := range txs {
+		p.transactions--
+		p.bytes -= len(tx)
+	}
+
+	//Transactions that were added to the node without going through Admit
+	if p.transactions < 0 || p.bytes < 0 {
+		p.transactions = 0
+		p.bytes = 0
+	}
+}
+
+//Len returns the number of admitted transactions and their total size
+func (p *TxPool) Len() (int, int) {
+	if p == nil {
+		return 0, 0
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.transactions, p.bytes
+}
+
+//CheckEvent returns an error if the transactions of an Event exceed the limits,
+//which the Events of honest peers never do
+func (p *TxPool) CheckEvent(txs [][]byte) error {
+	if p == nil {
+		return nil
+	}
+
+	bytes := 0
+	for _, tx := range txs {
+		if p.maxTxBytes > 0 && len(tx) > p.maxTxBytes {
+			return fmt.Errorf("%v: %d bytes", ErrTxTooLarge, len(tx))
+		}
+		bytes += len(tx)
+	}
+
+	if p.maxTransactions > 0 && len(txs) > p.maxTransactions {
+		return fmt.Errorf("Too many transactions: %d", len(txs))
+	}
+
+	if p.maxBytes > 0 && bytes > p.maxBytes {
+		return fmt.Errorf("Too many transaction bytes: %d", bytes)
+	}
+
+	return nil
+}
+
+//TxPoolProxy is implemented by AppProxies that reject the transactions
+//submitted by the App when the node's TxPool is full
+type TxPoolProxy interface {
+	SetTxPool(pool *TxPool)
+}
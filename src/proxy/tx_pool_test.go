@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func TestTxPool(t *testing.T) {
+	pool := NewTxPool(5, 3, 8)
+
+	if err := pool.Admit([]byte("123456")); err != ErrTxTooLarge {
+		t.Fatalf("Admit should return ErrTxTooLarge, not %v", err)
+	}
+
+	txs := [][]byte{[]byte("abc"), []byte("de"), []byte("fg")}
+	for _, tx := range txs {
+		if err := pool.Admit(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pool.Admit([]byte("h")); err != ErrTxPoolFull {
+		t.Fatalf("Admit should return ErrTxPoolFull (count), not %v", err)
+	}
+
+	pool.Release(txs[2:])
+
+	if err := pool.Admit([]byte("hijk")); err != ErrTxPoolFull {
+		t.Fatalf("Admit should return ErrTxPoolFull (bytes), not %v", err)
+	}
+
+	if err := pool.Admit([]byte("hij")); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, bytes := pool.Len(); count != 3 || bytes != 8 {
+		t.Fatalf("Len should be 3 transactions and 8 bytes, not %d and %d", count, bytes)
+	}
+
+	//Events are checked against the same limits
+	if err := pool.CheckEvent(txs); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := [][][]byte{
+		{[]byte("123456")},
+		{[]byte("a"), []byte("b"), []byte("c"), []byte("d")},
+		{[]byte("abcde"), []byte("fghij")},
+	}
+	for i, c := range cases {
+		if err := pool.CheckEvent(c); err == nil {
+			t.Fatalf("CheckEvent should reject case %d", i)
+		}
+	}
+
+	//A nil TxPool accepts everything
+	var unlimited *TxPool
+	if err := unlimited.Admit(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,16 +2,27 @@ package proxy
 
 import "github.com/mosaicnetworks/babble/src/hashgraph"
 
+//CommitResponse captures the response to a CommitBlock call. StateHash is the
+//resulting state hash of the application, and InternalTransactionReceipts
+//indicate which of the Block's InternalTransactions were accepted or refused
+//by the application.
 type CommitResponse struct {
-	StateHash []byte
+	StateHash                   []byte
+	InternalTransactionReceipts []hashgraph.InternalTransactionReceipt
 }
 
 type CommitCallback func(block hashgraph.Block) (CommitResponse, error)
 
 //DummyCommitCallback is used for testing
 func DummyCommitCallback(block hashgraph.Block) (CommitResponse, error) {
+	receipts := []hashgraph.InternalTransactionReceipt{}
+	for _, itx := range block.InternalTransactions() {
+		receipts = append(receipts, itx.AsAccepted())
+	}
+
 	res := CommitResponse{
-		StateHash: []byte{},
+		StateHash:                   []byte{},
+		InternalTransactionReceipts: receipts,
 	}
 
 	return res, nil
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/node"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+AdminService serves the requests that control the node, like /leave, over HTTP
+on a Unix socket. Unlike the Service, which anyone who can reach its address
+can query, it is not exposed to the network: the socket is created in a
+directory that only the user running the node can access.
+*/
+type AdminService struct {
+	socketPath string
+	node       *node.Node
+	listener   net.Listener
+	server     *http.Server
+	logger     *logrus.Logger
+}
+
+func NewAdminService(socketPath string, n *node.Node, logger *logrus.Logger) *AdminService {
+	service := AdminService{
+		socketPath: socketPath,
+		node:       n,
+		logger:     logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/leave", service.Leave)
+	service.server = &http.Server{Handler: mux}
+
+	return &service
+}
+
+//Listen creates the socket. The directory of the socket is restricted to its
+//owner before the socket is created, because connecting requires the
+//permission to traverse it, whatever the mode of the socket itself.
+func (s *AdminService) Listen() error {
+	dir := filepath.Dir(s.socketPath)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+
+	//A socket left over by a node that did not shut down cleanly
+	if _, err := os.Stat(s.socketPath); err == nil {
+		if conn, err := net.Dial("unix", s.socketPath); err == nil {
+			conn.Close()
+			return fmt.Errorf("Admin socket %s is used by another node", s.socketPath)
+		}
+		if err := os.Remove(s.socketPath); err != nil {
+			return err
+		}
+	}
+
+	l, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return err
+	}
+
+	s.listener = l
+
+	return nil
+}
+
+//Serve serves requests on the socket created by Listen
+func (s *AdminService) Serve() {
+	s.logger.WithField("socket", s.socketPath).Debug("Admin service serving")
+
+	err := s.server.Serve(s.listener)
+
+	if err != nil && err != http.ErrServerClosed {
+		s.logger.WithField("error", err).Error("Admin service failed")
+	}
+}
+
+//Shutdown stops the AdminService and removes the socket. A leave request in
+//progress, which waits for the node to shut down, still gets its response.
+func (s *AdminService) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.WithField("error", err).Error("Shutting down admin service")
+	}
+}
+
+//Leave serves POST /leave, which makes the node leave the network gracefully.
+//It responds once the node has left and shut down, which also terminates the
+//babble run command.
+func (s *AdminService) Leave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+
+		http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if err := s.node.Leave(); err != nil {
+		s.logger.WithError(err).Error("Leaving")
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mosaicnetworks/babble/src/common"
+)
+
+func TestAdminService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "babble_admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "admin", "babble.sock")
+
+	//A socket left over by a node that crashed is replaced
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := NewAdminService(socket, nil, common.NewTestLogger(t))
+	if err := admin.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go admin.Serve()
+
+	info, err := os.Stat(filepath.Dir(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("Directory of the admin socket should only be accessible by its owner, not %v", info.Mode().Perm())
+	}
+
+	//A second node cannot take the socket over
+	if err := NewAdminService(socket, nil, common.NewTestLogger(t)).Listen(); err == nil || !strings.Contains(err.Error(), "used by another node") {
+		t.Fatalf("Listening on a socket in use should fail, not return %v", err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	resp, err := client.Get("http://babble/leave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /leave should not be allowed, not return %s", resp.Status)
+	}
+
+	//The admin socket does not serve the public Service
+	resp, err = client.Get("http://babble/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("/stats should not be served, not return %s", resp.Status)
+	}
+
+	admin.Shutdown()
+
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatalf("Shutdown should remove the socket: %v", err)
+	}
+}
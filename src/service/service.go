@@ -1,10 +1,16 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mosaicnetworks/babble/src/common"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
 	"github.com/mosaicnetworks/babble/src/node"
 	"github.com/sirupsen/logrus"
 )
@@ -13,6 +19,7 @@ type Service struct {
 	bindAddress string
 	node        *node.Node
 	graph       *node.Graph
+	server      *http.Server
 	logger      *logrus.Logger
 }
 
@@ -21,6 +28,7 @@ func NewService(bindAddress string, n *node.Node, logger *logrus.Logger) *Servic
 		bindAddress: bindAddress,
 		node:        n,
 		graph:       node.NewGraph(n),
+		server:      &http.Server{Addr: bindAddress},
 		logger:      logger,
 	}
 
@@ -36,15 +44,32 @@ func (s *Service) Serve() {
 
 	http.HandleFunc("/graph", s.GetGraph)
 
+	http.HandleFunc("/graph.dot", s.GetGraphDot)
+
 	http.HandleFunc("/peers", s.GetPeers)
 
-	err := http.ListenAndServe(s.bindAddress, nil)
+	http.HandleFunc("/forkproofs", s.GetForkProofs)
 
-	if err != nil {
+	http.HandleFunc("/tx/", s.GetTx)
+
+	err := s.server.ListenAndServe()
+
+	if err != nil && err != http.ErrServerClosed {
 		s.logger.WithField("error", err).Error("Service failed")
 	}
 }
 
+//Shutdown stops the Service. Requests in progress still get to send their
+//responses.
+func (s *Service) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.WithField("error", err).Error("Shutting down service")
+	}
+}
+
 func (s *Service) GetStats(w http.ResponseWriter, r *http.Request) {
 	stats := s.node.GetStats()
 
@@ -53,8 +78,24 @@ func (s *Service) GetStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+/*
+GetBlock serves /block/{block_index} and, for transaction inclusion proofs,
+/block/{block_index}/tx/{tx_index}/proof
+*/
 func (s *Service) GetBlock(w http.ResponseWriter, r *http.Request) {
-	param := r.URL.Path[len("/block/"):]
+	params := strings.Split(r.URL.Path[len("/block/"):], "/")
+
+	if len(params) == 4 && params[1] == "tx" && params[3] == "proof" {
+		s.GetTxProof(w, params[0], params[2])
+		return
+	}
+
+	if len(params) != 1 {
+		http.Error(w, fmt.Sprintf("Unknown path %s", r.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	param := params[0]
 
 	blockIndex, err := strconv.Atoi(param)
 
@@ -81,6 +122,48 @@ func (s *Service) GetBlock(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(block)
 }
 
+func (s *Service) GetTxProof(w http.ResponseWriter, blockParam, txParam string) {
+	blockIndex, err := strconv.Atoi(blockParam)
+	if err != nil {
+		s.logger.WithError(err).Errorf("Parsing block_index parameter %s", blockParam)
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	txIndex, err := strconv.Atoi(txParam)
+	if err != nil {
+		s.logger.WithError(err).Errorf("Parsing tx_index parameter %s", txParam)
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	block, err := s.node.GetBlock(blockIndex)
+	if err != nil {
+		s.logger.WithError(err).Errorf("Retrieving block %d", blockIndex)
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	proof, err := block.TxProof(txIndex)
+	if err != nil {
+		s.logger.WithError(err).Errorf("Computing proof of tx %d in block %d", txIndex, blockIndex)
+
+		http.Error(w, err.Error(), http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(proof)
+}
+
 func (s *Service) GetGraph(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -91,6 +174,43 @@ func (s *Service) GetGraph(w http.ResponseWriter, r *http.Request) {
 	encoder.Encode(res)
 }
 
+/*
+GetGraphDot serves /graph.dot, which draws the hashgraph in Graphviz DOT format.
+The optional from and to query parameters restrict it to a range of rounds.
+*/
+func (s *Service) GetGraphDot(w http.ResponseWriter, r *http.Request) {
+	from, to := 0, -1
+
+	for param, value := range map[string]*int{"from": &from, "to": &to} {
+		if v := r.URL.Query().Get(param); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				s.logger.WithError(err).Errorf("Parsing %s parameter %s", param, v)
+
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+			*value = i
+		}
+	}
+
+	infos, err := s.graph.GetInfos()
+	if err != nil {
+		s.logger.WithError(err).Error("Retrieving graph")
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.graphviz")
+
+	if err := infos.FilterRounds(from, to).WriteDot(w); err != nil {
+		s.logger.WithError(err).Error("Writing graph")
+	}
+}
+
 func (s *Service) GetPeers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -100,3 +220,65 @@ func (s *Service) GetPeers(w http.ResponseWriter, r *http.Request) {
 
 	encoder.Encode(res)
 }
+
+func (s *Service) GetForkProofs(w http.ResponseWriter, r *http.Request) {
+	proofs, err := s.node.GetForkProofs()
+
+	if err != nil {
+		s.logger.WithError(err).Error("Retrieving ForkProofs")
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(proofs)
+}
+
+//TxStatus is the response of the /tx/{hash} endpoint. Location and Block are
+//only set if the transaction was committed.
+type TxStatus struct {
+	TxHash    string
+	Committed bool
+	Location  *hg.TxLocation  `json:",omitempty"`
+	Block     *hg.BlockHeader `json:",omitempty"`
+}
+
+//GetTx serves /tx/{tx_hash}, which tells whether a transaction was committed,
+//and in which Block
+func (s *Service) GetTx(w http.ResponseWriter, r *http.Request) {
+	hash := hg.NormalizeTxHash(r.URL.Path[len("/tx/"):])
+
+	status := TxStatus{TxHash: hash}
+
+	location, err := s.node.GetTxLocation(hash)
+	switch {
+	case err == nil:
+		block, err := s.node.GetBlock(location.BlockIndex)
+		if err != nil {
+			s.logger.WithError(err).Errorf("Retrieving block %d", location.BlockIndex)
+
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		header := block.Header()
+
+		status.Committed = true
+		status.Location = location
+		status.Block = &header
+	case !common.Is(err, common.KeyNotFound):
+		s.logger.WithError(err).Errorf("Retrieving location of tx %s", hash)
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,44 @@
+package simulation
+
+import (
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/proxy"
+	"github.com/mosaicnetworks/babble/src/proxy/dummy"
+	"github.com/sirupsen/logrus"
+)
+
+//appSubmitBuffer is the number of transactions that can wait for the next
+//Heartbeat of a node
+const appSubmitBuffer = 1000
+
+//app implements the AppProxy interface on top of the dummy State. Unlike the
+//InmemProxy, its SubmitCh is buffered so that the Simulation can submit
+//transactions without blocking; nodes pick them up on their next Heartbeat.
+type app struct {
+	submitCh chan []byte
+	state    *dummy.State
+}
+
+func newApp(logger *logrus.Logger) *app {
+	return &app{
+		submitCh: make(chan []byte, appSubmitBuffer),
+		state:    dummy.NewState(logger),
+	}
+}
+
+func (a *app) SubmitCh() chan []byte {
+	return a.submitCh
+}
+
+func (a *app) CommitBlock(block hg.Block) (proxy.CommitResponse, error) {
+	return a.state.CommitHandler(block)
+}
+
+func (a *app) GetSnapshot(blockIndex int) ([]byte, error) {
+	return a.state.SnapshotHandler(blockIndex)
+}
+
+func (a *app) Restore(snapshot []byte) error {
+	_, err := a.state.RestoreHandler(snapshot)
+	return err
+}
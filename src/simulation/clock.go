@@ -0,0 +1,95 @@
+package simulation
+
+import (
+	"container/heap"
+	"time"
+)
+
+/*
+Clock is a virtual clock. Time only moves when Step fires the next pending
+timer, so a simulation can cover minutes of heartbeats and network delays in
+a fraction of a second. Timers due at the same time fire in the order in which
+they were created. Clock is not safe for concurrent use; the Simulation only
+lets one goroutine run at a time.
+*/
+type Clock struct {
+	now    time.Time
+	seq    int
+	timers timerHeap
+}
+
+//NewClock creates a Clock that starts at start
+func NewClock(start time.Time) *Clock {
+	return &Clock{
+		now:    start,
+		timers: timerHeap{},
+	}
+}
+
+//Now returns the current virtual time
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+//After has the signature of node.TimerFactory. The returned channel receives
+//the virtual time once d has elapsed on the Clock.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.AfterFunc(d, func() {
+		ch <- c.now
+	})
+	return ch
+}
+
+//AfterFunc schedules f to be called by Step once d has elapsed on the Clock
+func (c *Clock) AfterFunc(d time.Duration, f func()) {
+	if d < 0 {
+		d = 0
+	}
+	heap.Push(&c.timers, &timer{
+		when: c.now.Add(d),
+		seq:  c.seq,
+		f:    f,
+	})
+	c.seq++
+}
+
+//Step moves the Clock to the next pending timer and fires it. It returns false
+//if no timer is due before deadline.
+func (c *Clock) Step(deadline time.Time) bool {
+	if len(c.timers) == 0 || c.timers[0].when.After(deadline) {
+		return false
+	}
+
+	t := heap.Pop(&c.timers).(*timer)
+	c.now = t.when
+	t.f()
+
+	return true
+}
+
+type timer struct {
+	when time.Time
+	seq  int
+	f    func()
+}
+
+//timerHeap implements heap.Interface, ordering timers by due time, then by
+//creation order
+type timerHeap []*timer
+
+func (h timerHeap) Len() int { return len(h) }
+func (h timerHeap) Less(i, j int) bool {
+	if !h[i].when.Equal(h[j].when) {
+		return h[i].when.Before(h[j].when)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h timerHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *timerHeap) Push(x interface{}) { *h = append(*h, x.(*timer)) }
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,92 @@
+package simulation
+
+import (
+	"math/rand"
+	"time"
+)
+
+/*
+Fault describes the misbehaviour of the network during a window of the
+simulation. Start and End are offsets from the beginning of the simulation; an
+End of 0 means that the Fault lasts until the end. Every message, request or
+response, sent during the window is:
+
+  - dropped with probability Drop,
+  - delayed by a duration picked uniformly between MinDelay and MaxDelay,
+  - delivered twice with probability Duplicate.
+
+If Partition is not empty, the listed nodes cannot exchange messages with the
+other nodes during the window, but can still talk to each other.
+*/
+type Fault struct {
+	Start     time.Duration
+	End       time.Duration
+	Drop      float64
+	Duplicate float64
+	MinDelay  time.Duration
+	MaxDelay  time.Duration
+	Partition []int
+}
+
+func (f *Fault) active(elapsed time.Duration) bool {
+	return elapsed >= f.Start && (f.End == 0 || elapsed < f.End)
+}
+
+func (f *Fault) partitioned(from, to int) bool {
+	in := func(id int) bool {
+		for _, p := range f.Partition {
+			if p == id {
+				return true
+			}
+		}
+		return false
+	}
+	return len(f.Partition) > 0 && in(from) != in(to)
+}
+
+//verdict is the fate of a single message
+type verdict struct {
+	drop      bool
+	duplicate bool
+	delay     time.Duration
+	reason    string
+}
+
+/*
+judge decides the fate of a message from one node to another, combining the
+Faults that are active at elapsed. It always draws the same number of values
+from rnd for a given set of active Faults, so that a change in the outcome of
+one message does not shift the decisions made for the following ones.
+*/
+func judge(faults []Fault, elapsed time.Duration, from, to int, rnd *rand.Rand) verdict {
+	v := verdict{}
+
+	for i := range faults {
+		f := &faults[i]
+		if !f.active(elapsed) {
+			continue
+		}
+
+		drop := rnd.Float64()
+		duplicate := rnd.Float64()
+		delay := rnd.Int63()
+
+		if f.partitioned(from, to) {
+			v.drop = true
+			v.reason = "partition"
+		}
+		if drop < f.Drop && !v.drop {
+			v.drop = true
+			v.reason = "drop"
+		}
+		if duplicate < f.Duplicate {
+			v.duplicate = true
+		}
+		v.delay += f.MinDelay
+		if spread := f.MaxDelay - f.MinDelay; spread > 0 {
+			v.delay += time.Duration(delay % int64(spread))
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,454 @@
+package simulation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/crypto"
+	hg "github.com/mosaicnetworks/babble/src/hashgraph"
+	"github.com/mosaicnetworks/babble/src/net"
+	"github.com/mosaicnetworks/babble/src/node"
+	"github.com/mosaicnetworks/babble/src/peers"
+	"github.com/sirupsen/logrus"
+)
+
+//Config contains the parameters of a Simulation. Durations are measured on the
+//virtual Clock.
+type Config struct {
+	Nodes            int           //number of nodes
+	Seed             int64         //seed of the scheduler
+	Duration         time.Duration //virtual time after which the simulation stops
+	HeartbeatTimeout time.Duration //heartbeat of the nodes
+	Timeout          time.Duration //time after which an unanswered RPC fails
+	TxInterval       time.Duration //interval between transactions. 0 disables transactions
+	CacheSize        int
+	SyncLimit        int
+	Faults           []Fault
+	Logger           *logrus.Logger
+}
+
+//DefaultConfig returns the Config of a fault-free simulation of 4 nodes
+func DefaultConfig() *Config {
+	logger := logrus.New()
+	logger.Level = logrus.DebugLevel
+
+	return &Config{
+		Nodes:            4,
+		Seed:             1,
+		Duration:         10 * time.Second,
+		HeartbeatTimeout: 10 * time.Millisecond,
+		Timeout:          200 * time.Millisecond,
+		TxInterval:       50 * time.Millisecond,
+		CacheSize:        5000,
+		SyncLimit:        1000,
+		Logger:           logger,
+	}
+}
+
+/*
+Simulation runs a set of Babble nodes in a single process, on a virtual Clock,
+over a network that misbehaves according to a list of Faults.
+
+The nodes do not run their own Run loops. The Simulation fires their
+heartbeats from the virtual Clock, through their ControlTimer's TimerFactory,
+and delivers their RPCs after a delay decided by the Faults. Every heartbeat
+runs in its own goroutine, because gossip blocks on RPCs, but only one
+goroutine runs at any time: a heartbeat runs until it finishes or waits for an
+RPC, and the Simulation only resumes it when the response is delivered or the
+RPC times out. All choices - jitter of the heartbeats, gossip partners,
+transactions, and the fate of every message - are drawn from a single source
+seeded with Config.Seed, so the schedule of a simulation, recorded in its
+Trace, is a function of its Config. When the nodes disagree on a Block, the
+seed is enough to replay the run that led to it.
+*/
+type Simulation struct {
+	conf   *Config
+	logger *logrus.Entry
+
+	clock *Clock
+	start time.Time
+	rnd   *rand.Rand
+
+	nodes      []*node.Node
+	apps       []*app
+	byAddr     map[string]int
+	heartbeats []<-chan time.Time
+	lastPeer   []uint32
+	routines   []int
+
+	yieldCh  chan struct{}
+	calls    map[int]*call
+	nextCall int
+	stopped  bool
+
+	trace []string
+	txs   int
+}
+
+//call is an RPC waiting for its response
+type call struct {
+	id      int
+	from    int
+	to      int
+	args    interface{}
+	replyCh chan net.RPCResponse
+	done    bool
+}
+
+//NewSimulation creates and initializes the nodes of a Simulation
+func NewSimulation(conf *Config) (*Simulation, error) {
+	start := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	s := &Simulation{
+		conf:     conf,
+		logger:   conf.Logger.WithField("seed", conf.Seed),
+		clock:    NewClock(start),
+		start:    start,
+		rnd:      rand.New(rand.NewSource(conf.Seed)),
+		byAddr:   make(map[string]int),
+		lastPeer: make([]uint32, conf.Nodes),
+		routines: make([]int, conf.Nodes),
+		yieldCh:  make(chan struct{}),
+		calls:    make(map[int]*call),
+		trace:    []string{},
+	}
+
+	keys := []*ecdsa.PrivateKey{}
+	peerSlice := []*peers.Peer{}
+	for i := 0; i < conf.Nodes; i++ {
+		key := newKey(s.rnd)
+		addr := fmt.Sprintf("node%d", i)
+
+		keys = append(keys, key)
+		peerSlice = append(peerSlice, peers.NewPeer(
+			fmt.Sprintf("0x%X", crypto.FromECDSAPub(&key.PublicKey)),
+			addr))
+		s.byAddr[addr] = i
+	}
+	peerSet := peers.NewPeerSet(peerSlice)
+
+	for i, key := range keys {
+		nodeConf := node.NewConfig(conf.HeartbeatTimeout,
+			conf.Timeout,
+			conf.CacheSize,
+			conf.SyncLimit,
+			conf.Logger)
+		nodeConf.TimerFactory = s.timerFactory
+		nodeConf.Clock = s.clock.Now
+
+		app := newApp(conf.Logger)
+
+		n := node.NewNode(nodeConf,
+			peerSlice[i].ID(),
+			key,
+			peerSet,
+			hg.NewInmemStore(conf.CacheSize),
+			newTransport(s, i, peerSlice[i].NetAddr),
+			app)
+
+		if err := n.Init(); err != nil {
+			return nil, fmt.Errorf("Initializing node %d: %v", i, err)
+		}
+
+		s.nodes = append(s.nodes, n)
+		s.apps = append(s.apps, app)
+	}
+
+	return s, nil
+}
+
+//newKey derives a private key from rnd, so that the identities of the nodes
+//are also a function of the seed
+func newKey(rnd *rand.Rand) *ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	one := big.NewInt(1)
+
+	d := new(big.Int).Rand(rnd, new(big.Int).Sub(curve.Params().N, one))
+	d.Add(d, one)
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+
+	return key
+}
+
+//Nodes returns the nodes of the Simulation, in the order of Config
+func (s *Simulation) Nodes() []*node.Node {
+	return s.nodes
+}
+
+//Trace returns the schedule of the Simulation so far: one line per heartbeat,
+//transaction, and message
+func (s *Simulation) Trace() []string {
+	return s.trace
+}
+
+/*
+Run executes the Simulation until Config.Duration has elapsed on the virtual
+Clock, shuts the nodes down, and returns the result of Check.
+*/
+func (s *Simulation) Run() error {
+	for _, n := range s.nodes {
+		s.heartbeats = append(s.heartbeats, n.NextHeartbeat())
+	}
+
+	if s.conf.TxInterval > 0 {
+		s.clock.AfterFunc(s.conf.TxInterval, s.submitTransaction)
+	}
+
+	deadline := s.start.Add(s.conf.Duration)
+	for s.clock.Step(deadline) {
+		for i, hb := range s.heartbeats {
+			select {
+			case <-hb:
+				s.heartbeat(i)
+			default:
+			}
+		}
+	}
+
+	s.stop()
+
+	return s.Check()
+}
+
+/*
+Check verifies that the nodes agree on the hash of the body of every Block
+that more than one of them committed; signatures are collected at different
+times by different nodes, so they are left out. Nodes that fast-forwarded do
+not have the Blocks below the one they started from, so only the Blocks that a
+node has are compared.
+*/
+func (s *Simulation) Check() error {
+	last := -1
+	for _, n := range s.nodes {
+		if l := n.GetLastBlockIndex(); l > last {
+			last = l
+		}
+	}
+
+	for index := 0; index <= last; index++ {
+		var refHash []byte
+		refNode := -1
+
+		for i, n := range s.nodes {
+			block, err := n.GetBlock(index)
+			if err != nil {
+				continue
+			}
+
+			hash, err := block.Body.Hash()
+			if err != nil {
+				return err
+			}
+
+			if refNode < 0 {
+				refHash, refNode = hash, i
+				continue
+			}
+
+			if !bytes.Equal(hash, refHash) {
+				return fmt.Errorf("Block %d: node %d has hash 0x%X, node %d has hash 0x%X (seed %d)",
+					index, refNode, refHash, i, hash, s.conf.Seed)
+			}
+		}
+	}
+
+	return nil
+}
+
+//timerFactory is the TimerFactory of the nodes. Like the default ControlTimer,
+//it adds a random extra delay, up to the timeout, to every timeout.
+func (s *Simulation) timerFactory(min time.Duration) <-chan time.Time {
+	if min == 0 {
+		return nil
+	}
+	extra := time.Duration(s.rnd.Int63()) % min
+	return s.clock.After(min + extra)
+}
+
+func (s *Simulation) tracef(format string, args ...interface{}) {
+	line := fmt.Sprintf("%v ", s.clock.Now().Sub(s.start)) + fmt.Sprintf(format, args...)
+	s.trace = append(s.trace, line)
+	s.logger.Debug(line)
+}
+
+/*******************************************************************************
+Scheduling
+*******************************************************************************/
+
+//heartbeat starts the Heartbeat of node i, with a peer picked the same way as
+//the RandomPeerSelector, and schedules the next one
+func (s *Simulation) heartbeat(i int) {
+	n := s.nodes[i]
+
+	s.heartbeats[i] = n.NextHeartbeat()
+
+	//Like the Run loop, wait for the ongoing gossip routines to finish before
+	//fast-forwarding
+	if n.GetState() == node.CatchingUp && s.routines[i] > 0 {
+		return
+	}
+
+	peer := s.pickPeer(i)
+	if peer != nil {
+		s.lastPeer[i] = peer.ID()
+		s.tracef("heartbeat %d -> %d (%s)", i, s.byAddr[peer.NetAddr], n.GetState())
+	} else {
+		s.tracef("heartbeat %d (%s)", i, n.GetState())
+	}
+
+	s.routines[i]++
+	s.spawn(func() {
+		if err := n.Heartbeat(peer); err != nil {
+			s.logger.WithField("node", i).WithError(err).Debug("Heartbeat")
+		}
+		s.routines[i]--
+	})
+}
+
+func (s *Simulation) pickPeer(i int) *peers.Peer {
+	n := s.nodes[i]
+
+	_, selectable := peers.ExcludePeer(n.GetPeers(), n.ID())
+	if len(selectable) == 0 {
+		return nil
+	}
+	if len(selectable) > 1 {
+		_, selectable = peers.ExcludePeer(selectable, s.lastPeer[i])
+	}
+
+	return selectable[s.rnd.Intn(len(selectable))]
+}
+
+func (s *Simulation) submitTransaction() {
+	i := s.rnd.Intn(len(s.nodes))
+	tx := []byte(fmt.Sprintf("node%d tx%d", i, s.txs))
+	s.txs++
+
+	select {
+	case s.apps[i].submitCh <- tx:
+		s.tracef("tx %d: %s", i, tx)
+	default:
+		s.tracef("tx %d: %s (dropped, pool full)", i, tx)
+	}
+
+	s.clock.AfterFunc(s.conf.TxInterval, s.submitTransaction)
+}
+
+//spawn runs f in a new goroutine, and returns when f finishes or blocks on an
+//RPC
+func (s *Simulation) spawn(f func()) {
+	go func() {
+		f()
+		s.yieldCh <- struct{}{}
+	}()
+	<-s.yieldCh
+}
+
+/*
+call is used by the Transports. It sends the request to node to, and yields
+control back to the Simulation until the response, or a timeout, is delivered.
+*/
+func (s *Simulation) call(from int, target string, args interface{}) (interface{}, error) {
+	if s.stopped {
+		return nil, fmt.Errorf("Simulation stopped")
+	}
+
+	to, ok := s.byAddr[target]
+	if !ok {
+		return nil, fmt.Errorf("failed to connect to peer: %v", target)
+	}
+
+	c := &call{
+		id:      s.nextCall,
+		from:    from,
+		to:      to,
+		args:    args,
+		replyCh: make(chan net.RPCResponse, 1),
+	}
+	s.nextCall++
+	s.calls[c.id] = c
+
+	s.send(from, to, fmt.Sprintf("%T", args), func() { s.deliver(c) })
+
+	s.clock.AfterFunc(s.conf.Timeout, func() {
+		s.resume(c, net.RPCResponse{Error: fmt.Errorf("command timed out")})
+	})
+
+	s.yieldCh <- struct{}{}
+	resp := <-c.replyCh
+
+	return resp.Response, resp.Error
+}
+
+//send subjects a message to the active Faults, and schedules its delivery
+func (s *Simulation) send(from, to int, desc string, deliver func()) {
+	v := judge(s.conf.Faults, s.clock.Now().Sub(s.start), from, to, s.rnd)
+
+	if v.drop {
+		s.tracef("%d -> %d %s: %s", from, to, desc, v.reason)
+		return
+	}
+
+	s.tracef("%d -> %d %s: delay %v", from, to, desc, v.delay)
+	s.clock.AfterFunc(v.delay, deliver)
+
+	if v.duplicate {
+		s.tracef("%d -> %d %s: duplicate", from, to, desc)
+		s.clock.AfterFunc(v.delay, deliver)
+	}
+}
+
+//deliver hands a request to its target, and sends the response back
+func (s *Simulation) deliver(c *call) {
+	respCh := make(chan net.RPCResponse, 1)
+
+	s.nodes[c.to].ProcessRPC(net.RPC{
+		Command:  c.args,
+		RespChan: respCh,
+	})
+
+	resp := <-respCh
+
+	s.send(c.to, c.from, fmt.Sprintf("%T", resp.Response), func() { s.resume(c, resp) })
+}
+
+//resume completes a call, unless it was already completed, and waits for the
+//caller to finish or block again
+func (s *Simulation) resume(c *call, resp net.RPCResponse) {
+	if c.done {
+		return
+	}
+	c.done = true
+	delete(s.calls, c.id)
+
+	c.replyCh <- resp
+	<-s.yieldCh
+}
+
+//stop fails the pending calls, in order, and shuts the nodes down
+func (s *Simulation) stop() {
+	s.stopped = true
+
+	for len(s.calls) > 0 {
+		ids := []int{}
+		for id := range s.calls {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+
+		s.resume(s.calls[ids[0]], net.RPCResponse{Error: fmt.Errorf("Simulation stopped")})
+	}
+
+	for _, n := range s.nodes {
+		n.Shutdown()
+	}
+}
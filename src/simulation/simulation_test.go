@@ -0,0 +1,134 @@
+package simulation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mosaicnetworks/babble/src/common"
+	"github.com/sirupsen/logrus"
+)
+
+func testConfig(t *testing.T, seed int64) *Config {
+	logger := common.NewTestLogger(t)
+	logger.Level = logrus.WarnLevel
+
+	conf := DefaultConfig()
+	conf.Seed = seed
+	conf.Duration = 5 * time.Second
+	conf.Logger = logger
+
+	return conf
+}
+
+func runSimulation(t *testing.T, conf *Config) *Simulation {
+	sim, err := NewSimulation(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sim.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, n := range sim.Nodes() {
+		if n.GetLastBlockIndex() < 0 {
+			t.Fatalf("node %d did not commit any Block", i)
+		}
+	}
+
+	return sim
+}
+
+//blockHashes returns the hashes of the Blocks committed by every node,
+//signatures included
+func blockHashes(t *testing.T, sim *Simulation) [][]string {
+	res := [][]string{}
+	for _, n := range sim.Nodes() {
+		hashes := []string{}
+		for i := 0; i <= n.GetLastBlockIndex(); i++ {
+			block, err := n.GetBlock(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hashes = append(hashes, block.Hex())
+		}
+		res = append(res, hashes)
+	}
+	return res
+}
+
+func TestSimulation(t *testing.T) {
+	runSimulation(t, testConfig(t, 1))
+}
+
+func TestSimulationFaults(t *testing.T) {
+	conf := testConfig(t, 2)
+	conf.Duration = 10 * time.Second
+	conf.Faults = []Fault{
+		{
+			Drop:      0.1,
+			Duplicate: 0.1,
+			MinDelay:  time.Millisecond,
+			MaxDelay:  50 * time.Millisecond,
+		},
+		{
+			Start:     2 * time.Second,
+			End:       4 * time.Second,
+			Partition: []int{0},
+		},
+	}
+
+	sim := runSimulation(t, conf)
+
+	partitioned := 0
+	for _, line := range sim.Trace() {
+		if strings.HasSuffix(line, ": partition") {
+			partitioned++
+		}
+	}
+	if partitioned == 0 {
+		t.Fatal("No message was cut by the partition")
+	}
+}
+
+func TestSimulationDeterminism(t *testing.T) {
+	newConf := func(seed int64) *Config {
+		conf := testConfig(t, seed)
+		conf.Faults = []Fault{
+			{
+				Drop:      0.2,
+				Duplicate: 0.1,
+				MaxDelay:  20 * time.Millisecond,
+			},
+		}
+		return conf
+	}
+
+	firstSim := runSimulation(t, newConf(3))
+	secondSim := runSimulation(t, newConf(3))
+
+	//Event timestamps come from the virtual Clock and signatures are
+	//deterministic, so the Blocks are identical, not only the schedule
+	if !reflect.DeepEqual(blockHashes(t, firstSim), blockHashes(t, secondSim)) {
+		t.Fatal("Runs with the same seed should commit the same Blocks")
+	}
+
+	first := firstSim.Trace()
+	second := secondSim.Trace()
+
+	if !reflect.DeepEqual(first, second) {
+		for i := 0; i < len(first) && i < len(second); i++ {
+			if first[i] != second[i] {
+				t.Fatalf("Traces diverge at line %d: %q != %q", i, first[i], second[i])
+			}
+		}
+		t.Fatalf("Traces have different lengths: %d != %d", len(first), len(second))
+	}
+
+	other := runSimulation(t, newConf(4)).Trace()
+	if reflect.DeepEqual(first, other) {
+		t.Fatal("Different seeds should produce different traces")
+	}
+}
@@ -0,0 +1,83 @@
+package simulation
+
+import (
+	"fmt"
+
+	"github.com/mosaicnetworks/babble/src/net"
+)
+
+//Transport implements the Transport interface for the nodes of a Simulation.
+//Instead of reaching the target directly, every RPC goes through the
+//Simulation, which decides when, and whether, the request and the response
+//are delivered.
+type Transport struct {
+	id         int
+	localAddr  string
+	consumerCh chan net.RPC
+	sim        *Simulation
+}
+
+func newTransport(sim *Simulation, id int, addr string) *Transport {
+	return &Transport{
+		id:         id,
+		localAddr:  addr,
+		consumerCh: make(chan net.RPC),
+		sim:        sim,
+	}
+}
+
+//Consumer implements the Transport interface. Nodes of a Simulation do not
+//run their Run loop, so nothing is ever sent on this channel; the Simulation
+//hands RPCs to Node.ProcessRPC directly.
+func (t *Transport) Consumer() <-chan net.RPC {
+	return t.consumerCh
+}
+
+//LocalAddr implements the Transport interface.
+func (t *Transport) LocalAddr() string {
+	return t.localAddr
+}
+
+//Sync implements the Transport interface.
+func (t *Transport) Sync(target string, args *net.SyncRequest, resp *net.SyncResponse) error {
+	out, err := t.sim.call(t.id, target, args)
+	if err != nil {
+		return err
+	}
+
+	*resp = *out.(*net.SyncResponse)
+	return nil
+}
+
+//EagerSync implements the Transport interface.
+func (t *Transport) EagerSync(target string, args *net.EagerSyncRequest, resp *net.EagerSyncResponse) error {
+	out, err := t.sim.call(t.id, target, args)
+	if err != nil {
+		return err
+	}
+
+	*resp = *out.(*net.EagerSyncResponse)
+	return nil
+}
+
+//FastForward implements the Transport interface.
+func (t *Transport) FastForward(target string, args *net.FastForwardRequest, resp *net.FastForwardResponse) error {
+	out, err := t.sim.call(t.id, target, args)
+	if err != nil {
+		return err
+	}
+
+	*resp = *out.(*net.FastForwardResponse)
+	return nil
+}
+
+//Join implements the Transport interface. The PeerSet of a Simulation is
+//fixed, so JoinRequests are not supported.
+func (t *Transport) Join(target string, args *net.JoinRequest, resp *net.JoinResponse) error {
+	return fmt.Errorf("Join is not supported in simulations")
+}
+
+//Close implements the Transport interface.
+func (t *Transport) Close() error {
+	return nil
+}